@@ -0,0 +1,41 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package bolthold
+
+import (
+	bolt "go.etcd.io/bbolt"
+)
+
+// BatchInsert is the same as Insert, except it runs with bolt's DB.Batch, so that concurrent calls from many
+// goroutines are coalesced into fewer transactions, and fewer syncs to disk.  Each call still returns only its own
+// error, but if a call in a batch fails the others are run again, so the data shouldn't be changed by anything else
+// until BatchInsert returns.  Calls only wait for each other when they're made concurrently, a single caller gets
+// no benefit and waits up to Options.MaxBatchDelay.  Batch transactions aren't reported to the TxMetricsHook
+func (s *Store) BatchInsert(key, data interface{}) error {
+	return s.Bolt().Batch(func(tx *bolt.Tx) error {
+		return s.insert(tx, key, data)
+	})
+}
+
+// BatchUpdate is the same as Update, except it's coalesced with concurrent calls like BatchInsert
+func (s *Store) BatchUpdate(key, data interface{}) error {
+	return s.Bolt().Batch(func(tx *bolt.Tx) error {
+		return s.update(tx, key, data)
+	})
+}
+
+// BatchUpsert is the same as Upsert, except it's coalesced with concurrent calls like BatchInsert
+func (s *Store) BatchUpsert(key, data interface{}) error {
+	return s.Bolt().Batch(func(tx *bolt.Tx) error {
+		return s.upsert(tx, key, data)
+	})
+}
+
+// BatchDelete is the same as Delete, except it's coalesced with concurrent calls like BatchInsert
+func (s *Store) BatchDelete(key, dataType interface{}) error {
+	return s.Bolt().Batch(func(tx *bolt.Tx) error {
+		return s.delete(tx, key, dataType)
+	})
+}
@@ -0,0 +1,68 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package bolthold_test
+
+import (
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/timshannon/bolthold"
+)
+
+func TestBatchWrites(t *testing.T) {
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		var wg sync.WaitGroup
+		errs := make(chan error, len(testData))
+
+		for i := range testData {
+			wg.Add(1)
+			go func(item ItemTest) {
+				defer wg.Done()
+				errs <- store.BatchInsert(item.Key, item)
+			}(testData[i])
+		}
+		wg.Wait()
+		close(errs)
+
+		for err := range errs {
+			ok(t, err)
+		}
+
+		count, err := store.Count(&ItemTest{}, nil)
+		ok(t, err)
+		equals(t, len(testData), count)
+
+		equals(t, bolthold.ErrKeyExists, store.BatchInsert(testData[0].Key, testData[0]))
+
+		item := testData[0]
+		item.Name = "batched"
+		ok(t, store.BatchUpdate(item.Key, item))
+		ok(t, store.BatchUpsert(item.Key+1000, item))
+
+		var result []ItemTest
+		ok(t, store.Find(&result, bolthold.Where("Name").Eq("batched")))
+		equals(t, 2, len(result))
+
+		ok(t, store.BatchDelete(item.Key, &ItemTest{}))
+		equals(t, bolthold.ErrNotFound, store.Get(item.Key, &ItemTest{}))
+		equals(t, bolthold.ErrNotFound, store.BatchDelete(item.Key, &ItemTest{}))
+	})
+}
+
+func TestBatchOptions(t *testing.T) {
+	filename := tempfile()
+	store, err := bolthold.Open(filename, 0666, &bolthold.Options{
+		MaxBatchSize:  50,
+		MaxBatchDelay: time.Millisecond,
+	})
+	ok(t, err)
+	defer os.Remove(filename)
+	defer store.Close()
+
+	equals(t, 50, store.Bolt().MaxBatchSize)
+	equals(t, time.Millisecond, store.Bolt().MaxBatchDelay)
+}
@@ -0,0 +1,687 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package bolthold
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// CBOR major types
+const (
+	cborUint   = 0
+	cborNegInt = 1
+	cborBytes  = 2
+	cborString = 3
+	cborArray  = 4
+	cborMap    = 5
+	cborTag    = 6
+	cborSimple = 7
+)
+
+const (
+	cborFalse      = 0xf4
+	cborTrue       = 0xf5
+	cborNull       = 0xf6
+	cborUndefined  = 0xf7
+	cborFloat16    = 0xf9
+	cborFloat32    = 0xfa
+	cborFloat64    = 0xfb
+	cborBreak      = 0xff
+	cborIndefinite = 31
+
+	cborTagTime  = 0 // RFC 3339 string
+	cborTagEpoch = 1 // seconds since the epoch
+)
+
+// CBOREncode encodes a value as CBOR (RFC 8949), which non-Go programs can read and is usually smaller than gob for
+// small structs.  Structs are encoded as maps keyed by field name, and the keys of all maps are sorted so the same
+// value always encodes to the same bytes.  time.Time values are encoded as RFC 3339 strings
+func CBOREncode(value interface{}) ([]byte, error) {
+	var buff bytes.Buffer
+	err := cborEncode(&buff, reflect.ValueOf(value))
+	if err != nil {
+		return nil, err
+	}
+	return buff.Bytes(), nil
+}
+
+// CBORCodec stores the records of a single type as CBOR, see RegisterCodec
+var CBORCodec = Codec{
+	Encoder: CBOREncode,
+	Decoder: CBORDecode,
+}
+
+// CBORDecode decodes CBOR encoded data into value, which must be a pointer
+func CBORDecode(data []byte, value interface{}) error {
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return fmt.Errorf("CBORDecode needs a non-nil pointer, not %T", value)
+	}
+
+	d := &cborDecoder{data: data}
+	err := d.decode(v.Elem())
+	if err != nil {
+		return err
+	}
+	if d.pos != len(d.data) {
+		return errors.New("Extra data after the CBOR value")
+	}
+	return nil
+}
+
+func cborHead(buff *bytes.Buffer, major byte, arg uint64) {
+	major <<= 5
+	switch {
+	case arg < 24:
+		buff.WriteByte(major | byte(arg))
+	case arg <= math.MaxUint8:
+		buff.WriteByte(major | 24)
+		buff.WriteByte(byte(arg))
+	case arg <= math.MaxUint16:
+		buff.WriteByte(major | 25)
+		_ = binary.Write(buff, binary.BigEndian, uint16(arg))
+	case arg <= math.MaxUint32:
+		buff.WriteByte(major | 26)
+		_ = binary.Write(buff, binary.BigEndian, uint32(arg))
+	default:
+		buff.WriteByte(major | 27)
+		_ = binary.Write(buff, binary.BigEndian, arg)
+	}
+}
+
+func cborEncode(buff *bytes.Buffer, v reflect.Value) error {
+	if !v.IsValid() {
+		buff.WriteByte(cborNull)
+		return nil
+	}
+
+	if v.Type() == timeType {
+		buff.WriteByte(cborTag<<5 | cborTagTime)
+		s := v.Interface().(time.Time).Format(time.RFC3339Nano)
+		cborHead(buff, cborString, uint64(len(s)))
+		buff.WriteString(s)
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			buff.WriteByte(cborNull)
+			return nil
+		}
+		return cborEncode(buff, v.Elem())
+	case reflect.Bool:
+		if v.Bool() {
+			buff.WriteByte(cborTrue)
+		} else {
+			buff.WriteByte(cborFalse)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i := v.Int()
+		if i < 0 {
+			cborHead(buff, cborNegInt, uint64(-1-i))
+		} else {
+			cborHead(buff, cborUint, uint64(i))
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		cborHead(buff, cborUint, v.Uint())
+	case reflect.Float32:
+		buff.WriteByte(cborFloat32)
+		_ = binary.Write(buff, binary.BigEndian, math.Float32bits(float32(v.Float())))
+	case reflect.Float64:
+		buff.WriteByte(cborFloat64)
+		_ = binary.Write(buff, binary.BigEndian, math.Float64bits(v.Float()))
+	case reflect.String:
+		cborHead(buff, cborString, uint64(v.Len()))
+		buff.WriteString(v.String())
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			buff.WriteByte(cborNull)
+			return nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			cborHead(buff, cborBytes, uint64(v.Len()))
+			for i := 0; i < v.Len(); i++ {
+				buff.WriteByte(byte(v.Index(i).Uint()))
+			}
+			return nil
+		}
+		cborHead(buff, cborArray, uint64(v.Len()))
+		for i := 0; i < v.Len(); i++ {
+			err := cborEncode(buff, v.Index(i))
+			if err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if v.IsNil() {
+			buff.WriteByte(cborNull)
+			return nil
+		}
+		entries := make([]cborEntry, 0, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			var key bytes.Buffer
+			err := cborEncode(&key, iter.Key())
+			if err != nil {
+				return err
+			}
+			entries = append(entries, cborEntry{key: key.Bytes(), value: iter.Value()})
+		}
+		return cborEncodeMap(buff, entries)
+	case reflect.Struct:
+		tp := v.Type()
+		entries := make([]cborEntry, 0, tp.NumField())
+		for i := 0; i < tp.NumField(); i++ {
+			if tp.Field(i).PkgPath != "" {
+				// unexported
+				continue
+			}
+			var key bytes.Buffer
+			cborHead(&key, cborString, uint64(len(tp.Field(i).Name)))
+			key.WriteString(tp.Field(i).Name)
+			entries = append(entries, cborEntry{key: key.Bytes(), value: v.Field(i)})
+		}
+		return cborEncodeMap(buff, entries)
+	default:
+		return fmt.Errorf("CBOR can't encode values of type %s", v.Type())
+	}
+	return nil
+}
+
+type cborEntry struct {
+	key   []byte
+	value reflect.Value
+}
+
+// cborEncodeMap writes the entries sorted by their encoded keys, as in RFC 8949's core deterministic encoding
+func cborEncodeMap(buff *bytes.Buffer, entries []cborEntry) error {
+	sort.Slice(entries, func(i, j int) bool {
+		return bytes.Compare(entries[i].key, entries[j].key) < 0
+	})
+
+	cborHead(buff, cborMap, uint64(len(entries)))
+	for i := range entries {
+		buff.Write(entries[i].key)
+		err := cborEncode(buff, entries[i].value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var errCBORTruncated = errors.New("The CBOR data is truncated")
+
+type cborDecoder struct {
+	data []byte
+	pos  int
+}
+
+// head reads the initial byte of an item and its argument.  Indefinite length items have an info of cborIndefinite
+func (d *cborDecoder) head() (major byte, info byte, arg uint64, err error) {
+	if d.pos >= len(d.data) {
+		return 0, 0, 0, errCBORTruncated
+	}
+	b := d.data[d.pos]
+	d.pos++
+	major, info = b>>5, b&0x1f
+
+	size := 0
+	switch {
+	case info < 24:
+		return major, info, uint64(info), nil
+	case info == 24:
+		size = 1
+	case info == 25:
+		size = 2
+	case info == 26:
+		size = 4
+	case info == 27:
+		size = 8
+	case info == cborIndefinite:
+		return major, info, 0, nil
+	default:
+		return 0, 0, 0, fmt.Errorf("Invalid CBOR additional information %d", info)
+	}
+
+	if d.pos+size > len(d.data) {
+		return 0, 0, 0, errCBORTruncated
+	}
+	for _, c := range d.data[d.pos : d.pos+size] {
+		arg = arg<<8 | uint64(c)
+	}
+	d.pos += size
+	return major, info, arg, nil
+}
+
+func (d *cborDecoder) isBreak() bool {
+	if d.pos < len(d.data) && d.data[d.pos] == cborBreak {
+		d.pos++
+		return true
+	}
+	return false
+}
+
+// length returns the number of items in an array or map, or -1 if it's indefinite
+func (d *cborDecoder) length(info byte, arg uint64) (int, error) {
+	if info == cborIndefinite {
+		return -1, nil
+	}
+	if arg > uint64(len(d.data)-d.pos) {
+		// every item takes at least a byte
+		return 0, errCBORTruncated
+	}
+	return int(arg), nil
+}
+
+// readString reads the contents of a byte or text string, joining the chunks of indefinite length strings
+func (d *cborDecoder) readString(major, info byte, arg uint64) ([]byte, error) {
+	if info != cborIndefinite {
+		if uint64(len(d.data)-d.pos) < arg {
+			return nil, errCBORTruncated
+		}
+		s := d.data[d.pos : d.pos+int(arg)]
+		d.pos += int(arg)
+		return s, nil
+	}
+
+	var s []byte
+	for !d.isBreak() {
+		chunkMajor, chunkInfo, chunkArg, err := d.head()
+		if err != nil {
+			return nil, err
+		}
+		if chunkMajor != major || chunkInfo == cborIndefinite {
+			return nil, errors.New("Invalid chunk in an indefinite length CBOR string")
+		}
+		chunk, err := d.readString(chunkMajor, chunkInfo, chunkArg)
+		if err != nil {
+			return nil, err
+		}
+		s = append(s, chunk...)
+	}
+	return s, nil
+}
+
+func (d *cborDecoder) decode(v reflect.Value) error {
+	if d.pos < len(d.data) && (d.data[d.pos] == cborNull || d.data[d.pos] == cborUndefined) {
+		d.pos++
+		switch v.Kind() {
+		case reflect.Ptr, reflect.Interface, reflect.Slice, reflect.Map:
+			v.Set(reflect.Zero(v.Type()))
+		}
+		return nil
+	}
+
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return d.decode(v.Elem())
+	}
+
+	if v.Kind() == reflect.Interface && v.NumMethod() == 0 {
+		value, err := d.decodeAny()
+		if err != nil {
+			return err
+		}
+		if value == nil {
+			v.Set(reflect.Zero(v.Type()))
+		} else {
+			v.Set(reflect.ValueOf(value))
+		}
+		return nil
+	}
+
+	major, info, arg, err := d.head()
+	if err != nil {
+		return err
+	}
+
+	if major == cborTag {
+		return d.decodeTagged(v, arg)
+	}
+
+	if v.Type() == timeType {
+		return fmt.Errorf("Can't decode CBOR major type %d into time.Time", major)
+	}
+
+	switch major {
+	case cborUint, cborNegInt:
+		return cborSetInt(v, major, arg)
+	case cborBytes, cborString:
+		s, err := d.readString(major, info, arg)
+		if err != nil {
+			return err
+		}
+		switch {
+		case v.Kind() == reflect.String:
+			v.SetString(string(s))
+		case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+			v.SetBytes(append([]byte(nil), s...))
+		case v.Kind() == reflect.Array && v.Type().Elem().Kind() == reflect.Uint8:
+			reflect.Copy(v, reflect.ValueOf(s))
+		default:
+			return fmt.Errorf("Can't decode a CBOR string into %s", v.Type())
+		}
+		return nil
+	case cborArray, cborMap:
+		length, err := d.length(info, arg)
+		if err != nil {
+			return err
+		}
+		if major == cborArray {
+			return d.decodeArray(v, length)
+		}
+		return d.decodeMap(v, length)
+	case cborSimple:
+		return d.decodeSimple(v, info, arg)
+	}
+	return fmt.Errorf("Invalid CBOR major type %d", major)
+}
+
+func cborSetInt(v reflect.Value, major byte, arg uint64) error {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if arg > math.MaxInt64 {
+			return fmt.Errorf("The CBOR integer overflows %s", v.Type())
+		}
+		i := int64(arg)
+		if major == cborNegInt {
+			i = -1 - i
+		}
+		if v.OverflowInt(i) {
+			return fmt.Errorf("The CBOR integer %d overflows %s", i, v.Type())
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if major == cborNegInt {
+			return fmt.Errorf("Can't decode a negative CBOR integer into %s", v.Type())
+		}
+		if v.OverflowUint(arg) {
+			return fmt.Errorf("The CBOR integer %d overflows %s", arg, v.Type())
+		}
+		v.SetUint(arg)
+	case reflect.Float32, reflect.Float64:
+		f := float64(arg)
+		if major == cborNegInt {
+			f = -1 - f
+		}
+		v.SetFloat(f)
+	default:
+		return fmt.Errorf("Can't decode a CBOR integer into %s", v.Type())
+	}
+	return nil
+}
+
+func (d *cborDecoder) decodeSimple(v reflect.Value, info byte, arg uint64) error {
+	switch info {
+	case cborFalse & 0x1f, cborTrue & 0x1f:
+		if v.Kind() != reflect.Bool {
+			return fmt.Errorf("Can't decode a CBOR bool into %s", v.Type())
+		}
+		v.SetBool(info == cborTrue&0x1f)
+		return nil
+	case cborFloat16 & 0x1f, cborFloat32 & 0x1f, cborFloat64 & 0x1f:
+		if v.Kind() != reflect.Float32 && v.Kind() != reflect.Float64 {
+			return fmt.Errorf("Can't decode a CBOR float into %s", v.Type())
+		}
+		v.SetFloat(cborFloat(info, arg))
+		return nil
+	}
+	return fmt.Errorf("Can't decode the CBOR simple value %d into %s", arg, v.Type())
+}
+
+func cborFloat(info byte, arg uint64) float64 {
+	switch info {
+	case cborFloat16 & 0x1f:
+		sign := 1.0
+		if arg&0x8000 != 0 {
+			sign = -1
+		}
+		exp := int(arg>>10) & 0x1f
+		mant := float64(arg & 0x3ff)
+		switch exp {
+		case 0:
+			return sign * math.Ldexp(mant, -24)
+		case 0x1f:
+			if mant == 0 {
+				return math.Inf(int(sign))
+			}
+			return math.NaN()
+		}
+		return sign * math.Ldexp(mant+1024, exp-25)
+	case cborFloat32 & 0x1f:
+		return float64(math.Float32frombits(uint32(arg)))
+	}
+	return math.Float64frombits(arg)
+}
+
+func (d *cborDecoder) decodeTagged(v reflect.Value, tag uint64) error {
+	if v.Type() != timeType {
+		// other tags are ignored, and their content decoded as is
+		return d.decode(v)
+	}
+
+	switch tag {
+	case cborTagTime:
+		var s string
+		err := d.decode(reflect.ValueOf(&s).Elem())
+		if err != nil {
+			return err
+		}
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(t))
+		return nil
+	case cborTagEpoch:
+		var f float64
+		err := d.decode(reflect.ValueOf(&f).Elem())
+		if err != nil {
+			return err
+		}
+		sec, frac := math.Modf(f)
+		v.Set(reflect.ValueOf(time.Unix(int64(sec), int64(frac*1e9))))
+		return nil
+	}
+	return fmt.Errorf("Can't decode CBOR tag %d into time.Time", tag)
+}
+
+func (d *cborDecoder) decodeArray(v reflect.Value, length int) error {
+	switch v.Kind() {
+	case reflect.Slice:
+		if length >= 0 {
+			v.Set(reflect.MakeSlice(v.Type(), length, length))
+			for i := 0; i < length; i++ {
+				err := d.decode(v.Index(i))
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		v.Set(reflect.MakeSlice(v.Type(), 0, 0))
+		for !d.isBreak() {
+			elem := reflect.New(v.Type().Elem()).Elem()
+			err := d.decode(elem)
+			if err != nil {
+				return err
+			}
+			v.Set(reflect.Append(v, elem))
+		}
+		return nil
+	case reflect.Array:
+		for i := 0; length < 0 || i < length; i++ {
+			if length < 0 && d.isBreak() {
+				break
+			}
+			if i < v.Len() {
+				err := d.decode(v.Index(i))
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			err := d.skip()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("Can't decode a CBOR array into %s", v.Type())
+}
+
+func (d *cborDecoder) decodeMap(v reflect.Value, length int) error {
+	more := func(i int) bool {
+		if length < 0 {
+			return !d.isBreak()
+		}
+		return i < length
+	}
+
+	switch v.Kind() {
+	case reflect.Map:
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		for i := 0; more(i); i++ {
+			key := reflect.New(v.Type().Key()).Elem()
+			err := d.decode(key)
+			if err != nil {
+				return err
+			}
+			value := reflect.New(v.Type().Elem()).Elem()
+			err = d.decode(value)
+			if err != nil {
+				return err
+			}
+			v.SetMapIndex(key, value)
+		}
+		return nil
+	case reflect.Struct:
+		for i := 0; more(i); i++ {
+			var name string
+			err := d.decode(reflect.ValueOf(&name).Elem())
+			if err != nil {
+				return err
+			}
+			field, ok := v.Type().FieldByName(name)
+			if !ok || field.PkgPath != "" || len(field.Index) != 1 {
+				// fields that aren't in the type are skipped
+				err = d.skip()
+			} else {
+				err = d.decode(v.Field(field.Index[0]))
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("Can't decode a CBOR map into %s", v.Type())
+}
+
+// skip reads past the next item
+func (d *cborDecoder) skip() error {
+	_, err := d.decodeAny()
+	return err
+}
+
+// decodeAny decodes the next item into the Go type closest to it
+func (d *cborDecoder) decodeAny() (interface{}, error) {
+	major, info, arg, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+
+	switch major {
+	case cborUint:
+		return arg, nil
+	case cborNegInt:
+		if arg > math.MaxInt64 {
+			return nil, errors.New("The negative CBOR integer overflows int64")
+		}
+		return -1 - int64(arg), nil
+	case cborBytes:
+		s, err := d.readString(major, info, arg)
+		return append([]byte(nil), s...), err
+	case cborString:
+		s, err := d.readString(major, info, arg)
+		return string(s), err
+	case cborArray:
+		length, err := d.length(info, arg)
+		if err != nil {
+			return nil, err
+		}
+		var values []interface{}
+		for i := 0; length < 0 || i < length; i++ {
+			if length < 0 && d.isBreak() {
+				break
+			}
+			value, err := d.decodeAny()
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+		}
+		return values, nil
+	case cborMap:
+		length, err := d.length(info, arg)
+		if err != nil {
+			return nil, err
+		}
+		values := make(map[interface{}]interface{})
+		for i := 0; length < 0 || i < length; i++ {
+			if length < 0 && d.isBreak() {
+				break
+			}
+			key, err := d.decodeAny()
+			if err != nil {
+				return nil, err
+			}
+			if !reflect.TypeOf(key).Comparable() {
+				return nil, errors.New("CBOR map keys must be comparable")
+			}
+			value, err := d.decodeAny()
+			if err != nil {
+				return nil, err
+			}
+			values[key] = value
+		}
+		return values, nil
+	case cborTag:
+		if arg == cborTagTime {
+			var t time.Time
+			err := d.decodeTagged(reflect.ValueOf(&t).Elem(), arg)
+			return t, err
+		}
+		return d.decodeAny()
+	case cborSimple:
+		switch info {
+		case cborFalse & 0x1f:
+			return false, nil
+		case cborTrue & 0x1f:
+			return true, nil
+		case cborNull & 0x1f, cborUndefined & 0x1f:
+			return nil, nil
+		case cborFloat16 & 0x1f, cborFloat32 & 0x1f, cborFloat64 & 0x1f:
+			return cborFloat(info, arg), nil
+		}
+		return nil, fmt.Errorf("Unsupported CBOR simple value %d", arg)
+	}
+	return nil, fmt.Errorf("Invalid CBOR major type %d", major)
+}
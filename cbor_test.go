@@ -0,0 +1,93 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package bolthold_test
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/timshannon/bolthold"
+)
+
+func TestCBOREncoding(t *testing.T) {
+	filename := tempfile()
+	store, err := bolthold.Open(filename, 0666, &bolthold.Options{
+		Encoder: bolthold.CBOREncode,
+		Decoder: bolthold.CBORDecode,
+	})
+	ok(t, err)
+	defer store.Close()
+	defer os.Remove(filename)
+
+	insertTestData(t, store)
+
+	for _, tData := range testData {
+		var result ItemTest
+		ok(t, store.Get(tData.Key, &result))
+		assert(t, result.equal(&tData), "Wanted %v, got %v", tData, result)
+	}
+
+	var result []ItemTest
+	ok(t, store.Find(&result, bolthold.Where("Category").Eq("vehicle").Index("Category")))
+	equals(t, 5, len(result))
+
+	result = nil
+	ok(t, store.Find(&result, bolthold.Where("Tags").Contains("takeout")))
+	assert(t, len(result) > 0, "No records found by a slice index")
+}
+
+func TestCBORFormat(t *testing.T) {
+	// map keys are sorted, so the encoding is the same every time
+	data, err := bolthold.CBOREncode(map[string]int{"b": 2, "a": 1})
+	ok(t, err)
+	equals(t, []byte{0xa2, 0x61, 'a', 0x01, 0x61, 'b', 0x02}, data)
+
+	data, err = bolthold.CBOREncode(-500)
+	ok(t, err)
+	equals(t, []byte{0x39, 0x01, 0xf3}, data)
+
+	// indefinite length arrays and half precision floats written by other encoders
+	var values []interface{}
+	ok(t, bolthold.CBORDecode([]byte{0x9f, 0x01, 0xf9, 0x3c, 0x00, 0x63, 'a', 'b', 'c', 0xff}, &values))
+	equals(t, []interface{}{uint64(1), 1.0, "abc"}, values)
+
+	type record struct {
+		Name    string
+		Count   int
+		Ratio   float32
+		Created time.Time
+		Data    []byte
+		Tags    map[string]bool
+		Next    *record
+		skipped int
+	}
+
+	created := time.Date(2021, 3, 4, 5, 6, 7, 8, time.UTC)
+	in := record{
+		Name:    "root",
+		Count:   -7,
+		Ratio:   0.5,
+		Created: created,
+		Data:    []byte{1, 2, 3},
+		Tags:    map[string]bool{"x": true},
+		Next:    &record{Name: "child"},
+		skipped: 4,
+	}
+
+	data, err = bolthold.CBOREncode(in)
+	ok(t, err)
+
+	var out record
+	ok(t, bolthold.CBORDecode(data, &out))
+	assert(t, out.Created.Equal(created), "Time wasn't decoded, got %v", out.Created)
+	out.Created = created
+	in.skipped = 0
+	equals(t, in, out)
+
+	assert(t, bolthold.CBORDecode(data[:len(data)-1], &out) != nil, "Truncated data didn't fail to decode")
+	_, err = bolthold.CBOREncode(make(chan int))
+	assert(t, err != nil, "Encoding a channel didn't fail")
+}
@@ -0,0 +1,93 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package bolthold
+
+import (
+	"errors"
+	"reflect"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// FindInChunks runs the query, and calls fn with the matching records a chunk at a time, as a slice of up to
+// chunkSize values of dataType's type, such as []Item for a dataType of &Item{}.  The same backing array is reused
+// for every chunk, so fn must copy anything it wants to keep once it returns.  If fn returns an error, no more
+// chunks are found, and the error is returned
+//
+//	err := store.FindInChunks(&Item{}, nil, 500, func(chunk interface{}) error {
+//		for _, item := range chunk.([]Item) {
+//			...
+//		}
+//		return nil
+//	})
+func (s *Store) FindInChunks(dataType interface{}, query *Query, chunkSize int, fn func(chunk interface{}) error) error {
+	return s.Bolt().View(func(tx *bolt.Tx) error {
+		return s.TxFindInChunks(tx, dataType, query, chunkSize, fn)
+	})
+}
+
+// TxFindInChunks is the same as FindInChunks but you get to specify your transaction
+func (s *Store) TxFindInChunks(tx *bolt.Tx, dataType interface{}, query *Query, chunkSize int,
+	fn func(chunk interface{}) error) error {
+	return s.findInChunks(tx, dataType, query, chunkSize, fn)
+}
+
+// FindInChunksInBucket is the same as FindInChunks but you get to specify your parent bucket
+func (s *Store) FindInChunksInBucket(parent *bolt.Bucket, dataType interface{}, query *Query, chunkSize int,
+	fn func(chunk interface{}) error) error {
+	return s.findInChunks(parent, dataType, query, chunkSize, fn)
+}
+
+func (s *Store) findInChunks(source BucketSource, dataType interface{}, query *Query, chunkSize int,
+	fn func(chunk interface{}) error) error {
+	if chunkSize < 1 {
+		return errors.New("FindInChunks needs a chunk size of at least 1")
+	}
+
+	query, err := s.prepQuery(dataType, query)
+	if err != nil {
+		return err
+	}
+
+	tp := reflect.TypeOf(dataType)
+	for tp.Kind() == reflect.Ptr {
+		tp = tp.Elem()
+	}
+
+	keyField := ""
+	if field, ok := decodedKeyField(tp); ok {
+		keyField = field.Name
+	}
+
+	chunk := reflect.MakeSlice(reflect.SliceOf(tp), 0, chunkSize)
+
+	err = s.runQuery(source, dataType, query, nil, query.skip, func(r *record) error {
+		value := r.value.Elem()
+		if keyField != "" {
+			err := s.decodeKey(r.key, value.FieldByName(keyField).Addr().Interface())
+			if err != nil {
+				return err
+			}
+		}
+
+		chunk = reflect.Append(chunk, value)
+		if chunk.Len() < chunkSize {
+			return nil
+		}
+
+		err := fn(chunk.Interface())
+		// the records of the next chunk overwrite this one's
+		chunk = chunk.Slice(0, 0)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if chunk.Len() > 0 {
+		return fn(chunk.Interface())
+	}
+	return nil
+}
@@ -5,7 +5,10 @@
 package bolthold
 
 import (
+	"bytes"
+	"encoding"
 	"fmt"
+	"math"
 	"math/big"
 	"reflect"
 	"time"
@@ -60,9 +63,45 @@ func (c *Criterion) compare(rowValue, criterionValue interface{}, currentRow int
 		other = reflect.ValueOf(other).Elem().Interface()
 	}
 
+	if c.epsilon != 0 {
+		if result, ok := compareApprox(value, other, c.epsilon); ok {
+			return result, nil
+		}
+	}
+
 	return compare(value, other)
 }
 
+// compareApprox compares two floats of the same type, treating them as equal if they are within epsilon of each
+// other.  If the values aren't both floats, ok is false
+func compareApprox(value, other interface{}, epsilon float64) (result int, ok bool) {
+	var v, o float64
+	switch t := value.(type) {
+	case float32:
+		tother, isFloat := other.(float32)
+		if !isFloat {
+			return 0, false
+		}
+		v, o = float64(t), float64(tother)
+	case float64:
+		tother, isFloat := other.(float64)
+		if !isFloat {
+			return 0, false
+		}
+		v, o = t, tother
+	default:
+		return 0, false
+	}
+
+	if math.Abs(v-o) <= epsilon {
+		return 0, true
+	}
+	if v < o {
+		return -1, true
+	}
+	return 1, true
+}
+
 func compare(value, other interface{}) (int, error) {
 	switch t := value.(type) {
 	case time.Time:
@@ -295,6 +334,10 @@ func compare(value, other interface{}) (int, error) {
 	case Comparer:
 		return value.(Comparer).Compare(other)
 	default:
+		if result, ok, err := compareBinary(value, other); ok {
+			return result, err
+		}
+
 		valS := fmt.Sprintf("%s", value)
 		otherS := fmt.Sprintf("%s", other)
 		if valS == otherS {
@@ -309,3 +352,40 @@ func compare(value, other interface{}) (int, error) {
 	}
 
 }
+
+// compareBinary compares two values of the same type that implement encoding.BinaryMarshaler by their marshaled
+// bytes, so domain types such as typed IDs compare in the same order as their encoded keys.  If the values aren't
+// both binary marshalers of the same type, ok is false
+func compareBinary(value, other interface{}) (result int, ok bool, err error) {
+	if value == nil || reflect.TypeOf(value) != reflect.TypeOf(other) {
+		return 0, false, nil
+	}
+
+	v, ok := binaryMarshaler(value)
+	if !ok {
+		return 0, false, nil
+	}
+	o, _ := binaryMarshaler(other)
+
+	vData, err := v.MarshalBinary()
+	if err != nil {
+		return 0, true, err
+	}
+	oData, err := o.MarshalBinary()
+	if err != nil {
+		return 0, true, err
+	}
+	return bytes.Compare(vData, oData), true, nil
+}
+
+// binaryMarshaler returns value as an encoding.BinaryMarshaler, including when only a pointer to it implements it
+func binaryMarshaler(value interface{}) (encoding.BinaryMarshaler, bool) {
+	if m, ok := value.(encoding.BinaryMarshaler); ok {
+		return m, true
+	}
+
+	ptr := reflect.New(reflect.TypeOf(value))
+	ptr.Elem().Set(reflect.ValueOf(value))
+	m, ok := ptr.Interface().(encoding.BinaryMarshaler)
+	return m, ok
+}
@@ -7,6 +7,7 @@ package bolthold_test
 import (
 	"fmt"
 	"math/big"
+	"os"
 	"reflect"
 	"testing"
 	"time"
@@ -302,3 +303,54 @@ func TestFindWithBuiltinTypes(t *testing.T) {
 
 	})
 }
+
+type Product struct {
+	Name  string
+	Price float64 `boltholdIndex:"Price"`
+}
+
+func TestEqApprox(t *testing.T) {
+	// computed at runtime so the result is not exactly 0.3
+	tenth := 0.1
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		ok(t, store.Insert("a", &Product{Name: "a", Price: tenth + 0.2}))
+		ok(t, store.Insert("b", &Product{Name: "b", Price: 0.35}))
+
+		var result []Product
+		ok(t, store.Find(&result, bolthold.Where("Price").Eq(0.3)))
+		equals(t, 0, len(result))
+
+		ok(t, store.Find(&result, bolthold.Where("Price").EqApprox(0.3, 0.0001)))
+		equals(t, 1, len(result))
+		equals(t, "a", result[0].Name)
+
+		result = nil
+		ok(t, store.Find(&result, bolthold.Where("Price").EqApprox(0.3, 0.0001).Index("Price")))
+		equals(t, 1, len(result))
+
+		result = nil
+		ok(t, store.Find(&result, bolthold.Where("Price").EqApprox(0.3, 0.1)))
+		equals(t, 2, len(result))
+	})
+}
+
+func TestStoreFloatTolerance(t *testing.T) {
+	filename := tempfile()
+	store, err := bolthold.Open(filename, 0666, &bolthold.Options{
+		FloatTolerance: 0.0001,
+	})
+	ok(t, err)
+	defer os.Remove(filename)
+	defer store.Close()
+
+	tenth := 0.1
+	ok(t, store.Insert("a", &Product{Name: "a", Price: tenth + 0.2}))
+
+	var result []Product
+	ok(t, store.Find(&result, bolthold.Where("Price").Eq(0.3)))
+	equals(t, 1, len(result))
+
+	count, err := store.Count(&Product{}, bolthold.Where("Price").Ne(0.3))
+	ok(t, err)
+	equals(t, 0, count)
+}
@@ -0,0 +1,382 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package bolthold
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CompositeKey is a key made up of several values, which is encoded so that keys sort by their first value, then
+// their second and so on, no matter which key encoder the store uses.  A CompositeKey made of the first few values of
+// another is a prefix of its encoding, so ForEachKeyPrefix can find every record that shares those leading values.
+// Values can be strings, byte slices, bools, integers, floats, time.Times or types that implement
+// encoding.BinaryMarshaler.  When a key is decoded into a CompositeKey, integers are returned as int64 or uint64,
+// floats as float64, times in UTC and binary marshaled values as []byte
+//
+//	err := store.Get(bolthold.CompositeKey{"acme", 42}, &order)
+//	err = store.ForEachKeyPrefix(&Order{}, bolthold.CompositeKey{"acme"}, func(record interface{}) error {...})
+type CompositeKey []interface{}
+
+// AutoKey is used in place of a key to Insert, Update or Upsert a record with the key returned by its type's Key
+// method, if it implements Keyer, or else with the CompositeKey built from its key fields.  A type's key fields are
+// the fields tagged with `boltholdKey:"1"`, `boltholdKey:"2"` and so on, which are used in that order, and are stored
+// in the record like any other field
+//
+//	type Order struct {
+//		Customer string `boltholdKey:"1"`
+//		Number   int    `boltholdKey:"2"`
+//		Total    float64
+//	}
+//
+//	err := store.Insert(bolthold.AutoKey, &Order{Customer: "acme", Number: 42})
+var AutoKey interface{} = autoKey{}
+
+type autoKey struct{}
+
+// the type bytes that start each encoded value of a composite key, which also order values of different types
+const (
+	compositeBool byte = iota + 1
+	compositeInt
+	compositeUint
+	compositeFloat
+	compositeString
+	compositeBytes
+	compositeTime
+	compositeBinary
+)
+
+// bytes values are escaped so that they sort before their own extensions: 0x00 is written as 0x00 0xFF, and the value
+// ends with 0x00 0x01
+const (
+	compositeEscape    byte = 0x00
+	compositeEscaped   byte = 0xFF
+	compositeTerminate byte = 0x01
+)
+
+// Compare compares the encoding of the two keys, so that composite keys can be used in Key criteria
+func (k CompositeKey) Compare(other interface{}) (int, error) {
+	o, ok := other.(CompositeKey)
+	if !ok {
+		return 0, &ErrTypeMismatch{k, other}
+	}
+
+	kData, err := k.encode()
+	if err != nil {
+		return 0, err
+	}
+	oData, err := o.encode()
+	if err != nil {
+		return 0, err
+	}
+	return bytes.Compare(kData, oData), nil
+}
+
+func (k CompositeKey) encode() ([]byte, error) {
+	var buf []byte
+	for i := range k {
+		var err error
+		buf, err = appendComposite(buf, k[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return buf, nil
+}
+
+func appendComposite(buf []byte, value interface{}) ([]byte, error) {
+	switch v := value.(type) {
+	case time.Time:
+		buf = append(buf, compositeTime)
+		buf = appendUint64(buf, uint64(v.Unix())^(1<<63))
+		return append(buf, byte(v.Nanosecond()>>24), byte(v.Nanosecond()>>16), byte(v.Nanosecond()>>8),
+			byte(v.Nanosecond())), nil
+	case []byte:
+		return appendEscaped(append(buf, compositeBytes), v), nil
+	case encoding.BinaryMarshaler:
+		data, err := v.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		return appendEscaped(append(buf, compositeBinary), data), nil
+	}
+
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Bool:
+		if rv.Bool() {
+			return append(buf, compositeBool, 1), nil
+		}
+		return append(buf, compositeBool, 0), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return appendUint64(append(buf, compositeInt), uint64(rv.Int())^(1<<63)), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return appendUint64(append(buf, compositeUint), rv.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		bits := math.Float64bits(rv.Float())
+		if bits&(1<<63) != 0 {
+			bits = ^bits
+		} else {
+			bits |= 1 << 63
+		}
+		return appendUint64(append(buf, compositeFloat), bits), nil
+	case reflect.String:
+		return appendEscaped(append(buf, compositeString), []byte(rv.String())), nil
+	}
+
+	return nil, fmt.Errorf("A %T can't be used as part of a CompositeKey", value)
+}
+
+func appendUint64(buf []byte, v uint64) []byte {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], v)
+	return append(buf, b[:]...)
+}
+
+func appendEscaped(buf, data []byte) []byte {
+	for _, b := range data {
+		if b == compositeEscape {
+			buf = append(buf, compositeEscape, compositeEscaped)
+			continue
+		}
+		buf = append(buf, b)
+	}
+	return append(buf, compositeEscape, compositeTerminate)
+}
+
+var errBadCompositeKey = errors.New("The key isn't a valid CompositeKey")
+
+func decodeComposite(data []byte) (CompositeKey, error) {
+	var key CompositeKey
+	for len(data) > 0 {
+		kind := data[0]
+		data = data[1:]
+
+		switch kind {
+		case compositeBool:
+			if len(data) < 1 {
+				return nil, errBadCompositeKey
+			}
+			key = append(key, data[0] == 1)
+			data = data[1:]
+		case compositeInt, compositeUint, compositeFloat:
+			if len(data) < 8 {
+				return nil, errBadCompositeKey
+			}
+			v := binary.BigEndian.Uint64(data)
+			data = data[8:]
+			switch kind {
+			case compositeInt:
+				key = append(key, int64(v^(1<<63)))
+			case compositeUint:
+				key = append(key, v)
+			default:
+				if v&(1<<63) != 0 {
+					v &^= 1 << 63
+				} else {
+					v = ^v
+				}
+				key = append(key, math.Float64frombits(v))
+			}
+		case compositeTime:
+			if len(data) < 12 {
+				return nil, errBadCompositeKey
+			}
+			sec := int64(binary.BigEndian.Uint64(data) ^ (1 << 63))
+			nsec := int64(binary.BigEndian.Uint32(data[8:]))
+			key = append(key, time.Unix(sec, nsec).UTC())
+			data = data[12:]
+		case compositeString, compositeBytes, compositeBinary:
+			var value []byte
+			var ok bool
+			value, data, ok = readEscaped(data)
+			if !ok {
+				return nil, errBadCompositeKey
+			}
+			if kind == compositeString {
+				key = append(key, string(value))
+			} else {
+				key = append(key, value)
+			}
+		default:
+			return nil, errBadCompositeKey
+		}
+	}
+	return key, nil
+}
+
+func readEscaped(data []byte) (value, rest []byte, ok bool) {
+	value = []byte{}
+	for i := 0; i < len(data)-1; i++ {
+		if data[i] != compositeEscape {
+			value = append(value, data[i])
+			continue
+		}
+		switch data[i+1] {
+		case compositeEscaped:
+			value = append(value, compositeEscape)
+			i++
+		case compositeTerminate:
+			return value, data[i+2:], true
+		default:
+			return nil, nil, false
+		}
+	}
+	return nil, nil, false
+}
+
+// compositeKeyEncoder encodes CompositeKeys itself, so they sort in order with any key encoder, and leaves every
+// other key to encode
+func compositeKeyEncoder(encode EncodeFunc) EncodeFunc {
+	return func(value interface{}) ([]byte, error) {
+		if key, ok := value.(CompositeKey); ok {
+			return key.encode()
+		}
+		return encode(value)
+	}
+}
+
+// compositeKeyDecoder is the decoder for the keys encoded by compositeKeyEncoder
+func compositeKeyDecoder(decode DecodeFunc) DecodeFunc {
+	return func(data []byte, value interface{}) error {
+		if key, ok := value.(*CompositeKey); ok {
+			var err error
+			*key, err = decodeComposite(data)
+			return err
+		}
+		return decode(data, value)
+	}
+}
+
+// compositeKeyFields returns the indexes of the fields tagged as the parts of the type's composite key, in key order.
+// A type needs at least two numbered key fields to have a composite key, so a lone `boltholdKey:"1"` field is still
+// treated as a regular key field
+func compositeKeyFields(tp reflect.Type) []int {
+	for tp.Kind() == reflect.Ptr {
+		tp = tp.Elem()
+	}
+	if tp.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var fields, order []int
+	for i := 0; i < tp.NumField(); i++ {
+		tag, ok := tp.Field(i).Tag.Lookup(BoltholdKeyTag)
+		if !ok {
+			continue
+		}
+		n, err := strconv.Atoi(tag)
+		if err != nil || n < 1 {
+			continue
+		}
+		fields = append(fields, i)
+		order = append(order, n)
+	}
+	if len(fields) < 2 {
+		return nil
+	}
+
+	sort.Sort(byKeyOrder{fields: fields, order: order})
+	return fields
+}
+
+type byKeyOrder struct {
+	fields []int
+	order  []int
+}
+
+func (b byKeyOrder) Len() int           { return len(b.fields) }
+func (b byKeyOrder) Less(i, j int) bool { return b.order[i] < b.order[j] }
+func (b byKeyOrder) Swap(i, j int) {
+	b.fields[i], b.fields[j] = b.fields[j], b.fields[i]
+	b.order[i], b.order[j] = b.order[j], b.order[i]
+}
+
+// compositeKeyOf builds the composite key of the record from its key fields
+func compositeKeyOf(data interface{}) (CompositeKey, error) {
+	value := reflect.Indirect(reflect.ValueOf(data))
+	fields := compositeKeyFields(value.Type())
+	if fields == nil {
+		return nil, fmt.Errorf("The type %s has no composite key fields tagged with `%s:\"1\"`, `%s:\"2\"` and so on",
+			value.Type(), BoltholdKeyTag, BoltholdKeyTag)
+	}
+
+	key := make(CompositeKey, len(fields))
+	for i := range fields {
+		key[i] = value.Field(fields[i]).Interface()
+	}
+	return key, nil
+}
+
+// resolveKey returns the key a record is written with, which is derived from the record itself for AutoKey
+func (s *Store) resolveKey(key, data interface{}) (interface{}, error) {
+	if _, ok := key.(autoKey); !ok {
+		return key, nil
+	}
+
+	storer := s.newStorer(data)
+	keyer, ok := storer.(Keyer)
+	if !ok {
+		keyer, ok = data.(Keyer)
+	}
+	if !ok {
+		return compositeKeyOf(data)
+	}
+
+	key, err := keyer.Key(data)
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		return nil, fmt.Errorf("The Key method of %s returned a nil key", storer.Type())
+	}
+	return key, nil
+}
+
+// setCompositeKeyFields sets the key fields of the record to the values of the composite key
+func setCompositeKeyFields(value reflect.Value, fields []int, key interface{}) error {
+	composite, ok := key.(CompositeKey)
+	if !ok || len(composite) != len(fields) {
+		return fmt.Errorf("The type %s has a composite key of %d fields, not a %T", value.Type(), len(fields), key)
+	}
+
+	for i := range fields {
+		field := value.Field(fields[i])
+		part := reflect.ValueOf(composite[i])
+		if !part.IsValid() || !part.Type().ConvertibleTo(field.Type()) {
+			return fmt.Errorf("The key field %s is a %s, not a %T", value.Type().Field(fields[i]).Name,
+				field.Type(), composite[i])
+		}
+		field.Set(part.Convert(field.Type()))
+	}
+	return nil
+}
+
+// decodedKeyField returns the field the record's key is decoded into when it's read, if the type has one.  The parts of a
+// composite key are stored in the record, so they're never decoded from its key
+func decodedKeyField(tp reflect.Type) (reflect.StructField, bool) {
+	for tp.Kind() == reflect.Ptr {
+		tp = tp.Elem()
+	}
+	if tp.Kind() != reflect.Struct || compositeKeyFields(tp) != nil {
+		return reflect.StructField{}, false
+	}
+
+	for i := 0; i < tp.NumField(); i++ {
+		if strings.Contains(string(tp.Field(i).Tag), BoltholdKeyTag) {
+			return tp.Field(i), true
+		}
+	}
+	return reflect.StructField{}, false
+}
@@ -0,0 +1,174 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package bolthold_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/timshannon/bolthold"
+	bolt "go.etcd.io/bbolt"
+)
+
+type Shipment struct {
+	Customer string    `boltholdKey:"1"`
+	Shipped  time.Time `boltholdKey:"3"`
+	Number   int       `boltholdKey:"2"`
+	Carrier  string    `boltholdIndex:"Carrier"`
+}
+
+func TestCompositeKey(t *testing.T) {
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+		shipments := []Shipment{
+			{Customer: "acme", Number: 10, Shipped: day, Carrier: "ups"},
+			{Customer: "acme", Number: -5, Shipped: day, Carrier: "fedex"},
+			{Customer: "acme", Number: 2, Shipped: day.Add(time.Hour), Carrier: "ups"},
+			{Customer: "acme", Number: 2, Shipped: day, Carrier: "dhl"},
+			{Customer: "acmex", Number: 1, Shipped: day, Carrier: "ups"},
+			{Customer: "ac", Number: 99, Shipped: day, Carrier: "ups"},
+		}
+		for i := range shipments {
+			ok(t, store.Insert(bolthold.AutoKey, &shipments[i]))
+		}
+
+		equals(t, bolthold.ErrKeyExists, store.Insert(bolthold.AutoKey, &shipments[0]))
+
+		var result []Shipment
+		ok(t, store.Find(&result, nil))
+		carriers := func(shipments []Shipment) []string {
+			var carriers []string
+			for i := range shipments {
+				carriers = append(carriers, shipments[i].Carrier+"/"+shipments[i].Customer)
+			}
+			return carriers
+		}
+		equals(t, []string{"ups/ac", "fedex/acme", "dhl/acme", "ups/acme", "ups/acme", "ups/acmex"},
+			carriers(result))
+		equals(t, result[2].Number, 2)
+		assert(t, result[2].Shipped.Equal(day), "key field wasn't read back from the record")
+
+		var shipment Shipment
+		ok(t, store.Get(bolthold.CompositeKey{"acme", 2, day.Add(time.Hour)}, &shipment))
+		equals(t, "ups", shipment.Carrier)
+
+		t.Run("Prefix", func(t *testing.T) {
+			var found []string
+			ok(t, store.ForEachKeyPrefix(&Shipment{}, bolthold.CompositeKey{"acme"},
+				func(record interface{}) error {
+					found = append(found, record.(*Shipment).Carrier)
+					return nil
+				}))
+			equals(t, []string{"fedex", "dhl", "ups", "ups"}, found)
+
+			found = nil
+			ok(t, store.ForEachKeyPrefix(&Shipment{}, bolthold.CompositeKey{"acme", 2},
+				func(record interface{}) error {
+					found = append(found, record.(*Shipment).Carrier)
+					return nil
+				}))
+			equals(t, []string{"dhl", "ups"}, found)
+		})
+
+		t.Run("Range", func(t *testing.T) {
+			var result []Shipment
+			ok(t, store.Find(&result, bolthold.Where(bolthold.Key).Ge(bolthold.CompositeKey{"acme", 0}).
+				And(bolthold.Key).Lt(bolthold.CompositeKey{"acme", 10}).And("Carrier").Eq("ups")))
+			equals(t, 1, len(result))
+			equals(t, 2, result[0].Number)
+
+			var keys []bolthold.CompositeKey
+			ok(t, store.ForEach(bolthold.Where(bolthold.Key).Gt(bolthold.CompositeKey{"acme", 10, day}),
+				func(s *Shipment) error {
+					keys = append(keys, bolthold.CompositeKey{s.Customer, s.Number})
+					return nil
+				}))
+			equals(t, []bolthold.CompositeKey{{"acmex", 1}}, keys)
+		})
+
+		t.Run("Update", func(t *testing.T) {
+			shipment := Shipment{Customer: "acme", Number: 10, Shipped: day, Carrier: "usps"}
+			ok(t, store.Update(bolthold.AutoKey, &shipment))
+			ok(t, store.Upsert(bolthold.AutoKey, &Shipment{Customer: "new", Number: 1, Carrier: "ups"}))
+
+			var result []Shipment
+			ok(t, store.Find(&result, bolthold.Where("Carrier").Eq("usps").Index("Carrier")))
+			equals(t, 1, len(result))
+			equals(t, 10, result[0].Number)
+
+			ok(t, store.Delete(bolthold.CompositeKey{"new", 1, time.Time{}}, &Shipment{}))
+			equals(t, bolthold.ErrNotFound, store.Get(bolthold.CompositeKey{"new", 1, time.Time{}}, &Shipment{}))
+		})
+	})
+}
+
+func TestCompositeKeyDecode(t *testing.T) {
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		ok(t, store.Insert(bolthold.CompositeKey{"a\x00b", int8(-3), uint(7), 1.5, true, []byte{0, 1}},
+			&ItemTest{Name: "composite"}))
+
+		var key bolthold.CompositeKey
+		ok(t, store.Bolt().View(func(tx *bolt.Tx) error {
+			c := store.TxCursor(tx, &ItemTest{})
+			err := c.First(&ItemTest{})
+			if err != nil {
+				return err
+			}
+			return c.Key(&key)
+		}))
+		equals(t, bolthold.CompositeKey{"a\x00b", int64(-3), uint64(7), 1.5, true, []byte{0, 1}}, key)
+	})
+}
+
+func TestAutoKeyWithoutKeyFields(t *testing.T) {
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		assert(t, store.Insert(bolthold.AutoKey, &ItemTest{}) != nil, "AutoKey needs composite key fields")
+		assert(t, store.Insert(bolthold.CompositeKey{struct{}{}}, &ItemTest{}) != nil,
+			"struct values can't be part of a composite key")
+	})
+}
+
+// Currency is keyed by its ISO code, which it derives itself
+type Currency struct {
+	Code  string
+	Name  string
+	Minor int
+}
+
+func (c *Currency) Key(record interface{}) (interface{}, error) {
+	currency := record.(*Currency)
+	if len(currency.Code) != 3 {
+		return nil, fmt.Errorf("%q isn't a currency code", currency.Code)
+	}
+	return strings.ToUpper(currency.Code), nil
+}
+
+func TestKeyer(t *testing.T) {
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		ok(t, store.Insert(bolthold.AutoKey, &Currency{Code: "usd", Name: "US Dollar", Minor: 2}))
+		ok(t, store.Insert(bolthold.AutoKey, &Currency{Code: "JPY", Name: "Yen"}))
+		equals(t, bolthold.ErrKeyExists, store.Insert(bolthold.AutoKey, &Currency{Code: "USD"}))
+		assert(t, store.Insert(bolthold.AutoKey, &Currency{Code: "euro"}) != nil, "Key errors weren't returned")
+
+		var currency Currency
+		ok(t, store.Get("USD", &currency))
+		equals(t, "US Dollar", currency.Name)
+
+		ok(t, store.Upsert(bolthold.AutoKey, &Currency{Code: "jpy", Name: "Japanese Yen"}))
+		ok(t, store.Get("JPY", &currency))
+		equals(t, "Japanese Yen", currency.Name)
+
+		found, err := store.FindOrInsert(bolthold.AutoKey, &currency, &Currency{Code: "usd", Name: "Other"})
+		ok(t, err)
+		equals(t, false, found)
+		equals(t, "US Dollar", currency.Name)
+
+		count, err := store.Count(&Currency{}, nil)
+		ok(t, err)
+		equals(t, 2, count)
+	})
+}
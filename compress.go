@@ -0,0 +1,90 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package bolthold
+
+import (
+	"bytes"
+	"compress/flate"
+	"io/ioutil"
+)
+
+// Compressor compresses record values before they are written to bolt, and decompresses them when they are read.
+// Any compression library, such as snappy or zstd, can be used by wrapping it in a Compressor
+type Compressor interface {
+	Compress(data []byte) ([]byte, error)
+	Decompress(data []byte) ([]byte, error)
+}
+
+// FlateCompressor is a Compressor using compress/flate from the standard library
+type FlateCompressor struct {
+	// Level is the flate compression level, zero uses flate.DefaultCompression
+	Level int
+}
+
+// Compress compresses data with flate
+func (f FlateCompressor) Compress(data []byte) ([]byte, error) {
+	level := f.Level
+	if level == 0 {
+		level = flate.DefaultCompression
+	}
+
+	var buff bytes.Buffer
+	w, err := flate.NewWriter(&buff, level)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = w.Write(data)
+	if err != nil {
+		return nil, err
+	}
+
+	err = w.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return buff.Bytes(), nil
+}
+
+// Decompress decompresses flate compressed data
+func (f FlateCompressor) Decompress(data []byte) ([]byte, error) {
+	r := flate.NewReader(bytes.NewReader(data))
+	defer r.Close()
+
+	return ioutil.ReadAll(r)
+}
+
+// compressedHeader marks a compressed record value.  Values without it were written uncompressed, either before
+// compression was turned on or because compressing them didn't make them smaller
+var compressedHeader = []byte{0xbc, 'h', 'z', 0x01}
+
+// compress returns the value to write to bolt for the encoded record
+func (s *Store) compress(value []byte) ([]byte, error) {
+	if s.compressor == nil {
+		return value, nil
+	}
+
+	compressed, err := s.compressor.Compress(value)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(compressed)+len(compressedHeader) >= len(value) {
+		return value, nil
+	}
+
+	return append(append(make([]byte, 0, len(compressedHeader)+len(compressed)), compressedHeader...),
+		compressed...), nil
+}
+
+// decompress returns the encoded record from the value read from bolt
+func (s *Store) decompress(value []byte) ([]byte, error) {
+	if s.compressor == nil || !bytes.HasPrefix(value, compressedHeader) {
+		return value, nil
+	}
+
+	return s.compressor.Decompress(value[len(compressedHeader):])
+}
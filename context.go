@@ -0,0 +1,178 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package bolthold
+
+import (
+	"context"
+	"sync/atomic"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// states of a write started with updateTxContext
+const (
+	ctxWaiting int32 = iota
+	ctxRunning
+	ctxAbandoned
+)
+
+// updateTxContext is the same as updateTx, except the caller stops waiting for bolt's write lock when ctx is done,
+// and gets ctx.Err().  An abandoned write still waits for the lock in the background, but is rolled back as soon as
+// it gets it, so it never changes the store.  If ctx is done while fn is running, it is rolled back when fn returns
+func (s *Store) updateTxContext(ctx context.Context, fn func(tx *bolt.Tx) error) error {
+	err := ctx.Err()
+	if err != nil {
+		return err
+	}
+
+	state := ctxWaiting
+	result := make(chan error, 1)
+
+	go func() {
+		result <- s.updateTx(func(tx *bolt.Tx) error {
+			if !atomic.CompareAndSwapInt32(&state, ctxWaiting, ctxRunning) {
+				return context.Canceled
+			}
+			err := fn(tx)
+			if err != nil {
+				return err
+			}
+			return ctx.Err()
+		})
+	}()
+
+	select {
+	case err = <-result:
+		return err
+	case <-ctx.Done():
+		if atomic.CompareAndSwapInt32(&state, ctxWaiting, ctxAbandoned) {
+			return ctx.Err()
+		}
+		// fn is already running, and will roll back when it sees ctx is done
+		return <-result
+	}
+}
+
+// InsertContext is the same as Insert, except it gives up waiting for other writers when ctx is done
+func (s *Store) InsertContext(ctx context.Context, key, data interface{}) error {
+	return s.updateTxContext(ctx, func(tx *bolt.Tx) error {
+		return s.insert(tx, key, data)
+	})
+}
+
+// UpdateContext is the same as Update, except it gives up waiting for other writers when ctx is done
+func (s *Store) UpdateContext(ctx context.Context, key, data interface{}) error {
+	return s.updateTxContext(ctx, func(tx *bolt.Tx) error {
+		return s.update(tx, key, data)
+	})
+}
+
+// UpsertContext is the same as Upsert, except it gives up waiting for other writers when ctx is done
+func (s *Store) UpsertContext(ctx context.Context, key, data interface{}) error {
+	return s.updateTxContext(ctx, func(tx *bolt.Tx) error {
+		return s.upsert(tx, key, data)
+	})
+}
+
+// InsertKeyContext is the same as InsertKey, except it gives up waiting for other writers when ctx is done
+func (s *Store) InsertKeyContext(ctx context.Context, key, data interface{}) (interface{}, error) {
+	var stored interface{}
+	err := s.updateTxContext(ctx, func(tx *bolt.Tx) error {
+		var err error
+		stored, err = s.insertKey(tx, key, data)
+		return err
+	})
+	return stored, err
+}
+
+// FindOrInsertContext is the same as FindOrInsert, except it gives up waiting for other writers when ctx is done
+func (s *Store) FindOrInsertContext(ctx context.Context, key, result, defaultValue interface{}) (bool, error) {
+	inserted := false
+	err := s.updateTxContext(ctx, func(tx *bolt.Tx) error {
+		var err error
+		inserted, err = s.TxFindOrInsert(tx, key, result, defaultValue)
+		return err
+	})
+	return inserted, err
+}
+
+// UpdateMatchingContext is the same as UpdateMatching, except it gives up waiting for other writers when ctx is
+// done
+func (s *Store) UpdateMatchingContext(ctx context.Context, dataType interface{}, query *Query,
+	update func(record interface{}) error) error {
+	return s.updateTxContext(ctx, func(tx *bolt.Tx) error {
+		return s.updateQuery(tx, dataType, query, update)
+	})
+}
+
+// UpdateFieldsContext is the same as UpdateFields, except it gives up waiting for other writers when ctx is done
+func (s *Store) UpdateFieldsContext(ctx context.Context, key, dataType interface{},
+	fields map[string]interface{}) error {
+	return s.updateTxContext(ctx, func(tx *bolt.Tx) error {
+		return s.updateFields(tx, key, dataType, fields)
+	})
+}
+
+// MergeContext is the same as Merge, except it gives up waiting for other writers when ctx is done
+func (s *Store) MergeContext(ctx context.Context, key, data interface{}) error {
+	return s.updateTxContext(ctx, func(tx *bolt.Tx) error {
+		return s.merge(tx, key, data)
+	})
+}
+
+// IncrementContext is the same as Increment, except it gives up waiting for other writers when ctx is done
+func (s *Store) IncrementContext(ctx context.Context, key, dataType interface{}, field string,
+	delta interface{}) error {
+	return s.updateTxContext(ctx, func(tx *bolt.Tx) error {
+		return s.increment(tx, key, dataType, field, delta)
+	})
+}
+
+// DeleteContext is the same as Delete, except it gives up waiting for other writers when ctx is done
+func (s *Store) DeleteContext(ctx context.Context, key, dataType interface{}) error {
+	return s.updateTxContext(ctx, func(tx *bolt.Tx) error {
+		return s.delete(tx, key, dataType)
+	})
+}
+
+// DeleteMatchingContext is the same as DeleteMatching, except it gives up waiting for other writers when ctx is
+// done
+func (s *Store) DeleteMatchingContext(ctx context.Context, dataType interface{}, query *Query) error {
+	return s.updateTxContext(ctx, func(tx *bolt.Tx) error {
+		_, err := s.deleteQuery(tx, dataType, query)
+		return err
+	})
+}
+
+// DeleteKeysContext is the same as DeleteKeys, except it gives up waiting for other writers when ctx is done
+func (s *Store) DeleteKeysContext(ctx context.Context, dataType interface{}, keys ...interface{}) error {
+	return s.updateTxContext(ctx, func(tx *bolt.Tx) error {
+		return s.TxDeleteKeys(tx, dataType, keys...)
+	})
+}
+
+// PopContext is the same as Pop, except it gives up waiting for other writers when ctx is done
+func (s *Store) PopContext(ctx context.Context, key, result interface{}) error {
+	return s.updateTxContext(ctx, func(tx *bolt.Tx) error {
+		return s.pop(tx, key, result)
+	})
+}
+
+// PurgeDeletedContext is the same as PurgeDeleted, except it gives up waiting for other writers when ctx is done
+func (s *Store) PurgeDeletedContext(ctx context.Context, dataType interface{}, query *Query) (int, error) {
+	count := 0
+	err := s.updateTxContext(ctx, func(tx *bolt.Tx) error {
+		var err error
+		count, err = s.TxPurgeDeleted(tx, dataType, query)
+		return err
+	})
+	return count, err
+}
+
+// CommitContext is the same as Commit, except it gives up waiting for other writers when ctx is done, and doesn't
+// retry once ctx is done
+func (t *Txn) CommitContext(ctx context.Context) error {
+	return t.commit(ctx)
+}
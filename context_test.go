@@ -0,0 +1,103 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package bolthold_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/timshannon/bolthold"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestWriteContext(t *testing.T) {
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		insertTestData(t, store)
+
+		ctx := context.Background()
+		item := ItemTest{Key: 1000, Name: "context"}
+		ok(t, store.InsertContext(ctx, item.Key, item))
+		item.Name = "updated"
+		ok(t, store.UpdateContext(ctx, item.Key, item))
+		ok(t, store.UpsertContext(ctx, item.Key+1, item))
+		ok(t, store.UpdateMatchingContext(ctx, &ItemTest{}, bolthold.Where("Name").Eq("updated"),
+			func(record interface{}) error {
+				record.(*ItemTest).Category = "context"
+				return nil
+			}))
+
+		count, err := store.Count(&ItemTest{}, bolthold.Where("Category").Eq("context"))
+		ok(t, err)
+		equals(t, 2, count)
+
+		ok(t, store.DeleteContext(ctx, item.Key, &ItemTest{}))
+		ok(t, store.DeleteMatchingContext(ctx, &ItemTest{}, bolthold.Where("Category").Eq("context")))
+		count, err = store.Count(&ItemTest{}, bolthold.Where("Category").Eq("context"))
+		ok(t, err)
+		equals(t, 0, count)
+
+		stored, err := store.InsertKeyContext(ctx, 3000, ItemTest{Key: 3000, Name: "context"})
+		ok(t, err)
+		equals(t, 3000, stored)
+		ok(t, store.UpdateFieldsContext(ctx, 3000, &ItemTest{}, map[string]interface{}{"Color": "red"}))
+		ok(t, store.MergeContext(ctx, 3000, &ItemTest{Fruit: "apple"}))
+		ok(t, store.IncrementContext(ctx, 3000, &ItemTest{}, "ID", 2))
+
+		var found ItemTest
+		inserted, err := store.FindOrInsertContext(ctx, 3000, &found, ItemTest{})
+		ok(t, err)
+		assert(t, !inserted, "FindOrInsertContext inserted over an existing record")
+		equals(t, "red", found.Color)
+		equals(t, "apple", found.Fruit)
+		equals(t, 2, found.ID)
+
+		ok(t, store.PopContext(ctx, 3000, &found))
+		ok(t, store.InsertContext(ctx, 3001, ItemTest{Key: 3001}))
+		ok(t, store.DeleteKeysContext(ctx, &ItemTest{}, 3001))
+		equals(t, bolthold.ErrNotFound, store.Get(3000, &ItemTest{}))
+		equals(t, bolthold.ErrNotFound, store.Get(3001, &ItemTest{}))
+
+		purged, err := store.PurgeDeletedContext(ctx, &ItemTest{}, nil)
+		ok(t, err)
+		equals(t, 0, purged)
+
+		cancelled, cancel := context.WithCancel(ctx)
+		cancel()
+		equals(t, context.Canceled, store.InsertContext(cancelled, 2000, item))
+		equals(t, context.Canceled, store.Txn().Insert(2000, item).CommitContext(cancelled))
+		equals(t, bolthold.ErrNotFound, store.Get(2000, &ItemTest{}))
+	})
+}
+
+func TestWriteContextWaiting(t *testing.T) {
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		locked := make(chan struct{})
+		release := make(chan struct{})
+		done := make(chan error, 1)
+
+		go func() {
+			done <- store.Bolt().Update(func(tx *bolt.Tx) error {
+				close(locked)
+				<-release
+				return nil
+			})
+		}()
+		<-locked
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		item := ItemTest{Key: 1000, Name: "abandoned"}
+		equals(t, context.DeadlineExceeded, store.InsertContext(ctx, item.Key, item))
+
+		close(release)
+		ok(t, <-done)
+
+		// the abandoned insert gets the lock after the other writer, and must not write anything
+		ok(t, store.Insert(item.Key+1, item))
+		equals(t, bolthold.ErrNotFound, store.Get(item.Key, &ItemTest{}))
+	})
+}
@@ -0,0 +1,111 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package bolthold
+
+import (
+	"reflect"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// CopyTransform is called by CopyMatching with each matching record, as a pointer to srcType, and returns the
+// record to write to the destination, which can be of any type, along with its key.  A nil key keeps the record's
+// current key, and a nil record skips it
+type CopyTransform func(record interface{}) (out interface{}, key interface{}, err error)
+
+// CopyMatching upserts every record of srcType which matches the query into dst, which can be the same store or
+// another one.  Records are read one at a time, so large types can be copied without holding them in memory.  If
+// transform is nil, records are copied as they are under the same key.  Keys kept from the source are copied
+// already encoded, so both stores should use the same KeyEncoder.  The records are written in a single transaction
+// in dst, use DeleteMatching afterwards to move them instead
+func (s *Store) CopyMatching(srcType interface{}, dst *Store, query *Query, transform CopyTransform) error {
+	if dst == s {
+		return s.updateTx(func(tx *bolt.Tx) error {
+			return s.TxCopyMatching(tx, tx, srcType, dst, query, transform)
+		})
+	}
+
+	return dst.updateTx(func(dstTx *bolt.Tx) error {
+		return s.Bolt().View(func(srcTx *bolt.Tx) error {
+			return s.TxCopyMatching(srcTx, dstTx, srcType, dst, query, transform)
+		})
+	})
+}
+
+// TxCopyMatching is the same as CopyMatching except it allows you to specify your own transactions.  srcTx and dstTx
+// can be the same transaction
+func (s *Store) TxCopyMatching(srcTx, dstTx *bolt.Tx, srcType interface{}, dst *Store, query *Query,
+	transform CopyTransform) error {
+	if !dstTx.Writable() {
+		return bolt.ErrTxNotWritable
+	}
+	return s.copyMatching(srcTx, dstTx, srcType, dst, query, transform)
+}
+
+func (s *Store) copyMatching(src, dstSource BucketSource, srcType interface{}, dst *Store, query *Query,
+	transform CopyTransform) error {
+	query, err := s.prepQuery(srcType, query)
+	if err != nil {
+		return err
+	}
+
+	tp := reflect.TypeOf(srcType)
+	for tp.Kind() == reflect.Ptr {
+		tp = tp.Elem()
+	}
+
+	var keyField string
+	if field, ok := decodedKeyField(tp); ok {
+		keyField = field.Name
+	}
+
+	copyRecord := func(r *record) error {
+		if keyField != "" {
+			err := s.decodeKey(r.key, reflect.Indirect(r.value).FieldByName(keyField).Addr().Interface())
+			if err != nil {
+				return err
+			}
+		}
+
+		var out, key interface{} = r.value.Interface(), nil
+		if transform != nil {
+			out, key, err = transform(r.value.Interface())
+			if err != nil {
+				return err
+			}
+			if out == nil {
+				return nil
+			}
+		}
+
+		if key == nil {
+			return dst.upsertKey(dstSource, r.key, out)
+		}
+		return dst.upsert(dstSource, key, out)
+	}
+
+	if src != dstSource {
+		return s.runQuery(src, srcType, query, nil, query.skip, copyRecord)
+	}
+
+	// writing while the query's cursors are open could move them, so records are collected first when both are
+	// in the same transaction
+	var records []*record
+	err = s.runQuery(src, srcType, query, nil, query.skip, func(r *record) error {
+		records = append(records, r)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for i := range records {
+		err = copyRecord(records[i])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package bolthold_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/timshannon/bolthold"
+)
+
+type ArchivedItem struct {
+	ID       int
+	Name     string
+	Category string `boltholdIndex:"Category"`
+}
+
+func TestCopyMatching(t *testing.T) {
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		insertTestData(t, store)
+
+		archive, err := bolthold.Open(tempfile(), 0666, nil)
+		ok(t, err)
+		defer os.Remove(archive.Bolt().Path())
+		defer archive.Close()
+
+		query := bolthold.Where("Category").Eq("vehicle")
+		ok(t, store.CopyMatching(&ItemTest{}, archive, query, nil))
+
+		var want, got []ItemTest
+		ok(t, store.Find(&want, query))
+		ok(t, archive.Find(&got, query))
+		assert(t, len(want) > 0, "No records to copy")
+		equals(t, len(want), len(got))
+		for i := range want {
+			equals(t, want[i].Key, got[i].Key)
+			equals(t, want[i].Name, got[i].Name)
+		}
+
+		count, err := store.Count(&ItemTest{}, nil)
+		ok(t, err)
+		equals(t, len(testData), count)
+	})
+}
+
+func TestCopyMatchingTransform(t *testing.T) {
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		insertTestData(t, store)
+
+		query := bolthold.Where("Category").Eq("food")
+		ok(t, store.CopyMatching(&ItemTest{}, store, query, func(record interface{}) (interface{}, interface{}, error) {
+			item := record.(*ItemTest)
+			if item.Name == "pizza" {
+				return nil, nil, nil
+			}
+			return ArchivedItem{ID: item.Key, Name: item.Name, Category: item.Category}, item.Key, nil
+		}))
+
+		var archived []ArchivedItem
+		ok(t, store.Find(&archived, bolthold.Where("Category").Eq("food").Index("Category")))
+
+		var food []ItemTest
+		ok(t, store.Find(&food, bolthold.Where("Category").Eq("food").And("Name").Ne("pizza")))
+		assert(t, len(food) > 0, "No records to copy")
+		equals(t, len(food), len(archived))
+		for i := range food {
+			equals(t, food[i].Key, archived[i].ID)
+			equals(t, food[i].Name, archived[i].Name)
+
+			var stored ArchivedItem
+			ok(t, store.Get(food[i].Key, &stored))
+			equals(t, food[i].Name, stored.Name)
+		}
+
+		pizzas, err := store.Count(&ItemTest{}, bolthold.Where("Category").Eq("food").And("Name").Eq("pizza"))
+		ok(t, err)
+		assert(t, pizzas > 0, "No records were skipped")
+
+		// copying over existing records replaces them
+		ok(t, store.CopyMatching(&ItemTest{}, store, query, func(record interface{}) (interface{}, interface{}, error) {
+			item := record.(*ItemTest)
+			return ArchivedItem{ID: item.Key, Name: "copied", Category: item.Category}, item.Key, nil
+		}))
+		count, err := store.Count(&ArchivedItem{}, bolthold.Where("Name").Eq("copied"))
+		ok(t, err)
+		equals(t, len(food)+pizzas, count)
+	})
+}
@@ -0,0 +1,409 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+// Package crashtest drives concurrent writers and readers against a bolthold store in a child process, kills that
+// process at random points, and verifies the store's invariants every time it's reopened.
+//
+// The child process is the calling program itself, so RunChild must be called before anything else in main, or
+// in TestMain when running from tests:
+//
+//	func TestMain(m *testing.M) {
+//		crashtest.RunChild()
+//		os.Exit(m.Run())
+//	}
+package crashtest
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/timshannon/bolthold"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	childEnv   = "BOLTHOLD_CRASHTEST_FILE"
+	writersEnv = "BOLTHOLD_CRASHTEST_WRITERS"
+	readersEnv = "BOLTHOLD_CRASHTEST_READERS"
+)
+
+// exit code used by the child process when it finds an invariant broken while running
+const exitInvariant = 3
+
+// Config is the configuration for a crash test run
+type Config struct {
+	Filename string        // bolthold file to test against, it is created if it doesn't exist
+	Rounds   int           // number of times the child process is started and killed, defaults to 10
+	MaxRun   time.Duration // maximum time the child runs before it is killed, defaults to 1 second
+	Writers  int           // number of concurrent writers in the child, defaults to 4
+	Readers  int           // number of concurrent readers in the child, defaults to 2
+}
+
+// Record is the type written by the crash test workload
+type Record struct {
+	ID        uint64 `boltholdKey:"ID"`
+	Writer    int    `boltholdIndex:"Writer"`
+	WriterSeq uint64
+	Group     string   `boltholdIndex:"Group"`
+	Tags      []string `boltholdIndex:"Tags"`
+	Code      string   `boltholdUnique:"Code"`
+}
+
+// ErrInvariant is the error returned when the store is found in an inconsistent state
+type ErrInvariant struct {
+	Round  int
+	Reason string
+}
+
+func (e *ErrInvariant) Error() string {
+	return fmt.Sprintf("Invariant broken after round %d: %s", e.Round, e.Reason)
+}
+
+var groups = []string{"red", "green", "blue", "orange", "purple"}
+
+// Run starts the workload in a child process Rounds times, killing it after a random amount of time, and verifies
+// the store after every kill.  It returns the first broken invariant found as an *ErrInvariant
+func Run(config Config) error {
+	if config.Rounds <= 0 {
+		config.Rounds = 10
+	}
+	if config.MaxRun <= 0 {
+		config.MaxRun = time.Second
+	}
+	if config.Writers <= 0 {
+		config.Writers = 4
+	}
+	if config.Readers <= 0 {
+		config.Readers = 2
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	for round := 1; round <= config.Rounds; round++ {
+		var stderr bytes.Buffer
+		cmd := exec.Command(exe)
+		cmd.Env = append(os.Environ(),
+			childEnv+"="+config.Filename,
+			writersEnv+"="+strconv.Itoa(config.Writers),
+			readersEnv+"="+strconv.Itoa(config.Readers),
+		)
+		cmd.Stderr = &stderr
+
+		err = cmd.Start()
+		if err != nil {
+			return err
+		}
+
+		done := make(chan error, 1)
+		go func() {
+			done <- cmd.Wait()
+		}()
+
+		select {
+		case err = <-done:
+			// the child should run until it's killed
+			if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == exitInvariant {
+				return &ErrInvariant{Round: round, Reason: stderr.String()}
+			}
+			return fmt.Errorf("Crash test child exited before it was killed: %v %s", err, stderr.String())
+		case <-time.After(time.Duration(rand.Int63n(int64(config.MaxRun)))):
+			err = cmd.Process.Kill()
+			if err != nil {
+				return err
+			}
+			<-done
+		}
+
+		reason, err := verify(config.Filename)
+		if err != nil {
+			return err
+		}
+		if reason != "" {
+			return &ErrInvariant{Round: round, Reason: reason}
+		}
+	}
+
+	return nil
+}
+
+// RunChild runs the crash test workload if the current process was started by Run, in which case it never returns.
+// Otherwise it returns immediately.
+func RunChild() {
+	filename := os.Getenv(childEnv)
+	if filename == "" {
+		return
+	}
+
+	writers, _ := strconv.Atoi(os.Getenv(writersEnv))
+	readers, _ := strconv.Atoi(os.Getenv(readersEnv))
+
+	err := workload(filename, writers, readers)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		if _, ok := err.(*ErrInvariant); ok {
+			os.Exit(exitInvariant)
+		}
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+func open(filename string) (*bolthold.Store, error) {
+	return bolthold.Open(filename, 0666, &bolthold.Options{
+		Options: &bolt.Options{Timeout: 10 * time.Second},
+	})
+}
+
+// workload runs the writers and readers until the process is killed, or an error occurs
+func workload(filename string, writers, readers int) error {
+	store, err := open(filename)
+	if err != nil {
+		return err
+	}
+
+	errs := make(chan error, writers+readers)
+
+	for i := 0; i < writers; i++ {
+		go func(writer int) {
+			errs <- write(store, writer)
+		}(i)
+	}
+
+	for i := 0; i < readers; i++ {
+		go func() {
+			errs <- read(store)
+		}()
+	}
+
+	return <-errs
+}
+
+// write inserts, updates and deletes records for the passed in writer
+func write(store *bolthold.Store, writer int) error {
+	var last []Record
+	err := store.Find(&last, bolthold.Where("Writer").Eq(writer).Index("Writer").SortBy("WriterSeq").Reverse().
+		Limit(1))
+	if err != nil {
+		return err
+	}
+
+	var seq uint64
+	if len(last) != 0 {
+		seq = last[0].WriterSeq
+	}
+
+	random := rand.New(rand.NewSource(time.Now().UnixNano() + int64(writer)))
+
+	for {
+		switch op := random.Intn(100); {
+		case op < 60:
+			seq++
+			err = store.Insert(bolthold.NextSequence(), &Record{
+				Writer:    writer,
+				WriterSeq: seq,
+				Group:     groups[random.Intn(len(groups))],
+				Tags:      randomTags(random),
+				Code:      code(writer, seq),
+			})
+		case op < 85:
+			err = store.UpdateMatching(&Record{}, bolthold.Where("Writer").Eq(writer).Index("Writer").
+				And("WriterSeq").Eq(uint64(random.Int63n(int64(seq)+1))),
+				func(record interface{}) error {
+					r := record.(*Record)
+					r.Group = groups[random.Intn(len(groups))]
+					r.Tags = randomTags(random)
+					if random.Intn(10) == 0 {
+						// usually taken by another of the writer's records, which the constraint must refuse
+						r.Code = code(writer, uint64(random.Int63n(int64(seq)+1)))
+					}
+					return nil
+				})
+			if _, ok := err.(*bolthold.ErrUniqueViolation); ok {
+				err = nil
+			}
+		default:
+			err = store.DeleteMatching(&Record{}, bolthold.Where("Writer").Eq(writer).Index("Writer").
+				And("WriterSeq").Eq(uint64(random.Int63n(int64(seq)+1))))
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// code returns the unique code of a writer's record.  The writer's sequence only grows, so inserted records never
+// share a code
+func code(writer int, seq uint64) string {
+	return fmt.Sprintf("%d-%d", writer, seq)
+}
+
+func randomTags(random *rand.Rand) []string {
+	tags := make([]string, random.Intn(3))
+	for i := range tags {
+		tags[i] = groups[random.Intn(len(groups))]
+	}
+	return tags
+}
+
+// read continuously checks that records returned by an index match the indexed value
+func read(store *bolthold.Store) error {
+	for {
+		group := groups[rand.Intn(len(groups))]
+		var records []Record
+		err := store.Find(&records, bolthold.Where("Group").Eq(group).Index("Group"))
+		if err != nil {
+			return err
+		}
+
+		for i := range records {
+			if records[i].Group != group {
+				return &ErrInvariant{
+					Reason: fmt.Sprintf("Record %d was returned from the Group index for %s, but is in %s",
+						records[i].ID, group, records[i].Group),
+				}
+			}
+		}
+	}
+}
+
+// verify opens the store and checks all invariants, returning the reason for the first broken invariant
+func verify(filename string) (string, error) {
+	store, err := open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer store.Close()
+
+	var records []Record
+	err = store.Find(&records, nil)
+	if err != nil {
+		return "", err
+	}
+
+	// sequence monotonicity
+	var sequence uint64
+	err = store.Bolt().View(func(tx *bolt.Tx) error {
+		if bucket := tx.Bucket([]byte("Record")); bucket != nil {
+			sequence = bucket.Sequence()
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	// keys are stored in encoded order, not numeric order
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].ID < records[j].ID
+	})
+
+	lastSeq := make(map[int]uint64)
+	codes := make(map[string]uint64, len(records))
+	for i := range records {
+		if other, ok := codes[records[i].Code]; ok {
+			return fmt.Sprintf("Records %d and %d both have the unique code %s", other, records[i].ID,
+				records[i].Code), nil
+		}
+		codes[records[i].Code] = records[i].ID
+
+		if records[i].ID > sequence {
+			return fmt.Sprintf("Record %d has a key greater than the bucket sequence %d", records[i].ID,
+				sequence), nil
+		}
+		if records[i].WriterSeq <= lastSeq[records[i].Writer] {
+			return fmt.Sprintf("Record %d for writer %d is out of sequence", records[i].ID,
+				records[i].Writer), nil
+		}
+		lastSeq[records[i].Writer] = records[i].WriterSeq
+	}
+
+	// index consistency: every index entry must match a record, and every index lookup must return exactly the
+	// records a full scan does
+	problems, err := store.CheckIndexes(&Record{}, false)
+	if err != nil {
+		return "", err
+	}
+	if len(problems) != 0 {
+		return fmt.Sprintf("Found %d index problems, the first in the %s index", len(problems),
+			problems[0].Index), nil
+	}
+
+	// unique constraints: the constraint's index must return exactly the one record with each code
+	for value, id := range codes {
+		var indexed []Record
+		err = store.Find(&indexed, bolthold.Where("Code").Eq(value).Index("Code"))
+		if err != nil {
+			return fmt.Sprintf("Querying the Code index for %s failed: %s", value, err), nil
+		}
+		if len(indexed) != 1 || indexed[0].ID != id {
+			return fmt.Sprintf("The Code index for %s returned %d records, but only record %d has it", value,
+				len(indexed), id), nil
+		}
+	}
+
+	var checks []indexCheck
+	for i := range groups {
+		checks = append(checks, indexCheck{"Group", groups[i]}, indexCheck{"Tags", groups[i]})
+	}
+	for writer := range lastSeq {
+		checks = append(checks, indexCheck{"Writer", writer})
+	}
+
+	for _, check := range checks {
+		var indexed, scanned []Record
+		if check.field == "Tags" {
+			err = store.Find(&indexed, bolthold.Where(check.field).Contains(check.value).Index(check.field))
+			if err == nil {
+				err = store.Find(&scanned, bolthold.Where(check.field).Contains(check.value))
+			}
+		} else {
+			err = store.Find(&indexed, bolthold.Where(check.field).Eq(check.value).Index(check.field))
+			if err == nil {
+				err = store.Find(&scanned, bolthold.Where(check.field).Eq(check.value))
+			}
+		}
+		if err != nil {
+			return fmt.Sprintf("Querying the %s index for %v failed: %s", check.field, check.value, err), nil
+		}
+
+		if !sameRecords(indexed, scanned) {
+			return fmt.Sprintf("The %s index for %v returned %d records, but there are %d", check.field,
+				check.value, len(indexed), len(scanned)), nil
+		}
+	}
+
+	return "", nil
+}
+
+// indexCheck is an indexed field and a value to look up in that index
+type indexCheck struct {
+	field string
+	value interface{}
+}
+
+func sameRecords(a, b []Record) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	ids := make(map[uint64]bool, len(a))
+	for i := range a {
+		ids[a[i].ID] = true
+	}
+	for i := range b {
+		if !ids[b[i].ID] {
+			return false
+		}
+	}
+	return true
+}
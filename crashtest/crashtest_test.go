@@ -0,0 +1,43 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package crashtest_test
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/timshannon/bolthold/crashtest"
+)
+
+func TestMain(m *testing.M) {
+	crashtest.RunChild()
+	os.Exit(m.Run())
+}
+
+func TestCrash(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping crash test in short mode")
+	}
+
+	f, err := ioutil.TempFile("", "bolthold-crashtest-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	filename := f.Name()
+	f.Close()
+	os.Remove(filename)
+	defer os.Remove(filename)
+
+	err = crashtest.Run(crashtest.Config{
+		Filename: filename,
+		Rounds:   3,
+		MaxRun:   500 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -28,6 +28,11 @@ const (
 	contains // slice only
 	any      // slice only
 	all      // slice only
+
+	withinRadius // GeoPoint only
+	withinBox    // GeoPoint only
+
+	custom // added with RegisterOperator
 )
 
 // Key is shorthand for specifying a query to run again the Key in a bolthold, simply returns ""
@@ -45,9 +50,16 @@ type Query struct {
 	fieldCriteria map[string][]*Criterion
 	ors           []*Query
 
-	badIndex bool
-	dataType reflect.Type
-	source   BucketSource
+	badIndex     bool
+	recheckIndex bool
+	keysOnly     bool
+	branchOrder  bool
+	withDeleted  bool
+	// records which fail to decode are skipped instead of failing the query
+	skipUndecodable bool
+	after           []byte // only records with encoded keys after this are matched, used by FindPage
+	dataType        reflect.Type
+	source          BucketSource
 
 	limit   int
 	skip    int
@@ -72,6 +84,41 @@ func (q *Query) IsEmpty() bool {
 	return true
 }
 
+// IndexName returns the name of the index this query will use, an empty string means the query
+// will run against the Key
+func (q *Query) IndexName() string {
+	return q.index
+}
+
+// clone returns a copy of the query which can be modified without changing the original
+func (q *Query) clone() *Query {
+	c := *q
+
+	if q.fieldCriteria != nil {
+		c.fieldCriteria = make(map[string][]*Criterion, len(q.fieldCriteria))
+		for field, criteria := range q.fieldCriteria {
+			cCriteria := make([]*Criterion, len(criteria))
+			for i := range criteria {
+				criterion := *criteria[i]
+				criterion.query = &c
+				cCriteria[i] = &criterion
+			}
+			c.fieldCriteria[field] = cCriteria
+		}
+	}
+
+	if q.ors != nil {
+		c.ors = make([]*Query, len(q.ors))
+		for i := range q.ors {
+			c.ors[i] = q.ors[i].clone()
+		}
+	}
+
+	c.sort = append([]string(nil), q.sort...)
+
+	return &c
+}
+
 // Criterion is an operator and a value that a given field needs to match on
 type Criterion struct {
 	query    *Query
@@ -79,11 +126,15 @@ type Criterion struct {
 	value    interface{}
 	values   []interface{}
 	negate   bool
+	epsilon  float64
+	custom   *namedOperator
 }
 
+// hasMatchFunc returns true if any of the criteria are tested by a func, rather than by comparing against the
+// index's values
 func hasMatchFunc(criteria []*Criterion) bool {
 	for _, c := range criteria {
-		if c.operator == fn {
+		if c.operator == fn || c.operator == custom {
 			return true
 		}
 	}
@@ -211,29 +262,56 @@ func (q *Query) Index(indexName string) *Query {
 }
 
 // Or creates another separate query that gets unioned with any other results in the query
-// Or will panic if the query passed in contains a limit or skip value, as they are only
-// allowed on top level queries
+// The Or'd query can have its own SortBy and Limit, which only apply to the records it adds to the results.
+// Or will panic if the query passed in contains a skip value, as skip is only allowed on top level queries
 func (q *Query) Or(query *Query) *Query {
-	if query.skip != 0 || query.limit != 0 {
-		panic("Or'd queries cannot contain skip or limit values")
+	if query.skip != 0 {
+		panic("Or'd queries cannot contain skip values")
 	}
 	q.ors = append(q.ors, query)
 	return q
 }
 
+// InBranchOrder returns the records matched by the query first, followed by the records of each Or'd query in the
+// order they were added, instead of sorting all of them together by the query's SortBy.  The query's SortBy then only
+// sorts the records it matches itself, the same way an Or'd query's SortBy only sorts its own records.  Skip and
+// Limit still apply to the combined results
+//
+//	bolthold.Where("Pinned").Eq(true).SortBy("Title").
+//		Or(bolthold.Where("Pinned").Eq(false).SortBy("Created").Reverse().Limit(10)).
+//		InBranchOrder()
+func (q *Query) InBranchOrder() *Query {
+	q.branchOrder = true
+	return q
+}
+
+// hasBranchOptions returns true if the query and its Or'd queries need to be run separately, rather than as one
+// union of records
+func (q *Query) hasBranchOptions() bool {
+	if q.branchOrder {
+		return true
+	}
+	for i := range q.ors {
+		if q.ors[i].limit != 0 || len(q.ors[i].sort) != 0 {
+			return true
+		}
+	}
+	return false
+}
+
 func (q *Query) matchesAllFields(s *Store, key []byte, value reflect.Value, currentRow interface{}) (bool, error) {
 	if q.IsEmpty() {
 		return true, nil
 	}
 
 	for field, criteria := range q.fieldCriteria {
-		if field == q.index && !q.badIndex {
+		if field == q.index && !q.badIndex && !q.recheckIndex {
 			// already handled by index Iterator
 			continue
 		}
 
 		if field == Key {
-			ok, err := matchesAllCriteria(s, criteria, key, true, currentRow)
+			ok, err := matchesAllCriteria(s, criteria, key, s.decodeKey, currentRow)
 			if err != nil {
 				return false, err
 			}
@@ -249,7 +327,7 @@ func (q *Query) matchesAllFields(s *Store, key []byte, value reflect.Value, curr
 			return false, err
 		}
 
-		ok, err := matchesAllCriteria(s, criteria, fVal, false, currentRow)
+		ok, err := matchesAllCriteria(s, criteria, fVal, nil, currentRow)
 		if err != nil {
 			return false, err
 		}
@@ -261,6 +339,32 @@ func (q *Query) matchesAllFields(s *Store, key []byte, value reflect.Value, curr
 	return true, nil
 }
 
+// comparesFields returns true if any of the criteria compare against another field of the record
+func comparesFields(criteria []*Criterion) bool {
+	for _, c := range criteria {
+		if _, ok := c.value.(Field); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// coveredByIndex returns true if all of the query's criteria are answered by the index iterator, so the records
+// themselves don't need to be read to know if they match
+func (q *Query) coveredByIndex() bool {
+	if q.index == Key || q.badIndex || q.recheckIndex {
+		return false
+	}
+
+	for field, criteria := range q.fieldCriteria {
+		if field != q.index || comparesFields(criteria) {
+			return false
+		}
+	}
+
+	return true
+}
+
 func fieldValue(value reflect.Value, field string) (interface{}, error) {
 	current := value
 
@@ -329,6 +433,15 @@ func (c *Criterion) Eq(value interface{}) *Query {
 	return c.op(eq, value)
 }
 
+// EqApprox tests if the current field is within epsilon of the passed in float value
+func (c *Criterion) EqApprox(value interface{}, epsilon float64) *Query {
+	if epsilon < 0 {
+		panic("EqApprox epsilon must not be negative")
+	}
+	c.epsilon = epsilon
+	return c.op(eq, value)
+}
+
 // Ne test if the current field is Not Equal to the passed in value
 func (c *Criterion) Ne(value interface{}) *Query {
 	return c.op(ne, value)
@@ -459,10 +572,18 @@ func (c *Criterion) MatchFunc(match interface{}) *Query {
 	return c.op(fn, match)
 }
 
-// test if the criterion passes with the passed in value
-func (c *Criterion) test(s *Store, testValue interface{}, encoded bool, currentRow interface{}) (bool, error) {
+// test if the criterion passes with the passed in value.  If decode is set the value is encoded, and is decoded
+// with it before it is compared
+func (c *Criterion) test(s *Store, testValue interface{}, decode DecodeFunc, currentRow interface{}) (bool, error) {
+	if c.epsilon == 0 && s.floatTolerance != 0 {
+		// apply the store's default float tolerance
+		tc := *c
+		tc.epsilon = s.floatTolerance
+		c = &tc
+	}
+
 	var recordValue interface{}
-	if encoded {
+	if decode != nil {
 		if len(testValue.([]byte)) != 0 {
 			// used with keys
 			if c.operator == in || c.operator == any || c.operator == all {
@@ -471,7 +592,7 @@ func (c *Criterion) test(s *Store, testValue interface{}, encoded bool, currentR
 			} else {
 				recordValue = newElemType(c.value)
 			}
-			err := s.decode(testValue.([]byte), recordValue)
+			err := decode(testValue.([]byte), recordValue)
 			if err != nil {
 				return false, err
 			}
@@ -532,6 +653,10 @@ func (c *Criterion) test(s *Store, testValue interface{}, encoded bool, currentR
 		return false, out[1].Interface().(error)
 	case isnil:
 		return reflect.ValueOf(recordValue).IsNil(), nil
+	case withinRadius, withinBox:
+		return c.testGeo(recordValue)
+	case custom:
+		return c.custom.Match(recordValue, c.value)
 	case contains, any, all:
 		slc := reflect.ValueOf(recordValue)
 		kind := slc.Kind()
@@ -545,7 +670,7 @@ func (c *Criterion) test(s *Store, testValue interface{}, encoded bool, currentR
 
 		if c.operator == contains {
 			for i := 0; i < slc.Len(); i++ {
-				result, err := c.compare(slc.Index(i), c.value, currentRow)
+				result, err := c.compare(slc.Index(i).Interface(), c.value, currentRow)
 				if err != nil {
 					return false, err
 				}
@@ -559,7 +684,7 @@ func (c *Criterion) test(s *Store, testValue interface{}, encoded bool, currentR
 		if c.operator == any {
 			for i := 0; i < slc.Len(); i++ {
 				for k := range c.values {
-					result, err := c.compare(slc.Index(i), c.values[k], currentRow)
+					result, err := c.compare(slc.Index(i).Interface(), c.values[k], currentRow)
 					if err != nil {
 						return false, err
 					}
@@ -576,7 +701,7 @@ func (c *Criterion) test(s *Store, testValue interface{}, encoded bool, currentR
 		for k := range c.values {
 			found := false
 			for i := 0; i < slc.Len(); i++ {
-				result, err := c.compare(slc.Index(i), c.values[k], currentRow)
+				result, err := c.compare(slc.Index(i).Interface(), c.values[k], currentRow)
 				if err != nil {
 					return false, err
 				}
@@ -618,10 +743,10 @@ func (c *Criterion) test(s *Store, testValue interface{}, encoded bool, currentR
 	}
 }
 
-func matchesAllCriteria(s *Store, criteria []*Criterion, value interface{}, encoded bool,
+func matchesAllCriteria(s *Store, criteria []*Criterion, value interface{}, decode DecodeFunc,
 	currentRow interface{}) (bool, error) {
 	for i := range criteria {
-		ok, err := criteria[i].test(s, value, encoded, currentRow)
+		ok, err := criteria[i].test(s, value, decode, currentRow)
 		if err != nil {
 			return false, err
 		}
@@ -678,6 +803,9 @@ func (c *Criterion) String() string {
 	}
 	switch c.operator {
 	case eq:
+		if c.epsilon != 0 {
+			return "== " + fmt.Sprintf("%v (+/- %v)", c.value, c.epsilon)
+		}
 		s += "=="
 	case ne:
 		s += "!="
@@ -703,6 +831,10 @@ func (c *Criterion) String() string {
 		return "contains any of " + fmt.Sprintf("%v", c.values)
 	case all:
 		return "contains all of " + fmt.Sprintf("%v", c.values)
+	case withinRadius, withinBox:
+		s += "within"
+	case custom:
+		s += c.custom.name
 	default:
 		panic("invalid operator")
 	}
@@ -0,0 +1,238 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package bolthold
+
+import (
+	"bytes"
+	"reflect"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Cursor walks the records of a single type in the order of their encoded keys, for traversals queries can't
+// express.  Each move decodes the record it lands on into result, which must be a pointer, and returns ErrNotFound
+// if there's no record in that direction.  Expired and soft deleted records are stepped over, like Get.  Once a
+// move returns ErrNotFound, the cursor has to be positioned again with First, Last or Seek.  A Cursor is only valid
+// for the life of the transaction it was created in
+type Cursor struct {
+	store  *Store
+	storer Storer
+	cursor reversibleCursor
+	key    []byte
+}
+
+// reversibleCursor is a record cursor which can also move backwards, which bolt's cursors and shard cursors both
+// can
+type reversibleCursor interface {
+	recordCursor
+	Last() (key []byte, value []byte)
+	Prev() (key []byte, value []byte)
+}
+
+// TxCursor returns a cursor over the records of dataType in the transaction
+//
+//	c := store.TxCursor(tx, &Item{})
+//	var item Item
+//	for err := c.Last(&item); err == nil; err = c.Prev(&item) {
+//		...
+//	}
+func (s *Store) TxCursor(tx *bolt.Tx, dataType interface{}) *Cursor {
+	return s.cursor(tx, dataType)
+}
+
+// CursorInBucket is the same as TxCursor, except the records are read from the passed in parent bucket
+func (s *Store) CursorInBucket(parent *bolt.Bucket, dataType interface{}) *Cursor {
+	return s.cursor(parent, dataType)
+}
+
+func (s *Store) cursor(source BucketSource, dataType interface{}) *Cursor {
+	c := &Cursor{
+		store:  s,
+		storer: s.newStorer(dataType),
+	}
+
+	if bkt := getRecordBucket(source, c.storer); bkt != nil {
+		c.cursor = bkt.Cursor().(reversibleCursor)
+	}
+	return c
+}
+
+// ForEachKeyPrefix calls fn with each record of dataType whose encoded key starts with the encoded prefix, in key
+// order, seeking straight to the first of them rather than scanning the type.  Each record is a pointer to a new
+// value of dataType.  Prefixes only match hierarchical keys such as "tenant:user:id" when the key encoder stores a
+// prefix of a key as a prefix of the encoded key, which OrderedKeyEncode does for strings and the default gob
+// encoding doesn't
+//
+//	err := store.ForEachKeyPrefix(&User{}, "acme:", func(record interface{}) error {
+//		user := record.(*User)
+//		...
+//	})
+func (s *Store) ForEachKeyPrefix(dataType, prefix interface{}, fn func(record interface{}) error) error {
+	return s.Bolt().View(func(tx *bolt.Tx) error {
+		return s.TxForEachKeyPrefix(tx, dataType, prefix, fn)
+	})
+}
+
+// TxForEachKeyPrefix is the same as ForEachKeyPrefix but you get to specify your transaction
+func (s *Store) TxForEachKeyPrefix(tx *bolt.Tx, dataType, prefix interface{}, fn func(record interface{}) error) error {
+	return s.forEachKeyPrefix(tx, dataType, prefix, fn)
+}
+
+// ForEachKeyPrefixInBucket is the same as ForEachKeyPrefix but you get to specify your parent bucket
+func (s *Store) ForEachKeyPrefixInBucket(parent *bolt.Bucket, dataType, prefix interface{},
+	fn func(record interface{}) error) error {
+	return s.forEachKeyPrefix(parent, dataType, prefix, fn)
+}
+
+func (s *Store) forEachKeyPrefix(source BucketSource, dataType, prefix interface{},
+	fn func(record interface{}) error) error {
+	gk, err := s.encodeKey(prefix)
+	if err != nil {
+		return err
+	}
+
+	c := s.cursor(source, dataType)
+	if c.cursor == nil {
+		return nil
+	}
+
+	tp := reflect.TypeOf(dataType)
+	for tp.Kind() == reflect.Ptr {
+		tp = tp.Elem()
+	}
+
+	record := reflect.New(tp).Interface()
+	k, v := c.cursor.Seek(gk)
+	for err = c.forward(k, v, record); err == nil; err = c.Next(record) {
+		if !bytes.HasPrefix(c.key, gk) {
+			return nil
+		}
+
+		err = fn(record)
+		if err != nil {
+			return err
+		}
+		record = reflect.New(tp).Interface()
+	}
+	if err == ErrNotFound {
+		return nil
+	}
+	return err
+}
+
+// First moves to the record with the smallest key
+func (c *Cursor) First(result interface{}) error {
+	if c.cursor == nil {
+		return ErrNotFound
+	}
+	k, v := c.cursor.First()
+	return c.forward(k, v, result)
+}
+
+// Last moves to the record with the largest key
+func (c *Cursor) Last(result interface{}) error {
+	if c.cursor == nil {
+		return ErrNotFound
+	}
+	k, v := c.cursor.Last()
+	return c.backward(k, v, result)
+}
+
+// Seek moves to the record with the passed in key, or the record after where it would be if there isn't one
+func (c *Cursor) Seek(key, result interface{}) error {
+	if c.cursor == nil {
+		return ErrNotFound
+	}
+	gk, err := c.store.encodeKey(key)
+	if err != nil {
+		return err
+	}
+	k, v := c.cursor.Seek(gk)
+	return c.forward(k, v, result)
+}
+
+// Next moves to the record after the current one
+func (c *Cursor) Next(result interface{}) error {
+	if c.key == nil {
+		return ErrNotFound
+	}
+	k, v := c.cursor.Next()
+	return c.forward(k, v, result)
+}
+
+// Prev moves to the record before the current one
+func (c *Cursor) Prev(result interface{}) error {
+	if c.key == nil {
+		return ErrNotFound
+	}
+	k, v := c.cursor.Prev()
+	return c.backward(k, v, result)
+}
+
+// Key decodes the key of the current record into key, which must be a pointer
+func (c *Cursor) Key(key interface{}) error {
+	if c.key == nil {
+		return ErrNotFound
+	}
+	return c.store.decodeKey(c.key, key)
+}
+
+func (c *Cursor) forward(k, v []byte, result interface{}) error {
+	for ; k != nil; k, v = c.cursor.Next() {
+		found, err := c.decode(k, v, result)
+		if found || err != nil {
+			return err
+		}
+	}
+	c.key = nil
+	return ErrNotFound
+}
+
+func (c *Cursor) backward(k, v []byte, result interface{}) error {
+	for ; k != nil; k, v = c.cursor.Prev() {
+		found, err := c.decode(k, v, result)
+		if found || err != nil {
+			return err
+		}
+	}
+	c.key = nil
+	return ErrNotFound
+}
+
+// decode decodes the record at k into result, and returns false if it should be stepped over
+func (c *Cursor) decode(k, v []byte, result interface{}) (bool, error) {
+	c.key = k
+	if v == nil {
+		// nested bucket
+		return false, nil
+	}
+
+	// decoding into a fresh value, so fields of a skipped record aren't left behind in result
+	val := reflect.New(reflect.TypeOf(result).Elem())
+	err := c.store.decodeRecord(c.storer, v, val.Interface())
+	if err != nil {
+		return false, err
+	}
+
+	if isExpired(c.storer, val.Interface(), time.Now()) || isSoftDeleted(c.storer, val.Interface()) {
+		return false, nil
+	}
+
+	tp := val.Elem().Type()
+	for tp.Kind() == reflect.Ptr {
+		tp = tp.Elem()
+	}
+
+	if field, ok := decodedKeyField(tp); ok {
+		err = c.store.decodeKey(k, reflect.Indirect(val.Elem()).FieldByIndex(field.Index).Addr().Interface())
+		if err != nil {
+			return false, err
+		}
+	}
+
+	reflect.ValueOf(result).Elem().Set(val.Elem())
+	return true, nil
+}
@@ -0,0 +1,151 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package bolthold_test
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/timshannon/bolthold"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestCursor(t *testing.T) {
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		insertTestData(t, store)
+
+		ok(t, store.Bolt().View(func(tx *bolt.Tx) error {
+			var items []ItemTest
+			ok(t, store.TxFind(tx, &items, nil))
+
+			c := store.TxCursor(tx, &ItemTest{})
+			var item ItemTest
+			i := 0
+			for err := c.First(&item); err != bolthold.ErrNotFound; err = c.Next(&item) {
+				ok(t, err)
+				equals(t, items[i].Key, item.Key)
+				equals(t, items[i].Name, item.Name)
+				i++
+			}
+			equals(t, len(items), i)
+			equals(t, bolthold.ErrNotFound, c.Prev(&item))
+
+			i = len(items) - 1
+			for err := c.Last(&item); err != bolthold.ErrNotFound; err = c.Prev(&item) {
+				ok(t, err)
+				equals(t, items[i].Key, item.Key)
+				i--
+			}
+			equals(t, -1, i)
+
+			ok(t, c.Seek(items[3].Key, &item))
+			equals(t, items[3].Key, item.Key)
+			ok(t, c.Prev(&item))
+			equals(t, items[2].Key, item.Key)
+			ok(t, c.Next(&item))
+			equals(t, items[3].Key, item.Key)
+
+			var key int
+			ok(t, c.Key(&key))
+			equals(t, items[3].Key, key)
+
+			equals(t, bolthold.ErrNotFound, store.TxCursor(tx, &Ledger{}).First(&Ledger{}))
+			return nil
+		}))
+	})
+}
+
+func TestCursorSharded(t *testing.T) {
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		for i := 0; i < 40; i++ {
+			ok(t, store.Insert(bolthold.NextSequence(), &Reading{Value: i}))
+		}
+
+		ok(t, store.WithTx(false, func(tx *bolthold.Tx) error {
+			c := tx.Cursor(&Reading{})
+			var reading Reading
+
+			ok(t, c.Seek(uint64(20), &reading))
+			equals(t, uint64(20), reading.ID)
+
+			// changing direction part way through still visits every key in order across the shards
+			for i := uint64(19); i > 10; i-- {
+				ok(t, c.Prev(&reading))
+				equals(t, i, reading.ID)
+			}
+			for i := uint64(12); i <= 40; i++ {
+				ok(t, c.Next(&reading))
+				equals(t, i, reading.ID)
+			}
+			equals(t, bolthold.ErrNotFound, c.Next(&reading))
+
+			ok(t, c.Last(&reading))
+			equals(t, uint64(40), reading.ID)
+			return nil
+		}))
+	})
+}
+
+func TestCursorSkipsDeleted(t *testing.T) {
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		insertNotes(t, store)
+		ok(t, store.Delete(0, &Note{}))
+		ok(t, store.Delete(5, &Note{}))
+
+		snap, err := store.Snapshot()
+		ok(t, err)
+		defer snap.Close()
+
+		c := snap.Cursor(&Note{})
+		var note Note
+		ok(t, c.First(&note))
+		equals(t, 1, note.ID)
+		ok(t, c.Last(&note))
+		equals(t, 4, note.ID)
+	})
+}
+
+type Member struct {
+	ID   string `boltholdKey:"ID"`
+	Name string
+}
+
+func TestForEachKeyPrefix(t *testing.T) {
+	filename := tempfile()
+	store, err := bolthold.Open(filename, 0666, &bolthold.Options{
+		KeyEncoder: bolthold.OrderedKeyEncode,
+		KeyDecoder: bolthold.OrderedKeyDecode,
+	})
+	ok(t, err)
+	defer store.Close()
+	defer os.Remove(filename)
+
+	for _, id := range []string{"acme:alice", "acme:bob", "acmecorp:carol", "globex:dave", "ac:erin"} {
+		ok(t, store.Insert(id, &Member{Name: id}))
+	}
+
+	var ids []string
+	ok(t, store.ForEachKeyPrefix(&Member{}, "acme:", func(record interface{}) error {
+		ids = append(ids, record.(*Member).ID)
+		return nil
+	}))
+	equals(t, []string{"acme:alice", "acme:bob"}, ids)
+
+	ids = nil
+	ok(t, store.ForEachKeyPrefix(&Member{}, "zzz", func(record interface{}) error {
+		ids = append(ids, record.(*Member).ID)
+		return nil
+	}))
+	equals(t, 0, len(ids))
+
+	errStop := fmt.Errorf("stop")
+	calls := 0
+	equals(t, errStop, store.ForEachKeyPrefix(&Member{}, "acme", func(record interface{}) error {
+		calls++
+		return errStop
+	}))
+	equals(t, 1, calls)
+}
@@ -5,13 +5,15 @@
 package bolthold
 
 import (
+	"reflect"
+
 	bolt "go.etcd.io/bbolt"
 )
 
 // Delete deletes a record from the bolthold, datatype just needs to be an example of the type stored so that
 // the proper bucket and indexes are updated
 func (s *Store) Delete(key, dataType interface{}) error {
-	return s.Bolt().Update(func(tx *bolt.Tx) error {
+	return s.updateTx(func(tx *bolt.Tx) error {
 		return s.delete(tx, key, dataType)
 	})
 }
@@ -34,13 +36,19 @@ func (s *Store) DeleteFromBucket(parent *bolt.Bucket, key, dataType interface{})
 
 func (s *Store) delete(source BucketSource, key, dataType interface{}) error {
 	storer := s.newStorer(dataType)
-	gk, err := s.encode(key)
+
+	err := checkMutable(storer, dataType, "delete")
+	if err != nil {
+		return err
+	}
+
+	gk, err := s.encodeKey(key)
 
 	if err != nil {
 		return err
 	}
 
-	b := source.Bucket([]byte(storer.Type()))
+	b := getRecordBucket(source, storer)
 	if b == nil {
 		return ErrNotFound
 	}
@@ -52,35 +60,164 @@ func (s *Store) delete(source BucketSource, key, dataType interface{}) error {
 		return ErrNotFound
 	}
 
-	err = s.decode(bVal, value)
+	err = s.decodeRecord(storer, bVal, value)
 	if err != nil {
 		return err
 	}
 
-	// delete data
-	err = b.Delete(gk)
+	if hasSoftDelete(storer) {
+		if isSoftDeleted(storer, value) {
+			return ErrNotFound
+		}
+		return s.softDelete(source, storer, b, gk, value)
+	}
+
+	return s.deleteRecord(source, storer, b, gk, value)
+}
 
+// deleteRecord removes the record and its index entries
+func (s *Store) deleteRecord(source BucketSource, storer Storer, b *recordBucket, key []byte,
+	value interface{}) error {
+	s.writes.record(false, key, nil)
+	s.changes.add(storer, key, true)
+	err := b.Delete(key)
 	if err != nil {
 		return err
 	}
 
 	// remove any indexes
-	return s.deleteIndexes(storer, source, gk, value)
+	return s.deleteIndexes(storer, source, key, value)
+}
+
+// DeleteKeys deletes the records with each of the passed in keys in a single transaction.  If any of the keys don't
+// exist it fails with ErrNotFound, and none of the records are deleted
+func (s *Store) DeleteKeys(dataType interface{}, keys ...interface{}) error {
+	return s.updateTx(func(tx *bolt.Tx) error {
+		return s.TxDeleteKeys(tx, dataType, keys...)
+	})
+}
+
+// TxDeleteKeys is the same as DeleteKeys except it allows you specify your own transaction.  The records are
+// deleted in the order they're passed in, and it stops at the first key that doesn't exist, so records before it
+// are still deleted in tx unless the caller rolls tx back
+func (s *Store) TxDeleteKeys(tx *bolt.Tx, dataType interface{}, keys ...interface{}) error {
+	if !tx.Writable() {
+		return bolt.ErrTxNotWritable
+	}
+
+	for i := range keys {
+		err := s.delete(tx, keys[i], dataType)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Pop gets the record with the passed in key into result, and deletes it in the same transaction, so no other
+// caller can get the same record.  If the key doesn't exist it fails with ErrNotFound
+func (s *Store) Pop(key, result interface{}) error {
+	return s.updateTx(func(tx *bolt.Tx) error {
+		return s.pop(tx, key, result)
+	})
+}
+
+// TxPop is the same as Pop except it allows you specify your own transaction
+func (s *Store) TxPop(tx *bolt.Tx, key, result interface{}) error {
+	if !tx.Writable() {
+		return bolt.ErrTxNotWritable
+	}
+	return s.pop(tx, key, result)
+}
+
+// PopFromBucket allows you to specify the parent bucket to pop from
+func (s *Store) PopFromBucket(parent *bolt.Bucket, key, result interface{}) error {
+	if !parent.Tx().Writable() {
+		return bolt.ErrTxNotWritable
+	}
+	return s.pop(parent, key, result)
+}
+
+func (s *Store) pop(source BucketSource, key, result interface{}) error {
+	err := checkMutable(s.newStorer(result), result, "delete")
+	if err != nil {
+		return err
+	}
+
+	err = s.get(source, key, result)
+	if err != nil {
+		return err
+	}
+
+	return s.delete(source, key, result)
 }
 
 // DeleteMatching deletes all of the records that match the passed in query
 func (s *Store) DeleteMatching(dataType interface{}, query *Query) error {
-	return s.Bolt().Update(func(tx *bolt.Tx) error {
+	return s.updateTx(func(tx *bolt.Tx) error {
 		return s.TxDeleteMatching(tx, dataType, query)
 	})
 }
 
 // TxDeleteMatching does the same as DeleteMatching, but allows you to specify your own transaction
 func (s *Store) TxDeleteMatching(tx *bolt.Tx, dataType interface{}, query *Query) error {
-	return s.deleteQuery(tx, dataType, query)
+	_, err := s.deleteQuery(tx, dataType, query)
+	return err
 }
 
 // DeleteMatchingFromBucket does the same as DeleteMatching, but allows you to specify your own parent bucket
 func (s *Store) DeleteMatchingFromBucket(parent *bolt.Bucket, dataType interface{}, query *Query) error {
-	return s.deleteQuery(parent, dataType, query)
+	_, err := s.deleteQuery(parent, dataType, query)
+	return err
+}
+
+// DeleteMatchingCount does the same as DeleteMatching, and returns the number of records deleted
+func (s *Store) DeleteMatchingCount(dataType interface{}, query *Query) (int, error) {
+	count := 0
+	err := s.updateTx(func(tx *bolt.Tx) error {
+		var err error
+		count, err = s.TxDeleteMatchingCount(tx, dataType, query)
+		return err
+	})
+	return count, err
+}
+
+// TxDeleteMatchingCount does the same as DeleteMatchingCount, but allows you to specify your own transaction
+func (s *Store) TxDeleteMatchingCount(tx *bolt.Tx, dataType interface{}, query *Query) (int, error) {
+	keys, err := s.deleteQuery(tx, dataType, query)
+	return len(keys), err
+}
+
+// DeleteMatchingKeys does the same as DeleteMatching, and appends the keys of the deleted records to keys, which
+// must be a pointer to a slice of the key type
+func (s *Store) DeleteMatchingKeys(dataType interface{}, query *Query, keys interface{}) error {
+	return s.updateTx(func(tx *bolt.Tx) error {
+		return s.TxDeleteMatchingKeys(tx, dataType, query, keys)
+	})
+}
+
+// TxDeleteMatchingKeys does the same as DeleteMatchingKeys, but allows you to specify your own transaction
+func (s *Store) TxDeleteMatchingKeys(tx *bolt.Tx, dataType interface{}, query *Query, keys interface{}) error {
+	keysVal := reflect.ValueOf(keys)
+	if keysVal.Kind() != reflect.Ptr || keysVal.Elem().Kind() != reflect.Slice {
+		panic("keys argument must be a slice address")
+	}
+
+	deleted, err := s.deleteQuery(tx, dataType, query)
+	if err != nil {
+		return err
+	}
+
+	sliceVal := keysVal.Elem()
+	for i := range deleted {
+		key := reflect.New(sliceVal.Type().Elem())
+		err = s.decodeKey(deleted[i], key.Interface())
+		if err != nil {
+			return err
+		}
+		sliceVal = reflect.Append(sliceVal, key.Elem())
+	}
+	keysVal.Elem().Set(sliceVal)
+
+	return nil
 }
@@ -6,6 +6,8 @@ package bolthold_test
 
 import (
 	"errors"
+	"sort"
+	"sync"
 	"testing"
 	"time"
 
@@ -93,6 +95,106 @@ func TestDeleteMatching(t *testing.T) {
 	}
 }
 
+func TestDeleteMatchingCount(t *testing.T) {
+	for _, tst := range testResults {
+		t.Run(tst.name, func(t *testing.T) {
+			testWrap(t, func(store *bolthold.Store, t *testing.T) {
+				insertTestData(t, store)
+
+				count, err := store.DeleteMatchingCount(&ItemTest{}, tst.query)
+				ok(t, err)
+				equals(t, len(tst.result), count)
+
+				remaining, err := store.Count(&ItemTest{}, nil)
+				ok(t, err)
+				equals(t, len(testData)-len(tst.result), remaining)
+			})
+		})
+	}
+}
+
+func TestDeleteMatchingKeys(t *testing.T) {
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		insertTestData(t, store)
+
+		var keys []int
+		ok(t, store.DeleteMatchingKeys(&ItemTest{}, bh.Where("Category").Eq("animal").Index("Category"), &keys))
+
+		var expected []int
+		for i := range testData {
+			if testData[i].Category == "animal" {
+				expected = append(expected, testData[i].Key)
+			}
+		}
+		sort.Ints(keys)
+		equals(t, expected, keys)
+
+		count, err := store.DeleteMatchingCount(&ItemTest{}, bh.Where("Category").Eq("animal"))
+		ok(t, err)
+		equals(t, 0, count)
+	})
+}
+
+func TestDeleteKeys(t *testing.T) {
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		insertTestData(t, store)
+
+		ok(t, store.DeleteKeys(&ItemTest{}, testData[0].Key, testData[1].Key, testData[2].Key))
+
+		count, err := store.Count(&ItemTest{}, nil)
+		ok(t, err)
+		equals(t, len(testData)-3, count)
+
+		var result []ItemTest
+		ok(t, store.Find(&result, bh.Where("Category").Eq(testData[0].Category).Index("Category")))
+		for i := range result {
+			assert(t, result[i].Key != testData[0].Key, "Deleted record is still in the index")
+		}
+
+		// a missing key fails the whole delete
+		equals(t, bolthold.ErrNotFound, store.DeleteKeys(&ItemTest{}, testData[3].Key, testData[0].Key))
+		ok(t, store.Get(testData[3].Key, &ItemTest{}))
+	})
+}
+
+func TestPop(t *testing.T) {
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		insertTestData(t, store)
+
+		var result ItemTest
+		ok(t, store.Pop(testData[0].Key, &result))
+		assert(t, result.equal(&testData[0]), "Wanted %v, got %v", testData[0], result)
+
+		equals(t, bolthold.ErrNotFound, store.Get(testData[0].Key, &ItemTest{}))
+		equals(t, bolthold.ErrNotFound, store.Pop(testData[0].Key, &result))
+
+		var found []ItemTest
+		ok(t, store.Find(&found, bh.Where("Category").Eq(testData[0].Category).Index("Category")))
+		for i := range found {
+			assert(t, found[i].ID != testData[0].ID, "Popped record is still in the index")
+		}
+
+		// only one of the callers gets the record
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		popped := 0
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				var r ItemTest
+				if store.Pop(testData[1].Key, &r) == nil {
+					mu.Lock()
+					popped++
+					mu.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+		equals(t, 1, popped)
+	})
+}
+
 func TestDeleteOnUnknownType(t *testing.T) {
 	testWrap(t, func(store *bolthold.Store, t *testing.T) {
 		insertTestData(t, store)
@@ -198,3 +300,19 @@ func TestDeleteEOFIssue116(t *testing.T) {
 		}
 	})
 }
+
+func TestImmutableDelete(t *testing.T) {
+	testWrap(t, func(store *bh.Store, t *testing.T) {
+		ok(t, store.Insert(uint64(1), &AuditEvent{Message: "created"}))
+
+		_, isImmutable := store.Delete(uint64(1), AuditEvent{}).(*bh.ErrImmutable)
+		assert(t, isImmutable, "Delete did not return ErrImmutable")
+
+		_, isImmutable = store.DeleteMatching(AuditEvent{}, nil).(*bh.ErrImmutable)
+		assert(t, isImmutable, "DeleteMatching did not return ErrImmutable")
+
+		count, err := store.Count(AuditEvent{}, nil)
+		ok(t, err)
+		equals(t, 1, count)
+	})
+}
@@ -0,0 +1,229 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package bolthold
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// describeSubsystem is the metadata bucket the descriptions of types are kept in
+const describeSubsystem = "describe"
+
+// TypeDescription is a machine readable description of a stored type, so that tools can make sense of a bolthold
+// file without the Go types that wrote it
+type TypeDescription struct {
+	Type  string `json:"type"`
+	Count int    `json:"count"`
+	// KeyType is the Go type of the type's keys, if it has a key field, and KeyFields are the fields the key is
+	// stored in, which is more than one for composite keys
+	KeyType   string             `json:"keyType,omitempty"`
+	KeyFields []string           `json:"keyFields,omitempty"`
+	Fields    []FieldDescription `json:"fields,omitempty"`
+	Indexes   []IndexDescription `json:"indexes,omitempty"`
+}
+
+// FieldDescription describes a field of a stored type, by its path from the type, such as Address.Street
+type FieldDescription struct {
+	Path string `json:"path"`
+	Type string `json:"type"`
+}
+
+// IndexDescription describes an index of a stored type, and the fields it indexes
+type IndexDescription struct {
+	Name    string   `json:"name"`
+	Fields  []string `json:"fields,omitempty"`
+	Unique  bool     `json:"unique,omitempty"`
+	Slice   bool     `json:"slice,omitempty"`
+	Geo     bool     `json:"geo,omitempty"`
+	Entries int      `json:"entries"`
+}
+
+// Describe returns a description of every type stored in the bolthold, sorted by type name.  The types passed in are
+// described from their fields and indexes, and, unless the store is read only, their descriptions are kept in the
+// store, so that types which aren't passed in, such as when Describe is called by a tool without the Go types, are
+// described as they were when they were last passed in.  Types that have never been passed in are described only by
+// their counts and index names
+func (s *Store) Describe(dataTypes ...interface{}) ([]TypeDescription, error) {
+	described := make(map[string]TypeDescription)
+	for _, dataType := range dataTypes {
+		description := s.describeType(dataType)
+		described[description.Type] = description
+	}
+
+	if len(described) > 0 && !s.Bolt().IsReadOnly() {
+		err := s.updateTx(func(tx *bolt.Tx) error {
+			meta, err := createMetaBucket(tx, describeSubsystem)
+			if err != nil {
+				return err
+			}
+			for typeName, description := range described {
+				value, err := json.Marshal(description)
+				if err != nil {
+					return err
+				}
+				err = meta.Put([]byte(typeName), value)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	stored, err := s.Buckets()
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.Bolt().View(func(tx *bolt.Tx) error {
+		meta := metaBucket(tx, describeSubsystem)
+		for _, info := range stored {
+			description, ok := described[info.Type]
+			if !ok {
+				description = TypeDescription{Type: info.Type}
+				if meta != nil {
+					if value := meta.Get([]byte(info.Type)); value != nil {
+						err := json.Unmarshal(value, &description)
+						if err != nil {
+							return err
+						}
+					}
+				}
+			}
+
+			description.Count = info.Count
+			for _, index := range info.Indexes {
+				i := sort.Search(len(description.Indexes), func(i int) bool {
+					return description.Indexes[i].Name >= index.Name
+				})
+				if i == len(description.Indexes) || description.Indexes[i].Name != index.Name {
+					description.Indexes = append(description.Indexes, IndexDescription{})
+					copy(description.Indexes[i+1:], description.Indexes[i:])
+					description.Indexes[i] = IndexDescription{Name: index.Name}
+				}
+				description.Indexes[i].Entries = index.Entries
+			}
+			described[info.Type] = description
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	descriptions := make([]TypeDescription, 0, len(described))
+	for _, description := range described {
+		descriptions = append(descriptions, description)
+	}
+	sort.Slice(descriptions, func(i, j int) bool {
+		return descriptions[i].Type < descriptions[j].Type
+	})
+	return descriptions, nil
+}
+
+// describeType describes the type from its fields and indexes, with no counts
+func (s *Store) describeType(dataType interface{}) TypeDescription {
+	storer := s.newStorer(dataType)
+	tp := reflect.TypeOf(dataType)
+	for tp.Kind() == reflect.Ptr {
+		tp = tp.Elem()
+	}
+
+	description := TypeDescription{
+		Type:   storer.Type(),
+		Fields: typeFields(tp),
+	}
+
+	if keyType, ok := keyType(dataType); ok {
+		description.KeyType = keyType.String()
+	}
+	if fields := compositeKeyFields(tp); fields != nil {
+		for _, i := range fields {
+			description.KeyFields = append(description.KeyFields, tp.Field(i).Name)
+		}
+	} else if field, ok := decodedKeyField(tp); ok {
+		description.KeyFields = []string{field.Name}
+	}
+
+	indexes := make(map[string]*IndexDescription)
+	for name := range storer.Indexes() {
+		indexes[name] = &IndexDescription{Name: name}
+	}
+	for name := range storer.SliceIndexes() {
+		indexes[name] = &IndexDescription{Name: name, Slice: true}
+	}
+	if unique, ok := storer.(UniqueIndexer); ok {
+		for _, name := range unique.UniqueIndexes() {
+			if index, ok := indexes[name]; ok {
+				index.Unique = true
+			}
+		}
+	}
+	indexFields(tp, indexes)
+
+	for _, index := range indexes {
+		description.Indexes = append(description.Indexes, *index)
+	}
+	sort.Slice(description.Indexes, func(i, j int) bool {
+		return description.Indexes[i].Name < description.Indexes[j].Name
+	})
+	return description
+}
+
+// indexFields fills in the fields of the indexes defined by struct tags on the type, including those of embedded
+// structs, whose fields are indexed as if they were the type's own
+func indexFields(tp reflect.Type, indexes map[string]*IndexDescription) {
+	addField := func(name string, field reflect.StructField) *IndexDescription {
+		if name == "" {
+			name = field.Name
+		}
+		index, ok := indexes[name]
+		if !ok {
+			return &IndexDescription{}
+		}
+		index.Fields = append(index.Fields, field.Name)
+		return index
+	}
+
+	for i := 0; i < tp.NumField(); i++ {
+		field := tp.Field(i)
+		if isTransient(field) {
+			continue
+		}
+		if field.Anonymous {
+			anonType := field.Type
+			if anonType.Kind() == reflect.Ptr {
+				anonType = anonType.Elem()
+			}
+			if anonType.Kind() == reflect.Struct {
+				indexFields(anonType, indexes)
+			}
+			continue
+		}
+
+		if name, ok := field.Tag.Lookup(BoltholdIndexTag); ok {
+			addField(name, field)
+		}
+		if name, ok := field.Tag.Lookup(BoltholdSliceIndexTag); ok {
+			addField(name, field)
+		}
+		if name, ok := field.Tag.Lookup(BoltholdGeoIndexTag); ok {
+			addField(name, field).Geo = true
+		}
+		if name, ok := field.Tag.Lookup(BoltholdUniqueTag); ok {
+			addField(name, field).Unique = true
+		}
+		if _, ok := field.Tag.Lookup(BoltholdExpireTag); ok {
+			addField(expireIndexName, field)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package bolthold_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/timshannon/bolthold"
+)
+
+type Listing struct {
+	ID       uint64   `boltholdKey:"ID"`
+	Title    string   `boltholdIndex:"Title"`
+	SKU      string   `boltholdUnique:""`
+	Tags     []string `boltholdIndex:"Tags"`
+	Location bolthold.GeoPoint
+	Seller   Address
+	private  int
+}
+
+func TestDescribe(t *testing.T) {
+	filename := tempfile()
+	defer os.Remove(filename)
+
+	store, err := bolthold.Open(filename, 0666, nil)
+	ok(t, err)
+	ok(t, store.Insert(bolthold.NextSequence(), &Listing{Title: "lamp", SKU: "l-1", Tags: []string{"home", "light"}}))
+	ok(t, store.Insert(bolthold.NextSequence(), &Listing{Title: "desk", SKU: "d-1", Tags: []string{"home"}}))
+	ok(t, store.Insert("a", &ItemTest{Name: "a"}))
+
+	expected := []bolthold.TypeDescription{
+		{
+			Type:  "ItemTest",
+			Count: 1,
+			Indexes: []bolthold.IndexDescription{
+				{Name: "Category", Entries: 1},
+				{Name: "UpdateIndex", Entries: 1},
+			},
+		},
+		{
+			Type:      "Listing",
+			Count:     2,
+			KeyType:   "uint64",
+			KeyFields: []string{"ID"},
+			Fields: []bolthold.FieldDescription{
+				{Path: "ID", Type: "uint64"},
+				{Path: "Title", Type: "string"},
+				{Path: "SKU", Type: "string"},
+				{Path: "Tags", Type: "[]string"},
+				{Path: "Location", Type: "bolthold.GeoPoint"},
+				{Path: "Location.Lat", Type: "float64"},
+				{Path: "Location.Lon", Type: "float64"},
+				{Path: "Seller", Type: "bolthold_test.Address"},
+				{Path: "Seller.Street", Type: "string"},
+				{Path: "Seller.City", Type: "string"},
+			},
+			Indexes: []bolthold.IndexDescription{
+				{Name: "SKU", Fields: []string{"SKU"}, Unique: true, Entries: 2},
+				{Name: "Tags", Fields: []string{"Tags"}, Slice: true, Entries: 2},
+				{Name: "Title", Fields: []string{"Title"}, Entries: 2},
+			},
+		},
+	}
+
+	descriptions, err := store.Describe(&Listing{})
+	ok(t, err)
+	equals(t, expected, descriptions)
+	ok(t, store.Close())
+
+	// without the Go type the description kept in the store is used
+	store, err = bolthold.Open(filename, 0666, nil)
+	ok(t, err)
+	defer store.Close()
+	descriptions, err = store.Describe()
+	ok(t, err)
+	equals(t, expected, descriptions)
+}
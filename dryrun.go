@@ -0,0 +1,97 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package bolthold
+
+import (
+	"errors"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// dryRunSample is how many of the records a dry run would change are returned in DryRun.Sample
+const dryRunSample = 10
+
+// errDryRun rolls back the transaction of a dry run
+var errDryRun = errors.New("dry run")
+
+// DryRun reports what a write would change, without changing anything
+type DryRun struct {
+	Written int // the number of records which would be inserted or updated
+	Deleted int // the number of records which would be deleted, or soft deleted
+	// Sample is the first of the records which would be changed, in the order they would be changed
+	Sample []Change
+}
+
+// DryRunUpdateMatching reports the records UpdateMatching would update, without updating them.  The updates are
+// made in a write transaction which is rolled back, so, like UpdateMatching, it waits for other writes, and update
+// is called for each record
+func (s *Store) DryRunUpdateMatching(dataType interface{}, query *Query,
+	update func(record interface{}) error) (DryRun, error) {
+	return s.dryRun(func(tx *bolt.Tx) error {
+		return s.updateQuery(tx, dataType, query, update)
+	})
+}
+
+// DryRunDeleteMatching reports the records DeleteMatching would delete, without deleting them
+func (s *Store) DryRunDeleteMatching(dataType interface{}, query *Query) (DryRun, error) {
+	return s.dryRun(func(tx *bolt.Tx) error {
+		_, err := s.deleteQuery(tx, dataType, query)
+		return err
+	})
+}
+
+// DryRunSchemaMigrations reports the records RunSchemaMigrations would rewrite, without rewriting them.  Unlike
+// RunSchemaMigrations, every migration is run in a single transaction, which is rolled back
+func (s *Store) DryRunSchemaMigrations() (DryRun, error) {
+	return s.dryRun(func(tx *bolt.Tx) error {
+		for _, schema := range s.schemas {
+			storer := s.newStorer(schema.Type)
+			for _, migration := range schema.Migrations {
+				for finished := false; !finished; {
+					var err error
+					_, finished, err = s.schemaChunk(tx, storer, schema.Type, migration)
+					if err != nil {
+						return err
+					}
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// dryRun runs fn in a write transaction, logging the records it changes, and rolls it back.  Commit hooks aren't
+// run, as nothing is committed
+func (s *Store) dryRun(fn func(tx *bolt.Tx) error) (DryRun, error) {
+	log := &changeLog{index: make(map[string]int)}
+	err := s.Bolt().Update(func(tx *bolt.Tx) error {
+		s.changes = log
+		defer func() {
+			s.changes = nil
+		}()
+
+		err := fn(tx)
+		if err != nil {
+			return err
+		}
+		return errDryRun
+	})
+	if err != errDryRun {
+		return DryRun{}, err
+	}
+
+	var result DryRun
+	for _, change := range log.changes {
+		if change.Deleted {
+			result.Deleted++
+		} else {
+			result.Written++
+		}
+		if len(result.Sample) < dryRunSample {
+			result.Sample = append(result.Sample, change)
+		}
+	}
+	return result, nil
+}
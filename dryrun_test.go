@@ -0,0 +1,71 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package bolthold_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/timshannon/bolthold"
+)
+
+func TestDryRun(t *testing.T) {
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		insertTestData(t, store)
+
+		committed := 0
+		store.OnPostCommit(func(changes []bolthold.Change) {
+			committed++
+		})
+
+		query := bolthold.Where("Category").Eq("vehicle").Index("Category")
+		vehicles, err := store.Count(&ItemTest{}, query)
+		ok(t, err)
+
+		report, err := store.DryRunUpdateMatching(&ItemTest{}, query, func(record interface{}) error {
+			record.(*ItemTest).Category = "car"
+			return nil
+		})
+		ok(t, err)
+		equals(t, vehicles, report.Written)
+		equals(t, 0, report.Deleted)
+		equals(t, vehicles, len(report.Sample))
+		equals(t, "ItemTest", report.Sample[0].Type)
+
+		count, err := store.Count(&ItemTest{}, query)
+		ok(t, err)
+		equals(t, vehicles, count)
+
+		report, err = store.DryRunDeleteMatching(&ItemTest{}, nil)
+		ok(t, err)
+		equals(t, 0, report.Written)
+		equals(t, len(testData), report.Deleted)
+		equals(t, 10, len(report.Sample))
+
+		count, err = store.Count(&ItemTest{}, nil)
+		ok(t, err)
+		equals(t, len(testData), count)
+		equals(t, 0, committed)
+
+		ok(t, store.RegisterSchemaMigrations(&ItemTest{}, bolthold.SchemaMigration{
+			Version: 1,
+			Migrate: func(record interface{}) error {
+				item := record.(*ItemTest)
+				item.Name = strings.ToUpper(item.Name)
+				return nil
+			},
+		}))
+		report, err = store.DryRunSchemaMigrations()
+		ok(t, err)
+		equals(t, len(testData), report.Written)
+
+		version, err := store.SchemaVersion(&ItemTest{})
+		ok(t, err)
+		equals(t, uint64(0), version)
+		count, err = store.Count(&ItemTest{}, bolthold.Where("Name").Eq("CAR"))
+		ok(t, err)
+		equals(t, 0, count)
+	})
+}
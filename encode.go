@@ -7,6 +7,8 @@ package bolthold
 import (
 	"bytes"
 	"encoding/gob"
+	"fmt"
+	"reflect"
 )
 
 // EncodeFunc is a function for encoding a value into bytes
@@ -15,6 +17,107 @@ type EncodeFunc func(value interface{}) ([]byte, error)
 // DecodeFunc is a function for decoding a value from bytes
 type DecodeFunc func(data []byte, value interface{}) error
 
+// Codec is a pair of encoding and decoding funcs used for the records of a single type
+type Codec struct {
+	Encoder EncodeFunc
+	Decoder DecodeFunc
+}
+
+// TypeCodec can be implemented by a Storer to store its records with a different encoding than the rest of the
+// store, for instance protobuf for one message type and gob for everything else.  Keys and index values are always
+// encoded with the store's encoders, so they sort and compare the same way for every type.  A nil Encoder or Decoder
+// falls back to the store's
+type TypeCodec interface {
+	Codec() Codec
+}
+
+// Marshaler is implemented by types that encode themselves, such as Protocol Buffers messages generated by gogo
+// protobuf or golang/protobuf v1
+type Marshaler interface {
+	Marshal() ([]byte, error)
+}
+
+// Unmarshaler is implemented by types that decode themselves
+type Unmarshaler interface {
+	Unmarshal(data []byte) error
+}
+
+// MarshalerCodec stores the records of a type in the format of its own Marshal and Unmarshal methods, for
+// instance the Protocol Buffers wire format, which other services can read without knowing about gob.
+//
+//	store.RegisterCodec(&pb.Event{}, bolthold.MarshalerCodec)
+var MarshalerCodec = Codec{
+	Encoder: MarshalerEncode,
+	Decoder: MarshalerDecode,
+}
+
+// MarshalerEncode encodes a value that implements Marshaler
+func MarshalerEncode(value interface{}) ([]byte, error) {
+	m, ok := value.(Marshaler)
+	if !ok {
+		// Marshal is usually defined on the pointer
+		ptr := reflect.New(reflect.TypeOf(value))
+		ptr.Elem().Set(reflect.ValueOf(value))
+		m, ok = ptr.Interface().(Marshaler)
+	}
+	if !ok {
+		return nil, fmt.Errorf("%T does not implement Marshal() ([]byte, error)", value)
+	}
+	return m.Marshal()
+}
+
+// MarshalerDecode decodes data into a value that implements Unmarshaler
+func MarshalerDecode(data []byte, value interface{}) error {
+	u, ok := value.(Unmarshaler)
+	if !ok {
+		return fmt.Errorf("%T does not implement Unmarshal([]byte) error", value)
+	}
+	return u.Unmarshal(data)
+}
+
+// encodeRecord encodes a record's value with the codec of its type, if it has one, adds the type's version, and
+// compresses it if the store has a Compressor
+func (s *Store) encodeRecord(storer Storer, value interface{}) ([]byte, error) {
+	encode := s.encode
+	if tc, ok := storer.(TypeCodec); ok {
+		if codec := tc.Codec(); codec.Encoder != nil {
+			encode = codec.Encoder
+		}
+	}
+
+	data, err := encode(withoutTransient(storer, value))
+	if err != nil {
+		return nil, err
+	}
+	return s.compress(addVersion(storer, data))
+}
+
+// decodeRecord decodes a record's value with the codec of its type, if it has one, migrating it if it was written
+// with an older version of the type
+func (s *Store) decodeRecord(storer Storer, data []byte, value interface{}) error {
+	data, err := s.decompress(data)
+	if err != nil {
+		return err
+	}
+
+	version, data := splitVersion(data)
+	if migrated, err := migrateRecord(storer, version, data, value); migrated {
+		return err
+	}
+	return s.decodeValue(storer, data, value)
+}
+
+// decodeValue decodes a record, which has already been decompressed and had its version removed, with the type's
+// codec if it has one
+func (s *Store) decodeValue(storer Storer, data []byte, value interface{}) error {
+	if tc, ok := storer.(TypeCodec); ok {
+		if codec := tc.Codec(); codec.Decoder != nil {
+			return codec.Decoder(data, value)
+		}
+	}
+	return s.decode(data, value)
+}
+
 // DefaultEncode is the default encoding func for bolthold (Gob)
 func DefaultEncode(value interface{}) ([]byte, error) {
 	var buff bytes.Buffer
@@ -0,0 +1,141 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package bolthold
+
+import (
+	"bytes"
+	"encoding/binary"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// BoltholdExpireTag is the struct tag used to set when a record expires.  It must be on a time.Time field.  Expired
+// records are left out of query results, and are deleted when a query in a writable transaction comes across them,
+// or by PurgeExpired.  A zero time never expires
+//
+//	Expires time.Time `boltholdExpire:""`
+const BoltholdExpireTag = "boltholdExpire"
+
+// expireIndexName is the index of the expiry times of a type, stored in time order
+const expireIndexName = "_expires"
+
+// expirer is implemented by storers of types with a boltholdExpire field
+type expirer interface {
+	expireField() string
+}
+
+// encodeExpiry encodes the time so that the encoded times sort in time order
+func encodeExpiry(t time.Time) []byte {
+	key := make([]byte, 8)
+	// flip the sign bit so times before 1970 sort first
+	binary.BigEndian.PutUint64(key, uint64(t.UnixNano())^(1<<63))
+	return key
+}
+
+func expireIndex(field string) Index {
+	return func(name string, value interface{}) ([]byte, error) {
+		expires, _ := findIndexValue(field, value, BoltholdExpireTag).(time.Time)
+		if expires.IsZero() {
+			return nil, nil
+		}
+		return encodeExpiry(expires), nil
+	}
+}
+
+func hasExpiry(storer Storer) bool {
+	e, ok := storer.(expirer)
+	return ok && e.expireField() != ""
+}
+
+// isExpired returns true if the value has expired as of now
+func isExpired(storer Storer, value interface{}, now time.Time) bool {
+	e, ok := storer.(expirer)
+	if !ok || e.expireField() == "" {
+		return false
+	}
+
+	expires, _ := findIndexValue(e.expireField(), value, BoltholdExpireTag).(time.Time)
+	return !expires.IsZero() && !expires.After(now)
+}
+
+// PurgeExpired deletes every record of the type that has expired, and returns how many were deleted.  Expired records
+// are found through a time ordered index, so records which haven't expired aren't read
+func (s *Store) PurgeExpired(dataType interface{}) (int, error) {
+	count := 0
+	err := s.updateTx(func(tx *bolt.Tx) error {
+		var err error
+		count, err = s.TxPurgeExpired(tx, dataType)
+		return err
+	})
+	return count, err
+}
+
+// TxPurgeExpired is the same as PurgeExpired except it allows you to specify your own transaction
+func (s *Store) TxPurgeExpired(tx *bolt.Tx, dataType interface{}) (int, error) {
+	if !tx.Writable() {
+		return 0, bolt.ErrTxNotWritable
+	}
+
+	storer := s.newStorer(dataType)
+
+	iBucket := tx.Bucket(indexBucketName(storer.Type(), expireIndexName))
+	if iBucket == nil {
+		return 0, nil
+	}
+
+	now := encodeExpiry(time.Now())
+
+	var keys [][]byte
+	c := iBucket.Cursor()
+	for k, v := c.First(); k != nil && bytes.Compare(k, now) <= 0; k, v = c.Next() {
+		var entry keyList
+		err := s.decode(v, &entry)
+		if err != nil {
+			return 0, err
+		}
+		keys = append(keys, entry...)
+	}
+
+	return s.deleteExpired(tx, storer, dataType, keys)
+}
+
+// deleteExpired deletes the records with the passed in keys and their index entries, returning the number of records
+// deleted
+func (s *Store) deleteExpired(source BucketSource, storer Storer, dataType interface{}, keys [][]byte) (int, error) {
+	b := getRecordBucket(source, storer)
+	if b == nil {
+		return 0, nil
+	}
+
+	count := 0
+	for i := range keys {
+		v := b.Get(keys[i])
+		if v == nil {
+			continue
+		}
+
+		value := newElemType(dataType)
+		err := s.decodeRecord(storer, v, value)
+		if err != nil {
+			return count, err
+		}
+
+		s.writes.record(false, keys[i], nil)
+		s.changes.add(storer, keys[i], true)
+		err = b.Delete(keys[i])
+		if err != nil {
+			return count, err
+		}
+
+		err = s.deleteIndexes(storer, source, keys[i], value)
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	return count, nil
+}
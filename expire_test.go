@@ -0,0 +1,109 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package bolthold_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/timshannon/bolthold"
+	bolt "go.etcd.io/bbolt"
+)
+
+type Session struct {
+	ID      int
+	User    string    `boltholdIndex:"User"`
+	Expires time.Time `boltholdExpire:""`
+}
+
+func insertSessions(t *testing.T, store *bolthold.Store) {
+	now := time.Now()
+	for i := 0; i < 10; i++ {
+		expires := now.Add(time.Hour)
+		if i%2 == 0 {
+			expires = now.Add(-time.Duration(i+1) * time.Minute)
+		}
+		if i == 9 {
+			expires = time.Time{}
+		}
+		ok(t, store.Insert(i, &Session{ID: i, User: "tim", Expires: expires}))
+	}
+}
+
+func TestExpire(t *testing.T) {
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		insertSessions(t, store)
+
+		var result []Session
+		ok(t, store.Find(&result, nil))
+		equals(t, 5, len(result))
+		for i := range result {
+			equals(t, 1, result[i].ID%2)
+		}
+
+		count, err := store.Count(&Session{}, bolthold.Where("User").Eq("tim").Index("User"))
+		ok(t, err)
+		equals(t, 5, count)
+
+		var session Session
+		equals(t, bolthold.ErrNotFound, store.Get(0, &session))
+		ok(t, store.Get(1, &session))
+
+		// read only queries can't purge expired records
+		ok(t, store.Bolt().View(func(tx *bolt.Tx) error {
+			equals(t, 10, tx.Bucket([]byte("Session")).Stats().KeyN)
+			return nil
+		}))
+
+		ok(t, store.Bolt().Update(func(tx *bolt.Tx) error {
+			var result []Session
+			return store.TxFind(tx, &result, nil)
+		}))
+
+		ok(t, store.Bolt().View(func(tx *bolt.Tx) error {
+			equals(t, 5, tx.Bucket([]byte("Session")).Stats().KeyN)
+			return nil
+		}))
+
+		problems, err := store.CheckIndexes(&Session{}, false)
+		ok(t, err)
+		equals(t, 0, len(problems))
+	})
+}
+
+func TestPurgeExpired(t *testing.T) {
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		insertSessions(t, store)
+
+		count, err := store.PurgeExpired(&Session{})
+		ok(t, err)
+		equals(t, 5, count)
+
+		count, err = store.PurgeExpired(&Session{})
+		ok(t, err)
+		equals(t, 0, count)
+
+		count, err = store.Count(&Session{}, nil)
+		ok(t, err)
+		equals(t, 5, count)
+
+		problems, err := store.CheckIndexes(&Session{}, false)
+		ok(t, err)
+		equals(t, 0, len(problems))
+	})
+}
+
+func TestExpireInvalidField(t *testing.T) {
+	type Invalid struct {
+		Expires int `boltholdExpire:""`
+	}
+
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		defer func() {
+			assert(t, recover() != nil, "No panic on an expire field that isn't a time.Time")
+		}()
+		_ = store.Insert(1, &Invalid{Expires: 1})
+	})
+}
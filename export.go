@@ -0,0 +1,172 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package bolthold
+
+import (
+	"encoding"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// ExportFormat is the format ExportMatching writes records in
+type ExportFormat int
+
+const (
+	// ExportNDJSON writes each record as its own line of JSON, the same as FindNDJSON
+	ExportNDJSON ExportFormat = iota
+	// ExportCSV writes a header row of the exported field names of the type, followed by a row for each record.
+	// Times are written in RFC 3339 format, types that implement encoding.TextMarshaler with their MarshalText method,
+	// and structs, slices and maps as JSON
+	ExportCSV
+)
+
+// ExportMatching writes the records that match the query to w in the passed in format.  Records are written as they
+// are read, without collecting them into a slice first, unless the query is sorted
+//
+//	err := store.ExportMatching(w, &Item{}, bolthold.Where("Category").Eq("tools"), bolthold.ExportCSV)
+func (s *Store) ExportMatching(w io.Writer, dataType interface{}, query *Query, format ExportFormat) error {
+	return s.Bolt().View(func(tx *bolt.Tx) error {
+		return s.TxExportMatching(tx, w, dataType, query, format)
+	})
+}
+
+// TxExportMatching is the same as ExportMatching but you get to specify your transaction
+func (s *Store) TxExportMatching(tx *bolt.Tx, w io.Writer, dataType interface{}, query *Query,
+	format ExportFormat) error {
+	return s.exportMatching(tx, w, dataType, query, format)
+}
+
+// ExportMatchingInBucket is the same as ExportMatching but you get to specify your parent bucket
+func (s *Store) ExportMatchingInBucket(parent *bolt.Bucket, w io.Writer, dataType interface{}, query *Query,
+	format ExportFormat) error {
+	return s.exportMatching(parent, w, dataType, query, format)
+}
+
+func (s *Store) exportMatching(source BucketSource, w io.Writer, dataType interface{}, query *Query,
+	format ExportFormat) error {
+	switch format {
+	case ExportNDJSON:
+		return s.findJSON(source, w, dataType, query, true)
+	case ExportCSV:
+		return s.exportCSV(source, w, dataType, query)
+	default:
+		return fmt.Errorf("Unknown export format %d", format)
+	}
+}
+
+func (s *Store) exportCSV(source BucketSource, w io.Writer, dataType interface{}, query *Query) error {
+	tp := reflect.TypeOf(dataType)
+	for tp.Kind() == reflect.Ptr {
+		tp = tp.Elem()
+	}
+
+	var keyField string
+	if field, ok := decodedKeyField(tp); ok {
+		keyField = field.Name
+	}
+
+	var columns []int
+	var header []string
+
+	for i := 0; i < tp.NumField(); i++ {
+		field := tp.Field(i)
+		if field.PkgPath != "" {
+			// unexported
+			continue
+		}
+		columns = append(columns, i)
+		header = append(header, field.Name)
+	}
+
+	dataType = reflect.New(tp).Interface()
+
+	query, err := s.prepQuery(dataType, query)
+	if err != nil {
+		return err
+	}
+
+	writer := csv.NewWriter(w)
+	err = writer.Write(header)
+	if err != nil {
+		return err
+	}
+
+	row := make([]string, len(columns))
+
+	err = s.runQuery(source, dataType, query, nil, query.skip, func(r *record) error {
+		value := r.value.Elem()
+		if keyField != "" {
+			err := s.decodeKey(r.key, value.FieldByName(keyField).Addr().Interface())
+			if err != nil {
+				return err
+			}
+		}
+
+		for i := range columns {
+			var err error
+			row[i], err = csvValue(value.Field(columns[i]))
+			if err != nil {
+				return err
+			}
+		}
+		return writer.Write(row)
+	})
+	if err != nil {
+		return err
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// csvValue returns the text of a single field for a CSV row
+func csvValue(value reflect.Value) (string, error) {
+	for value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return "", nil
+		}
+		value = value.Elem()
+	}
+
+	switch v := value.Interface().(type) {
+	case time.Time:
+		return v.Format(time.RFC3339Nano), nil
+	case encoding.TextMarshaler:
+		text, err := v.MarshalText()
+		return string(text), err
+	}
+
+	if value.CanAddr() {
+		if marshaler, ok := value.Addr().Interface().(encoding.TextMarshaler); ok {
+			text, err := marshaler.MarshalText()
+			return string(text), err
+		}
+	}
+
+	switch value.Kind() {
+	case reflect.String:
+		return value.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(value.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(value.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(value.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(value.Float(), 'g', -1, value.Type().Bits()), nil
+	case reflect.Struct, reflect.Slice, reflect.Array, reflect.Map:
+		data, err := json.Marshal(value.Interface())
+		return string(data), err
+	default:
+		return fmt.Sprint(value.Interface()), nil
+	}
+}
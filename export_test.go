@@ -0,0 +1,11 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package bolthold
+
+// SetBeforeOrsReplay sets a func which is called after the Or'd queries of a query have been run in parallel, and
+// before their records are returned, so tests can write to the store in between
+func (s *Store) SetBeforeOrsReplay(fn func()) {
+	s.beforeOrsReplay = fn
+}
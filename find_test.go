@@ -6,12 +6,15 @@ package bolthold_test
 
 import (
 	"fmt"
+	"os"
 	"regexp"
+	"sort"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/timshannon/bolthold"
+	bolt "go.etcd.io/bbolt"
 )
 
 type ItemTest struct {
@@ -937,14 +940,85 @@ func TestSkipInOr(t *testing.T) {
 
 func TestLimitInOr(t *testing.T) {
 	testWrap(t, func(store *bolthold.Store, t *testing.T) {
-		defer func() {
-			if r := recover(); r == nil {
-				t.Fatalf("Running Find with limit in or query did not panic!")
+		insertTestData(t, store)
+
+		var expected []ItemTest
+		var vehicles []ItemTest
+		for i := range testData {
+			switch testData[i].Category {
+			case "animal":
+				expected = append(expected, testData[i])
+			case "vehicle":
+				vehicles = append(vehicles, testData[i])
 			}
-		}()
+		}
+		sort.Slice(vehicles, func(i, j int) bool { return vehicles[i].ID > vehicles[j].ID })
+		expected = append(expected, vehicles[:2]...)
 
 		var result []ItemTest
-		_ = store.Find(&result, bolthold.Where("Name").Eq("blah").Or(bolthold.Where("Name").Eq("blah").Limit(3)))
+		ok(t, store.Find(&result, bolthold.Where("Category").Eq("animal").
+			Or(bolthold.Where("Category").Eq("vehicle").SortBy("ID").Reverse().Limit(2))))
+
+		equals(t, len(expected), len(result))
+		for i := range expected {
+			equals(t, expected[i].Key, result[i].Key)
+		}
+
+		count, err := store.Count(&ItemTest{}, bolthold.Where("Category").Eq("animal").
+			Or(bolthold.Where("Category").Eq("vehicle").Limit(2)))
+		ok(t, err)
+		equals(t, len(expected), count)
+	})
+}
+
+func TestInBranchOrder(t *testing.T) {
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		insertTestData(t, store)
+
+		query := func() *bolthold.Query {
+			return bolthold.Where("Category").Eq("animal").SortBy("Name").
+				Or(bolthold.Where("Category").Ne("animal").SortBy("ID").Reverse().Limit(3))
+		}
+
+		var result []ItemTest
+		ok(t, store.Find(&result, query().InBranchOrder()))
+
+		animals := 0
+		for i := range testData {
+			if testData[i].Category == "animal" {
+				animals++
+			}
+		}
+		equals(t, animals+3, len(result))
+
+		for i := range result {
+			if i < animals {
+				equals(t, "animal", result[i].Category)
+				if i > 0 {
+					assert(t, result[i-1].Name <= result[i].Name, "Pinned records aren't sorted by name")
+				}
+				continue
+			}
+
+			assert(t, result[i].Category != "animal", "Or'd record returned before the query's own records")
+			if i > animals {
+				assert(t, result[i-1].ID > result[i].ID, "Or'd records aren't sorted by their own SortBy")
+			}
+		}
+
+		// without InBranchOrder the combined records are sorted together
+		result = nil
+		ok(t, store.Find(&result, query()))
+		equals(t, animals+3, len(result))
+		for i := 1; i < len(result); i++ {
+			assert(t, result[i-1].Name <= result[i].Name, "Records aren't sorted by name")
+		}
+
+		// skip and limit apply to the combined results
+		result = nil
+		ok(t, store.Find(&result, query().InBranchOrder().Skip(animals).Limit(1)))
+		equals(t, 1, len(result))
+		assert(t, result[0].Category != "animal", "Skip wasn't applied to the combined results")
 	})
 }
 
@@ -1158,6 +1232,85 @@ func TestCount(t *testing.T) {
 	})
 }
 
+func TestCountIndexOnly(t *testing.T) {
+	decoded := 0
+	filename := tempfile()
+	store, err := bolthold.Open(filename, 0666, &bolthold.Options{
+		Decoder: func(data []byte, value interface{}) error {
+			if _, ok := value.(*ItemTest); ok {
+				decoded++
+			}
+			return bolthold.DefaultDecode(data, value)
+		},
+	})
+	ok(t, err)
+	defer store.Close()
+	defer os.Remove(filename)
+
+	insertTestData(t, store)
+
+	count, err := store.Count(&ItemTest{}, bolthold.Where("Category").Eq("vehicle").Index("Category"))
+	ok(t, err)
+	assert(t, count > 0, "no records counted")
+	equals(t, 0, decoded)
+
+	// criteria on other fields still need the records
+	_, err = store.Count(&ItemTest{}, bolthold.Where("Category").Eq("vehicle").Index("Category").
+		And("Name").Ne("car"))
+	ok(t, err)
+	equals(t, count, decoded)
+}
+
+func TestFindKeys(t *testing.T) {
+	decoded := 0
+	filename := tempfile()
+	store, err := bolthold.Open(filename, 0666, &bolthold.Options{
+		Decoder: func(data []byte, value interface{}) error {
+			if _, ok := value.(*ItemTest); ok {
+				decoded++
+			}
+			return bolthold.DefaultDecode(data, value)
+		},
+	})
+	ok(t, err)
+	defer store.Close()
+	defer os.Remove(filename)
+
+	insertTestData(t, store)
+
+	var records []ItemTest
+	ok(t, store.Find(&records, bolthold.Where("Category").Eq("vehicle").Index("Category")))
+	assert(t, len(records) > 0, "no records found")
+
+	decoded = 0
+	var keys []int
+	ok(t, store.FindKeys(&ItemTest{}, bolthold.Where("Category").Eq("vehicle").Index("Category"), &keys))
+	equals(t, 0, decoded)
+	equals(t, len(records), len(keys))
+	for i := range records {
+		equals(t, records[i].Key, keys[i])
+	}
+
+	// criteria on other fields still need the records
+	keys = nil
+	ok(t, store.FindKeys(&ItemTest{}, bolthold.Where("Category").Eq("vehicle").Index("Category").
+		And("Name").Ne("car"), &keys))
+	equals(t, len(records), decoded)
+	for i := range keys {
+		assert(t, keys[i] != 0, "zero key returned")
+	}
+
+	ok(t, store.Bolt().View(func(tx *bolt.Tx) error {
+		var txKeys []int
+		err := store.TxFindKeys(tx, &ItemTest{}, bolthold.Where(bolthold.Key).Eq(records[0].Key), &txKeys)
+		if err != nil {
+			return err
+		}
+		equals(t, []int{records[0].Key}, txKeys)
+		return nil
+	}))
+}
+
 func TestFindOne(t *testing.T) {
 	testWrap(t, func(store *bolthold.Store, t *testing.T) {
 		insertTestData(t, store)
@@ -1227,3 +1380,90 @@ func Test67SeekCursor(t *testing.T) {
 		equals(t, 0, len(result))
 	})
 }
+
+// countedBlob counts how many times it's decoded
+type countedBlob []byte
+
+var blobDecodes int
+
+func (b countedBlob) GobEncode() ([]byte, error) { return b, nil }
+
+func (b *countedBlob) GobDecode(data []byte) error {
+	blobDecodes++
+	*b = append((*b)[:0], data...)
+	return nil
+}
+
+type Document struct {
+	Title  string
+	Author string
+	Body   countedBlob
+}
+
+func TestPartialDecode(t *testing.T) {
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		for i := 0; i < 20; i++ {
+			ok(t, store.Insert(i, &Document{
+				Title:  fmt.Sprintf("doc %d", i),
+				Author: []string{"ann", "bob"}[i%2],
+				Body:   countedBlob(strings.Repeat("x", 1000)),
+			}))
+		}
+
+		blobDecodes = 0
+		var result []Document
+		ok(t, store.Find(&result, bolthold.Where("Author").Eq("ann").And("Title").Ne("doc 0")))
+		equals(t, 9, len(result))
+		// only the matching records are fully decoded
+		equals(t, 9, blobDecodes)
+		equals(t, 1000, len(result[0].Body))
+
+		// match funcs can read the whole record, so every record is decoded
+		blobDecodes = 0
+		result = nil
+		ok(t, store.Find(&result, bolthold.Where("Author").MatchFunc(func(ra *bolthold.RecordAccess) (bool, error) {
+			return ra.Field() == "bob", nil
+		})))
+		equals(t, 10, len(result))
+		equals(t, 20, blobDecodes)
+	})
+}
+
+func TestFindInChunks(t *testing.T) {
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		insertTestData(t, store)
+
+		var want []ItemTest
+		ok(t, store.Find(&want, nil))
+
+		var got []ItemTest
+		var backing *ItemTest
+		chunks := 0
+		ok(t, store.FindInChunks(&ItemTest{}, nil, 4, func(chunk interface{}) error {
+			items := chunk.([]ItemTest)
+			assert(t, len(items) <= 4, "Chunk is larger than the chunk size")
+			if backing == nil {
+				backing = &items[0]
+			}
+			equals(t, backing, &items[0])
+
+			got = append(got, items...)
+			chunks++
+			return nil
+		}))
+		equals(t, (len(want)+3)/4, chunks)
+		equals(t, len(want), len(got))
+		for i := range want {
+			equals(t, want[i].Key, got[i].Key)
+			equals(t, want[i].Name, got[i].Name)
+		}
+
+		errStop := fmt.Errorf("stop")
+		chunks = 0
+		equals(t, errStop, store.FindInChunks(&ItemTest{}, nil, 2, func(chunk interface{}) error {
+			chunks++
+			return errStop
+		}))
+		equals(t, 1, chunks)
+	})
+}
@@ -145,3 +145,79 @@ func TestForEachKeyStructTagIntoPtr(t *testing.T) {
 		}
 	})
 }
+
+func TestForEachUpdate(t *testing.T) {
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		insertTestData(t, store)
+
+		vehicles, err := store.Count(&ItemTest{}, bolthold.Where("Category").Eq("vehicle"))
+		ok(t, err)
+		assert(t, vehicles > 0, "No records to update")
+
+		keys := 0
+		ok(t, store.ForEachUpdate(bolthold.Where("Category").Eq("vehicle").Index("Category"),
+			func(record *ItemTest) error {
+				if record.Key != 0 {
+					keys++
+				}
+				record.Category = "transport"
+				return nil
+			}))
+		assert(t, keys > 0, "Key struct tag was not set")
+
+		count, err := store.Count(&ItemTest{}, bolthold.Where("Category").Eq("transport").Index("Category"))
+		ok(t, err)
+		equals(t, vehicles, count)
+
+		count, err = store.Count(&ItemTest{}, bolthold.Where("Category").Eq("vehicle").Index("Category"))
+		ok(t, err)
+		equals(t, 0, count)
+
+		equals(t, bolt.ErrTxNotWritable, store.Bolt().View(func(tx *bolt.Tx) error {
+			return store.TxForEachUpdate(tx, nil, func(record *ItemTest) error { return nil })
+		}))
+	})
+}
+
+func TestForEachUpdateChunks(t *testing.T) {
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		type Tally struct {
+			Value int
+		}
+
+		ok(t, store.Bolt().Update(func(tx *bolt.Tx) error {
+			for i := 0; i < 2500; i++ {
+				ok(t, store.TxInsert(tx, bolthold.NextSequence(), &Tally{Value: 1}))
+			}
+			return nil
+		}))
+
+		errStop := fmt.Errorf("stop")
+		calls := 0
+		equals(t, errStop, store.ForEachUpdate(nil, func(record *Tally) error {
+			calls++
+			if calls == 1500 {
+				return errStop
+			}
+			record.Value = 2
+			return nil
+		}))
+
+		// only the chunk that failed is rolled back
+		count, err := store.Count(&Tally{}, bolthold.Where("Value").Eq(2))
+		ok(t, err)
+		equals(t, 1000, count)
+
+		calls = 0
+		ok(t, store.ForEachUpdate(nil, func(record *Tally) error {
+			calls++
+			record.Value = 2
+			return nil
+		}))
+		equals(t, 2500, calls)
+
+		count, err = store.Count(&Tally{}, bolthold.Where("Value").Eq(2))
+		ok(t, err)
+		equals(t, 2500, count)
+	})
+}
@@ -0,0 +1,146 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package bolthold
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// forEachUpdateChunk is how many records ForEachUpdate reads into memory at a time
+const forEachUpdateChunk = 1000
+
+// ForEachUpdate runs fn against every record matching the query in the order of their keys, and writes each record
+// back, along with its indexes, once fn returns.  fn must be a function taking a pointer to the record type and
+// returning an error.  Records are read a chunk at a time, and each chunk is written in its own transaction, so
+// memory use stays the same no matter how many records match, but if fn returns an error, only the chunk it
+// failed in is rolled back.  The query can't have a Skip, Limit or SortBy
+//
+//	err := store.ForEachUpdate(bolthold.Where("Version").Lt(2), func(record *Item) error {
+//		record.Name = strings.TrimSpace(record.Name)
+//		record.Version = 2
+//		return nil
+//	})
+func (s *Store) ForEachUpdate(query *Query, fn interface{}) error {
+	var after []byte
+	for {
+		done := false
+		err := s.updateTx(func(tx *bolt.Tx) error {
+			var txErr error
+			after, done, txErr = s.forEachUpdateChunk(tx, query, fn, after)
+			return txErr
+		})
+		if err != nil || done {
+			return err
+		}
+	}
+}
+
+// TxForEachUpdate is the same as ForEachUpdate, except every chunk is written in your own transaction, which must
+// be writable
+func (s *Store) TxForEachUpdate(tx *bolt.Tx, query *Query, fn interface{}) error {
+	if !tx.Writable() {
+		return bolt.ErrTxNotWritable
+	}
+	return s.forEachUpdate(tx, query, fn)
+}
+
+// ForEachUpdateInBucket is the same as TxForEachUpdate, except the records are read and written in the passed in
+// parent bucket
+func (s *Store) ForEachUpdateInBucket(parent *bolt.Bucket, query *Query, fn interface{}) error {
+	return s.forEachUpdate(parent, query, fn)
+}
+
+func (s *Store) forEachUpdate(source BucketSource, query *Query, fn interface{}) error {
+	var after []byte
+	for {
+		var done bool
+		var err error
+		after, done, err = s.forEachUpdateChunk(source, query, fn, after)
+		if err != nil || done {
+			return err
+		}
+	}
+}
+
+// forEachUpdateChunk updates the next chunk of records with keys after the passed in key, and returns the last key
+// it updated, and whether there are no records left
+func (s *Store) forEachUpdateChunk(source BucketSource, query *Query, fn interface{}, after []byte) ([]byte, bool,
+	error) {
+	fnVal := reflect.ValueOf(fn)
+	fnType := fnVal.Type()
+	if fnType.Kind() != reflect.Func || fnType.NumIn() != 1 || fnType.In(0).Kind() != reflect.Ptr {
+		panic("ForEachUpdate function must take a pointer to the record type")
+	}
+	argType := fnType.In(0).Elem()
+
+	if query == nil {
+		query = &Query{}
+	}
+	if query.skip != 0 || query.limit != 0 || len(query.sort) > 0 {
+		return nil, false, errors.New("ForEachUpdate updates every matching record in key order, so the query " +
+			"can't have a Skip, Limit or SortBy")
+	}
+
+	dataType := reflect.New(argType).Interface()
+	storer := s.newStorer(dataType)
+
+	err := checkMutable(storer, dataType, "update")
+	if err != nil {
+		return nil, false, err
+	}
+
+	query, err = s.prepQuery(dataType, query.clone())
+	if err != nil {
+		return nil, false, err
+	}
+	query.after = after
+
+	records, err := s.keyOrderRecords(source, dataType, query, 0, forEachUpdateChunk)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(records) == 0 {
+		return nil, true, nil
+	}
+
+	keyField := ""
+	if field, ok := decodedKeyField(argType); ok {
+		keyField = field.Name
+	}
+
+	b := getRecordBucket(source, storer)
+
+	for i := range records {
+		r := records[i]
+		if keyField != "" {
+			err = s.decodeKey(r.key, r.value.Elem().FieldByName(keyField).Addr().Interface())
+			if err != nil {
+				return nil, false, err
+			}
+		}
+
+		err = s.updateRecord(storer, source, b, r.key, r.value.Interface(), func(record interface{}) error {
+			out := fnVal.Call([]reflect.Value{reflect.ValueOf(record)})
+			if len(out) != 1 {
+				return fmt.Errorf("ForEachUpdate function does not return an error")
+			}
+			if out[0].IsNil() {
+				return nil
+			}
+			return out[0].Interface().(error)
+		})
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	// the keys are only valid for the life of the transaction, and the next chunk may be read in another one
+	last := append([]byte(nil), records[len(records)-1].key...)
+	return last, len(records) < forEachUpdateChunk, nil
+}
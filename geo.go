@@ -0,0 +1,292 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package bolthold
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"reflect"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// BoltholdGeoIndexTag is the struct tag used to define a geo index on a GeoPoint field.  Geo indexes are used by the
+// WithinRadius and WithinBox criteria to only read records near the area being searched
+//
+//	Location bolthold.GeoPoint `boltholdGeoIndex:"Location"`
+const BoltholdGeoIndexTag = "boltholdGeoIndex"
+
+// GeoPoint is a location on the earth, in degrees
+type GeoPoint struct {
+	Lat float64
+	Lon float64
+}
+
+// geohashPrecision is the length of the geohashes stored in geo indexes, which is accurate to a few centimeters
+const geohashPrecision = 12
+
+const geohashBase32 = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// earthRadius is the mean radius of the earth in meters
+const earthRadius = 6371008.8
+
+// metersPerDegree is the length of a degree of latitude in meters
+const metersPerDegree = earthRadius * math.Pi / 180
+
+// geoArea is the area a geo criterion matches.  Radius searches also have a bounding box, which is used to find
+// the geohash cells to scan
+type geoArea struct {
+	minLat, minLon, maxLat, maxLon float64
+
+	center GeoPoint
+	radius float64
+}
+
+func (a geoArea) contains(p GeoPoint) bool {
+	if a.radius != 0 {
+		return distance(a.center, p) <= a.radius
+	}
+	return p.Lat >= a.minLat && p.Lat <= a.maxLat && p.Lon >= a.minLon && p.Lon <= a.maxLon
+}
+
+func (a geoArea) String() string {
+	if a.radius != 0 {
+		return fmt.Sprintf("%v meters of %v", a.radius, a.center)
+	}
+	return fmt.Sprintf("the box %v, %v to %v, %v", a.minLat, a.minLon, a.maxLat, a.maxLon)
+}
+
+// WithinRadius tests if the current field, a GeoPoint, is within meters of lat and lon
+func (c *Criterion) WithinRadius(lat, lon, meters float64) *Query {
+	if meters < 0 {
+		panic("WithinRadius meters must not be negative")
+	}
+
+	dLat := meters / metersPerDegree
+	area := geoArea{
+		minLat: math.Max(lat-dLat, -90),
+		maxLat: math.Min(lat+dLat, 90),
+		minLon: -180,
+		maxLon: 180,
+		center: GeoPoint{Lat: lat, Lon: lon},
+		radius: meters,
+	}
+
+	// a radius which reaches a pole or crosses the antimeridian can't be bounded by longitude
+	if cos := math.Cos((math.Abs(lat) + dLat) * math.Pi / 180); area.maxLat < 90 && area.minLat > -90 && cos > 0 {
+		dLon := meters / (metersPerDegree * cos)
+		if lon-dLon >= -180 && lon+dLon <= 180 {
+			area.minLon = lon - dLon
+			area.maxLon = lon + dLon
+		}
+	}
+
+	return c.op(withinRadius, area)
+}
+
+// WithinBox tests if the current field, a GeoPoint, is inside the box with the passed in corners
+func (c *Criterion) WithinBox(minLat, minLon, maxLat, maxLon float64) *Query {
+	if minLat > maxLat || minLon > maxLon {
+		panic("WithinBox minimums must not be greater than the maximums")
+	}
+	return c.op(withinBox, geoArea{minLat: minLat, minLon: minLon, maxLat: maxLat, maxLon: maxLon})
+}
+
+// isGeoCriteria returns true if all of the criteria are geo criteria, which can be answered from a geo index
+func isGeoCriteria(criteria []*Criterion) bool {
+	if len(criteria) == 0 {
+		return false
+	}
+	for _, c := range criteria {
+		if c.negate || (c.operator != withinRadius && c.operator != withinBox) {
+			return false
+		}
+	}
+	return true
+}
+
+// testGeo tests if the record's value, which must be a GeoPoint, is in the criterion's area
+func (c *Criterion) testGeo(recordValue interface{}) (bool, error) {
+	val := reflect.ValueOf(recordValue)
+	for val.Kind() == reflect.Ptr {
+		if val.IsNil() {
+			return false, nil
+		}
+		val = val.Elem()
+	}
+
+	point, ok := val.Interface().(GeoPoint)
+	if !ok {
+		return false, &ErrTypeMismatch{recordValue, c.value}
+	}
+	return c.value.(geoArea).contains(point), nil
+}
+
+// distance returns the great circle distance between two points in meters
+func distance(a, b GeoPoint) float64 {
+	lat1 := a.Lat * math.Pi / 180
+	lat2 := b.Lat * math.Pi / 180
+	dLat := lat2 - lat1
+	dLon := (b.Lon - a.Lon) * math.Pi / 180
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// geohash encodes the point as a geohash of the passed in length
+func geohash(p GeoPoint, precision int) string {
+	minLat, maxLat := -90.0, 90.0
+	minLon, maxLon := -180.0, 180.0
+
+	hash := make([]byte, 0, precision)
+	even := true
+	bit := 0
+	ch := 0
+
+	for len(hash) < precision {
+		if even {
+			mid := (minLon + maxLon) / 2
+			if p.Lon >= mid {
+				ch |= 1 << uint(4-bit)
+				minLon = mid
+			} else {
+				maxLon = mid
+			}
+		} else {
+			mid := (minLat + maxLat) / 2
+			if p.Lat >= mid {
+				ch |= 1 << uint(4-bit)
+				minLat = mid
+			} else {
+				maxLat = mid
+			}
+		}
+		even = !even
+
+		if bit < 4 {
+			bit++
+		} else {
+			hash = append(hash, geohashBase32[ch])
+			bit = 0
+			ch = 0
+		}
+	}
+
+	return string(hash)
+}
+
+// geohashCellSize returns the width and height in degrees of the cells of geohashes of the passed in length
+func geohashCellSize(precision int) (width, height float64) {
+	bits := 5 * precision
+	lonBits := (bits + 1) / 2
+	latBits := bits / 2
+	return 360 / math.Pow(2, float64(lonBits)), 180 / math.Pow(2, float64(latBits))
+}
+
+// geohashCells returns the geohash prefixes which cover the area.  The cells are the smallest ones which are at
+// least as large as the area, so that it is covered by the cells at its corners
+func geohashCells(area geoArea) []string {
+	width := area.maxLon - area.minLon
+	height := area.maxLat - area.minLat
+
+	precision := 0
+	for precision < geohashPrecision {
+		cellWidth, cellHeight := geohashCellSize(precision + 1)
+		if cellWidth < width || cellHeight < height {
+			break
+		}
+		precision++
+	}
+
+	if precision == 0 {
+		// the whole index
+		return []string{""}
+	}
+
+	var cells []string
+	for _, corner := range []GeoPoint{
+		{Lat: area.minLat, Lon: area.minLon},
+		{Lat: area.minLat, Lon: area.maxLon},
+		{Lat: area.maxLat, Lon: area.minLon},
+		{Lat: area.maxLat, Lon: area.maxLon},
+	} {
+		cell := geohash(corner, precision)
+		found := false
+		for i := range cells {
+			if cells[i] == cell {
+				found = true
+				break
+			}
+		}
+		if !found {
+			cells = append(cells, cell)
+		}
+	}
+	return cells
+}
+
+// geoIndex returns the index function for a geo index, the index key is the geohash of the point
+func geoIndex(field string) Index {
+	return func(name string, value interface{}) ([]byte, error) {
+		val := reflect.ValueOf(findIndexValue(field, value, BoltholdGeoIndexTag))
+		for val.Kind() == reflect.Ptr {
+			if val.IsNil() {
+				return nil, nil
+			}
+			val = val.Elem()
+		}
+		point, ok := val.Interface().(GeoPoint)
+		if !ok {
+			return nil, nil
+		}
+		return []byte(geohash(point, geohashPrecision)), nil
+	}
+}
+
+// geoIndexer is implemented by storers which know which of their indexes are geo indexes
+type geoIndexer interface {
+	isGeoIndex(indexName string) bool
+}
+
+func isGeoIndex(storer Storer, indexName string) bool {
+	indexer, ok := storer.(geoIndexer)
+	return ok && indexer.isGeoIndex(indexName)
+}
+
+// geoCandidates returns the keys of the records in the geo index cells covering the areas of all of the criteria.
+// The records still have to be checked against the criteria, as the cells are larger than the areas
+func (s *Store) geoCandidates(iBucket *bolt.Bucket, criteria []*Criterion) (keyList, int64, error) {
+	var keys keyList
+	var scanned int64
+
+	for i, c := range criteria {
+		found := make(keyList, 0)
+		cursor := iBucket.Cursor()
+
+		for _, cell := range geohashCells(c.value.(geoArea)) {
+			prefix := []byte(cell)
+			for k, v := cursor.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = cursor.Next() {
+				scanned++
+				var entry keyList
+				err := s.decode(v, &entry)
+				if err != nil {
+					return nil, scanned, err
+				}
+				for j := range entry {
+					found.add(entry[j])
+				}
+			}
+		}
+
+		if i == 0 {
+			keys = found
+		} else {
+			keys = keys.intersect(found)
+		}
+	}
+
+	return keys, scanned, nil
+}
@@ -0,0 +1,111 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package bolthold_test
+
+import (
+	"testing"
+
+	"github.com/timshannon/bolthold"
+)
+
+type City struct {
+	Name     string
+	Location bolthold.GeoPoint `boltholdGeoIndex:"Location"`
+}
+
+var cities = []City{
+	{Name: "London", Location: bolthold.GeoPoint{Lat: 51.5074, Lon: -0.1278}},
+	{Name: "Paris", Location: bolthold.GeoPoint{Lat: 48.8566, Lon: 2.3522}},
+	{Name: "Brussels", Location: bolthold.GeoPoint{Lat: 50.8503, Lon: 4.3517}},
+	{Name: "Amsterdam", Location: bolthold.GeoPoint{Lat: 52.3676, Lon: 4.9041}},
+	{Name: "New York", Location: bolthold.GeoPoint{Lat: 40.7128, Lon: -74.0060}},
+	{Name: "Sydney", Location: bolthold.GeoPoint{Lat: -33.8688, Lon: 151.2093}},
+	{Name: "Auckland", Location: bolthold.GeoPoint{Lat: -36.8485, Lon: 174.7633}},
+	{Name: "Suva", Location: bolthold.GeoPoint{Lat: -18.1416, Lon: 178.4419}},
+}
+
+func cityNames(result []City) map[string]bool {
+	names := make(map[string]bool)
+	for i := range result {
+		names[result[i].Name] = true
+	}
+	return names
+}
+
+func TestGeoIndex(t *testing.T) {
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		for i := range cities {
+			ok(t, store.Insert(cities[i].Name, &cities[i]))
+		}
+
+		tests := []struct {
+			name     string
+			query    *bolthold.Query
+			expected []string
+		}{
+			{
+				name:     "Radius around London",
+				query:    bolthold.Where("Location").WithinRadius(51.5074, -0.1278, 350000),
+				expected: []string{"London", "Paris", "Brussels"},
+			},
+			{
+				name:     "Small radius",
+				query:    bolthold.Where("Location").WithinRadius(48.86, 2.35, 1000),
+				expected: []string{"Paris"},
+			},
+			{
+				name:     "Radius across the antimeridian",
+				query:    bolthold.Where("Location").WithinRadius(-18.0, -179.9, 500000),
+				expected: []string{"Suva"},
+			},
+			{
+				name:     "Box around the Low Countries",
+				query:    bolthold.Where("Location").WithinBox(50, 3, 53, 6),
+				expected: []string{"Brussels", "Amsterdam"},
+			},
+			{
+				name:     "Empty box",
+				query:    bolthold.Where("Location").WithinBox(0, 0, 1, 1),
+				expected: nil,
+			},
+		}
+
+		for _, tst := range tests {
+			t.Run(tst.name, func(t *testing.T) {
+				var scanned []City
+				ok(t, store.Find(&scanned, tst.query))
+				equals(t, len(tst.expected), len(scanned))
+
+				var indexed []City
+				ok(t, store.Find(&indexed, tst.query.Index("Location")))
+				equals(t, cityNames(scanned), cityNames(indexed))
+				for i := range tst.expected {
+					assert(t, cityNames(indexed)[tst.expected[i]], "%s was not found", tst.expected[i])
+				}
+			})
+		}
+
+		stats := store.IndexStats()
+		equals(t, 1, len(stats))
+		equals(t, int64(len(tests)), stats[0].Chosen)
+
+		problems, err := store.CheckIndexes(&City{}, false)
+		ok(t, err)
+		equals(t, 0, len(problems))
+	})
+}
+
+func TestGeoIndexInvalidField(t *testing.T) {
+	type Invalid struct {
+		Location string `boltholdGeoIndex:"Location"`
+	}
+
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		defer func() {
+			assert(t, recover() != nil, "No panic on a geo index field that isn't a GeoPoint")
+		}()
+		_ = store.Insert(1, &Invalid{Location: "here"})
+	})
+}
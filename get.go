@@ -7,7 +7,7 @@ package bolthold
 import (
 	"errors"
 	"reflect"
-	"strings"
+	"time"
 
 	bolt "go.etcd.io/bbolt"
 )
@@ -35,13 +35,13 @@ func (s *Store) GetFromBucket(parent *bolt.Bucket, key, result interface{}) erro
 func (s *Store) get(source BucketSource, key, result interface{}) error {
 	storer := s.newStorer(result)
 
-	gk, err := s.encode(key)
+	gk, err := s.encodeKey(key)
 
 	if err != nil {
 		return err
 	}
 
-	bkt := source.Bucket([]byte(storer.Type()))
+	bkt := getRecordBucket(source, storer)
 	if bkt == nil {
 		return ErrNotFound
 	}
@@ -51,27 +51,34 @@ func (s *Store) get(source BucketSource, key, result interface{}) error {
 		return ErrNotFound
 	}
 
-	err = s.decode(value, result)
+	err = s.decodeRecord(storer, value, result)
 	if err != nil {
 		return err
 	}
 
+	if isExpired(storer, result, time.Now()) || isSoftDeleted(storer, result) {
+		return ErrNotFound
+	}
+
+	if s.needsRewrite(storer, value) {
+		err = s.rewriteRecords(source, newElemType(result), [][]byte{gk})
+		if err != nil {
+			return err
+		}
+	}
+
 	tp := reflect.TypeOf(result)
 	for tp.Kind() == reflect.Ptr {
 		tp = tp.Elem()
 	}
 
 	var keyField string
-
-	for i := 0; i < tp.NumField(); i++ {
-		if strings.Contains(string(tp.Field(i).Tag), BoltholdKeyTag) {
-			keyField = tp.Field(i).Name
-			break
-		}
+	if field, ok := decodedKeyField(tp); ok {
+		keyField = field.Name
 	}
 
 	if keyField != "" {
-		err := s.decode(gk, reflect.ValueOf(result).Elem().FieldByName(keyField).Addr().Interface())
+		err := s.decodeKey(gk, reflect.ValueOf(result).Elem().FieldByName(keyField).Addr().Interface())
 		if err != nil {
 			return err
 		}
@@ -80,12 +87,73 @@ func (s *Store) get(source BucketSource, key, result interface{}) error {
 	return nil
 }
 
+// GetMany retrieves the records with the passed in keys in a single transaction, and appends them to result, which
+// must be a pointer to a slice, in the same order as the keys.  The keys which weren't found are returned rather
+// than failing with ErrNotFound
+func (s *Store) GetMany(keys []interface{}, result interface{}) ([]interface{}, error) {
+	var missing []interface{}
+	err := s.Bolt().View(func(tx *bolt.Tx) error {
+		var txErr error
+		missing, txErr = s.TxGetMany(tx, keys, result)
+		return txErr
+	})
+	return missing, err
+}
+
+// TxGetMany is the same as GetMany except it allows you to pass in your own bolt transaction
+func (s *Store) TxGetMany(tx *bolt.Tx, keys []interface{}, result interface{}) ([]interface{}, error) {
+	return s.getMany(tx, keys, result)
+}
+
+// GetManyFromBucket allows you to specify the parent bucket for retrieving records
+func (s *Store) GetManyFromBucket(parent *bolt.Bucket, keys []interface{}, result interface{}) ([]interface{},
+	error) {
+	return s.getMany(parent, keys, result)
+}
+
+func (s *Store) getMany(source BucketSource, keys []interface{}, result interface{}) ([]interface{}, error) {
+	resultVal := reflect.ValueOf(result)
+	if resultVal.Kind() != reflect.Ptr || resultVal.Elem().Kind() != reflect.Slice {
+		panic("result argument must be a slice address")
+	}
+
+	sliceVal := resultVal.Elem()
+	elType := sliceVal.Type().Elem()
+
+	tp := elType
+	for tp.Kind() == reflect.Ptr {
+		tp = tp.Elem()
+	}
+
+	var missing []interface{}
+	for _, key := range keys {
+		val := reflect.New(tp)
+		err := s.get(source, key, val.Interface())
+		if err == ErrNotFound {
+			missing = append(missing, key)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if elType.Kind() == reflect.Ptr {
+			sliceVal = reflect.Append(sliceVal, val)
+		} else {
+			sliceVal = reflect.Append(sliceVal, val.Elem())
+		}
+	}
+
+	resultVal.Elem().Set(sliceVal)
+	return missing, nil
+}
+
 // Find retrieves a set of values from the bolthold that matches the passed in query
 // result must be a pointer to a slice.
 // The result of the query will be appended to the passed in result slice, rather than the passed in slice being
 // emptied.
 func (s *Store) Find(result interface{}, query *Query) error {
-	return s.Bolt().View(func(tx *bolt.Tx) error {
+	return s.viewOrs(func(tx *bolt.Tx) error {
 		return s.TxFind(tx, result, query)
 	})
 }
@@ -100,6 +168,25 @@ func (s *Store) FindInBucket(parent *bolt.Bucket, result interface{}, query *Que
 	return s.findQuery(parent, result, query)
 }
 
+// FindKeys appends the keys of the records that match the passed in query to keys, which must be a pointer to a
+// slice of the key type.  If the query's criteria are all answered by the index it's run on, the records themselves
+// are never read or decoded
+func (s *Store) FindKeys(dataType interface{}, query *Query, keys interface{}) error {
+	return s.viewOrs(func(tx *bolt.Tx) error {
+		return s.TxFindKeys(tx, dataType, query, keys)
+	})
+}
+
+// TxFindKeys does the same as FindKeys, but allows you to specify your own transaction
+func (s *Store) TxFindKeys(tx *bolt.Tx, dataType interface{}, query *Query, keys interface{}) error {
+	return s.findKeysQuery(tx, dataType, query, keys)
+}
+
+// FindKeysInBucket does the same as FindKeys, but allows you to specify a parent bucket to search in
+func (s *Store) FindKeysInBucket(parent *bolt.Bucket, dataType interface{}, query *Query, keys interface{}) error {
+	return s.findKeysQuery(parent, dataType, query, keys)
+}
+
 // FindOne returns a single record, and so result is NOT a slice, but an pointer to a struct, if no record is found
 // that matches the query, then it returns ErrNotFound
 func (s *Store) FindOne(result interface{}, query *Query) error {
@@ -121,7 +208,7 @@ func (s *Store) FindOneInBucket(parent *bolt.Bucket, result interface{}, query *
 // Count returns the current record count for the passed in datatype
 func (s *Store) Count(dataType interface{}, query *Query) (int, error) {
 	count := 0
-	err := s.Bolt().View(func(tx *bolt.Tx) error {
+	err := s.viewOrs(func(tx *bolt.Tx) error {
 		var txErr error
 		count, txErr = s.TxCount(tx, dataType, query)
 		return txErr
@@ -139,12 +226,86 @@ func (s *Store) CountInBucket(parent *bolt.Bucket, dataType interface{}, query *
 	return s.countQuery(parent, dataType, query)
 }
 
+// Exists returns true if there is a record with the passed in key.  The record is only read if its type has an expire
+// or deleted field, to check that it hasn't expired or been soft deleted
+func (s *Store) Exists(key, dataType interface{}) (bool, error) {
+	found := false
+	err := s.Bolt().View(func(tx *bolt.Tx) error {
+		var txErr error
+		found, txErr = s.TxExists(tx, key, dataType)
+		return txErr
+	})
+	return found, err
+}
+
+// TxExists is the same as Exists except it allows you to pass in your own bolt transaction
+func (s *Store) TxExists(tx *bolt.Tx, key, dataType interface{}) (bool, error) {
+	return s.exists(tx, key, dataType)
+}
+
+// ExistsInBucket is the same as Exists except it allows you to specify the parent bucket
+func (s *Store) ExistsInBucket(parent *bolt.Bucket, key, dataType interface{}) (bool, error) {
+	return s.exists(parent, key, dataType)
+}
+
+func (s *Store) exists(source BucketSource, key, dataType interface{}) (bool, error) {
+	storer := s.newStorer(dataType)
+
+	gk, err := s.encodeKey(key)
+	if err != nil {
+		return false, err
+	}
+
+	bkt := getRecordBucket(source, storer)
+	if bkt == nil {
+		return false, nil
+	}
+
+	value := bkt.Get(gk)
+	if value == nil {
+		return false, nil
+	}
+
+	if !hasExpiry(storer) && !hasSoftDelete(storer) {
+		return true, nil
+	}
+
+	record := newElemType(dataType)
+	err = s.decodeRecord(storer, value, record)
+	if err != nil {
+		return false, err
+	}
+	return !isExpired(storer, record, time.Now()) && !isSoftDeleted(storer, record), nil
+}
+
+// ExistsMatching returns true if any record matches the query.  It stops at the first match, and records are only
+// decoded as far as they need to be to match the query
+func (s *Store) ExistsMatching(dataType interface{}, query *Query) (bool, error) {
+	found := false
+	err := s.Bolt().View(func(tx *bolt.Tx) error {
+		var txErr error
+		found, txErr = s.TxExistsMatching(tx, dataType, query)
+		return txErr
+	})
+	return found, err
+}
+
+// TxExistsMatching is the same as ExistsMatching except it allows you to pass in your own bolt transaction
+func (s *Store) TxExistsMatching(tx *bolt.Tx, dataType interface{}, query *Query) (bool, error) {
+	return s.existsQuery(tx, dataType, query)
+}
+
+// ExistsMatchingInBucket is the same as ExistsMatching except it allows you to specify the parent bucket
+func (s *Store) ExistsMatchingInBucket(parent *bolt.Bucket, dataType interface{}, query *Query) (bool, error) {
+	return s.existsQuery(parent, dataType, query)
+}
+
 // ForEach runs the function fn against every record that matches the query
 // Useful for when working with large sets of data that you don't want to hold the entire result
 // set in memory, similar to database cursors
 // Return an error from fn, will stop the cursor from iterating
 func (s *Store) ForEach(query *Query, fn interface{}) error {
-	return s.Bolt().View(func(tx *bolt.Tx) error {
+	return s.viewOrs(func(tx *bolt.Tx) error {
 		return s.TxForEach(tx, query, fn)
 	})
 }
@@ -111,3 +111,67 @@ func TestIssue103(t *testing.T) {
 
 	})
 }
+
+func TestGetMany(t *testing.T) {
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		insertTestData(t, store)
+
+		keys := []interface{}{testData[4].Key, -1, testData[0].Key, testData[2].Key, -2}
+
+		var result []ItemTest
+		missing, err := store.GetMany(keys, &result)
+		ok(t, err)
+		equals(t, []interface{}{-1, -2}, missing)
+		equals(t, 3, len(result))
+		assert(t, result[0].equal(&testData[4]), "Wanted %v, got %v", testData[4], result[0])
+		assert(t, result[1].equal(&testData[0]), "Wanted %v, got %v", testData[0], result[1])
+		assert(t, result[2].equal(&testData[2]), "Wanted %v, got %v", testData[2], result[2])
+
+		var ptrs []*ItemTest
+		missing, err = store.GetMany([]interface{}{testData[1].Key}, &ptrs)
+		ok(t, err)
+		equals(t, 0, len(missing))
+		equals(t, 1, len(ptrs))
+		assert(t, ptrs[0].equal(&testData[1]), "Wanted %v, got %v", testData[1], ptrs[0])
+	})
+}
+
+func TestExists(t *testing.T) {
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		found, err := store.Exists(testData[0].Key, &ItemTest{})
+		ok(t, err)
+		assert(t, !found, "Found a record in an empty store")
+
+		found, err = store.ExistsMatching(&ItemTest{}, nil)
+		ok(t, err)
+		assert(t, !found, "Found a matching record in an empty store")
+
+		insertTestData(t, store)
+
+		found, err = store.Exists(testData[0].Key, &ItemTest{})
+		ok(t, err)
+		assert(t, found, "Record %v wasn't found", testData[0].Key)
+
+		found, err = store.Exists(-1, &ItemTest{})
+		ok(t, err)
+		assert(t, !found, "Found a key that doesn't exist")
+
+		found, err = store.ExistsMatching(&ItemTest{}, bolthold.Where("Category").Eq("animal").Index("Category"))
+		ok(t, err)
+		assert(t, found, "No animal records were found")
+
+		found, err = store.ExistsMatching(&ItemTest{}, bolthold.Where("Name").Eq("nothing").
+			Or(bolthold.Where("Category").Eq("nothing")))
+		ok(t, err)
+		assert(t, !found, "Found a record that shouldn't match")
+
+		found, err = store.ExistsMatching(&ItemTest{}, bolthold.Where("Category").Eq("animal").SortBy("Name"))
+		ok(t, err)
+		assert(t, found, "No sorted animal records were found")
+
+		ok(t, store.Insert(0, &Session{ID: 0, Expires: time.Now().Add(-time.Minute)}))
+		found, err = store.Exists(0, &Session{})
+		ok(t, err)
+		assert(t, !found, "Found an expired record")
+	})
+}
@@ -0,0 +1,107 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package bolthold
+
+import (
+	bolt "go.etcd.io/bbolt"
+)
+
+// Change is a record written by a transaction, as passed to commit hooks
+type Change struct {
+	Type    string // the Storer type of the record
+	Key     []byte // the encoded key of the record, use Options.KeyDecoder to decode it
+	Deleted bool   // true if the record was deleted, or soft deleted, by the transaction
+}
+
+// PreCommitHook is run inside a write transaction just before it's committed, with the records it wrote.  The hook
+// can make more writes with the transaction, such as to an outbox, and returning an error rolls back the transaction
+type PreCommitHook func(tx *bolt.Tx, changes []Change) error
+
+// PostCommitHook is run after a write transaction has been committed, with the records it wrote
+type PostCommitHook func(changes []Change)
+
+// OnPreCommit adds a hook run before every write transaction run by bolthold is committed.  Hooks run in the order
+// they were added, and only for transactions that wrote records.  Transactions passed in to the Tx functions, and
+// the transactions of the Batch functions, aren't run by bolthold so they don't run hooks.
+// OnPreCommit is not safe to call while the store is running writes.
+func (s *Store) OnPreCommit(hook PreCommitHook) {
+	s.preCommitHooks = append(s.preCommitHooks, hook)
+}
+
+// OnPostCommit adds a hook run after every write transaction run by bolthold is committed, in the same way as
+// OnPreCommit.
+// OnPostCommit is not safe to call while the store is running writes.
+func (s *Store) OnPostCommit(hook PostCommitHook) {
+	s.postCommitHooks = append(s.postCommitHooks, hook)
+}
+
+// changeLog is the list of records written by the current write transaction.  Bolt only allows one write
+// transaction at a time, so the store only needs one
+type changeLog struct {
+	changes []Change
+	index   map[string]int
+}
+
+// add records a write of the key, a nil changeLog records nothing
+func (c *changeLog) add(storer Storer, key []byte, deleted bool) {
+	if c == nil {
+		return
+	}
+
+	id := storer.Type() + "\x00" + string(key)
+	if i, ok := c.index[id]; ok {
+		c.changes[i].Deleted = deleted
+		return
+	}
+
+	c.index[id] = len(c.changes)
+	c.changes = append(c.changes, Change{
+		Type:    storer.Type(),
+		Key:     append([]byte(nil), key...),
+		Deleted: deleted,
+	})
+}
+
+// withCommitHooks wraps fn so it logs the records written and runs the pre-commit hooks, and sets changes to the
+// records written for the post-commit hooks
+func (s *Store) withCommitHooks(fn func(tx *bolt.Tx) error, changes *[]Change) func(tx *bolt.Tx) error {
+	if len(s.preCommitHooks) == 0 && len(s.postCommitHooks) == 0 {
+		return fn
+	}
+
+	return func(tx *bolt.Tx) error {
+		log := &changeLog{index: make(map[string]int)}
+		s.changes = log
+		err := fn(tx)
+		// writes made by the hooks aren't logged
+		s.changes = nil
+		if err != nil {
+			return err
+		}
+
+		*changes = log.changes
+		if len(log.changes) == 0 {
+			return nil
+		}
+
+		for _, hook := range s.preCommitHooks {
+			err = hook(tx, log.changes)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// runPostCommitHooks runs the post-commit hooks for a committed transaction
+func (s *Store) runPostCommitHooks(changes []Change) {
+	if len(changes) == 0 {
+		return
+	}
+	for _, hook := range s.postCommitHooks {
+		hook(changes)
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package bolthold_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/timshannon/bolthold"
+	bolt "go.etcd.io/bbolt"
+)
+
+type OutboxEvent struct {
+	Type    string
+	Deleted bool
+}
+
+func TestCommitHooks(t *testing.T) {
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		var committed [][]bolthold.Change
+		store.OnPreCommit(func(tx *bolt.Tx, changes []bolthold.Change) error {
+			for i := range changes {
+				if changes[i].Type == "ItemTest" {
+					err := store.TxInsert(tx, bolthold.NextSequence(), OutboxEvent{
+						Type:    changes[i].Type,
+						Deleted: changes[i].Deleted,
+					})
+					if err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		})
+		store.OnPostCommit(func(changes []bolthold.Change) {
+			committed = append(committed, changes)
+		})
+
+		item := testData[0]
+		ok(t, store.Insert(item.Key, item))
+		equals(t, 1, len(committed))
+		equals(t, 1, len(committed[0]))
+		equals(t, "ItemTest", committed[0][0].Type)
+		assert(t, !committed[0][0].Deleted, "Insert was reported as a delete")
+
+		var key int
+		ok(t, bolthold.DefaultDecode(committed[0][0].Key, &key))
+		equals(t, item.Key, key)
+
+		// a record written more than once is reported once, with its last state
+		ok(t, store.Txn().Update(item.Key, item).Delete(item.Key, &ItemTest{}).Commit())
+		equals(t, 2, len(committed))
+		equals(t, 1, len(committed[1]))
+		assert(t, committed[1][0].Deleted, "Delete wasn't reported")
+
+		var events []OutboxEvent
+		ok(t, store.Find(&events, nil))
+		equals(t, []OutboxEvent{{Type: "ItemTest"}, {Type: "ItemTest", Deleted: true}}, events)
+
+		// transactions that don't write anything don't run hooks
+		ok(t, store.DeleteMatching(&ItemTest{}, nil))
+		equals(t, 2, len(committed))
+	})
+}
+
+func TestPreCommitHookRollback(t *testing.T) {
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		errRejected := errors.New("rejected")
+		posted := 0
+		store.OnPreCommit(func(tx *bolt.Tx, changes []bolthold.Change) error {
+			return errRejected
+		})
+		store.OnPostCommit(func(changes []bolthold.Change) {
+			posted++
+		})
+
+		equals(t, errRejected, store.Insert(testData[0].Key, testData[0]))
+		equals(t, bolthold.ErrNotFound, store.Get(testData[0].Key, &ItemTest{}))
+		equals(t, 0, posted)
+	})
+}
@@ -8,6 +8,8 @@ import (
 	"bytes"
 	"reflect"
 	"sort"
+	"strings"
+	"sync"
 
 	bolt "go.etcd.io/bbolt"
 )
@@ -19,8 +21,36 @@ const BoltholdIndexTag = "boltholdIndex"
 // slice is indexed separately rather than as one index
 const BoltholdSliceIndexTag = "boltholdSliceIndex"
 
+// BoltholdFilterTag is the struct tag used to make an index partial.  It names a method on the type, of the form
+// func() bool, and only records for which the method returns true are included in the index.  Queries which use a
+// partial index only return records that are in the index
+//
+//	Status string `boltholdIndex:"Status" boltholdFilter:"IsActive"`
+const BoltholdFilterTag = "boltholdFilter"
+
+// BoltholdCollateTag is the struct tag used to specify the collation of a string index, so that values are indexed
+// and looked up according to the collation rather than by their exact bytes
+// Indexes on slices are not collated
+//
+//	Name string `boltholdIndex:"Name" boltholdCollate:"nocase"`
+const BoltholdCollateTag = "boltholdCollate"
+
+// BoltholdOmitZeroTag is the struct tag used to leave records out of an index when the indexed field has its zero
+// value, which keeps indexes small when most records leave the field unset.  Queries that could match the zero
+// value don't use the index, and scan all records instead
+//
+//	ParentID string `boltholdIndex:"ParentID" boltholdOmitZero:""`
+const BoltholdOmitZeroTag = "boltholdOmitZero"
+
+// CollateNoCase is the built in collation which indexes and compares strings without regard to case
+const CollateNoCase = "nocase"
+
 const indexBucketPrefix = "_index"
 
+// droppedIndexSubsystem is the metadata bucket holding the names of the index buckets which have been deleted with
+// DeleteIndex, and should no longer be maintained
+const droppedIndexSubsystem = "droppedIndexes"
+
 // size of iterator keys stored in memory before more are fetched
 const iteratorKeyMinCacheSize = 100
 
@@ -30,6 +60,49 @@ type Index func(name string, value interface{}) ([]byte, error)
 // SliceIndex is a function that returns all of the indexable values in a slice
 type SliceIndex func(name string, value interface{}) ([][]byte, error)
 
+// Collation transforms a string into the form it is indexed and compared in, for instance lower case for
+// case-insensitive indexes
+type Collation func(value string) string
+
+// IndexCollator can be implemented by a Storer to specify the collation an index was built with, so that query
+// values are collated the same way as the indexed values when the index is used
+type IndexCollator interface {
+	IndexCollation(indexName string) Collation
+}
+
+// collateValue applies the collation to the value if it is a string
+func collateValue(collation Collation, value interface{}) interface{} {
+	if _, ok := value.(Field); ok {
+		return value
+	}
+
+	val := reflect.ValueOf(value)
+	if val.Kind() != reflect.String {
+		return value
+	}
+
+	return reflect.ValueOf(collation(val.String())).Convert(val.Type()).Interface()
+}
+
+// collateCriteria returns a copy of the criteria with their values collated
+func collateCriteria(collation Collation, criteria []*Criterion) []*Criterion {
+	collated := make([]*Criterion, len(criteria))
+
+	for i := range criteria {
+		c := *criteria[i]
+		c.value = collateValue(collation, c.value)
+		if c.values != nil {
+			c.values = make([]interface{}, len(criteria[i].values))
+			for j := range c.values {
+				c.values[j] = collateValue(collation, criteria[i].values[j])
+			}
+		}
+		collated[i] = &c
+	}
+
+	return collated
+}
+
 // adds an item to the index
 func (s *Store) addIndexes(storer Storer, source BucketSource, key []byte, data interface{}) error {
 	return s.updateIndexes(storer, source, key, data, false)
@@ -42,8 +115,13 @@ func (s *Store) deleteIndexes(storer Storer, source BucketSource, key []byte, or
 }
 
 func (s *Store) updateIndexes(storer Storer, source BucketSource, key []byte, data interface{}, delete bool) error {
+	dropped := metaBucket(source, droppedIndexSubsystem)
+
 	indexes := storer.Indexes()
 	for name, index := range indexes {
+		if isDropped(dropped, storer.Type(), name) {
+			continue
+		}
 		indexKey, err := index(name, data)
 		if err != nil {
 			return err
@@ -59,6 +137,9 @@ func (s *Store) updateIndexes(storer Storer, source BucketSource, key []byte, da
 
 	sliceIndexes := storer.SliceIndexes()
 	for name, index := range sliceIndexes {
+		if isDropped(dropped, storer.Type(), name) {
+			continue
+		}
 		indexKeys, err := index(name, data)
 		if err != nil {
 			return err
@@ -104,6 +185,7 @@ func (s *Store) updateIndex(typeName, indexName string, indexKey []byte, source
 	}
 
 	if len(indexValue) == 0 {
+		s.writes.record(true, indexKey, nil)
 		return b.Delete(indexKey)
 	}
 
@@ -112,9 +194,320 @@ func (s *Store) updateIndex(typeName, indexName string, indexKey []byte, source
 		return err
 	}
 
+	s.writes.record(true, indexKey, iVal)
 	return b.Put(indexKey, iVal)
 }
 
+// IndexStats are the usage counters for a single index since the store was opened
+type IndexStats struct {
+	Type        string
+	Index       string
+	Chosen      int64 // number of queries run using this index
+	KeysScanned int64 // number of index keys read while running queries
+	FullScans   int64 // number of queries which fell back to a full scan instead of using this index
+}
+
+// indexUsage tracks the IndexStats for every index queried
+type indexUsage struct {
+	sync.Mutex
+	disabled bool
+	stats    map[string]*IndexStats
+}
+
+func (u *indexUsage) record(typeName, indexName string, chosen, keysScanned, fullScans int64) {
+	if u.disabled {
+		return
+	}
+
+	u.Lock()
+	defer u.Unlock()
+
+	if u.stats == nil {
+		u.stats = make(map[string]*IndexStats)
+	}
+
+	name := string(indexBucketName(typeName, indexName))
+	stats, ok := u.stats[name]
+	if !ok {
+		stats = &IndexStats{
+			Type:  typeName,
+			Index: indexName,
+		}
+		u.stats[name] = stats
+	}
+
+	stats.Chosen += chosen
+	stats.KeysScanned += keysScanned
+	stats.FullScans += fullScans
+}
+
+// IndexStats returns the usage counters for every index that has been queried since the store was opened,
+// sorted by type and index name.  Indexes that have never been used in a query are not included, see IndexUsage.
+// No stats are tracked if the store was opened with DisableIndexStats.
+func (s *Store) IndexStats() []IndexStats {
+	s.indexUsage.Lock()
+	defer s.indexUsage.Unlock()
+
+	result := make([]IndexStats, 0, len(s.indexUsage.stats))
+	for _, stats := range s.indexUsage.stats {
+		result = append(result, *stats)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Type != result[j].Type {
+			return result[i].Type < result[j].Type
+		}
+		return result[i].Index < result[j].Index
+	})
+
+	return result
+}
+
+// IndexUsage returns the usage counters for every index in the store, including those which have never been used
+// by a query since the store was opened, so that unused indexes can be found and removed.  Indexes in nested
+// buckets are not included.
+func (s *Store) IndexUsage() ([]IndexStats, error) {
+	used := make(map[string]IndexStats)
+	for _, stats := range s.IndexStats() {
+		used[string(indexBucketName(stats.Type, stats.Index))] = stats
+	}
+
+	var result []IndexStats
+
+	err := s.Bolt().View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, _ *bolt.Bucket) error {
+			parts := strings.SplitN(string(name), ":", 3)
+			if len(parts) != 3 || parts[0] != indexBucketPrefix {
+				return nil
+			}
+
+			stats, ok := used[string(name)]
+			if !ok {
+				stats = IndexStats{
+					Type:  parts[1],
+					Index: parts[2],
+				}
+			}
+			result = append(result, stats)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// IndexProblem is an inconsistency between the records of a type and one of its indexes
+type IndexProblem struct {
+	Index string
+	Value []byte // encoded index value
+	Key   []byte // encoded record key
+	// Dangling is true if the index entry refers to a record that doesn't exist or no longer has this value,
+	// otherwise the record is missing from the index
+	Dangling bool
+}
+
+// CheckIndexes verifies that every record of the passed in datatype has matching entries in its indexes, and that
+// every index entry points at an existing record with that value.  If repair is true, any problems found are fixed
+// in the same transaction.  The problems found are returned whether they were repaired or not.
+func (s *Store) CheckIndexes(dataType interface{}, repair bool) ([]IndexProblem, error) {
+	var problems []IndexProblem
+	var err error
+
+	check := func(tx *bolt.Tx) error {
+		problems, err = s.checkIndexes(tx, dataType, repair)
+		return err
+	}
+
+	if repair {
+		err = s.updateTx(check)
+	} else {
+		err = s.Bolt().View(check)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return problems, nil
+}
+
+func (s *Store) checkIndexes(tx *bolt.Tx, dataType interface{}, repair bool) ([]IndexProblem, error) {
+	storer := s.newStorer(dataType)
+	dropped := metaBucket(tx, droppedIndexSubsystem)
+
+	// [indexName][indexValue] = record keys
+	expected := make(map[string]map[string]keyList)
+
+	var names []string
+	for name := range storer.Indexes() {
+		names = append(names, name)
+	}
+	for name := range storer.SliceIndexes() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for i := range names {
+		if !isDropped(dropped, storer.Type(), names[i]) {
+			expected[names[i]] = make(map[string]keyList)
+		}
+	}
+
+	if bucket := getRecordBucket(tx, storer); bucket != nil {
+		err := bucket.ForEach(func(k, v []byte) error {
+			value := newElemType(dataType)
+			err := s.decodeRecord(storer, v, value)
+			if err != nil {
+				return err
+			}
+
+			for name, index := range storer.Indexes() {
+				if expected[name] == nil {
+					continue
+				}
+				indexKey, err := index(name, value)
+				if err != nil {
+					return err
+				}
+				if indexKey != nil {
+					// k is only valid until the transaction closes, and is returned in IndexProblem.Key
+					keys := expected[name][string(indexKey)]
+					keys.add(append([]byte(nil), k...))
+					expected[name][string(indexKey)] = keys
+				}
+			}
+
+			for name, index := range storer.SliceIndexes() {
+				if expected[name] == nil {
+					continue
+				}
+				indexKeys, err := index(name, value)
+				if err != nil {
+					return err
+				}
+				for i := range indexKeys {
+					if indexKeys[i] == nil {
+						continue
+					}
+					keys := expected[name][string(indexKeys[i])]
+					keys.add(append([]byte(nil), k...))
+					expected[name][string(indexKeys[i])] = keys
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var problems []IndexProblem
+
+	for _, name := range names {
+		values, ok := expected[name]
+		if !ok {
+			continue
+		}
+
+		// [indexValue] = record keys
+		actual := make(map[string]keyList)
+
+		if iBucket := tx.Bucket(indexBucketName(storer.Type(), name)); iBucket != nil {
+			err := iBucket.ForEach(func(k, v []byte) error {
+				keys := make(keyList, 0)
+				err := s.decode(v, &keys)
+				if err != nil {
+					return err
+				}
+				actual[string(k)] = keys
+
+				valueKeys := values[string(k)]
+				for i := range keys {
+					if !valueKeys.in(keys[i]) {
+						problems = append(problems, IndexProblem{
+							Index:    name,
+							Value:    append([]byte(nil), k...),
+							Key:      keys[i],
+							Dangling: true,
+						})
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		var valueNames []string
+		for value := range values {
+			valueNames = append(valueNames, value)
+		}
+		sort.Strings(valueNames)
+
+		for _, value := range valueNames {
+			existing := actual[value]
+			for _, key := range values[value] {
+				if !existing.in(key) {
+					problems = append(problems, IndexProblem{
+						Index: name,
+						Value: []byte(value),
+						Key:   key,
+					})
+				}
+			}
+		}
+	}
+
+	if repair {
+		for i := range problems {
+			err := s.updateIndex(storer.Type(), problems[i].Index, problems[i].Value, tx, problems[i].Key,
+				problems[i].Dangling)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return problems, nil
+}
+
+// isDropped returns true if the index has been deleted with DeleteIndex
+func isDropped(dropped *bolt.Bucket, typeName, indexName string) bool {
+	return dropped != nil && dropped.Get(indexBucketName(typeName, indexName)) != nil
+}
+
+// DeleteIndex removes an index from the store, and stops maintaining it on any future writes, unlike RemoveIndex
+// where the index will start being rebuilt on the next write.  ReIndex will start maintaining the index again.
+func (s *Store) DeleteIndex(dataType interface{}, indexName string) error {
+	return s.updateTx(func(tx *bolt.Tx) error {
+		return s.TxDeleteIndex(tx, dataType, indexName)
+	})
+}
+
+// TxDeleteIndex is the same as DeleteIndex except it allows you to specify your own transaction
+func (s *Store) TxDeleteIndex(tx *bolt.Tx, dataType interface{}, indexName string) error {
+	if !tx.Writable() {
+		return bolt.ErrTxNotWritable
+	}
+
+	storer := s.newStorer(dataType)
+
+	err := tx.DeleteBucket(indexBucketName(storer.Type(), indexName))
+	if err != nil && err != bolt.ErrBucketNotFound {
+		return err
+	}
+
+	dropped, err := createMetaBucket(tx, droppedIndexSubsystem)
+	if err != nil {
+		return err
+	}
+
+	return dropped.Put(indexBucketName(storer.Type(), indexName), []byte{})
+}
+
 // IndexExists tests if an index exists for the passed in field name
 func (s *Store) IndexExists(source BucketSource, typeName, indexName string) bool {
 	return (source.Bucket(indexBucketName(typeName, indexName)) != nil)
@@ -148,13 +541,24 @@ func (v *keyList) remove(key []byte) {
 		return bytes.Compare((*v)[i], key) >= 0
 	})
 
-	if i < len(*v) {
+	if i < len(*v) && bytes.Equal((*v)[i], key) {
 		copy((*v)[i:], (*v)[i+1:])
 		(*v)[len(*v)-1] = nil
 		*v = (*v)[:len(*v)-1]
 	}
 }
 
+// intersect returns the keys that are in both lists
+func (v keyList) intersect(other keyList) keyList {
+	result := make(keyList, 0)
+	for i := range v {
+		if other.in(v[i]) {
+			result = append(result, v[i])
+		}
+	}
+	return result
+}
+
 func (v *keyList) in(key []byte) bool {
 	i := sort.Search(len(*v), func(i int) bool {
 		return bytes.Compare((*v)[i], key) >= 0
@@ -164,16 +568,21 @@ func (v *keyList) in(key []byte) bool {
 }
 
 // seekCursor attempts to save reads by seeking the cursor past values it doesn't need to compare since keys
-// are stored in order
-func (s *Store) seekCursor(cursor *bolt.Cursor, criteria []*Criterion) (key, value []byte) {
+// are stored in order.  encode is the encoder of the cursor's keys
+func (s *Store) seekCursor(cursor recordCursor, criteria []*Criterion, encode EncodeFunc) (key, value []byte) {
 	firstKey, firstValue := cursor.First()
 
 	if len(criteria) != 1 || criteria[0].negate {
 		return firstKey, firstValue
 	}
 
+	if criteria[0].epsilon != 0 || s.floatTolerance != 0 {
+		// approximate matches may be anywhere in the encoded key order
+		return firstKey, firstValue
+	}
+
 	if criteria[0].operator == gt || criteria[0].operator == ge || criteria[0].operator == eq {
-		seek, err := s.encode(criteria[0].value)
+		seek, err := encode(criteria[0].value)
 		if err != nil {
 			return cursor.First()
 		}
@@ -188,19 +597,39 @@ func (s *Store) seekCursor(cursor *bolt.Cursor, criteria []*Criterion) (key, val
 
 type iterator struct {
 	keyCache    [][]byte
-	dataBucket  *bolt.Bucket
-	indexCursor *bolt.Cursor
-	nextKeys    func(bool, *bolt.Cursor) ([][]byte, error)
+	dataBucket  *recordBucket
+	indexCursor recordCursor
 	prepCursor  bool
+	keysOnly    bool
 	err         error
+
+	// nextKeys appends the next batch of matching keys to the passed in slice
+	nextKeys func(bool, recordCursor, [][]byte) ([][]byte, error)
+	// keyBuf is the whole of the slice the key batches are read into, which is kept between batches and queries
+	keyBuf [][]byte
+
+	// records already decoded and matched against the query by a parallel scan
+	matched []*record
+	decoded reflect.Value
 }
 
-func (s *Store) newIterator(source BucketSource, typeName string, query *Query) *iterator {
+// iteratorPool holds iterators, and the key batches they've allocated, for reuse by later queries
+var iteratorPool = sync.Pool{
+	New: func() interface{} {
+		return &iterator{
+			keyBuf: make([][]byte, 0, iteratorKeyMinCacheSize),
+		}
+	},
+}
 
-	iter := &iterator{
-		dataBucket: source.Bucket([]byte(typeName)),
-		prepCursor: true,
-	}
+// newIterator returns an iterator over the records that could match the query, which must be released once the
+// query is done with it
+func (s *Store) newIterator(source BucketSource, storer Storer, query *Query) *iterator {
+	typeName := storer.Type()
+
+	iter := iteratorPool.Get().(*iterator)
+	iter.dataBucket = getRecordBucket(source, storer)
+	iter.prepCursor = true
 
 	if iter.dataBucket == nil {
 		return iter
@@ -210,16 +639,34 @@ func (s *Store) newIterator(source BucketSource, typeName string, query *Query)
 
 	//   Key field
 	if query.index == Key && !query.badIndex {
-		iter.indexCursor = source.Bucket([]byte(typeName)).Cursor()
+		iter.indexCursor = iter.dataBucket.Cursor()
+
+		keys, ok, err := s.planIndexes(source, storer, query)
+		if err != nil {
+			iter.err = err
+			return iter
+		}
+		if ok {
+			// only read the records the indexes say could match, still in key order
+			iter.indexCursor = &keyListCursor{keys: keys}
+		} else if s.canScanParallel(source, iter.dataBucket, query) {
+			iter.matched, iter.err = s.scanParallel(source, storer, iter.dataBucket, query)
+			return iter
+		}
 
-		iter.nextKeys = func(prepCursor bool, cursor *bolt.Cursor) ([][]byte, error) {
-			var nKeys [][]byte
+		iter.nextKeys = func(prepCursor bool, cursor recordCursor, nKeys [][]byte) ([][]byte, error) {
 
 			for len(nKeys) < iteratorKeyMinCacheSize {
 				var k []byte
 				if prepCursor {
 					// k, _ = cursor.First()
-					k, _ = s.seekCursor(cursor, criteria)
+					k, _ = s.seekCursor(cursor, criteria, s.encodeKey)
+					if k != nil && query.after != nil && bytes.Compare(k, query.after) <= 0 {
+						k, _ = cursor.Seek(query.after)
+						if bytes.Equal(k, query.after) {
+							k, _ = cursor.Next()
+						}
+					}
 					prepCursor = false
 				} else {
 					k, _ = cursor.Next()
@@ -228,14 +675,24 @@ func (s *Store) newIterator(source BucketSource, typeName string, query *Query)
 					return nKeys, nil
 				}
 
-				val := reflect.New(query.dataType)
 				v := iter.dataBucket.Get(k)
-				err := s.decode(v, val.Interface())
-				if err != nil {
-					return nil, err
+				if v == nil {
+					// dangling index entry
+					continue
 				}
 
-				ok, err := matchesAllCriteria(s, criteria, k, true, val.Interface())
+				// the record is only decoded here if the key is compared to one of its fields
+				var row interface{}
+				if comparesFields(criteria) {
+					val := reflect.New(query.dataType)
+					err := s.decodeRecord(storer, v, val.Interface())
+					if err != nil {
+						return nil, err
+					}
+					row = val.Interface()
+				}
+
+				ok, err := matchesAllCriteria(s, criteria, k, s.decodeKey, row)
 				if err != nil {
 					return nil, err
 				}
@@ -255,20 +712,68 @@ func (s *Store) newIterator(source BucketSource, typeName string, query *Query)
 		iBucket = source.Bucket(indexBucketName(typeName, query.index))
 	}
 
-	if iBucket == nil || hasMatchFunc(criteria) {
+	_, multiEntry := storer.SliceIndexes()[query.index]
+	// element criteria on a multi-entry index only narrow down the candidate records, which are then checked
+	// against the full criteria
+	query.recheckIndex = multiEntry && isElementCriteria(criteria)
+
+	geo := isGeoIndex(storer, query.index)
+
+	if iBucket == nil || hasMatchFunc(criteria) || (geo && !isGeoCriteria(criteria)) ||
+		(!multiEntry && omitsMatchingZero(s, storer, query.index, criteria)) {
 		// bad index or matches Function on indexed field, filter through entire store
 		query.badIndex = true
+		s.indexUsage.record(typeName, query.index, 0, 0, 1)
+
+		if s.canScanParallel(source, iter.dataBucket, query) {
+			iter.matched, iter.err = s.scanParallel(source, storer, iter.dataBucket, query)
+			return iter
+		}
 
-		iter.indexCursor = source.Bucket([]byte(typeName)).Cursor()
+		iter.indexCursor = iter.dataBucket.Cursor()
 
-		iter.nextKeys = func(prepCursor bool, cursor *bolt.Cursor) ([][]byte, error) {
-			var nKeys [][]byte
+		iter.nextKeys = func(prepCursor bool, cursor recordCursor, nKeys [][]byte) ([][]byte, error) {
 
 			for len(nKeys) < iteratorKeyMinCacheSize {
 				var k []byte
 				if prepCursor {
 					// k, _ = cursor.First()
-					k, _ = s.seekCursor(cursor, criteria)
+					k, _ = s.seekCursor(cursor, criteria, s.encodeKey)
+					prepCursor = false
+				} else {
+					k, _ = cursor.Next()
+				}
+				if k == nil {
+					return nKeys, nil
+				}
+
+				nKeys = append(nKeys, k)
+			}
+			return nKeys, nil
+		}
+
+		return iter
+	}
+
+	//   geo index
+	if geo {
+		// the index cells are larger than the area being searched, so the records are checked as well
+		query.recheckIndex = true
+
+		keys, scanned, err := s.geoCandidates(iBucket, criteria)
+		s.indexUsage.record(typeName, query.index, 1, scanned, 0)
+		if err != nil {
+			iter.err = err
+			return iter
+		}
+
+		iter.indexCursor = &keyListCursor{keys: keys}
+		iter.nextKeys = func(prepCursor bool, cursor recordCursor, nKeys [][]byte) ([][]byte, error) {
+
+			for len(nKeys) < iteratorKeyMinCacheSize {
+				var k []byte
+				if prepCursor {
+					k, _ = cursor.First()
 					prepCursor = false
 				} else {
 					k, _ = cursor.Next()
@@ -286,26 +791,57 @@ func (s *Store) newIterator(source BucketSource, typeName string, query *Query)
 	}
 
 	//   indexed field
+	if collator, ok := storer.(IndexCollator); ok && !multiEntry {
+		if collation := collator.IndexCollation(query.index); collation != nil {
+			criteria = collateCriteria(collation, criteria)
+		}
+	}
+
 	iter.indexCursor = iBucket.Cursor()
+	s.indexUsage.record(typeName, query.index, 1, 0, 0)
+
+	sortableType, sortable := sortableIndexType(storer, query.index)
+	sortable = sortable && !multiEntry
+	// the last index key that could match, when the keys are sortable
+	var upper []byte
+
+	// a record can be referenced by several entries in a multi-entry index
+	seen := make(keyList, 0)
 
-	iter.nextKeys = func(prepCursor bool, cursor *bolt.Cursor) ([][]byte, error) {
-		var nKeys [][]byte
+	iter.nextKeys = func(prepCursor bool, cursor recordCursor, nKeys [][]byte) ([][]byte, error) {
+		var scanned int64
+		defer func() {
+			s.indexUsage.record(typeName, query.index, 0, scanned, 0)
+		}()
 
 		for len(nKeys) < iteratorKeyMinCacheSize {
 			var k, v []byte
 			if prepCursor {
-				// k, v = cursor.First()
-				k, v = s.seekCursor(cursor, criteria)
+				if sortable {
+					k, v, upper = s.seekRange(cursor, criteria, sortableType)
+				} else {
+					// k, v = cursor.First()
+					k, v = s.seekCursor(cursor, criteria, s.encode)
+				}
 				prepCursor = false
 			} else {
 				k, v = cursor.Next()
 			}
-			if k == nil {
+			if k == nil || (upper != nil && bytes.Compare(k, upper) > 0) {
 				return nKeys, nil
 			}
-
-			// no currentRow on indexes as it refers to multiple rows
-			ok, err := matchesAllCriteria(s, criteria, k, true, nil)
+			scanned++
+
+			var ok bool
+			var err error
+			if sortable {
+				ok, err = matchesSortable(s, criteria, k, sortableType)
+			} else if query.recheckIndex {
+				ok, err = matchesElement(s, criteria[0], k)
+			} else {
+				// no currentRow on indexes as it refers to multiple rows
+				ok, err = matchesAllCriteria(s, criteria, k, s.decode, nil)
+			}
 			if err != nil {
 				return nil, err
 			}
@@ -318,7 +854,18 @@ func (s *Store) newIterator(source BucketSource, typeName string, query *Query)
 					return nil, err
 				}
 
-				nKeys = append(nKeys, [][]byte(keys)...)
+				if !multiEntry {
+					nKeys = append(nKeys, [][]byte(keys)...)
+					continue
+				}
+
+				for i := range keys {
+					if seen.in(keys[i]) {
+						continue
+					}
+					seen.add(keys[i])
+					nKeys = append(nKeys, keys[i])
+				}
 			}
 
 		}
@@ -330,6 +877,256 @@ func (s *Store) newIterator(source BucketSource, typeName string, query *Query)
 
 }
 
+// ZeroOmitter can be implemented by a Storer to report indexes that don't include records with a zero value in the
+// indexed field, so that queries which could match the zero value don't use them
+type ZeroOmitter interface {
+	// OmittedZero returns the zero value left out of the index, and false if the index includes zero values
+	OmittedZero(indexName string) (interface{}, bool)
+}
+
+// omitsMatchingZero returns true if the index leaves out zero values, and the zero value matches the criteria,
+// in which case the index can't find all of the matching records
+func omitsMatchingZero(s *Store, storer Storer, indexName string, criteria []*Criterion) bool {
+	omitter, ok := storer.(ZeroOmitter)
+	if !ok {
+		return false
+	}
+
+	zero, ok := omitter.OmittedZero(indexName)
+	if !ok {
+		return false
+	}
+
+	match, err := matchesAllCriteria(s, criteria, zero, nil, nil)
+	// if the criteria can't be tested against the zero value alone, don't rely on the index
+	return err != nil || match
+}
+
+// fieldIndexer is implemented by storers that know which of their indexes hold the plain encoded value of a field,
+// and so can be used to look up records matching equality criteria on that field
+type fieldIndexer interface {
+	fieldIndex(field string) (fieldIndex, bool)
+}
+
+type fieldIndex struct {
+	name      string
+	fieldType reflect.Type
+	omitZero  bool
+	sortable  bool
+}
+
+// planIndexes looks for indexes that can narrow down the records read by a query that doesn't specify an index.
+// Each field with Eq or In criteria on a field index is looked up in that index, and the keys found for every
+// field are intersected.  The records are still checked against all of the criteria, so the indexes only need
+// to find a superset of the matching records.  Returns false if no index can be used.
+func (s *Store) planIndexes(source BucketSource, storer Storer, query *Query) (keyList, bool, error) {
+	if !s.autoIndex || s.floatTolerance != 0 {
+		return nil, false, nil
+	}
+
+	indexer, ok := storer.(fieldIndexer)
+	if !ok {
+		return nil, false, nil
+	}
+
+	var fields []string
+	for field := range query.fieldCriteria {
+		if field != Key {
+			fields = append(fields, field)
+		}
+	}
+	// sorted so the plan is the same every time the query is run
+	sort.Strings(fields)
+
+	var keys keyList
+	found := false
+
+	for _, field := range fields {
+		index, ok := indexer.fieldIndex(field)
+		if !ok {
+			continue
+		}
+
+		values := lookupValues(query.fieldCriteria[field], index.fieldType)
+		if values == nil || (index.omitZero && hasZero(values)) {
+			continue
+		}
+
+		iBucket := source.Bucket(indexBucketName(storer.Type(), index.name))
+		if iBucket == nil {
+			continue
+		}
+
+		fieldKeys := make(keyList, 0)
+		for i := range values {
+			var indexKey []byte
+			var err error
+			if index.sortable {
+				indexKey, err = encodeSortable(values[i])
+			} else {
+				indexKey, err = s.encode(values[i])
+			}
+			if err != nil {
+				return nil, false, err
+			}
+
+			v := iBucket.Get(indexKey)
+			if v == nil {
+				continue
+			}
+
+			var entry keyList
+			err = s.decode(v, &entry)
+			if err != nil {
+				return nil, false, err
+			}
+			for j := range entry {
+				fieldKeys.add(entry[j])
+			}
+		}
+		s.indexUsage.record(storer.Type(), index.name, 1, int64(len(values)), 0)
+
+		if !found {
+			keys = fieldKeys
+			found = true
+		} else {
+			keys = keys.intersect(fieldKeys)
+		}
+
+		if len(keys) == 0 {
+			break
+		}
+	}
+
+	return keys, found, nil
+}
+
+// lookupValues returns the values that a field must be equal to one of to match the criteria, or nil if the
+// criteria can't be answered by looking up exact values of the field's type
+func lookupValues(criteria []*Criterion, fieldType reflect.Type) []interface{} {
+	for _, c := range criteria {
+		if c.negate || c.epsilon != 0 {
+			continue
+		}
+
+		var values []interface{}
+		switch c.operator {
+		case eq:
+			values = []interface{}{c.value}
+		case in:
+			values = c.values
+		case custom:
+			if c.custom.Candidates == nil {
+				continue
+			}
+			values = c.custom.Candidates(c.value)
+		default:
+			continue
+		}
+
+		usable := len(values) > 0
+		for i := range values {
+			// values of other types may compare as equal without encoding the same way
+			if values[i] == nil || reflect.TypeOf(values[i]) != fieldType {
+				usable = false
+				break
+			}
+		}
+		if usable {
+			return values
+		}
+	}
+	return nil
+}
+
+func hasZero(values []interface{}) bool {
+	for i := range values {
+		if reflect.ValueOf(values[i]).IsZero() {
+			return true
+		}
+	}
+	return false
+}
+
+// keyListCursor is a cursor over a sorted list of keys, without values
+type keyListCursor struct {
+	keys keyList
+	pos  int
+}
+
+func (c *keyListCursor) First() ([]byte, []byte) {
+	c.pos = 0
+	return c.current()
+}
+
+func (c *keyListCursor) Next() ([]byte, []byte) {
+	c.pos++
+	return c.current()
+}
+
+func (c *keyListCursor) Seek(seek []byte) ([]byte, []byte) {
+	c.pos = sort.Search(len(c.keys), func(i int) bool {
+		return bytes.Compare(c.keys[i], seek) >= 0
+	})
+	return c.current()
+}
+
+func (c *keyListCursor) current() ([]byte, []byte) {
+	if c.pos >= len(c.keys) {
+		return nil, nil
+	}
+	return c.keys[c.pos], nil
+}
+
+// isElementCriteria returns true if all of the criteria are slice membership tests, which can be answered from
+// an index holding each element of the slice separately
+func isElementCriteria(criteria []*Criterion) bool {
+	if len(criteria) == 0 {
+		return false
+	}
+	for _, c := range criteria {
+		if c.negate {
+			return false
+		}
+		switch c.operator {
+		case contains:
+		case any, all:
+			if len(c.values) == 0 {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// matchesElement tests if the encoded element from a multi-entry index is one of the values the criterion is looking
+// for.  Any record that matches the criterion must have at least one such element.
+func matchesElement(s *Store, c *Criterion, element []byte) (bool, error) {
+	values := c.values
+	if c.operator == contains {
+		values = []interface{}{c.value}
+	}
+
+	for i := range values {
+		elemValue := newElemType(values[i])
+		err := s.decode(element, elemValue)
+		if err != nil {
+			return false, err
+		}
+
+		result, err := c.compare(elemValue, values[i], nil)
+		if err != nil {
+			return false, err
+		}
+		if result == 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
 // Next returns the next key value that matches the iterators criteria
 // If no more kv's are available the return nil, if there is an error, they return nil
 // and iterator.Error() will return the error
@@ -342,28 +1139,44 @@ func (i *iterator) Next() (key []byte, value []byte) {
 		return nil, nil
 	}
 
+	if i.matched != nil {
+		if len(i.matched) == 0 {
+			return nil, nil
+		}
+		r := i.matched[0]
+		i.matched = i.matched[1:]
+		i.decoded = r.value
+		return r.key, nil
+	}
+
 	if i.nextKeys == nil {
 		return nil, nil
 	}
 
 	if len(i.keyCache) == 0 {
-		newKeys, err := i.nextKeys(i.prepCursor, i.indexCursor)
+		// every key in the batch has been returned, so the next batch can reuse its slice
+		newKeys, err := i.nextKeys(i.prepCursor, i.indexCursor, i.keyBuf[:0])
 		i.prepCursor = false
 		if err != nil {
 			i.err = err
 			return nil, nil
 		}
 
+		i.keyBuf = newKeys
 		if len(newKeys) == 0 {
 			return nil, nil
 		}
 
-		i.keyCache = append(i.keyCache, newKeys...)
+		i.keyCache = newKeys
 	}
 
 	nextKey := i.keyCache[0]
 	i.keyCache = i.keyCache[1:]
 
+	if i.keysOnly {
+		return nextKey, nil
+	}
+
 	val := i.dataBucket.Get(nextKey)
 
 	return nextKey, val
@@ -373,3 +1186,16 @@ func (i *iterator) Next() (key []byte, value []byte) {
 func (i *iterator) Error() error {
 	return i.err
 }
+
+// release returns the iterator to the pool, dropping everything it holds from the query's transaction
+func (i *iterator) release() {
+	keys := i.keyBuf[:cap(i.keyBuf)]
+	for j := range keys {
+		keys[j] = nil
+	}
+
+	*i = iterator{
+		keyBuf: keys[:0],
+	}
+	iteratorPool.Put(i)
+}
@@ -5,7 +5,9 @@
 package bolthold_test
 
 import (
+	"os"
 	"testing"
+	"time"
 
 	bh "github.com/timshannon/bolthold"
 	bolt "go.etcd.io/bbolt"
@@ -122,3 +124,506 @@ func TestSliceIndexWithPointers(t *testing.T) {
 		equals(t, len(es), 1)
 	})
 }
+
+func TestMultiEntryIndex(t *testing.T) {
+	type Post struct {
+		ID   uint64
+		Tags []string `boltholdIndex:"Tags"`
+	}
+
+	testWrap(t, func(store *bh.Store, t *testing.T) {
+		ok(t, store.Insert(uint64(1), &Post{ID: 1, Tags: []string{"go", "db", "bolt"}}))
+		ok(t, store.Insert(uint64(2), &Post{ID: 2, Tags: []string{"go", "web"}}))
+		ok(t, store.Insert(uint64(3), &Post{ID: 3, Tags: []string{"rust"}}))
+
+		ok(t, store.Bolt().View(func(tx *bolt.Tx) error {
+			bucket := tx.Bucket([]byte("_index:Post:Tags"))
+			assert(t, bucket != nil, "No index bucket found for Tags index")
+			equals(t, bucket.Stats().KeyN, 5)
+			return nil
+		}))
+
+		var posts []Post
+		ok(t, store.Find(&posts, bh.Where("Tags").Contains("go").Index("Tags")))
+		equals(t, len(posts), 2)
+
+		posts = nil
+		ok(t, store.Find(&posts, bh.Where("Tags").ContainsAny("db", "web", "bolt").Index("Tags")))
+		equals(t, len(posts), 2)
+
+		posts = nil
+		ok(t, store.Find(&posts, bh.Where("Tags").ContainsAll("go", "db").Index("Tags")))
+		equals(t, len(posts), 1)
+		equals(t, posts[0].ID, uint64(1))
+
+		posts = nil
+		ok(t, store.Find(&posts, bh.Where("Tags").Contains("go").Index("Tags").
+			And("Tags").Contains("web")))
+		equals(t, len(posts), 1)
+		equals(t, posts[0].ID, uint64(2))
+	})
+}
+
+func TestByteSliceIndex(t *testing.T) {
+	type Blob struct {
+		ID   uint64
+		Hash []byte `boltholdIndex:"Hash"`
+	}
+
+	testWrap(t, func(store *bh.Store, t *testing.T) {
+		ok(t, store.Insert(uint64(1), &Blob{ID: 1, Hash: []byte{1, 2}}))
+		ok(t, store.Insert(uint64(2), &Blob{ID: 2, Hash: []byte{1, 2}}))
+		ok(t, store.Insert(uint64(3), &Blob{ID: 3, Hash: []byte{1}}))
+
+		// a []byte is indexed as a single value, not one entry per byte
+		ok(t, store.Bolt().View(func(tx *bolt.Tx) error {
+			equals(t, tx.Bucket([]byte("_index:Blob:Hash")).Stats().KeyN, 2)
+			return nil
+		}))
+
+		var blobs []Blob
+		ok(t, store.Find(&blobs, bh.Where("Hash").Eq([]byte{1, 2}).Index("Hash")))
+		equals(t, len(blobs), 2)
+	})
+}
+
+func TestIndexStats(t *testing.T) {
+	testWrap(t, func(store *bh.Store, t *testing.T) {
+		insertTestData(t, store)
+
+		equals(t, 0, len(store.IndexStats()))
+
+		var result []ItemTest
+		ok(t, store.Find(&result, bh.Where("Category").Eq("vehicle").Index("Category")))
+		ok(t, store.Find(&result, bh.Where("Category").Eq("food").Index("Category")))
+		ok(t, store.Find(&result, bh.Where("Category").MatchFunc(func(ra *bh.RecordAccess) (bool, error) {
+			return true, nil
+		}).Index("Category")))
+		ok(t, store.Find(&result, bh.Where("Name").Eq("car")))
+
+		stats := store.IndexStats()
+		equals(t, 1, len(stats))
+		equals(t, "ItemTest", stats[0].Type)
+		equals(t, "Category", stats[0].Index)
+		equals(t, int64(2), stats[0].Chosen)
+		equals(t, int64(1), stats[0].FullScans)
+		assert(t, stats[0].KeysScanned > 0, "No index keys were counted as scanned")
+	})
+}
+
+func TestIndexOmitZero(t *testing.T) {
+	type Comment struct {
+		ID       int
+		ParentID int `boltholdIndex:"ParentID" boltholdOmitZero:""`
+	}
+
+	testWrap(t, func(store *bh.Store, t *testing.T) {
+		for i := 1; i <= 10; i++ {
+			parent := 0
+			if i%5 == 0 {
+				parent = i - 1
+			}
+			ok(t, store.Insert(i, &Comment{ID: i, ParentID: parent}))
+		}
+
+		indexes, err := store.Indexes(&Comment{})
+		ok(t, err)
+		equals(t, 1, len(indexes))
+		equals(t, 2, indexes[0].Entries)
+
+		var result []Comment
+		ok(t, store.Find(&result, bh.Where("ParentID").Eq(4).Index("ParentID")))
+		equals(t, 1, len(result))
+		equals(t, 5, result[0].ID)
+
+		// the zero value isn't in the index, so all records are scanned
+		result = nil
+		ok(t, store.Find(&result, bh.Where("ParentID").Eq(0).Index("ParentID")))
+		equals(t, 8, len(result))
+
+		result = nil
+		ok(t, store.Find(&result, bh.Where("ParentID").Lt(5).Index("ParentID")))
+		equals(t, 9, len(result))
+
+		result = nil
+		ok(t, store.Find(&result, bh.Where("ParentID").Eq(0)))
+		equals(t, 8, len(result))
+
+		stats := store.IndexStats()
+		equals(t, 1, len(stats))
+		equals(t, int64(1), stats[0].Chosen)
+		equals(t, int64(2), stats[0].FullScans)
+	})
+}
+
+func TestSortableIndexKeys(t *testing.T) {
+	type Measurement struct {
+		ID    int
+		Value int       `boltholdIndex:"Value"`
+		Temp  float64   `boltholdIndex:"Temp"`
+		Taken time.Time `boltholdIndex:"Taken"`
+	}
+
+	filename := tempfile()
+	store, err := bh.Open(filename, 0666, &bh.Options{SortableIndexKeys: true})
+	ok(t, err)
+	defer store.Close()
+	defer os.Remove(filename)
+
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := -100; i < 100; i++ {
+		ok(t, store.Insert(i, &Measurement{
+			ID:    i,
+			Value: i * 300,
+			Temp:  float64(i) / 4,
+			Taken: start.Add(time.Duration(i) * time.Hour),
+		}))
+	}
+
+	var result []Measurement
+	ok(t, store.Find(&result, bh.Where("Value").Ge(-900).And("Value").Lt(900).Index("Value")))
+	equals(t, 6, len(result))
+
+	stats := store.IndexStats()
+	equals(t, 1, len(stats))
+	// only the matching part of the index is read, plus the key that ends the range
+	assert(t, stats[0].KeysScanned <= 7, "the whole index was scanned")
+
+	result = nil
+	ok(t, store.Find(&result, bh.Where("Temp").Gt(-1.0).And("Temp").Le(0.5).Index("Temp")))
+	equals(t, 6, len(result))
+
+	// a float key can't be compared with an int without truncating it, the same as without sortable keys
+	result = nil
+	_, isMismatch := store.Find(&result, bh.Where("Temp").Gt(0).Index("Temp")).(*bh.ErrTypeMismatch)
+	assert(t, isMismatch, "comparing a float index with an int didn't fail with ErrTypeMismatch")
+
+	// but an int key can be compared with a float
+	result = nil
+	ok(t, store.Find(&result, bh.Where("Value").Gt(29400.5).Index("Value")))
+	equals(t, 1, len(result))
+
+	result = nil
+	ok(t, store.Find(&result, bh.Where("Taken").Lt(start).Index("Taken")))
+	equals(t, 100, len(result))
+
+	result = nil
+	ok(t, store.Find(&result, bh.Where("Value").Eq(-29700).Index("Value")))
+	equals(t, 1, len(result))
+	equals(t, -99, result[0].ID)
+
+	// values of another type are converted
+	result = nil
+	ok(t, store.Find(&result, bh.Where("Value").In(int64(0), int64(300)).Index("Value")))
+	equals(t, 2, len(result))
+
+	// and are still found without an explicit index
+	result = nil
+	ok(t, store.Find(&result, bh.Where("Value").Eq(600)))
+	equals(t, 1, len(result))
+	equals(t, 2, result[0].ID)
+
+	problems, err := store.CheckIndexes(&Measurement{}, false)
+	ok(t, err)
+	equals(t, 0, len(problems))
+}
+
+func TestAutoIndex(t *testing.T) {
+	filename := tempfile()
+	store, err := bh.Open(filename, 0666, &bh.Options{EnableAutoIndex: true})
+	ok(t, err)
+	defer store.Close()
+	defer os.Remove(filename)
+
+	insertTestData(t, store)
+
+	var expected []ItemTest
+	for i := range testData {
+		if testData[i].Category == "vehicle" && testData[i].Name != "car" {
+			expected = append(expected, testData[i])
+		}
+	}
+
+	var result []ItemTest
+	ok(t, store.Find(&result, bh.Where("Name").Ne("car").And("Category").Eq("vehicle")))
+	equals(t, len(expected), len(result))
+	for i := range result {
+		// still returned in key order
+		equals(t, expected[i].Key, result[i].Key)
+	}
+
+	stats := store.IndexStats()
+	equals(t, 1, len(stats))
+	equals(t, "Category", stats[0].Index)
+	equals(t, int64(1), stats[0].Chosen)
+
+	// both indexes are intersected
+	result = nil
+	ok(t, store.Find(&result, bh.Where("Category").In("vehicle", "animal").And("UpdateIndex").Eq("missing")))
+	equals(t, 0, len(result))
+	equals(t, 2, len(store.IndexStats()))
+
+	// values of a different type than the field can't be looked up
+	_, err = store.Count(&ItemTest{}, bh.Where("Category").Eq(bh.Field("Color")))
+	ok(t, err)
+	equals(t, int64(2), store.IndexStats()[0].Chosen)
+}
+
+func TestAutoIndexOff(t *testing.T) {
+	testWrap(t, func(store *bh.Store, t *testing.T) {
+		insertTestData(t, store)
+
+		var result []ItemTest
+		ok(t, store.Find(&result, bh.Where("Category").Eq("vehicle")))
+		assert(t, len(result) > 0, "no results found")
+		equals(t, 0, len(store.IndexStats()))
+
+		// an index missing records isn't used unless it's asked for
+		ok(t, store.RemoveIndex(&ItemTest{}, "Category"))
+		ok(t, store.Insert(1000, ItemTest{Key: 1000, Name: "van", Category: "vehicle"}))
+
+		var after []ItemTest
+		ok(t, store.Find(&after, bh.Where("Category").Eq("vehicle")))
+		equals(t, len(result)+1, len(after))
+	})
+}
+
+func TestIndexCollation(t *testing.T) {
+	type Person struct {
+		ID   int
+		Name string `boltholdIndex:"Name" boltholdCollate:"nocase"`
+	}
+
+	testWrap(t, func(store *bh.Store, t *testing.T) {
+		ok(t, store.Insert(1, &Person{ID: 1, Name: "Alice"}))
+		ok(t, store.Insert(2, &Person{ID: 2, Name: "bob"}))
+		ok(t, store.Insert(3, &Person{ID: 3, Name: "Carol"}))
+
+		var result []Person
+		ok(t, store.Find(&result, bh.Where("Name").Eq("ALICE").Index("Name")))
+		equals(t, 1, len(result))
+		equals(t, "Alice", result[0].Name)
+
+		result = nil
+		ok(t, store.Find(&result, bh.Where("Name").Ge("B").Index("Name")))
+		equals(t, 2, len(result))
+
+		result = nil
+		ok(t, store.Find(&result, bh.Where("Name").In("BOB", "carol").Index("Name")))
+		equals(t, 2, len(result))
+	})
+}
+
+func TestIndexCollationUndefined(t *testing.T) {
+	type Person struct {
+		Name string `boltholdIndex:"Name" boltholdCollate:"missing"`
+	}
+
+	testWrap(t, func(store *bh.Store, t *testing.T) {
+		defer func() {
+			assert(t, recover() != nil, "No panic on an undefined collation")
+		}()
+
+		_ = store.Insert(1, &Person{Name: "Alice"})
+	})
+}
+
+type Ticket struct {
+	ID       int
+	Status   string `boltholdIndex:"Status" boltholdFilter:"IsOpen"`
+	Archived bool
+}
+
+func (t *Ticket) IsOpen() bool {
+	return !t.Archived
+}
+
+func TestPartialIndex(t *testing.T) {
+	testWrap(t, func(store *bh.Store, t *testing.T) {
+		ok(t, store.Insert(1, Ticket{ID: 1, Status: "new"}))
+		ok(t, store.Insert(2, &Ticket{ID: 2, Status: "new", Archived: true}))
+		ok(t, store.Insert(3, &Ticket{ID: 3, Status: "done"}))
+
+		ok(t, store.Bolt().View(func(tx *bolt.Tx) error {
+			bucket := tx.Bucket([]byte("_index:Ticket:Status"))
+			assert(t, bucket != nil, "No index bucket found for Status index")
+			equals(t, 2, bucket.Stats().KeyN)
+			return nil
+		}))
+
+		var result []Ticket
+		ok(t, store.Find(&result, bh.Where("Status").Eq("new").Index("Status")))
+		equals(t, 1, len(result))
+		equals(t, 1, result[0].ID)
+
+		// archiving removes the record from the index, and un-archiving adds it back
+		ok(t, store.Update(1, &Ticket{ID: 1, Status: "new", Archived: true}))
+		ok(t, store.Update(2, &Ticket{ID: 2, Status: "new"}))
+
+		result = nil
+		ok(t, store.Find(&result, bh.Where("Status").Eq("new").Index("Status")))
+		equals(t, 1, len(result))
+		equals(t, 2, result[0].ID)
+
+		result = nil
+		ok(t, store.Find(&result, bh.Where("Status").Eq("new")))
+		equals(t, 2, len(result))
+	})
+}
+
+func TestPartialIndexInvalidFilter(t *testing.T) {
+	type Item struct {
+		Status string `boltholdIndex:"Status" boltholdFilter:"Missing"`
+	}
+
+	testWrap(t, func(store *bh.Store, t *testing.T) {
+		defer func() {
+			assert(t, recover() != nil, "No panic on an undefined filter method")
+		}()
+
+		_ = store.Insert(1, &Item{Status: "new"})
+	})
+}
+
+func TestIndexUsage(t *testing.T) {
+	testWrap(t, func(store *bh.Store, t *testing.T) {
+		insertTestData(t, store)
+
+		var result []ItemTest
+		ok(t, store.Find(&result, bh.Where("Category").Eq("vehicle").Index("Category")))
+
+		usage, err := store.IndexUsage()
+		ok(t, err)
+
+		found := make(map[string]bh.IndexStats)
+		for i := range usage {
+			equals(t, "ItemTest", usage[i].Type)
+			found[usage[i].Index] = usage[i]
+		}
+
+		equals(t, int64(1), found["Category"].Chosen)
+
+		unused, exists := found["UpdateIndex"]
+		assert(t, exists, "Unused index is not included in the usage report")
+		equals(t, int64(0), unused.Chosen)
+	})
+}
+
+func TestDisableIndexStats(t *testing.T) {
+	filename := tempfile()
+	store, err := bh.Open(filename, 0666, &bh.Options{DisableIndexStats: true})
+	ok(t, err)
+	defer os.Remove(filename)
+	defer store.Close()
+
+	insertTestData(t, store)
+
+	var result []ItemTest
+	ok(t, store.Find(&result, bh.Where("Category").Eq("vehicle").Index("Category")))
+	equals(t, 0, len(store.IndexStats()))
+}
+
+func TestCheckIndexes(t *testing.T) {
+	testWrap(t, func(store *bh.Store, t *testing.T) {
+		insertTestData(t, store)
+
+		problems, err := store.CheckIndexes(&ItemTest{}, false)
+		ok(t, err)
+		equals(t, 0, len(problems))
+
+		// corrupt the Category index by moving the vehicle entries to a bogus value
+		ok(t, store.Bolt().Update(func(tx *bolt.Tx) error {
+			bucket := tx.Bucket([]byte("_index:ItemTest:Category"))
+			c := bucket.Cursor()
+			for k, v := c.First(); k != nil; k, v = c.Next() {
+				var category string
+				ok(t, bh.DefaultDecode(k, &category))
+				if category != "vehicle" {
+					continue
+				}
+				bogus, err := bh.DefaultEncode("bogus")
+				if err != nil {
+					return err
+				}
+				err = bucket.Put(bogus, v)
+				if err != nil {
+					return err
+				}
+				return bucket.Delete(k)
+			}
+			return nil
+		}))
+
+		vehicles := 0
+		for i := range testData {
+			if testData[i].Category == "vehicle" {
+				vehicles++
+			}
+		}
+
+		problems, err = store.CheckIndexes(&ItemTest{}, false)
+		ok(t, err)
+		equals(t, vehicles*2, len(problems))
+
+		dangling := 0
+		for i := range problems {
+			equals(t, "Category", problems[i].Index)
+			if problems[i].Dangling {
+				dangling++
+			}
+		}
+		equals(t, vehicles, dangling)
+
+		problems, err = store.CheckIndexes(&ItemTest{}, true)
+		ok(t, err)
+		equals(t, vehicles*2, len(problems))
+
+		problems, err = store.CheckIndexes(&ItemTest{}, false)
+		ok(t, err)
+		equals(t, 0, len(problems))
+
+		var result []ItemTest
+		ok(t, store.Find(&result, bh.Where("Category").Eq("vehicle").Index("Category")))
+		equals(t, vehicles, len(result))
+	})
+}
+
+func TestIteratorReuse(t *testing.T) {
+	testWrap(t, func(store *bh.Store, t *testing.T) {
+		insertTestData(t, store)
+
+		var want []ItemTest
+		ok(t, store.Find(&want, bh.Where("Category").Eq("food").Index("Category")))
+
+		// queries that stop part way through a batch of keys don't leave them behind for the next query
+		for i := 0; i < 10; i++ {
+			var first []ItemTest
+			ok(t, store.Find(&first, bh.Where("Name").Ne("").Limit(1)))
+			equals(t, 1, len(first))
+
+			var got []ItemTest
+			ok(t, store.Find(&got, bh.Where("Category").Eq("food").Index("Category")))
+			equals(t, len(want), len(got))
+			for j := range want {
+				equals(t, want[j].Key, got[j].Key)
+			}
+		}
+	})
+}
+
+func TestIndexRemoveMissingKey(t *testing.T) {
+	testWrap(t, func(store *bh.Store, t *testing.T) {
+		ok(t, store.Insert(1, &ItemTest{Key: 1, Category: "food"}))
+		ok(t, store.RemoveIndex(&ItemTest{}, "Category"))
+		// the index is rebuilt from this write only, so it doesn't hold the first record
+		ok(t, store.Insert(2, &ItemTest{Key: 2, Category: "food"}))
+
+		// removing a key that isn't in the index entry must leave the other keys alone
+		ok(t, store.Delete(1, &ItemTest{}))
+
+		var result []ItemTest
+		ok(t, store.Find(&result, bh.Where("Category").Eq("food").Index("Category")))
+		equals(t, 1, len(result))
+		equals(t, 2, result[0].Key)
+	})
+}
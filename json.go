@@ -0,0 +1,125 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package bolthold
+
+import (
+	"encoding/json"
+	"io"
+	"reflect"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// FindJSON writes the records that match the query to w as a JSON array.  Records are written as they are read, so
+// the full result set is never held in memory unless the query is sorted.  dataType is an example of the type
+// to query, and records are decoded into it before being re-encoded as JSON, so the store can use any encoder
+func (s *Store) FindJSON(w io.Writer, dataType interface{}, query *Query) error {
+	return s.Bolt().View(func(tx *bolt.Tx) error {
+		return s.TxFindJSON(tx, w, dataType, query)
+	})
+}
+
+// TxFindJSON is the same as FindJSON but you get to specify your transaction
+func (s *Store) TxFindJSON(tx *bolt.Tx, w io.Writer, dataType interface{}, query *Query) error {
+	return s.findJSON(tx, w, dataType, query, false)
+}
+
+// FindJSONInBucket is the same as FindJSON but you get to specify your parent bucket
+func (s *Store) FindJSONInBucket(parent *bolt.Bucket, w io.Writer, dataType interface{}, query *Query) error {
+	return s.findJSON(parent, w, dataType, query, false)
+}
+
+// FindNDJSON is the same as FindJSON, but writes each record as its own line of JSON (newline delimited JSON)
+// instead of a single array
+func (s *Store) FindNDJSON(w io.Writer, dataType interface{}, query *Query) error {
+	return s.Bolt().View(func(tx *bolt.Tx) error {
+		return s.TxFindNDJSON(tx, w, dataType, query)
+	})
+}
+
+// TxFindNDJSON is the same as FindNDJSON but you get to specify your transaction
+func (s *Store) TxFindNDJSON(tx *bolt.Tx, w io.Writer, dataType interface{}, query *Query) error {
+	return s.findJSON(tx, w, dataType, query, true)
+}
+
+// FindNDJSONInBucket is the same as FindNDJSON but you get to specify your parent bucket
+func (s *Store) FindNDJSONInBucket(parent *bolt.Bucket, w io.Writer, dataType interface{}, query *Query) error {
+	return s.findJSON(parent, w, dataType, query, true)
+}
+
+func (s *Store) findJSON(source BucketSource, w io.Writer, dataType interface{}, query *Query, lines bool) error {
+	tp := reflect.TypeOf(dataType)
+	for tp.Kind() == reflect.Ptr {
+		tp = tp.Elem()
+	}
+
+	var keyField string
+	if field, ok := decodedKeyField(tp); ok {
+		keyField = field.Name
+	}
+
+	dataType = reflect.New(tp).Interface()
+
+	query, err := s.prepQuery(dataType, query)
+	if err != nil {
+		return err
+	}
+
+	separator := []byte(",")
+	if lines {
+		separator = []byte("\n")
+	} else {
+		_, err = w.Write([]byte("["))
+		if err != nil {
+			return err
+		}
+	}
+
+	first := true
+
+	err = s.runQuery(source, dataType, query, nil, query.skip, func(r *record) error {
+		if keyField != "" {
+			rowKey := r.value
+			for rowKey.Kind() == reflect.Ptr {
+				rowKey = rowKey.Elem()
+			}
+			err := s.decodeKey(r.key, rowKey.FieldByName(keyField).Addr().Interface())
+			if err != nil {
+				return err
+			}
+		}
+
+		data, err := json.Marshal(r.value.Interface())
+		if err != nil {
+			return err
+		}
+
+		if !first && !lines {
+			_, err = w.Write(separator)
+			if err != nil {
+				return err
+			}
+		}
+		first = false
+
+		_, err = w.Write(data)
+		if err != nil {
+			return err
+		}
+
+		if lines {
+			_, err = w.Write(separator)
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if !lines {
+		_, err = w.Write([]byte("]"))
+	}
+	return err
+}
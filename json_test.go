@@ -0,0 +1,95 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package bolthold_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/timshannon/bolthold"
+)
+
+func TestFindJSON(t *testing.T) {
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		insertTestData(t, store)
+
+		query := bolthold.Where("Category").Eq("vehicle").Index("Category")
+
+		var expected []ItemTest
+		ok(t, store.Find(&expected, query))
+
+		var buff bytes.Buffer
+		ok(t, store.FindJSON(&buff, &ItemTest{}, query))
+
+		var result []ItemTest
+		ok(t, json.Unmarshal(buff.Bytes(), &result))
+		equals(t, len(expected), len(result))
+		for i := range expected {
+			assert(t, expected[i].equal(&result[i]), "%v != %v", expected[i], result[i])
+		}
+
+		buff.Reset()
+		ok(t, store.FindNDJSON(&buff, &ItemTest{}, query))
+
+		scanner := bufio.NewScanner(&buff)
+		count := 0
+		for scanner.Scan() {
+			var item ItemTest
+			ok(t, json.Unmarshal(scanner.Bytes(), &item))
+			assert(t, expected[count].equal(&item), "%v != %v", expected[count], item)
+			count++
+		}
+		equals(t, len(expected), count)
+
+		buff.Reset()
+		ok(t, store.FindJSON(&buff, &ItemTest{}, bolthold.Where("Name").Eq("missing")))
+		equals(t, "[]", buff.String())
+	})
+}
+
+func TestExportMatching(t *testing.T) {
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		insertTestData(t, store)
+
+		query := bolthold.Where("Category").Eq("vehicle").Index("Category")
+
+		var expected []ItemTest
+		ok(t, store.Find(&expected, query))
+
+		var ndjson, exported bytes.Buffer
+		ok(t, store.FindNDJSON(&ndjson, &ItemTest{}, query))
+		ok(t, store.ExportMatching(&exported, &ItemTest{}, query, bolthold.ExportNDJSON))
+		equals(t, ndjson.String(), exported.String())
+
+		exported.Reset()
+		ok(t, store.ExportMatching(&exported, &ItemTest{}, query, bolthold.ExportCSV))
+
+		rows, err := csv.NewReader(&exported).ReadAll()
+		ok(t, err)
+		equals(t, len(expected)+1, len(rows))
+		equals(t, []string{"Key", "ID", "Name", "Category", "Created", "Tags", "Color", "Fruit", "UpdateField",
+			"UpdateIndex", "MapVal"}, rows[0])
+
+		for i := range expected {
+			row := rows[i+1]
+			equals(t, strconv.Itoa(expected[i].ID), row[1])
+			equals(t, expected[i].Name, row[2])
+			equals(t, expected[i].Category, row[3])
+			equals(t, expected[i].Created.Format(time.RFC3339Nano), row[4])
+
+			tags, err := json.Marshal(expected[i].Tags)
+			ok(t, err)
+			equals(t, string(tags), row[5])
+		}
+
+		assert(t, store.ExportMatching(&exported, &ItemTest{}, query, bolthold.ExportFormat(100)) != nil,
+			"No error for an unknown format")
+	})
+}
@@ -0,0 +1,172 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package bolthold
+
+import (
+	"encoding"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// orderedTimeFormat is RFC 3339 with a fixed number of fractional digits, so that times sort in order
+const orderedTimeFormat = "2006-01-02T15:04:05.000000000Z07:00"
+
+// OrderedKeyEncode is a KeyEncoder which encodes keys as readable text that sorts in the same order as the keys:
+//
+//   - strings and []byte are stored as they are
+//   - unsigned integers are zero-padded to 20 digits
+//   - signed integers are zero-padded to 19 digits, and negative integers are stored as a '-' followed by their
+//     distance from math.MinInt64, so they sort before positive integers
+//   - time.Time is stored in UTC in RFC 3339 format, with nanoseconds
+//   - types that implement encoding.BinaryMarshaler, but not encoding.TextMarshaler, are stored as the bytes from
+//     MarshalBinary, so they sort in the same order as those bytes.  A big endian, fixed width encoding keeps
+//     numeric IDs in order
+//
+// Other types are stored with their MarshalText method, if they have one, which may not sort in order
+func OrderedKeyEncode(value interface{}) ([]byte, error) {
+	switch v := value.(type) {
+	case string:
+		return []byte(v), nil
+	case []byte:
+		return v, nil
+	case time.Time:
+		return []byte(v.UTC().Format(orderedTimeFormat)), nil
+	case encoding.TextMarshaler:
+		return v.MarshalText()
+	case encoding.BinaryMarshaler:
+		return v.MarshalBinary()
+	}
+
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.String:
+		return []byte(rv.String()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return []byte(fmt.Sprintf("%020d", rv.Uint())), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i := rv.Int()
+		if i < 0 {
+			return []byte(fmt.Sprintf("-%019d", uint64(i-math.MinInt64))), nil
+		}
+		return []byte(fmt.Sprintf("%019d", i)), nil
+	case reflect.Slice:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			return rv.Bytes(), nil
+		}
+	}
+
+	return nil, fmt.Errorf("OrderedKeyEncode can't encode keys of type %T", value)
+}
+
+// OrderedKeyDecode is the KeyDecoder for keys encoded with OrderedKeyEncode
+func OrderedKeyDecode(data []byte, value interface{}) error {
+	switch v := value.(type) {
+	case *string:
+		*v = string(data)
+		return nil
+	case *[]byte:
+		*v = append([]byte(nil), data...)
+		return nil
+	case *time.Time:
+		t, err := time.Parse(orderedTimeFormat, string(data))
+		if err != nil {
+			return err
+		}
+		*v = t
+		return nil
+	case encoding.TextUnmarshaler:
+		return v.UnmarshalText(data)
+	case encoding.BinaryUnmarshaler:
+		return v.UnmarshalBinary(append([]byte(nil), data...))
+	}
+
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("OrderedKeyDecode needs a non-nil pointer, not a %T", value)
+	}
+	rv = rv.Elem()
+
+	switch rv.Kind() {
+	case reflect.String:
+		rv.SetString(string(data))
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u, err := strconv.ParseUint(string(data), 10, rv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		rv.SetUint(u)
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var i int64
+		if len(data) > 0 && data[0] == '-' {
+			u, err := strconv.ParseUint(string(data[1:]), 10, 64)
+			if err != nil {
+				return err
+			}
+			i = int64(u) + math.MinInt64
+		} else {
+			var err error
+			i, err = strconv.ParseInt(string(data), 10, 64)
+			if err != nil {
+				return err
+			}
+		}
+		if rv.OverflowInt(i) {
+			return fmt.Errorf("The key %s overflows a %s", data, rv.Type())
+		}
+		rv.SetInt(i)
+		return nil
+	case reflect.Slice:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			rv.SetBytes(append([]byte(nil), data...))
+			return nil
+		}
+	}
+
+	return fmt.Errorf("OrderedKeyDecode can't decode keys into a %T", value)
+}
+
+// DecodeKey decodes raw, a key as it's stored in the bucket of dataType's type, such as one read from a Cursor or a
+// Result, into out, which must be a pointer.  If out is a pointer to an empty interface, it's set to the key decoded
+// as the type of the type's key field, or as a CompositeKey if the type has composite key fields
+func (s *Store) DecodeKey(dataType interface{}, raw []byte, out interface{}) error {
+	target, ok := out.(*interface{})
+	if !ok {
+		return s.decodeKey(raw, out)
+	}
+
+	tp, ok := keyType(dataType)
+	if !ok {
+		return fmt.Errorf("The type %T has no key field, so the type of its keys isn't known", dataType)
+	}
+
+	key := reflect.New(tp)
+	err := s.decodeKey(raw, key.Interface())
+	if err != nil {
+		return err
+	}
+	*target = key.Elem().Interface()
+	return nil
+}
+
+// keyType returns the type of the keys of dataType's type, if it can be told from its key fields
+func keyType(dataType interface{}) (reflect.Type, bool) {
+	tp := reflect.TypeOf(dataType)
+	for tp.Kind() == reflect.Ptr {
+		tp = tp.Elem()
+	}
+
+	if compositeKeyFields(tp) != nil {
+		return reflect.TypeOf(CompositeKey{}), true
+	}
+	if field, ok := decodedKeyField(tp); ok {
+		return field.Type, true
+	}
+	return nil, false
+}
@@ -0,0 +1,210 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package bolthold_test
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/timshannon/bolthold"
+	bolt "go.etcd.io/bbolt"
+)
+
+type Sample struct {
+	ID    int64 `boltholdKey:"ID"`
+	Value float64
+}
+
+func TestKeyEncoder(t *testing.T) {
+	filename := tempfile()
+	store, err := bolthold.Open(filename, 0666, &bolthold.Options{
+		KeyEncoder: bolthold.OrderedKeyEncode,
+		KeyDecoder: bolthold.OrderedKeyDecode,
+	})
+	ok(t, err)
+	defer store.Close()
+	defer os.Remove(filename)
+
+	ids := []int64{5, -3, 1000, math.MinInt64, 0, math.MaxInt64, -250}
+	for _, id := range ids {
+		ok(t, store.Insert(id, &Sample{Value: float64(id)}))
+	}
+
+	var keys []string
+	ok(t, store.Bolt().View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte("Sample")).ForEach(func(k, v []byte) error {
+			keys = append(keys, string(k))
+			return nil
+		})
+	}))
+	equals(t, []string{
+		"-0000000000000000000",
+		"-9223372036854775558",
+		"-9223372036854775805",
+		"0000000000000000000",
+		"0000000000000000005",
+		"0000000000000001000",
+		"9223372036854775807",
+	}, keys)
+
+	var result Sample
+	ok(t, store.Get(int64(-250), &result))
+	equals(t, Sample{ID: -250, Value: -250}, result)
+
+	var results []Sample
+	ok(t, store.Find(&results, bolthold.Where(bolthold.Key).Ge(int64(-3)).And(bolthold.Key).Lt(int64(1000))))
+	equals(t, 3, len(results))
+	equals(t, int64(-3), results[0].ID)
+	equals(t, int64(5), results[2].ID)
+
+	ok(t, store.Delete(int64(math.MinInt64), &Sample{}))
+	n, err := store.Count(&Sample{}, nil)
+	ok(t, err)
+	equals(t, len(ids)-1, n)
+}
+
+func TestOrderedKeyEncode(t *testing.T) {
+	now := time.Date(2022, 1, 2, 3, 4, 5, 600, time.FixedZone("test", 3600))
+
+	for _, value := range []interface{}{"name", []byte("raw"), uint8(7), uint64(math.MaxUint64), int32(-9), now} {
+		data, err := bolthold.OrderedKeyEncode(value)
+		ok(t, err)
+
+		decoded := reflect.New(reflect.TypeOf(value)).Interface()
+		ok(t, bolthold.OrderedKeyDecode(data, decoded))
+
+		if tm, isTime := value.(time.Time); isTime {
+			assert(t, tm.Equal(*decoded.(*time.Time)), "Wanted %v, got %v", tm, decoded)
+			equals(t, "2022-01-02T02:04:05.000000600Z", string(data))
+			continue
+		}
+		equals(t, value, reflect.ValueOf(decoded).Elem().Interface())
+	}
+
+	_, err := bolthold.OrderedKeyEncode(1.5)
+	assert(t, err != nil, "Encoding a float key didn't fail")
+
+	var small int8
+	assert(t, bolthold.OrderedKeyDecode([]byte("0000000000000001000"), &small) != nil, "Overflow didn't fail")
+}
+
+// OrderID is a typed ID whose binary form is big endian, so it sorts in numeric order
+type OrderID struct {
+	Region uint16
+	Number uint32
+}
+
+func (id OrderID) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 6)
+	binary.BigEndian.PutUint16(b, id.Region)
+	binary.BigEndian.PutUint32(b[2:], id.Number)
+	return b, nil
+}
+
+func (id *OrderID) UnmarshalBinary(data []byte) error {
+	if len(data) != 6 {
+		return fmt.Errorf("An OrderID is 6 bytes, not %d", len(data))
+	}
+	id.Region = binary.BigEndian.Uint16(data)
+	id.Number = binary.BigEndian.Uint32(data[2:])
+	return nil
+}
+
+type Order struct {
+	ID    OrderID `boltholdKey:"ID"`
+	Total int
+}
+
+func TestBinaryMarshalerKeys(t *testing.T) {
+	for _, tst := range []struct {
+		name    string
+		options *bolthold.Options
+	}{
+		{"Gob", nil},
+		{"Ordered", &bolthold.Options{
+			KeyEncoder: bolthold.OrderedKeyEncode,
+			KeyDecoder: bolthold.OrderedKeyDecode,
+		}},
+	} {
+		t.Run(tst.name, func(t *testing.T) {
+			filename := tempfile()
+			store, err := bolthold.Open(filename, 0666, tst.options)
+			ok(t, err)
+			defer store.Close()
+			defer os.Remove(filename)
+
+			ids := []OrderID{{2, 1}, {1, 300}, {1, 2}, {2, 70000}, {1, 1 << 30}}
+			for _, id := range ids {
+				ok(t, store.Insert(id, &Order{Total: int(id.Number)}))
+			}
+
+			var orders []Order
+			ok(t, store.Find(&orders, nil))
+			equals(t, []OrderID{{1, 2}, {1, 300}, {1, 1 << 30}, {2, 1}, {2, 70000}}, func() []OrderID {
+				found := make([]OrderID, len(orders))
+				for i := range orders {
+					found[i] = orders[i].ID
+				}
+				return found
+			}())
+
+			orders = nil
+			ok(t, store.Find(&orders, bolthold.Where(bolthold.Key).Gt(OrderID{1, 300}).
+				And(bolthold.Key).Lt(OrderID{2, 70000})))
+			equals(t, 2, len(orders))
+			equals(t, OrderID{1, 1 << 30}, orders[0].ID)
+			equals(t, OrderID{2, 1}, orders[1].ID)
+
+			var order Order
+			ok(t, store.Get(OrderID{2, 70000}, &order))
+			equals(t, 70000, order.Total)
+		})
+	}
+}
+
+func TestDecodeKey(t *testing.T) {
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		type Keyed struct {
+			ID   uint32 `boltholdKey:"ID"`
+			Name string
+		}
+
+		ok(t, store.Insert(uint32(7), &Keyed{Name: "seven"}))
+		ok(t, store.Insert(bolthold.AutoKey, &Shipment{Customer: "acme", Number: 1}))
+		ok(t, store.Insert("item", &ItemTest{Name: "item"}))
+
+		ch, cancel := store.FindChan(&Keyed{}, nil)
+		result := <-ch
+		cancel()
+		ok(t, result.Err)
+
+		var key interface{}
+		ok(t, store.DecodeKey(&Keyed{}, result.Key, &key))
+		equals(t, uint32(7), key)
+
+		var id uint32
+		ok(t, store.DecodeKey(&Keyed{}, result.Key, &id))
+		equals(t, uint32(7), id)
+
+		ch, cancel = store.FindChan(&Shipment{}, nil)
+		result = <-ch
+		cancel()
+		ok(t, result.Err)
+		ok(t, store.DecodeKey(&Shipment{}, result.Key, &key))
+		equals(t, bolthold.CompositeKey{"acme", int64(1), time.Time{}.UTC()}, key)
+
+		ch, cancel = store.FindChan(&ItemTest{}, nil)
+		result = <-ch
+		cancel()
+		ok(t, result.Err)
+		assert(t, store.DecodeKey(&ItemTest{}, result.Key, &key) != nil,
+			"the key type of a type without a key field was guessed")
+	})
+}
@@ -0,0 +1,323 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package bolthold
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+)
+
+// KeyGenerator returns a new key for a record being inserted, see NewKey
+type KeyGenerator func() (interface{}, error)
+
+// KeyGenerated is an optional interface a type can implement to pick the generator used for its keys when it's
+// inserted with NewKey(nil)
+type KeyGenerated interface {
+	KeyGenerator() KeyGenerator
+}
+
+// generatedKey tells bolthold to insert the record with a key from the generator
+type generatedKey struct {
+	generator KeyGenerator
+}
+
+// NewKey is used to insert a record with a key from generator, which is written back to the record's key field if
+// it's a string.  A nil generator uses the generator of the record's type, if it implements KeyGenerated, or
+// ULIDKey otherwise
+//
+//	store.Insert(bolthold.NewKey(bolthold.UUIDv7Key), data)
+func NewKey(generator KeyGenerator) interface{} {
+	return generatedKey{generator: generator}
+}
+
+// generate returns the key to insert data with
+func (k generatedKey) generate(data interface{}) (interface{}, error) {
+	generator := k.generator
+	if generator == nil {
+		if generated, ok := newElemType(data).(KeyGenerated); ok {
+			generator = generated.KeyGenerator()
+		}
+	}
+	if generator == nil {
+		generator = ULIDKey
+	}
+	return generator()
+}
+
+// The built in key generators all return fixed length strings which sort in the order they were generated in, even
+// within the same clock tick, so that records are stored oldest first, and recent records can be found by reading
+// backwards from the end of the type.  With the default gob key encoding, a string's length is encoded before it,
+// so only keys of the same length sort in order, which every key from the same generator is
+var (
+	// UUIDv7Key generates RFC 9562 version 7 UUIDs in their canonical form, such as
+	// 0192a4d6-4f7a-7cb2-9e1b-3c5d8a2f6b10
+	UUIDv7Key KeyGenerator = uuidV7.next
+	// ULIDKey generates ULIDs, such as 01J9A7KXKQ8Y2W3V4T5R6P7N8M
+	ULIDKey KeyGenerator = ulid.next
+	// KSUIDKey generates KSUIDs, such as 2mY6ckb0dSqv5ZQ1bP6jZ0Hn3xA
+	KSUIDKey KeyGenerator = ksuid.next
+	// TimestampKey generates keys made of the UTC time to the nanosecond, followed by a random suffix, such as
+	// 20241016T093512.123456789Z-9f3a2c1d
+	TimestampKey KeyGenerator = timestampKeys.next
+	// TimeCounterKey generates keys made of the UTC time to the nanosecond, followed by a counter shared by every key
+	// the process generates, such as 20241016T093512.123456789Z-000000000000002a.  Unlike TimestampKey, keys from the
+	// same process can never collide, no matter how many are generated at once, but keys generated by different
+	// processes can
+	TimeCounterKey KeyGenerator = timeCounterKeys.next
+)
+
+var errKeySpaceExhausted = errors.New("Too many keys were generated in the same clock tick")
+
+const (
+	timeKeyFormat = "20060102T150405.000000000Z"
+
+	crockfordAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+	base62Alphabet    = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+	// ksuidEpoch is the start of KSUID time, in Unix seconds
+	ksuidEpoch = 1400000000
+)
+
+// monotonic holds the last time and random bytes of a generator, so keys generated in the same tick can be made
+// larger than the one before by incrementing the random bytes
+type monotonic struct {
+	sync.Mutex
+	last   int64
+	random []byte
+}
+
+// tick returns the tick and random bits for a key generated at now, which is moved forward to the last tick if the
+// clock has gone backwards.  The random bits are returned as big endian bytes
+func (m *monotonic) tick(now int64, bits int) (int64, []byte, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	if m.random != nil && now <= m.last {
+		if !incrementBytes(m.random) {
+			return 0, nil, errKeySpaceExhausted
+		}
+		return m.last, append([]byte(nil), m.random...), nil
+	}
+
+	size := (bits + 7) / 8
+	random := make([]byte, size)
+	_, err := rand.Read(random)
+	if err != nil {
+		return 0, nil, err
+	}
+	// the bits above the number asked for are cleared, along with the top one of those asked for, so that there's
+	// room to increment them for later keys in the same tick
+	for i, n := 0, size*8-bits+1; n > 0; i, n = i+1, n-8 {
+		if n >= 8 {
+			random[i] = 0
+		} else {
+			random[i] &= 0xff >> uint(n)
+		}
+	}
+
+	m.last = now
+	m.random = random
+	return now, append([]byte(nil), random...), nil
+}
+
+// incrementBytes adds one to b as a big endian number, and returns false if it overflowed
+func incrementBytes(b []byte) bool {
+	for i := len(b) - 1; i >= 0; i-- {
+		b[i]++
+		if b[i] != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// encodeBase encodes data as a big endian number in the alphabet's base, left padded to width
+func encodeBase(data []byte, alphabet string, width int) string {
+	n := new(big.Int).SetBytes(data)
+	base := big.NewInt(int64(len(alphabet)))
+	mod := new(big.Int)
+
+	out := make([]byte, width)
+	for i := width - 1; i >= 0; i-- {
+		n.DivMod(n, base, mod)
+		out[i] = alphabet[mod.Int64()]
+	}
+	return string(out)
+}
+
+type ulidGenerator struct {
+	monotonic
+}
+
+var ulid = &ulidGenerator{}
+
+func (g *ulidGenerator) next() (interface{}, error) {
+	ms, random, err := g.tick(time.Now().UnixNano()/int64(time.Millisecond), 80)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, 16)
+	putUint48(data, ms)
+	copy(data[6:], random)
+	return encodeBase(data, crockfordAlphabet, 26), nil
+}
+
+type uuidV7Generator struct {
+	monotonic
+}
+
+var uuidV7 = &uuidV7Generator{}
+
+func (g *uuidV7Generator) next() (interface{}, error) {
+	ms, random, err := g.tick(time.Now().UnixNano()/int64(time.Millisecond), 74)
+	if err != nil {
+		return nil, err
+	}
+
+	// the 74 random bits are split around the version and variant bits, as rand_a and rand_b
+	hi := uint64(random[0])<<8 | uint64(random[1])
+	lo := binary.BigEndian.Uint64(random[2:])
+	randA := (hi<<2 | lo>>62) & 0xfff
+	randB := lo & (1<<62 - 1)
+
+	data := make([]byte, 16)
+	putUint48(data, ms)
+	data[6] = 0x70 | byte(randA>>8)
+	data[7] = byte(randA)
+	binary.BigEndian.PutUint64(data[8:], 1<<63|randB)
+
+	text := hex.EncodeToString(data)
+	return text[0:8] + "-" + text[8:12] + "-" + text[12:16] + "-" + text[16:20] + "-" + text[20:], nil
+}
+
+type ksuidGenerator struct {
+	monotonic
+}
+
+var ksuid = &ksuidGenerator{}
+
+func (g *ksuidGenerator) next() (interface{}, error) {
+	seconds, payload, err := g.tick(time.Now().Unix()-ksuidEpoch, 128)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, 20)
+	data[0] = byte(seconds >> 24)
+	data[1] = byte(seconds >> 16)
+	data[2] = byte(seconds >> 8)
+	data[3] = byte(seconds)
+	copy(data[4:], payload)
+	return encodeBase(data, base62Alphabet, 27), nil
+}
+
+type timestampGenerator struct {
+	monotonic
+}
+
+var timestampKeys = &timestampGenerator{}
+
+func (g *timestampGenerator) next() (interface{}, error) {
+	ns, random, err := g.tick(time.Now().UnixNano(), 32)
+	if err != nil {
+		return nil, err
+	}
+
+	return time.Unix(0, ns).UTC().Format(timeKeyFormat) + "-" + hex.EncodeToString(random), nil
+}
+
+type timeCounterGenerator struct {
+	sync.Mutex
+	last    int64
+	counter uint64
+}
+
+var timeCounterKeys = &timeCounterGenerator{}
+
+func (g *timeCounterGenerator) next() (interface{}, error) {
+	g.Lock()
+	defer g.Unlock()
+
+	now := time.Now().UnixNano()
+	if now < g.last {
+		// the clock has gone backwards, so the key is kept after the last one
+		now = g.last
+	}
+	g.last = now
+	g.counter++
+
+	return fmt.Sprintf("%s-%016x", time.Unix(0, now).UTC().Format(timeKeyFormat), g.counter), nil
+}
+
+// KeyTime returns the time a key from one of the built in key generators was generated at, to the precision the
+// key holds it in: nanoseconds for TimestampKey and TimeCounterKey, milliseconds for UUIDv7Key and ULIDKey, and
+// seconds for KSUIDKey
+func KeyTime(key string) (time.Time, error) {
+	switch {
+	case len(key) > len(timeKeyFormat) && key[len(timeKeyFormat)] == '-':
+		return time.Parse(timeKeyFormat, key[:len(timeKeyFormat)])
+	case len(key) == 36 && strings.Count(key, "-") == 4:
+		data, err := hex.DecodeString(strings.Replace(key, "-", "", -1))
+		if err != nil || data[6]>>4 != 7 {
+			break
+		}
+		return time.Unix(0, uint48(data)*int64(time.Millisecond)).UTC(), nil
+	case len(key) == 26:
+		data, ok := decodeBase(key, crockfordAlphabet, 16)
+		if !ok {
+			break
+		}
+		return time.Unix(0, uint48(data)*int64(time.Millisecond)).UTC(), nil
+	case len(key) == 27:
+		data, ok := decodeBase(key, base62Alphabet, 20)
+		if !ok {
+			break
+		}
+		return time.Unix(int64(binary.BigEndian.Uint32(data))+ksuidEpoch, 0).UTC(), nil
+	}
+
+	return time.Time{}, fmt.Errorf("%q wasn't generated by one of the built in key generators", key)
+}
+
+// decodeBase decodes text from the alphabet's base into size big endian bytes, the reverse of encodeBase
+func decodeBase(text, alphabet string, size int) ([]byte, bool) {
+	n := new(big.Int)
+	base := big.NewInt(int64(len(alphabet)))
+	for i := 0; i < len(text); i++ {
+		digit := strings.IndexByte(alphabet, text[i])
+		if digit < 0 {
+			return nil, false
+		}
+		n.Mul(n, base)
+		n.Add(n, big.NewInt(int64(digit)))
+	}
+
+	data := n.Bytes()
+	if len(data) > size {
+		return nil, false
+	}
+	return append(make([]byte, size-len(data)), data...), true
+}
+
+func uint48(b []byte) int64 {
+	return int64(b[0])<<40 | int64(b[1])<<32 | int64(b[2])<<24 | int64(b[3])<<16 | int64(b[4])<<8 | int64(b[5])
+}
+
+func putUint48(b []byte, v int64) {
+	b[0] = byte(v >> 40)
+	b[1] = byte(v >> 32)
+	b[2] = byte(v >> 24)
+	b[3] = byte(v >> 16)
+	b[4] = byte(v >> 8)
+	b[5] = byte(v)
+}
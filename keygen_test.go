@@ -0,0 +1,127 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package bolthold_test
+
+import (
+	"regexp"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/timshannon/bolthold"
+)
+
+type Event struct {
+	ID      string `boltholdKey:"ID"`
+	Message string
+}
+
+type LogEntry struct {
+	ID      string `boltholdKey:"ID"`
+	Message string
+}
+
+func (a *LogEntry) KeyGenerator() bolthold.KeyGenerator {
+	return bolthold.KSUIDKey
+}
+
+func TestKeyGenerators(t *testing.T) {
+	tests := []struct {
+		name      string
+		generator bolthold.KeyGenerator
+		format    *regexp.Regexp
+	}{
+		{"UUIDv7", bolthold.UUIDv7Key,
+			regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)},
+		{"ULID", bolthold.ULIDKey, regexp.MustCompile(`^[0-7][0-9A-HJKMNP-TV-Z]{25}$`)},
+		{"KSUID", bolthold.KSUIDKey, regexp.MustCompile(`^[0-9A-Za-z]{27}$`)},
+		{"Timestamp", bolthold.TimestampKey, regexp.MustCompile(`^\d{8}T\d{6}\.\d{9}Z-[0-9a-f]{8}$`)},
+		{"TimeCounter", bolthold.TimeCounterKey, regexp.MustCompile(`^\d{8}T\d{6}\.\d{9}Z-[0-9a-f]{16}$`)},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.name, func(t *testing.T) {
+			keys := make([]string, 2000)
+			for i := range keys {
+				key, err := tst.generator()
+				ok(t, err)
+				keys[i] = key.(string)
+				assert(t, tst.format.MatchString(keys[i]), "%s doesn't match the %s format", keys[i], tst.name)
+			}
+
+			// keys generated in the same clock tick still sort in the order they were generated
+			assert(t, sort.StringsAreSorted(keys), "%s keys aren't generated in order", tst.name)
+			for i := 1; i < len(keys); i++ {
+				assert(t, keys[i] != keys[i-1], "%s generated %s twice", tst.name, keys[i])
+			}
+		})
+	}
+}
+
+func TestInsertNewKey(t *testing.T) {
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		var ids []string
+		for i := 0; i < 20; i++ {
+			event := &Event{Message: "event"}
+			ok(t, store.Insert(bolthold.NewKey(bolthold.UUIDv7Key), event))
+			assert(t, event.ID != "", "The generated key wasn't set on the record")
+			ids = append(ids, event.ID)
+		}
+
+		// records are stored in the order they were inserted
+		var events []Event
+		ok(t, store.Find(&events, nil))
+		equals(t, len(ids), len(events))
+		for i := range events {
+			equals(t, ids[i], events[i].ID)
+		}
+
+		var last []Event
+		ok(t, store.Last(1, &last, nil))
+		equals(t, ids[len(ids)-1], last[0].ID)
+
+		audit := &LogEntry{Message: "audit"}
+		ok(t, store.Insert(bolthold.NewKey(nil), audit))
+		assert(t, regexp.MustCompile(`^[0-9A-Za-z]{27}$`).MatchString(audit.ID),
+			"The type's key generator wasn't used: %s", audit.ID)
+
+		var found LogEntry
+		inserted, err := store.FindOrInsert(bolthold.NewKey(nil), &found, &LogEntry{Message: "default"})
+		ok(t, err)
+		assert(t, inserted, "FindOrInsert didn't insert with a new key")
+		ok(t, store.Get(found.ID, &LogEntry{}))
+	})
+}
+
+func TestKeyTime(t *testing.T) {
+	tests := []struct {
+		name      string
+		generator bolthold.KeyGenerator
+		precision time.Duration
+	}{
+		{"UUIDv7", bolthold.UUIDv7Key, time.Millisecond},
+		{"ULID", bolthold.ULIDKey, time.Millisecond},
+		{"KSUID", bolthold.KSUIDKey, time.Second},
+		{"Timestamp", bolthold.TimestampKey, 1},
+		{"TimeCounter", bolthold.TimeCounterKey, 1},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.name, func(t *testing.T) {
+			before := time.Now().Truncate(tst.precision)
+			key, err := tst.generator()
+			ok(t, err)
+			after := time.Now()
+
+			generated, err := bolthold.KeyTime(key.(string))
+			ok(t, err)
+			assert(t, !generated.Before(before) && !generated.After(after),
+				"%s was generated at %s, not between %s and %s", key, generated, before, after)
+		})
+	}
+
+	_, err := bolthold.KeyTime("not a key")
+	assert(t, err != nil, "KeyTime didn't fail for a key that wasn't generated")
+}
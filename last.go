@@ -0,0 +1,132 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package bolthold
+
+import (
+	"errors"
+	"reflect"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Last finds the n records matching the query with the largest keys, and puts them into result, which must be a
+// pointer to a slice, largest key first.  With keys that grow over time, such as NextSequence or OrderedKeyEncode'd
+// times, these are the newest records.  Queries that don't use an index or Or'd queries are answered by reading the
+// records backwards from the end, and stopping once n have matched.  The query's Skip skips that many of the
+// matches with the largest keys, and the query can't have a Limit or SortBy
+//
+//	var events []Event
+//	err := store.Last(20, &events, bolthold.Where("Level").Eq("error"))
+func (s *Store) Last(n int, result interface{}, query *Query) error {
+	return s.Bolt().View(func(tx *bolt.Tx) error {
+		return s.TxLast(tx, n, result, query)
+	})
+}
+
+// TxLast is the same as Last except it allows you to specify your own transaction
+func (s *Store) TxLast(tx *bolt.Tx, n int, result interface{}, query *Query) error {
+	return s.last(tx, n, result, query)
+}
+
+// LastInBucket is the same as Last but you get to specify your parent bucket
+func (s *Store) LastInBucket(parent *bolt.Bucket, n int, result interface{}, query *Query) error {
+	return s.last(parent, n, result, query)
+}
+
+func (s *Store) last(source BucketSource, n int, result interface{}, query *Query) error {
+	if query == nil {
+		query = &Query{}
+	}
+	if query.limit != 0 || len(query.sort) > 0 {
+		return errors.New("Last returns the records with the largest keys, so the query can't have a Limit or SortBy")
+	}
+
+	dataType, add, done := s.resultAppender(result)
+
+	err := s.lastRecords(source, dataType, n, query, add)
+	if err != nil {
+		return err
+	}
+	done()
+	return nil
+}
+
+// lastRecords adds the last n records matching the query, in reverse key order
+func (s *Store) lastRecords(source BucketSource, dataType interface{}, n int, query *Query,
+	add func(r *record) error) error {
+	if n <= 0 {
+		return nil
+	}
+
+	query, err := s.prepQuery(dataType, query.clone())
+	if err != nil {
+		return err
+	}
+
+	if query.index != "" || len(query.ors) > 0 || query.withDeleted {
+		return s.lastFromQuery(source, dataType, n, query, add)
+	}
+
+	query.source = source
+	query.dataType = reflect.TypeOf(dataType).Elem()
+	err = checkTransient(s.newStorer(dataType), query)
+	if err != nil {
+		return err
+	}
+
+	c := s.cursor(source, dataType)
+	if c.cursor == nil {
+		return nil
+	}
+
+	skip := query.skip
+	val := reflect.New(query.dataType)
+	for err = c.Last(val.Interface()); err == nil; err = c.Prev(val.Interface()) {
+		var ok bool
+		ok, err = query.matchesAllFields(s, c.key, val, val.Interface())
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		if skip > 0 {
+			skip--
+			continue
+		}
+
+		err = add(&record{key: c.key, value: val})
+		if err != nil {
+			return err
+		}
+		n--
+		if n == 0 {
+			return nil
+		}
+		val = reflect.New(query.dataType)
+	}
+	if err == ErrNotFound {
+		return nil
+	}
+	return err
+}
+
+// lastFromQuery runs the query in full, and adds the last n of the records in key order
+func (s *Store) lastFromQuery(source BucketSource, dataType interface{}, n int, query *Query,
+	add func(r *record) error) error {
+	records, err := s.keyOrderRecords(source, dataType, query, 0, 0)
+	if err != nil {
+		return err
+	}
+
+	end := len(records) - query.skip
+	for i := end - 1; i >= 0 && i >= end-n; i-- {
+		err = add(records[i])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package bolthold_test
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/timshannon/bolthold"
+)
+
+func TestLast(t *testing.T) {
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		insertTestData(t, store)
+
+		tests := []struct {
+			name  string
+			query func() *bolthold.Query
+		}{
+			{"All", func() *bolthold.Query { return nil }},
+			{"Criteria", func() *bolthold.Query { return bolthold.Where("Category").Eq("animal") }},
+			{"Index", func() *bolthold.Query { return bolthold.Where("Category").Eq("animal").Index("Category") }},
+			{"Or", func() *bolthold.Query {
+				return bolthold.Where("Category").Eq("food").Or(bolthold.Where("Name").Eq("fish"))
+			}},
+		}
+
+		for _, tst := range tests {
+			t.Run(tst.name, func(t *testing.T) {
+				var all []ItemTest
+				ok(t, store.Find(&all, tst.query()))
+				assert(t, len(all) > 3, "Not enough records")
+				// Or'd queries aren't found in key order
+				sort.Slice(all, func(i, j int) bool { return all[i].Key < all[j].Key })
+
+				var last []ItemTest
+				ok(t, store.Last(3, &last, tst.query()))
+				equals(t, 3, len(last))
+				for i := range last {
+					equals(t, all[len(all)-1-i].Key, last[i].Key)
+				}
+
+				var skipped []*ItemTest
+				query := tst.query()
+				if query == nil {
+					query = &bolthold.Query{}
+				}
+				ok(t, store.Last(2, &skipped, query.Skip(1)))
+				equals(t, 2, len(skipped))
+				equals(t, all[len(all)-2].Key, skipped[0].Key)
+				equals(t, all[len(all)-3].Key, skipped[1].Key)
+
+				var everything []ItemTest
+				ok(t, store.Last(len(all)+10, &everything, tst.query()))
+				equals(t, len(all), len(everything))
+			})
+		}
+
+		var none []ItemTest
+		ok(t, store.Last(5, &none, bolthold.Where("Name").Eq("nothing")))
+		equals(t, 0, len(none))
+	})
+}
@@ -0,0 +1,57 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package bolthold
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// lockHolder returns the PID of the process holding a lock on the passed in file by looking it up
+// in /proc/locks, returns 0 if it can't be found
+func lockHolder(filename string) int {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return 0
+	}
+
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0
+	}
+
+	locks, err := os.Open("/proc/locks")
+	if err != nil {
+		return 0
+	}
+	defer locks.Close()
+
+	inode := ":" + strconv.FormatUint(stat.Ino, 10)
+
+	// 1: FLOCK  ADVISORY  WRITE 1234 08:01:5678 0 EOF
+	scanner := bufio.NewScanner(locks)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 6 || fields[1] == "->" {
+			// "->" marks a process blocked waiting on the lock, not holding it
+			continue
+		}
+
+		if !strings.HasSuffix(fields[5], inode) {
+			continue
+		}
+
+		pid, err := strconv.Atoi(fields[4])
+		if err != nil {
+			return 0
+		}
+		return pid
+	}
+
+	return 0
+}
@@ -0,0 +1,13 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+//go:build !linux
+// +build !linux
+
+package bolthold
+
+// lockHolder can't determine the process holding a file lock on this platform
+func lockHolder(filename string) int {
+	return 0
+}
@@ -0,0 +1,53 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package bolthold
+
+import (
+	"fmt"
+	"strings"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// reservedPrefix starts the name of every bucket bolthold uses internally, and types can't be stored under names that
+// start with it
+const reservedPrefix = "_"
+
+// metaBucketName is the bucket bolthold keeps the metadata of its subsystems in, such as schema versions, stats or
+// expiry queues.  Each subsystem has a bucket of its own inside it, so their keys can't collide with each other, and
+// as it's outside of every type's bucket, its keys are never seen by queries, even those over Key
+const metaBucketName = reservedPrefix + "meta"
+
+// isReserved returns true if the bucket name is one of bolthold's internal buckets rather than a type
+func isReserved(name []byte) bool {
+	return strings.HasPrefix(string(name), reservedPrefix)
+}
+
+// checkTypeName returns an error if records can't be stored under the type name
+func checkTypeName(typeName string) error {
+	if isReserved([]byte(typeName)) {
+		return fmt.Errorf("The type name %s is reserved, names starting with %s are used internally by bolthold",
+			typeName, reservedPrefix)
+	}
+	return nil
+}
+
+// metaBucket returns the metadata bucket of the subsystem, or nil if nothing has been stored in it yet
+func metaBucket(source BucketSource, subsystem string) *bolt.Bucket {
+	meta := source.Bucket([]byte(metaBucketName))
+	if meta == nil {
+		return nil
+	}
+	return meta.Bucket([]byte(subsystem))
+}
+
+// createMetaBucket returns the metadata bucket of the subsystem, creating it if it doesn't exist yet
+func createMetaBucket(source BucketSource, subsystem string) (*bolt.Bucket, error) {
+	meta, err := source.CreateBucketIfNotExists([]byte(metaBucketName))
+	if err != nil {
+		return nil, err
+	}
+	return meta.CreateBucketIfNotExists([]byte(subsystem))
+}
@@ -0,0 +1,98 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package bolthold
+
+import (
+	"sync/atomic"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// TxMetrics are the metrics for a single write transaction run by bolthold, as passed to Options.TxMetricsHook
+type TxMetrics struct {
+	KeysWritten         int           // records put or deleted
+	IndexEntriesWritten int           // index entries put or deleted
+	BytesWritten        int           // size of all keys and values put, including index entries
+	Duration            time.Duration // total time from the start of the transaction until it was committed
+	CommitLatency       time.Duration // time spent committing the transaction
+	WriteTime           time.Duration // time bolt spent writing and syncing pages to disk during the commit
+}
+
+// writeCounters are running totals of all writes made by the store.  Bolt only allows one write transaction at a
+// time, so the difference in the counters from the start to the end of a transaction are that transaction's writes
+type writeCounters struct {
+	keys         int64
+	indexEntries int64
+	bytes        int64
+}
+
+// record counts a put or delete of the key, value is nil for deletes
+func (w *writeCounters) record(index bool, key, value []byte) {
+	if index {
+		atomic.AddInt64(&w.indexEntries, 1)
+	} else {
+		atomic.AddInt64(&w.keys, 1)
+	}
+	if value != nil {
+		atomic.AddInt64(&w.bytes, int64(len(key)+len(value)))
+	}
+}
+
+func (w *writeCounters) snapshot() writeCounters {
+	return writeCounters{
+		keys:         atomic.LoadInt64(&w.keys),
+		indexEntries: atomic.LoadInt64(&w.indexEntries),
+		bytes:        atomic.LoadInt64(&w.bytes),
+	}
+}
+
+// updateTx runs fn in a bolt write transaction, runs the commit hooks, and reports the transaction's metrics to the
+// TxMetricsHook if the transaction is committed
+func (s *Store) updateTx(fn func(tx *bolt.Tx) error) error {
+	var changes []Change
+	fn = s.withCommitHooks(fn, &changes)
+	fn = s.withPendingRewrites(fn)
+
+	if s.txMetricsHook == nil {
+		err := s.Bolt().Update(fn)
+		if err != nil {
+			return err
+		}
+		s.runPostCommitHooks(changes)
+		return nil
+	}
+
+	var tx *bolt.Tx
+	var commitStart time.Time
+	var before writeCounters
+
+	start := time.Now()
+	err := s.Bolt().Update(func(t *bolt.Tx) error {
+		// taken inside the transaction, so no other writer can change the counters
+		before = s.writes.snapshot()
+		tx = t
+		err := fn(t)
+		commitStart = time.Now()
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	after := s.writes.snapshot()
+
+	s.txMetricsHook(TxMetrics{
+		KeysWritten:         int(after.keys - before.keys),
+		IndexEntriesWritten: int(after.indexEntries - before.indexEntries),
+		BytesWritten:        int(after.bytes - before.bytes),
+		Duration:            time.Since(start),
+		CommitLatency:       time.Since(commitStart),
+		WriteTime:           tx.Stats().WriteTime,
+	})
+
+	s.runPostCommitHooks(changes)
+	return nil
+}
@@ -0,0 +1,360 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package bolthold
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"reflect"
+	"sync"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Migration upgrades the records of a type which were written by an older version of the type, when they are read
+type Migration struct {
+	// Version is the current version of the type, which is stored with every record written.  Records written
+	// before a Migration was registered are version 0
+	Version uint8
+
+	// Migrate is called with the version and encoded value of records written with any other version, and returns
+	// the record as the current version of the type, either as a value or a pointer.  Records are only rewritten
+	// with the current version the next time they are updated
+	Migrate func(fromVersion uint8, raw []byte) (interface{}, error)
+}
+
+// TypeMigrator can be implemented by a Storer to version its records, in the same way as RegisterMigration
+type TypeMigrator interface {
+	Migration() Migration
+}
+
+// versionHeader marks a record value which is stored with a version, it is followed by the version byte
+var versionHeader = []byte{0xbc, 'h', 'v'}
+
+// RegisterMigration versions the records of dataType, so that records written by older versions of the type are
+// upgraded by migration.Migrate when they are read, instead of failing to decode.
+// RegisterMigration is not safe to call while the store is running queries.
+func (s *Store) RegisterMigration(dataType interface{}, migration Migration) {
+	tp := reflect.TypeOf(dataType)
+	for tp.Kind() == reflect.Ptr {
+		tp = tp.Elem()
+	}
+	s.migrations[tp.Name()] = migration
+}
+
+// Migration returns the migration registered for the type with RegisterMigration
+func (t *anonStorer) Migration() Migration {
+	return t.migration
+}
+
+func storerMigration(storer Storer) Migration {
+	if tm, ok := storer.(TypeMigrator); ok {
+		return tm.Migration()
+	}
+	return Migration{}
+}
+
+// addVersion prefixes the encoded record with the current version of its type
+func addVersion(storer Storer, data []byte) []byte {
+	version := storerMigration(storer).Version
+	if version == 0 {
+		return data
+	}
+
+	versioned := make([]byte, 0, len(versionHeader)+1+len(data))
+	versioned = append(versioned, versionHeader...)
+	versioned = append(versioned, version)
+	return append(versioned, data...)
+}
+
+// splitVersion returns the version an encoded record was written with, and the record without the version
+func splitVersion(data []byte) (uint8, []byte) {
+	if len(data) <= len(versionHeader) || !bytes.HasPrefix(data, versionHeader) {
+		return 0, data
+	}
+	return data[len(versionHeader)], data[len(versionHeader)+1:]
+}
+
+// migrateRecord decodes a record written with an older version of its type into value.  It returns false if the
+// record is already the current version, or the type has no Migrate func
+func migrateRecord(storer Storer, version uint8, data []byte, value interface{}) (bool, error) {
+	migration := storerMigration(storer)
+	if version == migration.Version || migration.Migrate == nil {
+		return false, nil
+	}
+
+	migrated, err := migration.Migrate(version, data)
+	if err != nil {
+		return true, err
+	}
+
+	dest := reflect.ValueOf(value)
+	for dest.Kind() == reflect.Ptr && dest.Elem().Kind() == reflect.Ptr {
+		if dest.Elem().IsNil() {
+			dest.Elem().Set(reflect.New(dest.Elem().Type().Elem()))
+		}
+		dest = dest.Elem()
+	}
+
+	src := reflect.ValueOf(migrated)
+	for src.Kind() == reflect.Ptr && src.Type() != dest.Elem().Type() {
+		src = src.Elem()
+	}
+
+	if !src.IsValid() || src.Type() != dest.Elem().Type() {
+		return true, fmt.Errorf("Migrating %s from version %d returned a %T, not a %s", storer.Type(), version,
+			migrated, dest.Elem().Type())
+	}
+
+	dest.Elem().Set(src)
+	return true, nil
+}
+
+// RenameField rewrites every record of dataType's type that was stored with a field named oldName, which no longer
+// exists on the type, moving its value into the field newName.  Encoders such as gob drop fields that have been
+// renamed when they decode, so without it the old values would be lost the next time each record is written.
+// Records whose old field is empty, such as those written since the rename, are left as they are
+func (s *Store) RenameField(dataType interface{}, oldName, newName string) error {
+	return s.updateTx(func(tx *bolt.Tx) error {
+		return s.renameField(tx, dataType, oldName, newName)
+	})
+}
+
+// TxRenameField is the same as RenameField except it allows you to specify your own transaction
+func (s *Store) TxRenameField(tx *bolt.Tx, dataType interface{}, oldName, newName string) error {
+	if !tx.Writable() {
+		return bolt.ErrTxNotWritable
+	}
+	return s.renameField(tx, dataType, oldName, newName)
+}
+
+// RenameFieldInBucket is the same as RenameField but you get to specify your parent bucket
+func (s *Store) RenameFieldInBucket(parent *bolt.Bucket, dataType interface{}, oldName, newName string) error {
+	if !parent.Tx().Writable() {
+		return bolt.ErrTxNotWritable
+	}
+	return s.renameField(parent, dataType, oldName, newName)
+}
+
+func (s *Store) renameField(source BucketSource, dataType interface{}, oldName, newName string) error {
+	storer := s.newStorer(dataType)
+
+	err := checkMutable(storer, dataType, "rename a field of")
+	if err != nil {
+		return err
+	}
+
+	tp := reflect.TypeOf(dataType)
+	for tp.Kind() == reflect.Ptr {
+		tp = tp.Elem()
+	}
+	if tp.Kind() != reflect.Struct {
+		return fmt.Errorf("Fields can't be renamed on %s, as it isn't a struct", tp)
+	}
+	newField, ok := tp.FieldByName(newName)
+	if !ok || len(newField.Index) != 1 {
+		return fmt.Errorf("The type %s has no field named %s", tp, newName)
+	}
+	if oldName == newName || oldName == "" || !ast.IsExported(oldName) {
+		return fmt.Errorf("%s isn't a field %s can be renamed from", oldName, newName)
+	}
+
+	// the old field is decoded into a struct with just the old and new fields, as records written since the rename
+	// only have the new field, and some encoders, such as gob, fail to decode when no fields match
+	oldType := reflect.StructOf([]reflect.StructField{
+		{Name: oldName, Type: newField.Type},
+		{Name: newName, Type: newField.Type, Tag: newField.Tag},
+	})
+
+	b := getRecordBucket(source, storer)
+	if b == nil {
+		return nil
+	}
+
+	var keys, values [][]byte
+	err = b.ForEach(func(k, v []byte) error {
+		keys = append(keys, append([]byte(nil), k...))
+		values = append(values, append([]byte(nil), v...))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	keyField, hasKeyField := decodedKeyField(tp)
+
+	for i := range keys {
+		data, err := s.decompress(values[i])
+		if err != nil {
+			return err
+		}
+		_, data = splitVersion(data)
+
+		old := reflect.New(oldType)
+		err = s.decodeValue(storer, data, old.Interface())
+		if err != nil {
+			return err
+		}
+		oldValue := old.Elem().Field(0)
+		if oldValue.IsZero() {
+			continue
+		}
+
+		value := newElemType(dataType)
+		err = s.decodeRecord(storer, values[i], value)
+		if err != nil {
+			return err
+		}
+		if hasKeyField {
+			field := reflect.ValueOf(value).Elem().FieldByIndex(keyField.Index)
+			err = s.decodeKey(keys[i], field.Addr().Interface())
+			if err != nil {
+				return err
+			}
+		}
+
+		err = s.updateRecord(storer, source, b, keys[i], value, func(record interface{}) error {
+			reflect.ValueOf(record).Elem().FieldByIndex(newField.Index).Set(oldValue)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// migratedRecords are records which were migrated as they were read, outside of a writable transaction, and are
+// waiting to be rewritten with the current version of their type by the store's next write transaction
+type migratedRecords struct {
+	sync.Mutex
+	pending map[string]migratedRecord
+}
+
+type migratedRecord struct {
+	dataType interface{}
+	key      []byte
+}
+
+// maxPendingRewrites limits how many migrated records are waiting to be rewritten.  Records read once it's reached
+// are rewritten the next time they're read instead
+const maxPendingRewrites = 10000
+
+// needsRewrite returns true if the record was written with an older version of its type, and the store rewrites
+// migrated records as they're read
+func (s *Store) needsRewrite(storer Storer, raw []byte) bool {
+	if !s.rewriteMigrated || storerMigration(storer).Migrate == nil {
+		return false
+	}
+	data, err := s.decompress(raw)
+	if err != nil {
+		return false
+	}
+	version, _ := splitVersion(data)
+	return version != storerMigration(storer).Version
+}
+
+// rewriteRecords rewrites the migrated records with the current version of their type if the source is writable,
+// otherwise they're left for the store's next write transaction to rewrite.  Records in buckets other than the
+// transaction's top level buckets are only rewritten when they're read in a writable transaction
+func (s *Store) rewriteRecords(source BucketSource, dataType interface{}, keys [][]byte) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	if writable, ok := source.(interface{ Writable() bool }); ok && writable.Writable() {
+		for _, key := range keys {
+			err := s.rewriteRecord(source, dataType, key)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if _, ok := source.(*bolt.Tx); !ok {
+		return nil
+	}
+
+	typeName := s.newStorer(dataType).Type()
+	s.migrated.Lock()
+	defer s.migrated.Unlock()
+	for _, key := range keys {
+		if len(s.migrated.pending) >= maxPendingRewrites {
+			return nil
+		}
+		s.migrated.pending[typeName+"\x00"+string(key)] = migratedRecord{
+			dataType: dataType,
+			key:      append([]byte(nil), key...),
+		}
+	}
+	return nil
+}
+
+// withPendingRewrites rewrites the records which were migrated as they were read since the last write transaction,
+// once fn has succeeded
+func (s *Store) withPendingRewrites(fn func(tx *bolt.Tx) error) func(tx *bolt.Tx) error {
+	if !s.rewriteMigrated {
+		return fn
+	}
+
+	return func(tx *bolt.Tx) error {
+		err := fn(tx)
+		if err != nil {
+			return err
+		}
+		return s.rewritePending(tx)
+	}
+}
+
+// rewritePending rewrites the records which were migrated as they were read since the last write transaction
+func (s *Store) rewritePending(tx *bolt.Tx) error {
+	s.migrated.Lock()
+	pending := s.migrated.pending
+	s.migrated.pending = make(map[string]migratedRecord)
+	s.migrated.Unlock()
+
+	for _, record := range pending {
+		err := s.rewriteRecord(tx, record.dataType, record.key)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rewriteRecord rewrites the record with the current version of its type, if it hasn't been already.  Unlike an
+// update, the record's version and updated time are left alone, as its value hasn't changed
+func (s *Store) rewriteRecord(source BucketSource, dataType interface{}, key []byte) error {
+	storer := s.newStorer(dataType)
+	b := getRecordBucket(source, storer)
+	if b == nil {
+		return nil
+	}
+	raw := b.Get(key)
+	if raw == nil || !s.needsRewrite(storer, raw) {
+		return nil
+	}
+
+	value := newElemType(dataType)
+	err := s.decodeRecord(storer, raw, value)
+	if err != nil {
+		// the record can't be migrated, which the reads of it report, and it's left as it is
+		return nil
+	}
+
+	encoded, err := s.encodeRecord(storer, value)
+	if err != nil {
+		return nil
+	}
+	s.writes.record(false, key, encoded)
+	err = b.Put(key, encoded)
+	if err != nil {
+		return err
+	}
+	return s.addIndexes(storer, source, key, value)
+}
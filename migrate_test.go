@@ -0,0 +1,209 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package bolthold_test
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/timshannon/bolthold"
+	bolt "go.etcd.io/bbolt"
+)
+
+type Contact struct {
+	First string
+	Last  string
+}
+
+func TestMigration(t *testing.T) {
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		type contactV0 struct {
+			Name string
+		}
+
+		// records written before the type was versioned
+		ok(t, store.Bolt().Update(func(tx *bolt.Tx) error {
+			b, err := tx.CreateBucket([]byte("Contact"))
+			ok(t, err)
+			key, err := bolthold.DefaultEncode("ada")
+			ok(t, err)
+			value, err := bolthold.DefaultEncode(&contactV0{Name: "Ada Lovelace"})
+			ok(t, err)
+			return b.Put(key, value)
+		}))
+
+		migrated := 0
+		store.RegisterMigration(&Contact{}, bolthold.Migration{
+			Version: 1,
+			Migrate: func(fromVersion uint8, raw []byte) (interface{}, error) {
+				migrated++
+				equals(t, uint8(0), fromVersion)
+
+				var old contactV0
+				err := bolthold.DefaultDecode(raw, &old)
+				if err != nil {
+					return nil, err
+				}
+				names := strings.SplitN(old.Name, " ", 2)
+				return &Contact{First: names[0], Last: names[1]}, nil
+			},
+		})
+
+		var contact Contact
+		ok(t, store.Get("ada", &contact))
+		equals(t, Contact{First: "Ada", Last: "Lovelace"}, contact)
+		equals(t, 1, migrated)
+
+		ok(t, store.Insert("grace", &Contact{First: "Grace", Last: "Hopper"}))
+
+		var result []Contact
+		ok(t, store.Find(&result, bolthold.Where("Last").In("Lovelace", "Hopper")))
+		equals(t, 2, len(result))
+
+		// once a record is rewritten it's stored with the current version
+		ok(t, store.Update("ada", &contact))
+		migrated = 0
+		ok(t, store.Get("ada", &contact))
+		ok(t, store.Get("grace", &contact))
+		equals(t, 0, migrated)
+
+		ok(t, store.Bolt().View(func(tx *bolt.Tx) error {
+			key, err := bolthold.DefaultEncode("ada")
+			ok(t, err)
+			var old Contact
+			assert(t, bolthold.DefaultDecode(tx.Bucket([]byte("Contact")).Get(key), &old) != nil,
+				"Record was written without a version")
+			return nil
+		}))
+	})
+}
+
+type Recipient struct {
+	Name    string
+	Address string `boltholdIndex:"Address"`
+}
+
+func TestRenameField(t *testing.T) {
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		type recipientV0 struct {
+			Name string
+			Mail string
+		}
+
+		// records written before Mail was renamed to Address
+		ok(t, store.Bolt().Update(func(tx *bolt.Tx) error {
+			b, err := tx.CreateBucket([]byte("Recipient"))
+			ok(t, err)
+			for _, name := range []string{"ada", "grace"} {
+				key, err := bolthold.DefaultEncode(name)
+				ok(t, err)
+				value, err := bolthold.DefaultEncode(&recipientV0{Name: name, Mail: name + "@example.com"})
+				ok(t, err)
+				ok(t, b.Put(key, value))
+			}
+			return nil
+		}))
+		ok(t, store.Insert("alan", &Recipient{Name: "alan", Address: "alan@example.com"}))
+
+		var recipient Recipient
+		ok(t, store.Get("ada", &recipient))
+		equals(t, "", recipient.Address)
+
+		equals(t, bolt.ErrTxNotWritable, store.Bolt().View(func(tx *bolt.Tx) error {
+			return store.TxRenameField(tx, &Recipient{}, "Mail", "Address")
+		}))
+		assert(t, store.RenameField(&Recipient{}, "Mail", "Phone") != nil, "renamed to a field that doesn't exist")
+
+		ok(t, store.RenameField(&Recipient{}, "Mail", "Address"))
+
+		ok(t, store.Get("ada", &recipient))
+		equals(t, Recipient{Name: "ada", Address: "ada@example.com"}, recipient)
+		ok(t, store.Get("alan", &recipient))
+		equals(t, Recipient{Name: "alan", Address: "alan@example.com"}, recipient)
+
+		var result []Recipient
+		ok(t, store.Find(&result, bolthold.Where("Address").Eq("grace@example.com").Index("Address")))
+		equals(t, 1, len(result))
+		equals(t, "grace", result[0].Name)
+	})
+}
+
+func TestRewriteMigrated(t *testing.T) {
+	filename := tempfile()
+	defer os.Remove(filename)
+
+	store, err := bolthold.Open(filename, 0666, &bolthold.Options{RewriteMigrated: true})
+	ok(t, err)
+	defer store.Close()
+
+	type contactV0 struct {
+		Name string
+	}
+
+	ok(t, store.Bolt().Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket([]byte("Contact"))
+		ok(t, err)
+		for _, name := range []string{"Ada Lovelace", "Grace Hopper"} {
+			key, err := bolthold.DefaultEncode(strings.ToLower(strings.Fields(name)[0]))
+			ok(t, err)
+			value, err := bolthold.DefaultEncode(&contactV0{Name: name})
+			ok(t, err)
+			ok(t, b.Put(key, value))
+		}
+		return nil
+	}))
+
+	migrated := 0
+	store.RegisterMigration(&Contact{}, bolthold.Migration{
+		Version: 1,
+		Migrate: func(fromVersion uint8, raw []byte) (interface{}, error) {
+			migrated++
+			var old contactV0
+			err := bolthold.DefaultDecode(raw, &old)
+			if err != nil {
+				return nil, err
+			}
+			names := strings.SplitN(old.Name, " ", 2)
+			return &Contact{First: names[0], Last: names[1]}, nil
+		},
+	})
+
+	isVersioned := func(name string) bool {
+		versioned := false
+		ok(t, store.Bolt().View(func(tx *bolt.Tx) error {
+			key, err := bolthold.DefaultEncode(name)
+			ok(t, err)
+			var old contactV0
+			versioned = bolthold.DefaultDecode(tx.Bucket([]byte("Contact")).Get(key), &old) != nil
+			return nil
+		}))
+		return versioned
+	}
+
+	// read outside of a write transaction, the record is rewritten by the next one
+	var contact Contact
+	ok(t, store.Get("ada", &contact))
+	equals(t, Contact{First: "Ada", Last: "Lovelace"}, contact)
+	assert(t, !isVersioned("ada"), "record was rewritten by a read only transaction")
+
+	ok(t, store.Insert("alan", &Contact{First: "Alan", Last: "Turing"}))
+	assert(t, isVersioned("ada"), "record wasn't rewritten by the next write")
+
+	// read in a write transaction, the record is rewritten straight away
+	ok(t, store.Bolt().Update(func(tx *bolt.Tx) error {
+		var result []Contact
+		ok(t, store.TxFind(tx, &result, bolthold.Where("Last").Eq("Hopper")))
+		equals(t, 1, len(result))
+		return nil
+	}))
+	assert(t, isVersioned("grace"), "record wasn't rewritten by the transaction that read it")
+
+	migrated = 0
+	var result []Contact
+	ok(t, store.Find(&result, nil))
+	equals(t, 3, len(result))
+	equals(t, 0, migrated)
+}
@@ -0,0 +1,178 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package bolthold
+
+import (
+	bolt "go.etcd.io/bbolt"
+)
+
+const namespaceBucketPrefix = "_namespace"
+
+// Namespace is a scoped view of the store, whose types and their indexes are stored in a bucket of their own, apart
+// from the rest of the store and from every other namespace.  One store can hold the records of many tenants this
+// way, without adding the tenant to every key and query
+type Namespace struct {
+	store *Store
+	name  []byte
+}
+
+// Namespace returns the namespace with the passed in name.  Its bucket is created when a record is first written to it
+//
+//	tenant := store.Namespace("tenantA")
+//	err := tenant.Insert(key, &item)
+func (s *Store) Namespace(name string) *Namespace {
+	return &Namespace{
+		store: s,
+		name:  namespaceBucketName(name),
+	}
+}
+
+func namespaceBucketName(name string) []byte {
+	return []byte(namespaceBucketPrefix + ":" + name)
+}
+
+// DeleteNamespace deletes the namespace with the passed in name, along with every record and index in it
+func (s *Store) DeleteNamespace(name string) error {
+	return s.updateTx(func(tx *bolt.Tx) error {
+		return s.TxDeleteNamespace(tx, name)
+	})
+}
+
+// TxDeleteNamespace is the same as DeleteNamespace except it allows you to specify your own transaction
+func (s *Store) TxDeleteNamespace(tx *bolt.Tx, name string) error {
+	if !tx.Writable() {
+		return bolt.ErrTxNotWritable
+	}
+	err := tx.DeleteBucket(namespaceBucketName(name))
+	if err == bolt.ErrBucketNotFound {
+		return nil
+	}
+	return err
+}
+
+// Bucket returns the namespace's bucket in the transaction, for use with the InBucket functions of the store.  In a
+// writable transaction the bucket is created if it doesn't exist yet, otherwise it's nil until the namespace has
+// been written to
+func (n *Namespace) Bucket(tx *bolt.Tx) (*bolt.Bucket, error) {
+	if !tx.Writable() {
+		return tx.Bucket(n.name), nil
+	}
+	return tx.CreateBucketIfNotExists(n.name)
+}
+
+// update runs fn in a write transaction with the namespace's bucket
+func (n *Namespace) update(fn func(b *bolt.Bucket) error) error {
+	return n.store.updateTx(func(tx *bolt.Tx) error {
+		b, err := n.Bucket(tx)
+		if err != nil {
+			return err
+		}
+		return fn(b)
+	})
+}
+
+// view runs fn in a read transaction with the namespace's bucket, and returns empty instead if nothing has been
+// written to the namespace yet
+func (n *Namespace) view(empty error, fn func(b *bolt.Bucket) error) error {
+	return n.store.Bolt().View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(n.name)
+		if b == nil {
+			return empty
+		}
+		return fn(b)
+	})
+}
+
+// Insert is the same as Store.Insert, in the namespace
+func (n *Namespace) Insert(key, data interface{}) error {
+	return n.update(func(b *bolt.Bucket) error {
+		return n.store.InsertIntoBucket(b, key, data)
+	})
+}
+
+// InsertKey is the same as Store.InsertKey, in the namespace
+func (n *Namespace) InsertKey(key, data interface{}) (interface{}, error) {
+	var stored interface{}
+	err := n.update(func(b *bolt.Bucket) error {
+		var err error
+		stored, err = n.store.InsertKeyIntoBucket(b, key, data)
+		return err
+	})
+	return stored, err
+}
+
+// Update is the same as Store.Update, in the namespace
+func (n *Namespace) Update(key, data interface{}) error {
+	return n.update(func(b *bolt.Bucket) error {
+		return n.store.UpdateBucket(b, key, data)
+	})
+}
+
+// Upsert is the same as Store.Upsert, in the namespace
+func (n *Namespace) Upsert(key, data interface{}) error {
+	return n.update(func(b *bolt.Bucket) error {
+		return n.store.UpsertBucket(b, key, data)
+	})
+}
+
+// UpdateMatching is the same as Store.UpdateMatching, in the namespace
+func (n *Namespace) UpdateMatching(dataType interface{}, query *Query, update func(record interface{}) error) error {
+	return n.update(func(b *bolt.Bucket) error {
+		return n.store.UpdateMatchingInBucket(b, dataType, query, update)
+	})
+}
+
+// Delete is the same as Store.Delete, in the namespace
+func (n *Namespace) Delete(key, dataType interface{}) error {
+	return n.update(func(b *bolt.Bucket) error {
+		return n.store.DeleteFromBucket(b, key, dataType)
+	})
+}
+
+// DeleteMatching is the same as Store.DeleteMatching, in the namespace
+func (n *Namespace) DeleteMatching(dataType interface{}, query *Query) error {
+	return n.update(func(b *bolt.Bucket) error {
+		return n.store.DeleteMatchingFromBucket(b, dataType, query)
+	})
+}
+
+// Get is the same as Store.Get, in the namespace
+func (n *Namespace) Get(key, result interface{}) error {
+	return n.view(ErrNotFound, func(b *bolt.Bucket) error {
+		return n.store.GetFromBucket(b, key, result)
+	})
+}
+
+// Find is the same as Store.Find, in the namespace
+func (n *Namespace) Find(result interface{}, query *Query) error {
+	return n.view(nil, func(b *bolt.Bucket) error {
+		return n.store.FindInBucket(b, result, query)
+	})
+}
+
+// FindOne is the same as Store.FindOne, in the namespace
+func (n *Namespace) FindOne(result interface{}, query *Query) error {
+	return n.view(ErrNotFound, func(b *bolt.Bucket) error {
+		return n.store.FindOneInBucket(b, result, query)
+	})
+}
+
+// Count is the same as Store.Count, in the namespace
+func (n *Namespace) Count(dataType interface{}, query *Query) (int, error) {
+	count := 0
+	err := n.view(nil, func(b *bolt.Bucket) error {
+		var err error
+		count, err = n.store.CountInBucket(b, dataType, query)
+		return err
+	})
+	return count, err
+}
+
+// ForEach is the same as Store.ForEach, in the namespace
+func (n *Namespace) ForEach(query *Query, fn interface{}) error {
+	return n.view(nil, func(b *bolt.Bucket) error {
+		return n.store.ForEachInBucket(b, query, fn)
+	})
+}
@@ -0,0 +1,77 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package bolthold_test
+
+import (
+	"testing"
+
+	"github.com/timshannon/bolthold"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestNamespace(t *testing.T) {
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		tenantA := store.Namespace("tenantA")
+		tenantB := store.Namespace("tenantB")
+
+		var result []ItemTest
+		ok(t, tenantA.Find(&result, nil))
+		equals(t, 0, len(result))
+		equals(t, bolthold.ErrNotFound, tenantA.Get(1, &ItemTest{}))
+
+		ok(t, tenantA.Insert(1, &ItemTest{Name: "a1", Category: "vehicle"}))
+		ok(t, tenantA.Insert(2, &ItemTest{Name: "a2", Category: "food"}))
+		ok(t, tenantB.Insert(1, &ItemTest{Name: "b1", Category: "vehicle"}))
+		ok(t, store.Insert(1, &ItemTest{Name: "root", Category: "vehicle"}))
+
+		var item ItemTest
+		ok(t, tenantA.Get(1, &item))
+		equals(t, "a1", item.Name)
+		ok(t, tenantB.Get(1, &item))
+		equals(t, "b1", item.Name)
+		ok(t, store.Get(1, &item))
+		equals(t, "root", item.Name)
+
+		result = nil
+		ok(t, tenantA.Find(&result, bolthold.Where("Category").Eq("vehicle").Index("Category")))
+		equals(t, 1, len(result))
+		equals(t, "a1", result[0].Name)
+
+		count, err := tenantB.Count(&ItemTest{}, nil)
+		ok(t, err)
+		equals(t, 1, count)
+
+		ok(t, tenantA.UpdateMatching(&ItemTest{}, bolthold.Where("Category").Eq("food"),
+			func(record interface{}) error {
+				record.(*ItemTest).Category = "vehicle"
+				return nil
+			}))
+		count, err = tenantA.Count(&ItemTest{}, bolthold.Where("Category").Eq("vehicle").Index("Category"))
+		ok(t, err)
+		equals(t, 2, count)
+
+		ok(t, store.Bolt().Update(func(tx *bolt.Tx) error {
+			b, err := tenantB.Bucket(tx)
+			if err != nil {
+				return err
+			}
+			return store.InsertIntoBucket(b, 2, &ItemTest{Name: "b2"})
+		}))
+		count, err = tenantB.Count(&ItemTest{}, nil)
+		ok(t, err)
+		equals(t, 2, count)
+
+		types, err := store.Buckets()
+		ok(t, err)
+		equals(t, 1, len(types))
+		equals(t, 1, types[0].Count)
+
+		ok(t, store.DeleteNamespace("tenantA"))
+		equals(t, bolthold.ErrNotFound, tenantA.Get(1, &ItemTest{}))
+		ok(t, tenantB.Get(1, &item))
+		equals(t, "b1", item.Name)
+		ok(t, store.DeleteNamespace("tenantA"))
+	})
+}
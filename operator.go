@@ -0,0 +1,72 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package bolthold
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Operator is a criterion operator added with RegisterOperator, for matching that the built in operators can't do,
+// such as testing if an IP address is in a CIDR block
+type Operator struct {
+	// Match tests if the value of the field matches the argument passed to Criterion.Op
+	Match func(field, arg interface{}) (bool, error)
+
+	// Candidates optionally returns every field value that could match the argument, which lets queries on a field
+	// with a boltholdIndex tag look those values up in the index instead of reading every record, when
+	// Options.EnableAutoIndex is set.  The values must be the same type as the field, and the records found are
+	// still checked with Match.  Returning nil reads every record
+	Candidates func(arg interface{}) []interface{}
+}
+
+type namedOperator struct {
+	name string
+	Operator
+}
+
+var operators = struct {
+	sync.RWMutex
+	byName map[string]*namedOperator
+}{
+	byName: make(map[string]*namedOperator),
+}
+
+// RegisterOperator adds a criterion operator which can be used in any query with Criterion.Op.  Registering a
+// name twice, or an operator without a Match func, will panic
+func RegisterOperator(name string, operator Operator) {
+	if operator.Match == nil {
+		panic(fmt.Sprintf("The operator %s has no Match func", name))
+	}
+
+	operators.Lock()
+	defer operators.Unlock()
+
+	if _, ok := operators.byName[name]; ok {
+		panic(fmt.Sprintf("The operator %s has already been registered", name))
+	}
+	operators.byName[name] = &namedOperator{name: name, Operator: operator}
+}
+
+// Op tests the current field with the operator registered under name, passing it arg.  Op will panic if no
+// operator has been registered with that name
+//
+//	bolthold.Where("Address").Op("cidr", network)
+func (c *Criterion) Op(name string, arg interface{}) *Query {
+	if c.query.currentField == Key {
+		panic("Registered operators cannot be used against Keys, as the Key type is unknown at runtime")
+	}
+
+	operators.RLock()
+	operator, ok := operators.byName[name]
+	operators.RUnlock()
+
+	if !ok {
+		panic(fmt.Sprintf("No operator has been registered with the name %s", name))
+	}
+
+	c.custom = operator
+	return c.op(custom, arg)
+}
@@ -0,0 +1,109 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package bolthold_test
+
+import (
+	"net"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/timshannon/bolthold"
+)
+
+type Host struct {
+	Name    string
+	Address string `boltholdIndex:"Address"`
+}
+
+func init() {
+	bolthold.RegisterOperator("cidr", bolthold.Operator{
+		Match: func(field, arg interface{}) (bool, error) {
+			return arg.(*net.IPNet).Contains(net.ParseIP(field.(string))), nil
+		},
+		Candidates: func(arg interface{}) []interface{} {
+			network := arg.(*net.IPNet)
+			if ones, bits := network.Mask.Size(); bits-ones > 8 {
+				return nil
+			}
+
+			var addresses []interface{}
+			for ip := network.IP.Mask(network.Mask).To4(); network.Contains(ip); {
+				addresses = append(addresses, ip.String())
+
+				next := make(net.IP, len(ip))
+				copy(next, ip)
+				for i := len(next) - 1; i >= 0; i-- {
+					next[i]++
+					if next[i] != 0 {
+						break
+					}
+				}
+				ip = next
+			}
+			return addresses
+		},
+	})
+}
+
+func TestRegisteredOperator(t *testing.T) {
+	filename := tempfile()
+	store, err := bolthold.Open(filename, 0666, &bolthold.Options{EnableAutoIndex: true})
+	ok(t, err)
+	defer os.Remove(filename)
+	defer store.Close()
+
+	hosts := []Host{
+		{Name: "gateway", Address: "10.0.0.1"},
+		{Name: "printer", Address: "10.0.0.20"},
+		{Name: "nas", Address: "10.0.1.5"},
+		{Name: "dns", Address: "8.8.8.8"},
+	}
+	for i := range hosts {
+		ok(t, store.Insert(hosts[i].Name, &hosts[i]))
+	}
+
+	_, small, err := net.ParseCIDR("10.0.0.0/27")
+	ok(t, err)
+	_, large, err := net.ParseCIDR("10.0.0.0/16")
+	ok(t, err)
+
+	var result []Host
+	ok(t, store.Find(&result, bolthold.Where("Address").Op("cidr", small)))
+	equals(t, 2, len(result))
+
+	// the candidates were looked up in the index
+	stats := store.IndexStats()
+	equals(t, 1, len(stats))
+	equals(t, "Address", stats[0].Index)
+
+	// too many candidates, so every record is read
+	result = nil
+	ok(t, store.Find(&result, bolthold.Where("Address").Op("cidr", large)))
+	equals(t, 3, len(result))
+	equals(t, int64(1), store.IndexStats()[0].Chosen)
+
+	result = nil
+	ok(t, store.Find(&result, bolthold.Where("Address").Not().Op("cidr", large)))
+	equals(t, 1, len(result))
+	equals(t, "dns", result[0].Name)
+
+	result = nil
+	ok(t, store.Find(&result, bolthold.Where("Address").Op("cidr", small).Index("Address")))
+	equals(t, 2, len(result))
+
+	query := bolthold.Where("Address").Op("cidr", small)
+	assert(t, strings.Contains(query.String(), "Address cidr 10.0.0.0/27"), "Unexpected query string %s", query)
+}
+
+func TestRegisterOperatorTwice(t *testing.T) {
+	defer func() {
+		assert(t, recover() != nil, "Registering an operator twice didn't panic")
+	}()
+
+	bolthold.RegisterOperator("cidr", bolthold.Operator{
+		Match: func(field, arg interface{}) (bool, error) { return false, nil },
+	})
+}
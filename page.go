@@ -0,0 +1,211 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package bolthold
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+	"io"
+	"sort"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// ErrInvalidPageToken is the error returned by FindPage when the page token is malformed, was returned for a
+// different query, or doesn't carry a valid signature when Options.PageTokenKey is set
+var ErrInvalidPageToken = errors.New("The page token is invalid, or is for a different query")
+
+// FindPage finds a page of the records matching the query, which must have a Limit, in the order of their encoded
+// keys, which is the order Find returns them in when the query has no SortBy or Or'd queries.  The returned
+// token is passed in to the next call with the same query to get the next page, and is empty once there are no
+// more records.  Each page starts after the last key of the page before it, so records inserted or deleted between
+// calls don't cause records to be repeated or skipped, even though each page is read in its own transaction.  Skip
+// only applies to the first page, and SortBy isn't allowed.  Tokens are URL safe, and are signed when
+// Options.PageTokenKey is set, so they can be handed out to API clients as they are
+//
+//	token := ""
+//	for {
+//		var page []Item
+//		token, err = store.FindPage(&page, bolthold.Where("Category").Eq("tools").Limit(100), token)
+//		...
+//		if token == "" {
+//			break
+//		}
+//	}
+func (s *Store) FindPage(result interface{}, query *Query, token string) (string, error) {
+	next := ""
+	err := s.Bolt().View(func(tx *bolt.Tx) error {
+		var txErr error
+		next, txErr = s.TxFindPage(tx, result, query, token)
+		return txErr
+	})
+	return next, err
+}
+
+// TxFindPage is the same as FindPage except it allows you to specify your own transaction
+func (s *Store) TxFindPage(tx *bolt.Tx, result interface{}, query *Query, token string) (string, error) {
+	return s.findPage(tx, result, query, token)
+}
+
+func (s *Store) findPage(source BucketSource, result interface{}, query *Query, token string) (string, error) {
+	if query == nil || query.limit == 0 {
+		return "", errors.New("FindPage needs a query with a Limit")
+	}
+	if len(query.sort) > 0 {
+		return "", errors.New("FindPage returns records in key order, so the query can't have a SortBy")
+	}
+
+	dataType, add, done := s.resultAppender(result)
+
+	fingerprint := pageFingerprint(s.newStorer(dataType).Type(), query)
+
+	query, err := s.prepQuery(dataType, query.clone())
+	if err != nil {
+		return "", err
+	}
+
+	limit := query.limit
+	skip := query.skip
+
+	if token != "" {
+		after, err := s.decodePageToken(token, fingerprint)
+		if err != nil {
+			return "", err
+		}
+		query.after = after
+		skip = 0
+	}
+
+	records, err := s.keyOrderRecords(source, dataType, query, skip, limit)
+	if err != nil {
+		return "", err
+	}
+
+	for i := range records {
+		err = add(records[i])
+		if err != nil {
+			return "", err
+		}
+	}
+	done()
+
+	if len(records) < limit {
+		return "", nil
+	}
+	return s.encodePageToken(fingerprint, records[len(records)-1].key), nil
+}
+
+// keyOrderRecords runs a prepared query, and returns the matching records in the order of their keys, after skipping
+// the first skip of them, and stopping at limit
+func (s *Store) keyOrderRecords(source BucketSource, dataType interface{}, query *Query, skip, limit int) ([]*record,
+	error) {
+	var records []*record
+	collect := func(r *record) error {
+		records = append(records, r)
+		return nil
+	}
+
+	if query.index == "" && len(query.ors) == 0 {
+		// the records are already read in key order
+		query.limit = limit
+		err := s.runQuery(source, dataType, query, nil, skip, collect)
+		return records, err
+	}
+
+	// records read from an index, or by Or'd queries, need sorting by key before they can be cut
+	query.limit = 0
+	err := s.runQuery(source, dataType, query, nil, 0, collect)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return bytes.Compare(records[i].key, records[j].key) < 0
+	})
+	if skip > len(records) {
+		skip = len(records)
+	}
+	records = records[skip:]
+	if limit != 0 && len(records) > limit {
+		records = records[:limit]
+	}
+	return records, nil
+}
+
+// pageFingerprint identifies the type and criteria of a query, so a page token can't be used with another query
+func pageFingerprint(typeName string, query *Query) uint64 {
+	h := fnv.New64a()
+	_, _ = io.WriteString(h, typeName)
+	writeQueryFingerprint(h, query)
+	return h.Sum64()
+}
+
+func writeQueryFingerprint(w io.Writer, query *Query) {
+	fields := make([]string, 0, len(query.fieldCriteria))
+	for field := range query.fieldCriteria {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	_, _ = io.WriteString(w, "\x00index "+query.index)
+	for _, field := range fields {
+		for _, criterion := range query.fieldCriteria[field] {
+			_, _ = io.WriteString(w, "\x00"+field+" "+criterion.String())
+		}
+	}
+	if query.withDeleted {
+		_, _ = io.WriteString(w, "\x00deleted")
+	}
+	for i := range query.ors {
+		_, _ = io.WriteString(w, "\x00or")
+		writeQueryFingerprint(w, query.ors[i])
+	}
+}
+
+// encodePageToken returns the URL safe token of a page ending at key.  If the store has a page token key, the token
+// ends with an HMAC of the rest of it, so clients can't change the key to read from somewhere the query wouldn't
+func (s *Store) encodePageToken(fingerprint uint64, key []byte) string {
+	token := make([]byte, 8+len(key))
+	binary.BigEndian.PutUint64(token, fingerprint)
+	copy(token[8:], key)
+	if len(s.pageTokenKey) != 0 {
+		token = s.signPageToken(token, token)
+	}
+	return base64.RawURLEncoding.EncodeToString(token)
+}
+
+func (s *Store) decodePageToken(token string, fingerprint uint64) ([]byte, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrInvalidPageToken
+	}
+
+	if len(s.pageTokenKey) != 0 {
+		if len(data) < sha256.Size {
+			return nil, ErrInvalidPageToken
+		}
+		signed, mac := data[:len(data)-sha256.Size], data[len(data)-sha256.Size:]
+		if !hmac.Equal(mac, s.signPageToken(nil, signed)) {
+			return nil, ErrInvalidPageToken
+		}
+		data = signed
+	}
+
+	if len(data) <= 8 || binary.BigEndian.Uint64(data) != fingerprint {
+		return nil, ErrInvalidPageToken
+	}
+	return data[8:], nil
+}
+
+// signPageToken appends the HMAC-SHA256 of token, under the store's page token key, to dst
+func (s *Store) signPageToken(dst, token []byte) []byte {
+	mac := hmac.New(sha256.New, s.pageTokenKey)
+	_, _ = mac.Write(token)
+	return mac.Sum(dst)
+}
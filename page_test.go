@@ -0,0 +1,160 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package bolthold_test
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"os"
+	"testing"
+
+	"github.com/timshannon/bolthold"
+)
+
+func findAllPages(t *testing.T, store *bolthold.Store, query func() *bolthold.Query) []ItemTest {
+	var all []ItemTest
+	token := ""
+	for pages := 0; ; pages++ {
+		assert(t, pages <= len(testData), "FindPage didn't stop returning pages")
+
+		var page []ItemTest
+		var err error
+		token, err = store.FindPage(&page, query().Limit(3), token)
+		ok(t, err)
+		assert(t, len(page) <= 3, "FindPage returned more records than the limit")
+		all = append(all, page...)
+		if token == "" {
+			return all
+		}
+	}
+}
+
+func TestFindPage(t *testing.T) {
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		insertTestData(t, store)
+
+		queries := []func() *bolthold.Query{
+			func() *bolthold.Query { return &bolthold.Query{} },
+			func() *bolthold.Query { return bolthold.Where("Category").Eq("vehicle") },
+			func() *bolthold.Query { return bolthold.Where("Category").Eq("animal").Index("Category") },
+			func() *bolthold.Query {
+				return bolthold.Where("Category").Eq("food").Or(bolthold.Where("Name").Eq("car"))
+			},
+		}
+
+		for i := range queries {
+			var want []ItemTest
+			ok(t, store.Find(&want, queries[i]()))
+			assert(t, len(want) > 0, "Query %d matches no records", i)
+
+			got := findAllPages(t, store, queries[i])
+			equals(t, len(want), len(got))
+			for j := range got {
+				assert(t, j == 0 || got[j-1].Key < got[j].Key, "Query %d pages aren't in key order", i)
+			}
+		}
+	})
+}
+
+func TestFindPageStable(t *testing.T) {
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		insertTestData(t, store)
+
+		var first []ItemTest
+		token, err := store.FindPage(&first, (&bolthold.Query{}).Limit(3), "")
+		ok(t, err)
+		equals(t, 3, len(first))
+
+		// a record before the page boundary is deleted, and one is inserted before it
+		ok(t, store.Delete(first[0].Key, &ItemTest{}))
+		ok(t, store.Insert(-1, ItemTest{Key: -1, Name: "early"}))
+
+		var second []ItemTest
+		_, err = store.FindPage(&second, (&bolthold.Query{}).Limit(3), token)
+		ok(t, err)
+		equals(t, 3, len(second))
+		assert(t, second[0].Key > first[2].Key, "The second page repeated or skipped records")
+
+		var all []ItemTest
+		ok(t, store.Find(&all, nil))
+		for i := range all {
+			if all[i].Key > first[2].Key {
+				equals(t, all[i].Key, second[0].Key)
+				break
+			}
+		}
+	})
+}
+
+func TestFindPageErrors(t *testing.T) {
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		insertTestData(t, store)
+
+		var page []ItemTest
+		_, err := store.FindPage(&page, bolthold.Where("Name").Eq("car"), "")
+		assert(t, err != nil, "FindPage without a Limit didn't fail")
+
+		_, err = store.FindPage(&page, bolthold.Where("Name").Ne("car").SortBy("Name").Limit(2), "")
+		assert(t, err != nil, "FindPage with SortBy didn't fail")
+
+		token, err := store.FindPage(&page, bolthold.Where("Name").Ne("car").Limit(2), "")
+		ok(t, err)
+		assert(t, token != "", "No token was returned for the next page")
+
+		_, err = store.FindPage(&page, bolthold.Where("Name").Ne("truck").Limit(2), token)
+		equals(t, bolthold.ErrInvalidPageToken, err)
+		_, err = store.FindPage(&page, bolthold.Where("Name").Ne("car").Limit(2), "not a token")
+		equals(t, bolthold.ErrInvalidPageToken, err)
+	})
+}
+
+func TestFindPageSigned(t *testing.T) {
+	open := func(key []byte) (*bolthold.Store, func()) {
+		filename := tempfile()
+		store, err := bolthold.Open(filename, 0666, &bolthold.Options{PageTokenKey: key})
+		ok(t, err)
+		insertTestData(t, store)
+		return store, func() {
+			store.Close()
+			os.Remove(filename)
+		}
+	}
+
+	store, done := open([]byte("secret"))
+	defer done()
+	other, doneOther := open([]byte("another secret"))
+	defer doneOther()
+	unsigned, doneUnsigned := open(nil)
+	defer doneUnsigned()
+
+	query := func() *bolthold.Query { return bolthold.Where("Name").Ne("car") }
+
+	var want []ItemTest
+	ok(t, store.Find(&want, query()))
+	equals(t, len(want), len(findAllPages(t, store, query)))
+
+	var page []ItemTest
+	token, err := store.FindPage(&page, query().Limit(2), "")
+	ok(t, err)
+	assert(t, token != "", "No token was returned for the next page")
+
+	// the last key of the page is changed, so the next page would start somewhere else
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	ok(t, err)
+	data[len(data)-sha256.Size-1]++
+	_, err = store.FindPage(&page, query().Limit(2), base64.RawURLEncoding.EncodeToString(data))
+	equals(t, bolthold.ErrInvalidPageToken, err)
+
+	_, err = other.FindPage(&page, query().Limit(2), token)
+	equals(t, bolthold.ErrInvalidPageToken, err)
+
+	unsignedToken, err := unsigned.FindPage(&page, query().Limit(2), "")
+	ok(t, err)
+	_, err = store.FindPage(&page, query().Limit(2), unsignedToken)
+	equals(t, bolthold.ErrInvalidPageToken, err)
+
+	_, err = store.FindPage(&page, query().Limit(2), token)
+	ok(t, err)
+}
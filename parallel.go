@@ -0,0 +1,196 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package bolthold
+
+import (
+	"errors"
+	"sync"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// errOrsPlanned stops the first run of a query in viewOrs once its Or'd queries are known
+var errOrsPlanned = errors.New("Or'd queries planned")
+
+// orsRun is the state of a query whose Or'd queries are run in parallel by viewOrs.  The first time the query is run
+// it's only planned, and its Or'd queries are kept in query, the second time the records found by them are replayed
+type orsRun struct {
+	replay   bool
+	used     bool
+	dataType interface{}
+	query    *Query
+	txID     int
+	records  []*record
+}
+
+// viewOrs runs fn in a read transaction the store begins itself, running the Or'd queries of the query fn runs in
+// parallel if they can be.  Bolt transactions can't be shared between goroutines, and beginning a read transaction
+// while another is held by the same goroutine can deadlock with a writer waiting to grow the file, so fn is run
+// once to plan the query, its Or'd queries are each run in a read transaction of their own with no other held, and
+// fn is then run again, returning the records they found if every transaction saw the same data.  Otherwise the
+// query is run normally in fn's transaction
+func (s *Store) viewOrs(fn func(tx *bolt.Tx) error) error {
+	if !s.parallelOrs {
+		return s.Bolt().View(fn)
+	}
+
+	run := &orsRun{}
+	view := func() error {
+		return s.Bolt().View(func(tx *bolt.Tx) error {
+			s.orsRuns.Store(tx, run)
+			defer s.orsRuns.Delete(tx)
+			return fn(tx)
+		})
+	}
+
+	err := view()
+	if err != errOrsPlanned {
+		return err
+	}
+
+	err = s.runOrsParallel(run)
+	if err != nil {
+		return err
+	}
+	if s.beforeOrsReplay != nil {
+		s.beforeOrsReplay()
+	}
+
+	run.replay = true
+	return view()
+}
+
+// orsRun returns the parallel run of the query being run in source, if the store began the transaction in viewOrs,
+// and the query's Or'd queries can each be run in their own goroutine.  Skip and Limit depend on the records found by
+// the branches before, and match funcs aren't expected to be safe to call concurrently, so only queries without
+// them can be split
+func (s *Store) orsRun(source BucketSource, query *Query, skip int) *orsRun {
+	if !s.parallelOrs || len(query.ors) == 0 || skip != 0 {
+		return nil
+	}
+
+	tx, ok := source.(*bolt.Tx)
+	if !ok {
+		return nil
+	}
+	run, ok := s.orsRuns.Load(tx)
+	if !ok || run.(*orsRun).used || !parallelSafe(query) {
+		return nil
+	}
+	return run.(*orsRun)
+}
+
+func parallelSafe(query *Query) bool {
+	if query.limit != 0 || query.skip != 0 || len(query.sort) != 0 || query.branchOrder {
+		return false
+	}
+
+	for _, criteria := range query.fieldCriteria {
+		if hasMatchFunc(criteria) {
+			return false
+		}
+	}
+
+	for i := range query.ors {
+		if !parallelSafe(query.ors[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// runOrs plans or replays the parallel run of the query.  Returns false if the query has to be run normally, because
+// the store was written to between the transactions the Or'd queries were run in
+func (s *Store) runOrs(tx *bolt.Tx, run *orsRun, dataType interface{}, query *Query,
+	action func(r *record) error) (bool, error) {
+	if !run.replay {
+		run.dataType = dataType
+		run.query = query
+		return false, errOrsPlanned
+	}
+
+	run.used = true
+	if run.records == nil || run.txID != tx.ID() {
+		return false, nil
+	}
+
+	for _, r := range run.records {
+		err := action(r)
+		if err != nil {
+			return true, err
+		}
+	}
+	return true, nil
+}
+
+// runOrsParallel runs the planned query and each of its Or'd queries in their own goroutine and read transaction,
+// and keeps the records they find in the same order as they would be returned by runQuery.  If the transactions
+// didn't all see the same data no records are kept
+func (s *Store) runOrsParallel(run *orsRun) error {
+	query := run.query
+
+	first := *query
+	first.ors = nil
+	branches := append([]*Query{&first}, query.ors...)
+	for i := range query.ors {
+		query.ors[i].keysOnly = query.keysOnly
+		query.ors[i].withDeleted = query.withDeleted
+		query.ors[i].skipUndecodable = query.skipUndecodable
+		query.ors[i].after = query.after
+	}
+
+	found := make([][]*record, len(branches))
+	txIDs := make([]int, len(branches))
+	errs := make([]error, len(branches))
+
+	var wg sync.WaitGroup
+	for i := range branches {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = s.Bolt().View(func(tx *bolt.Tx) error {
+				txIDs[i] = tx.ID()
+				// a non-nil list of retrieved keys stops runQuery from trying to run the query in parallel again
+				return s.runQuery(tx, run.dataType, branches[i], keyList{}, 0, func(r *record) error {
+					// keys point into the branch's transaction, which is closed before the records are used
+					found[i] = append(found[i], &record{
+						key:   append([]byte(nil), r.key...),
+						value: r.value,
+					})
+					return nil
+				})
+			})
+		}(i)
+	}
+	wg.Wait()
+
+	for i := range errs {
+		if errs[i] != nil {
+			return errs[i]
+		}
+	}
+
+	for i := range txIDs {
+		if txIDs[i] != txIDs[0] {
+			// the store was written to while the branches were starting
+			return nil
+		}
+	}
+
+	run.txID = txIDs[0]
+	run.records = make([]*record, 0)
+	retrieved := make(map[string]bool)
+	for i := range found {
+		for _, r := range found[i] {
+			if retrieved[string(r.key)] {
+				continue
+			}
+			retrieved[string(r.key)] = true
+			run.records = append(run.records, r)
+		}
+	}
+
+	return nil
+}
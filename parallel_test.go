@@ -0,0 +1,80 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package bolthold_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/timshannon/bolthold"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestParallelOrs(t *testing.T) {
+	filename := tempfile()
+	store, err := bolthold.Open(filename, 0666, &bolthold.Options{ParallelOrs: true})
+	ok(t, err)
+	defer os.Remove(filename)
+	defer store.Close()
+
+	sequential, err := bolthold.Open(tempfile(), 0666, nil)
+	ok(t, err)
+	defer os.Remove(sequential.Bolt().Path())
+	defer sequential.Close()
+
+	insertTestData(t, store)
+	insertTestData(t, sequential)
+
+	queries := []func() *bolthold.Query{
+		func() *bolthold.Query {
+			return bolthold.Where("Category").Eq("vehicle").
+				Or(bolthold.Where("Category").Eq("animal")).
+				Or(bolthold.Where("Name").Eq("pizza").Or(bolthold.Where("Color").Eq("blue")))
+		},
+		func() *bolthold.Query {
+			// overlapping branches return each record once
+			return bolthold.Where("Category").Eq("food").
+				Or(bolthold.Where("Name").Eq("pizza")).
+				SortBy("Name")
+		},
+	}
+
+	for i := range queries {
+		var want, got []ItemTest
+		ok(t, sequential.Find(&want, queries[i]()))
+		ok(t, store.Find(&got, queries[i]()))
+		assert(t, len(got) > 0, "Query %d matched no records", i)
+		equals(t, want, got)
+
+		count, err := store.Count(&ItemTest{}, queries[i]())
+		ok(t, err)
+		equals(t, len(want), count)
+	}
+
+	// queries run in the caller's transaction run their Or'd queries one after the other
+	ok(t, store.Bolt().View(func(tx *bolt.Tx) error {
+		var want, got []ItemTest
+		ok(t, sequential.Find(&want, queries[0]()))
+		ok(t, store.TxFind(tx, &got, queries[0]()))
+		equals(t, want, got)
+		return nil
+	}))
+
+	// a write committed after the Or'd queries were run falls back to running the query in order, so the records
+	// found by them aren't returned
+	pizza := ItemTest{Key: 1000, Name: "pizza", Category: "food"}
+	store.SetBeforeOrsReplay(func() {
+		ok(t, store.Insert(pizza.Key, pizza))
+	})
+	var got []ItemTest
+	ok(t, store.Find(&got, queries[0]()))
+	store.SetBeforeOrsReplay(nil)
+
+	ok(t, sequential.Insert(pizza.Key, pizza))
+	var want []ItemTest
+	ok(t, sequential.Find(&want, queries[0]()))
+	equals(t, want, got)
+	equals(t, pizza.Key, got[len(got)-1].Key)
+}
@@ -0,0 +1,108 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package bolthold
+
+import (
+	"encoding"
+	"encoding/gob"
+	"reflect"
+	"strings"
+)
+
+var (
+	gobDecoderType    = reflect.TypeOf((*gob.GobDecoder)(nil)).Elem()
+	binaryDecoderType = reflect.TypeOf((*encoding.BinaryUnmarshaler)(nil)).Elem()
+)
+
+// partialType returns a struct type with only the fields of the query's data type that its criteria read, so
+// records can be matched without decoding the rest of their fields.  Gob skips the fields of a record that aren't in
+// the type it's decoding into.  partialType returns nil if the records need to be fully decoded to be matched
+func (s *Store) partialType(storer Storer, query *Query) reflect.Type {
+	if reflect.ValueOf(s.decode).Pointer() != reflect.ValueOf(DefaultDecode).Pointer() {
+		// other decoders may not match fields by name
+		return nil
+	}
+
+	if storerCodec(storer).Decoder != nil || storerMigration(storer).Migrate != nil {
+		return nil
+	}
+
+	tp := query.dataType
+	if tp.Kind() != reflect.Struct || reflect.PtrTo(tp).Implements(gobDecoderType) ||
+		reflect.PtrTo(tp).Implements(binaryDecoderType) {
+		return nil
+	}
+
+	needed := make(map[int]bool)
+	addField := func(field string) bool {
+		f, ok := tp.FieldByName(strings.SplitN(field, ".", 2)[0])
+		if !ok || f.Anonymous || len(f.Index) != 1 || f.PkgPath != "" {
+			return false
+		}
+		needed[f.Index[0]] = true
+		return true
+	}
+
+	for field, criteria := range query.fieldCriteria {
+		if field != Key && field == query.index && !query.badIndex && !query.recheckIndex {
+			// already matched by the index
+			continue
+		}
+		if field != Key && !addField(field) {
+			return nil
+		}
+
+		for _, c := range criteria {
+			if c.operator == fn {
+				// match funcs can read the whole record
+				return nil
+			}
+			if other, ok := c.value.(Field); ok && !addField(string(other)) {
+				return nil
+			}
+		}
+	}
+
+	if len(needed) == 0 || len(needed) >= tp.NumField() {
+		// nothing would be saved
+		return nil
+	}
+
+	fields := make([]reflect.StructField, 0, len(needed))
+	for i := 0; i < tp.NumField(); i++ {
+		if needed[i] {
+			f := tp.Field(i)
+			fields = append(fields, reflect.StructField{Name: f.Name, Type: f.Type, Tag: f.Tag})
+		}
+	}
+
+	return reflect.StructOf(fields)
+}
+
+func storerCodec(storer Storer) Codec {
+	if tc, ok := storer.(TypeCodec); ok {
+		return tc.Codec()
+	}
+	return Codec{}
+}
+
+// matchesPartial decodes only the fields of the record in the partial type, and tests them against the query
+func (s *Store) matchesPartial(storer Storer, partial reflect.Type, query *Query, key, value []byte) (bool, error) {
+	val := reflect.New(partial)
+
+	err := s.decodeRecord(storer, value, val.Interface())
+	if err != nil {
+		// records written by an older version of the type may be missing the fields, so fall back to decoding the
+		// whole record
+		full := reflect.New(query.dataType)
+		err = s.decodeRecord(storer, value, full.Interface())
+		if err != nil {
+			return false, &decodeError{err: err}
+		}
+		val = full
+	}
+
+	return query.matchesAllFields(s, key, val, val.Interface())
+}
@@ -6,7 +6,11 @@ package bolthold
 
 import (
 	"errors"
+	"fmt"
+	"math"
 	"reflect"
+	"strings"
+	"time"
 
 	bolt "go.etcd.io/bbolt"
 )
@@ -32,9 +36,10 @@ func NextSequence() interface{} {
 // is currently set to the zero-value for that type, then that field will be set to
 // the value of the insert key.
 //
-// To use this with bolthold.NextSequence() use a type of `uint64` for the key field.
+// To use this with bolthold.NextSequence() use any integer type for the key field, and the sequence is stored as
+// a key of that type, otherwise the key is a uint64.
 func (s *Store) Insert(key, data interface{}) error {
-	return s.Bolt().Update(func(tx *bolt.Tx) error {
+	return s.updateTx(func(tx *bolt.Tx) error {
 		return s.insert(tx, key, data)
 	})
 }
@@ -47,6 +52,88 @@ func (s *Store) TxInsert(tx *bolt.Tx, key, data interface{}) error {
 	return s.insert(tx, key, data)
 }
 
+// InsertKey is the same as Insert, and returns the key the record was stored with, such as the uint64 generated for
+// bolthold.NextSequence(), so it can be used to refer to the record
+func (s *Store) InsertKey(key, data interface{}) (interface{}, error) {
+	var stored interface{}
+	err := s.updateTx(func(tx *bolt.Tx) error {
+		var err error
+		stored, err = s.insertKey(tx, key, data)
+		return err
+	})
+	return stored, err
+}
+
+// TxInsertKey is the same as InsertKey except it allows you specify your own transaction
+func (s *Store) TxInsertKey(tx *bolt.Tx, key, data interface{}) (interface{}, error) {
+	if !tx.Writable() {
+		return nil, bolt.ErrTxNotWritable
+	}
+	return s.insertKey(tx, key, data)
+}
+
+// InsertKeyIntoBucket is the same as InsertKey except it allows you specify your own parent bucket
+func (s *Store) InsertKeyIntoBucket(parent *bolt.Bucket, key, data interface{}) (interface{}, error) {
+	if !parent.Tx().Writable() {
+		return nil, bolt.ErrTxNotWritable
+	}
+	return s.insertKey(parent, key, data)
+}
+
+// FindOrInsert gets the record with the passed in key into result, or if there isn't one, inserts defaultValue and
+// sets result to it, all in one transaction.  It returns true if defaultValue was inserted.  defaultValue must be
+// the same type as result, or a pointer to it
+func (s *Store) FindOrInsert(key, result, defaultValue interface{}) (bool, error) {
+	inserted := false
+	err := s.updateTx(func(tx *bolt.Tx) error {
+		var err error
+		inserted, err = s.TxFindOrInsert(tx, key, result, defaultValue)
+		return err
+	})
+	return inserted, err
+}
+
+// TxFindOrInsert is the same as FindOrInsert except it allows you specify your own transaction
+func (s *Store) TxFindOrInsert(tx *bolt.Tx, key, result, defaultValue interface{}) (bool, error) {
+	if !tx.Writable() {
+		return false, bolt.ErrTxNotWritable
+	}
+
+	resultVal := reflect.ValueOf(result)
+	if resultVal.Kind() != reflect.Ptr || resultVal.IsNil() {
+		panic("result argument must be an address")
+	}
+
+	defaultVal := reflect.Indirect(reflect.ValueOf(defaultValue))
+	if defaultVal.Type() != resultVal.Elem().Type() {
+		return false, fmt.Errorf("The default value is a %s, not a %s", defaultVal.Type(), resultVal.Elem().Type())
+	}
+
+	key, err := s.resolveKey(key, defaultValue)
+	if err != nil {
+		return false, err
+	}
+
+	_, isSequence := key.(sequence)
+	_, isGenerated := key.(generatedKey)
+	if !isSequence && !isGenerated {
+		// a new sequence or generated key can't have a record yet
+		err := s.get(tx, key, result)
+		if err != ErrNotFound {
+			return false, err
+		}
+	}
+
+	_, err = s.insertKey(tx, key, defaultValue)
+	if err != nil {
+		return false, err
+	}
+
+	// the default value may have had its key or version set by the insert
+	resultVal.Elem().Set(reflect.Indirect(reflect.ValueOf(defaultValue)))
+	return true, nil
+}
+
 // InsertIntoBucket is the same as Insert except it allows you specify your own parent bucket
 func (s *Store) InsertIntoBucket(parent *bolt.Bucket, key, data interface{}) error {
 	if !parent.Tx().Writable() {
@@ -56,51 +143,84 @@ func (s *Store) InsertIntoBucket(parent *bolt.Bucket, key, data interface{}) err
 }
 
 func (s *Store) insert(source BucketSource, key, data interface{}) error {
+	_, err := s.insertKey(source, key, data)
+	return err
+}
+
+// insertKey inserts the record, and returns the key it was stored with
+func (s *Store) insertKey(source BucketSource, key, data interface{}) (interface{}, error) {
 	storer := s.newStorer(data)
 
-	b, err := source.CreateBucketIfNotExists([]byte(storer.Type()))
+	b, err := createRecordBucket(source, storer, data)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	if _, ok := key.(sequence); ok {
-		key, err = b.NextSequence()
+		seq, err := b.NextSequence()
 		if err != nil {
-			return err
+			return nil, err
 		}
+		key = sequenceKey(data, seq)
 	}
 
-	gk, err := s.encode(key)
-
+	key, err = s.resolveKey(key, data)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	if generated, ok := key.(generatedKey); ok {
+		key, err = generated.generate(data)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var gk []byte
+	if stored, ok := key.(storedKey); ok {
+		gk = stored
+	} else {
+		gk, err = s.encodeKey(key)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	if b.Get(gk) != nil {
-		return ErrKeyExists
+		return nil, ErrKeyExists
 	}
 
-	value, err := s.encode(data)
+	err = s.checkUnique(storer, source, data)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	data = nextVersion(storer, data, 0)
+	data = timestamp(storer, data, nil, time.Now())
+
+	value, err := s.encodeRecord(storer, data)
+	if err != nil {
+		return nil, err
 	}
 
 	// insert data
+	s.writes.record(false, gk, value)
+	s.changes.add(storer, gk, false)
 	err = b.Put(gk, value)
 
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// insert any indexes
 	err = s.addIndexes(storer, source, gk, data)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	dataVal := reflect.Indirect(reflect.ValueOf(data))
 	if !dataVal.CanSet() {
-		return nil
+		return key, nil
 	}
 	dataType := dataVal.Type()
 
@@ -125,13 +245,100 @@ func (s *Store) insert(source BucketSource, key, data interface{}) error {
 		}
 	}
 
-	return nil
+	return key, nil
+}
+
+// sequenceKey returns the key to insert the record with for the next value of the bucket's sequence.  If the record
+// has a key field of another integer type the sequence is converted to it, so the key can be written back to the
+// field, and the record can be read with a key of the same type
+func sequenceKey(data interface{}, seq uint64) interface{} {
+	tp := reflect.TypeOf(data)
+	for tp.Kind() == reflect.Ptr {
+		tp = tp.Elem()
+	}
+	if tp.Kind() != reflect.Struct {
+		return seq
+	}
+
+	for i := 0; i < tp.NumField(); i++ {
+		tf := tp.Field(i)
+		if _, ok := tf.Tag.Lookup(BoltholdKeyTag); !ok {
+			continue
+		}
+		switch tf.Type.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+			return reflect.ValueOf(seq).Convert(tf.Type).Interface()
+		}
+		break
+	}
+
+	return seq
+}
+
+// AdoptBucket imports every record from a bolt bucket not managed by bolthold into the bolthold type of example,
+// building all of its indexes.  keyDecode returns the key to store each record under from the raw bolt key, and
+// valueDecode decodes the raw bolt value into a new record of the example type.  If keyDecode is nil the raw key
+// bytes are used as the key, and if valueDecode is nil the store's decoder is used.
+// The original bucket is left as is, and the adoption fails with ErrKeyExists if a key has already been stored
+// in bolthold.
+func (s *Store) AdoptBucket(bucketName []byte, example interface{}, keyDecode func(key []byte) (interface{}, error),
+	valueDecode DecodeFunc) error {
+	return s.updateTx(func(tx *bolt.Tx) error {
+		return s.TxAdoptBucket(tx, bucketName, example, keyDecode, valueDecode)
+	})
+}
+
+// TxAdoptBucket is the same as AdoptBucket except it allows you to specify your own transaction
+func (s *Store) TxAdoptBucket(tx *bolt.Tx, bucketName []byte, example interface{},
+	keyDecode func(key []byte) (interface{}, error), valueDecode DecodeFunc) error {
+	if !tx.Writable() {
+		return bolt.ErrTxNotWritable
+	}
+
+	storer := s.newStorer(example)
+	if string(bucketName) == storer.Type() {
+		return fmt.Errorf("The bucket %s is already managed by bolthold", bucketName)
+	}
+
+	bucket := tx.Bucket(bucketName)
+	if bucket == nil {
+		return bolt.ErrBucketNotFound
+	}
+
+	if valueDecode == nil {
+		valueDecode = s.decode
+	}
+
+	return bucket.ForEach(func(k, v []byte) error {
+		if v == nil {
+			// nested bucket
+			return nil
+		}
+
+		var key interface{} = k
+		if keyDecode != nil {
+			var err error
+			key, err = keyDecode(k)
+			if err != nil {
+				return err
+			}
+		}
+
+		value := newElemType(example)
+		err := valueDecode(v, value)
+		if err != nil {
+			return err
+		}
+
+		return s.insert(tx, key, value)
+	})
 }
 
 // Update updates an existing record in the bolthold
 // if the Key doesn't already exist in the store, then it fails with ErrNotFound
 func (s *Store) Update(key interface{}, data interface{}) error {
-	return s.Bolt().Update(func(tx *bolt.Tx) error {
+	return s.updateTx(func(tx *bolt.Tx) error {
 		return s.update(tx, key, data)
 	})
 }
@@ -156,13 +363,23 @@ func (s *Store) UpdateBucket(parent *bolt.Bucket, key interface{}, data interfac
 func (s *Store) update(source BucketSource, key interface{}, data interface{}) error {
 	storer := s.newStorer(data)
 
-	gk, err := s.encode(key)
+	err := checkMutable(storer, data, "update")
+	if err != nil {
+		return err
+	}
+
+	key, err = s.resolveKey(key, data)
+	if err != nil {
+		return err
+	}
+
+	gk, err := s.encodeKey(key)
 
 	if err != nil {
 		return err
 	}
 
-	b, err := source.CreateBucketIfNotExists([]byte(storer.Type()))
+	b, err := createRecordBucket(source, storer, data)
 	if err != nil {
 		return err
 	}
@@ -173,25 +390,39 @@ func (s *Store) update(source BucketSource, key interface{}, data interface{}) e
 		return ErrNotFound
 	}
 
+	err = s.checkUnique(storer, source, data, gk)
+	if err != nil {
+		return err
+	}
+
 	// delete any existing indexes
 	existingVal := newElemType(data)
 
-	err = s.decode(existing, existingVal)
+	err = s.decodeRecord(storer, existing, existingVal)
+	if err != nil {
+		return err
+	}
+
+	err = checkVersion(storer, existingVal, data)
 	if err != nil {
 		return err
 	}
+	data = nextVersion(storer, data, recordVersion(storer, existingVal))
+	data = timestamp(storer, data, existingVal, time.Now())
 
 	err = s.deleteIndexes(storer, source, gk, existingVal)
 	if err != nil {
 		return err
 	}
 
-	value, err := s.encode(data)
+	value, err := s.encodeRecord(storer, data)
 	if err != nil {
 		return err
 	}
 
 	// put data
+	s.writes.record(false, gk, value)
+	s.changes.add(storer, gk, false)
 	err = b.Put(gk, value)
 	if err != nil {
 		return err
@@ -201,10 +432,316 @@ func (s *Store) update(source BucketSource, key interface{}, data interface{}) e
 	return s.addIndexes(storer, source, gk, data)
 }
 
+// UpdateFields sets only the named fields of an existing record, leaving the rest of it as it is, and updates its
+// indexes.  fields maps field names, which can be nested such as "Address.City", to their new values, which must be
+// assignable or convertible to the type of the field.  If the Key doesn't exist it fails with ErrNotFound
+func (s *Store) UpdateFields(key, dataType interface{}, fields map[string]interface{}) error {
+	return s.updateTx(func(tx *bolt.Tx) error {
+		return s.updateFields(tx, key, dataType, fields)
+	})
+}
+
+// TxUpdateFields is the same as UpdateFields except it allows you to specify your own transaction
+func (s *Store) TxUpdateFields(tx *bolt.Tx, key, dataType interface{}, fields map[string]interface{}) error {
+	if !tx.Writable() {
+		return bolt.ErrTxNotWritable
+	}
+	return s.updateFields(tx, key, dataType, fields)
+}
+
+// UpdateFieldsInBucket does the same as UpdateFields, but allows you to specify your own parent bucket
+func (s *Store) UpdateFieldsInBucket(parent *bolt.Bucket, key, dataType interface{},
+	fields map[string]interface{}) error {
+	if !parent.Tx().Writable() {
+		return bolt.ErrTxNotWritable
+	}
+	return s.updateFields(parent, key, dataType, fields)
+}
+
+func (s *Store) updateFields(source BucketSource, key, dataType interface{}, fields map[string]interface{}) error {
+	record := newElemType(dataType)
+
+	err := s.get(source, key, record)
+	if err != nil {
+		return err
+	}
+
+	storer := s.newStorer(dataType)
+	for name, value := range fields {
+		err = setField(storer, reflect.ValueOf(record).Elem(), name, value)
+		if err != nil {
+			return err
+		}
+	}
+
+	return s.update(source, key, record)
+}
+
+// Merge updates an existing record with only the fields of data that aren't the zero value of their type, leaving
+// the rest of the stored record as it is, so a partial record such as the body of an HTTP PATCH doesn't blank out the
+// fields it doesn't include.  A field can't be set back to its zero value with Merge, use UpdateFields instead.  If
+// data is a pointer it is set to the merged record.  If the Key doesn't exist it fails with ErrNotFound
+func (s *Store) Merge(key, data interface{}) error {
+	return s.updateTx(func(tx *bolt.Tx) error {
+		return s.merge(tx, key, data)
+	})
+}
+
+// TxMerge is the same as Merge except it allows you to specify your own transaction
+func (s *Store) TxMerge(tx *bolt.Tx, key, data interface{}) error {
+	if !tx.Writable() {
+		return bolt.ErrTxNotWritable
+	}
+	return s.merge(tx, key, data)
+}
+
+// MergeInBucket does the same as Merge, but allows you to specify your own parent bucket
+func (s *Store) MergeInBucket(parent *bolt.Bucket, key, data interface{}) error {
+	if !parent.Tx().Writable() {
+		return bolt.ErrTxNotWritable
+	}
+	return s.merge(parent, key, data)
+}
+
+func (s *Store) merge(source BucketSource, key, data interface{}) error {
+	record := newElemType(data)
+
+	err := s.get(source, key, record)
+	if err != nil {
+		return err
+	}
+
+	storer := s.newStorer(data)
+	transient := map[string]bool{}
+	if tf, ok := storer.(transientFielder); ok {
+		transient = tf.transientFields()
+	}
+
+	dataVal := reflect.Indirect(reflect.ValueOf(data))
+	recordVal := reflect.ValueOf(record).Elem()
+	for i := 0; i < dataVal.NumField(); i++ {
+		field := dataVal.Type().Field(i)
+		if field.PkgPath != "" || transient[field.Name] || strings.Contains(string(field.Tag), BoltholdKeyTag) {
+			continue
+		}
+		if !dataVal.Field(i).IsZero() {
+			recordVal.Field(i).Set(dataVal.Field(i))
+		}
+	}
+
+	err = s.update(source, key, record)
+	if err != nil {
+		return err
+	}
+
+	if dataVal.CanSet() {
+		dataVal.Set(recordVal)
+	}
+	return nil
+}
+
+// setField sets the named field of the record to value, converting value to the field's type if needed
+func setField(storer Storer, record reflect.Value, name string, value interface{}) error {
+	field, err := storedField(storer, record, name)
+	if err != nil {
+		return err
+	}
+
+	if value == nil {
+		switch field.Kind() {
+		case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice:
+			field.Set(reflect.Zero(field.Type()))
+			return nil
+		}
+		return fmt.Errorf("The field %s of type %s can't be set to nil", name, field.Type())
+	}
+
+	newValue := reflect.ValueOf(value)
+	switch {
+	case newValue.Type().AssignableTo(field.Type()):
+		field.Set(newValue)
+	case newValue.Type().ConvertibleTo(field.Type()) && newValue.Kind() != reflect.String &&
+		field.Kind() != reflect.String:
+		// numbers are converted, but not numbers to strings, which convert to the character of the number
+		field.Set(newValue.Convert(field.Type()))
+	default:
+		return fmt.Errorf("The field %s of type %s can't be set to a %T", name, field.Type(), value)
+	}
+
+	return nil
+}
+
+// storedField returns the named field of the record, which can be nested such as "Address.City", so that it can be
+// changed.  Nil pointers on the way to the field are allocated.  Key fields and fields that aren't stored can't be
+// changed
+func storedField(storer Storer, record reflect.Value, name string) (reflect.Value, error) {
+	field := record
+	for i, part := range strings.Split(name, ".") {
+		if field.Kind() == reflect.Ptr {
+			if field.IsNil() {
+				field.Set(reflect.New(field.Type().Elem()))
+			}
+			field = field.Elem()
+		}
+
+		if field.Kind() != reflect.Struct {
+			return reflect.Value{}, fmt.Errorf("The field %s does not exist in the type %s", name, record.Type())
+		}
+		structField, ok := field.Type().FieldByName(part)
+		if !ok || structField.PkgPath != "" {
+			return reflect.Value{}, fmt.Errorf("The field %s does not exist in the type %s", name, record.Type())
+		}
+		if i == 0 {
+			if strings.Contains(string(structField.Tag), BoltholdKeyTag) {
+				return reflect.Value{}, fmt.Errorf("The key field %s can't be updated, use ChangeKey instead", name)
+			}
+			if tf, ok := storer.(transientFielder); ok && tf.transientFields()[part] {
+				return reflect.Value{}, fmt.Errorf("The field %s has the bolthold:\"-\" tag, and isn't stored",
+					name)
+			}
+		}
+		field = field.FieldByIndex(structField.Index)
+	}
+
+	return field, nil
+}
+
+// Increment adds delta to the numeric field of an existing record, and updates its indexes, all in one write
+// transaction, so concurrent increments aren't lost.  delta can be any integer or float type, and is negative to
+// decrement.  If dataType is a pointer it is set to the record after the increment.  Incrementing an integer field
+// past the limits of its type fails rather than wrapping around
+func (s *Store) Increment(key, dataType interface{}, field string, delta interface{}) error {
+	return s.updateTx(func(tx *bolt.Tx) error {
+		return s.increment(tx, key, dataType, field, delta)
+	})
+}
+
+// TxIncrement is the same as Increment except it allows you to specify your own transaction
+func (s *Store) TxIncrement(tx *bolt.Tx, key, dataType interface{}, field string, delta interface{}) error {
+	if !tx.Writable() {
+		return bolt.ErrTxNotWritable
+	}
+	return s.increment(tx, key, dataType, field, delta)
+}
+
+// IncrementInBucket does the same as Increment, but allows you to specify your own parent bucket
+func (s *Store) IncrementInBucket(parent *bolt.Bucket, key, dataType interface{}, field string,
+	delta interface{}) error {
+	if !parent.Tx().Writable() {
+		return bolt.ErrTxNotWritable
+	}
+	return s.increment(parent, key, dataType, field, delta)
+}
+
+func (s *Store) increment(source BucketSource, key, dataType interface{}, field string, delta interface{}) error {
+	record := newElemType(dataType)
+
+	err := s.get(source, key, record)
+	if err != nil {
+		return err
+	}
+
+	value, err := storedField(s.newStorer(dataType), reflect.ValueOf(record).Elem(), field)
+	if err != nil {
+		return err
+	}
+
+	if value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			value.Set(reflect.New(value.Type().Elem()))
+		}
+		value = value.Elem()
+	}
+
+	err = addDelta(value, field, delta)
+	if err != nil {
+		return err
+	}
+
+	err = s.update(source, key, record)
+	if err != nil {
+		return err
+	}
+
+	result := reflect.ValueOf(dataType)
+	if result.Kind() == reflect.Ptr && !result.IsNil() && result.Elem().Type() == reflect.TypeOf(record).Elem() {
+		result.Elem().Set(reflect.ValueOf(record).Elem())
+	}
+	return nil
+}
+
+// addDelta adds delta to the numeric value, returning an error if the result doesn't fit in the value's type
+func addDelta(value reflect.Value, name string, delta interface{}) error {
+	d := reflect.ValueOf(delta)
+	overflow := fmt.Errorf("Adding %v to the field %s overflows its type %s", delta, name, value.Type())
+
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var n int64
+		switch d.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			n = d.Int()
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			if d.Uint() > math.MaxInt64 {
+				return overflow
+			}
+			n = int64(d.Uint())
+		default:
+			return fmt.Errorf("The field %s of type %s can't be incremented by a %T", name, value.Type(), delta)
+		}
+
+		current := value.Int()
+		sum := current + n
+		if (n > 0 && sum < current) || (n < 0 && sum > current) || value.OverflowInt(sum) {
+			return overflow
+		}
+		value.SetInt(sum)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		current := value.Uint()
+		var sum uint64
+		switch d.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if n := d.Int(); n < 0 {
+				decrement := uint64(-(n + 1)) + 1
+				if decrement > current {
+					return overflow
+				}
+				sum = current - decrement
+			} else if sum = current + uint64(n); sum < current {
+				return overflow
+			}
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			if sum = current + d.Uint(); sum < current {
+				return overflow
+			}
+		default:
+			return fmt.Errorf("The field %s of type %s can't be incremented by a %T", name, value.Type(), delta)
+		}
+
+		if value.OverflowUint(sum) {
+			return overflow
+		}
+		value.SetUint(sum)
+	case reflect.Float32, reflect.Float64:
+		switch d.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+			reflect.Float32, reflect.Float64:
+			value.SetFloat(value.Float() + d.Convert(reflect.TypeOf(float64(0))).Float())
+		default:
+			return fmt.Errorf("The field %s of type %s can't be incremented by a %T", name, value.Type(), delta)
+		}
+	default:
+		return fmt.Errorf("The field %s of type %s isn't a number", name, value.Type())
+	}
+
+	return nil
+}
+
 // Upsert inserts the record into the bolthold if it doesn't exist.  If it does already exist, then it updates
 // the existing record
 func (s *Store) Upsert(key interface{}, data interface{}) error {
-	return s.Bolt().Update(func(tx *bolt.Tx) error {
+	return s.updateTx(func(tx *bolt.Tx) error {
 		return s.upsert(tx, key, data)
 	})
 }
@@ -226,42 +763,73 @@ func (s *Store) UpsertBucket(parent *bolt.Bucket, key interface{}, data interfac
 }
 
 func (s *Store) upsert(source BucketSource, key interface{}, data interface{}) error {
-	storer := s.newStorer(data)
+	key, err := s.resolveKey(key, data)
+	if err != nil {
+		return err
+	}
 
-	gk, err := s.encode(key)
+	gk, err := s.encodeKey(key)
 
 	if err != nil {
 		return err
 	}
 
-	b, err := source.CreateBucketIfNotExists([]byte(storer.Type()))
+	return s.upsertKey(source, gk, data)
+}
+
+// upsertKey is upsert with a key that's already encoded
+func (s *Store) upsertKey(source BucketSource, gk []byte, data interface{}) error {
+	storer := s.newStorer(data)
+
+	b, err := createRecordBucket(source, storer, data)
 	if err != nil {
 		return err
 	}
 
 	existing := b.Get(gk)
 
+	err = s.checkUnique(storer, source, data, gk)
+	if err != nil {
+		return err
+	}
+
 	if existing != nil {
+		err = checkMutable(storer, data, "update")
+		if err != nil {
+			return err
+		}
+
 		existingVal := newElemType(data)
 
-		err = s.decode(existing, existingVal)
+		err = s.decodeRecord(storer, existing, existingVal)
 		if err != nil {
 			return err
 		}
 
-		err = s.deleteIndexes(storer, source, gk, existingVal)
+		err = checkVersion(storer, existingVal, data)
 		if err != nil {
 			return err
 		}
+		data = nextVersion(storer, data, recordVersion(storer, existingVal))
+		data = timestamp(storer, data, existingVal, time.Now())
 
+		err = s.deleteIndexes(storer, source, gk, existingVal)
+		if err != nil {
+			return err
+		}
+	} else {
+		data = nextVersion(storer, data, 0)
+		data = timestamp(storer, data, nil, time.Now())
 	}
 
-	value, err := s.encode(data)
+	value, err := s.encodeRecord(storer, data)
 	if err != nil {
 		return err
 	}
 
 	// put data
+	s.writes.record(false, gk, value)
+	s.changes.add(storer, gk, false)
 	err = b.Put(gk, value)
 	if err != nil {
 		return err
@@ -274,7 +842,7 @@ func (s *Store) upsert(source BucketSource, key interface{}, data interface{}) e
 // UpdateMatching runs the update function for every record that match the passed in query
 // Note that the type  of record in the update func always has to be a pointer
 func (s *Store) UpdateMatching(dataType interface{}, query *Query, update func(record interface{}) error) error {
-	return s.Bolt().Update(func(tx *bolt.Tx) error {
+	return s.updateTx(func(tx *bolt.Tx) error {
 		return s.updateQuery(tx, dataType, query, update)
 	})
 }
@@ -290,3 +858,154 @@ func (s *Store) UpdateMatchingInBucket(parent *bolt.Bucket, dataType interface{}
 	update func(record interface{}) error) error {
 	return s.updateQuery(parent, dataType, query, update)
 }
+
+// KeyReference is a field of another type which holds keys of the type whose key is being changed with ChangeKey.
+// The field must be the same type as the new key
+type KeyReference struct {
+	DataType interface{}
+	Field    string
+}
+
+// ChangeKey moves the record stored under oldKey to newKey, updating its index entries, its key field if it has
+// one, and any of the passed in references to it in other types, all in a single transaction.
+// ChangeKey returns ErrNotFound if there is no record at oldKey, and ErrKeyExists if there is already a record
+// at newKey
+func (s *Store) ChangeKey(dataType, oldKey, newKey interface{}, references ...KeyReference) error {
+	return s.updateTx(func(tx *bolt.Tx) error {
+		return s.changeKey(tx, dataType, oldKey, newKey, references)
+	})
+}
+
+// TxChangeKey is the same as ChangeKey except it allows you to specify your own transaction
+func (s *Store) TxChangeKey(tx *bolt.Tx, dataType, oldKey, newKey interface{}, references ...KeyReference) error {
+	if !tx.Writable() {
+		return bolt.ErrTxNotWritable
+	}
+	return s.changeKey(tx, dataType, oldKey, newKey, references)
+}
+
+func (s *Store) changeKey(source BucketSource, dataType, oldKey, newKey interface{}, references []KeyReference) error {
+	storer := s.newStorer(dataType)
+
+	err := checkMutable(storer, dataType, "change the key of")
+	if err != nil {
+		return err
+	}
+
+	oldGk, err := s.encodeKey(oldKey)
+	if err != nil {
+		return err
+	}
+
+	newGk, err := s.encodeKey(newKey)
+	if err != nil {
+		return err
+	}
+
+	b := getRecordBucket(source, storer)
+	if b == nil {
+		return ErrNotFound
+	}
+
+	existing := b.Get(oldGk)
+	if existing == nil {
+		return ErrNotFound
+	}
+
+	if b.Get(newGk) != nil {
+		return ErrKeyExists
+	}
+
+	value := newElemType(dataType)
+	err = s.decodeRecord(storer, existing, value)
+	if err != nil {
+		return err
+	}
+
+	err = s.deleteIndexes(storer, source, oldGk, value)
+	if err != nil {
+		return err
+	}
+
+	s.writes.record(false, oldGk, nil)
+	s.changes.add(storer, oldGk, true)
+	err = b.Delete(oldGk)
+	if err != nil {
+		return err
+	}
+
+	err = setKeyField(value, newKey)
+	if err != nil {
+		return err
+	}
+
+	err = s.checkUnique(storer, source, value, oldGk, newGk)
+	if err != nil {
+		return err
+	}
+
+	encoded, err := s.encodeRecord(storer, value)
+	if err != nil {
+		return err
+	}
+
+	s.writes.record(false, newGk, encoded)
+	s.changes.add(storer, newGk, false)
+	err = b.Put(newGk, encoded)
+	if err != nil {
+		return err
+	}
+
+	err = s.addIndexes(storer, source, newGk, value)
+	if err != nil {
+		return err
+	}
+
+	for _, ref := range references {
+		field := ref.Field
+		err = s.updateQuery(source, ref.DataType, Where(field).Eq(oldKey), func(record interface{}) error {
+			fieldVal := reflect.Indirect(reflect.ValueOf(record)).FieldByName(field)
+			if !fieldVal.IsValid() || !fieldVal.CanSet() {
+				return fmt.Errorf("The field %s can't be set in the type %T", field, record)
+			}
+			if reflect.TypeOf(newKey) != fieldVal.Type() {
+				return fmt.Errorf("The field %s is a %s, not a %T", field, fieldVal.Type(), newKey)
+			}
+			fieldVal.Set(reflect.ValueOf(newKey))
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// setKeyField sets the field with the boltholdKey tag to the key, if the type has one, or the fields of its
+// composite key
+func setKeyField(value, key interface{}) error {
+	dataVal := reflect.Indirect(reflect.ValueOf(value))
+	dataType := dataVal.Type()
+
+	if fields := compositeKeyFields(dataType); fields != nil {
+		return setCompositeKeyFields(dataVal, fields, key)
+	}
+
+	for i := 0; i < dataType.NumField(); i++ {
+		tf := dataType.Field(i)
+		if _, ok := tf.Tag.Lookup(BoltholdKeyTag); ok {
+			if !dataVal.Field(i).CanSet() {
+				return nil
+			}
+			keyValue := reflect.ValueOf(key)
+			if keyValue.Type() != tf.Type {
+				return fmt.Errorf("The key field %s is a %s, not a %T", tf.Name, tf.Type, key)
+			}
+			dataVal.Field(i).Set(keyValue)
+			return nil
+		}
+	}
+
+	return nil
+}
@@ -6,6 +6,8 @@ package bolthold_test
 
 import (
 	"fmt"
+	"math"
+	"sync"
 	"testing"
 	"time"
 
@@ -545,3 +547,443 @@ func TestInsertSetKey(t *testing.T) {
 
 	})
 }
+
+type AuditEvent struct {
+	ID      uint64 `boltholdKey:"ID"`
+	Message string
+}
+
+func (a *AuditEvent) Immutable() bool { return true }
+
+func TestImmutableUpdate(t *testing.T) {
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		event := &AuditEvent{Message: "created"}
+		ok(t, store.Insert(bolthold.NextSequence(), event))
+
+		event.Message = "changed"
+
+		err := store.Update(event.ID, event)
+		imErr, isImmutable := err.(*bolthold.ErrImmutable)
+		assert(t, isImmutable, "Update did not return ErrImmutable: %s", err)
+		equals(t, "AuditEvent", imErr.Type)
+		equals(t, "update", imErr.Operation)
+
+		_, isImmutable = store.Upsert(event.ID, event).(*bolthold.ErrImmutable)
+		assert(t, isImmutable, "Upsert over an existing record did not return ErrImmutable")
+
+		ok(t, store.Upsert(uint64(100), &AuditEvent{Message: "new"}))
+
+		_, isImmutable = store.UpdateMatching(&AuditEvent{}, nil, func(record interface{}) error {
+			return nil
+		}).(*bolthold.ErrImmutable)
+		assert(t, isImmutable, "UpdateMatching did not return ErrImmutable")
+
+		var stored AuditEvent
+		ok(t, store.Get(event.ID, &stored))
+		equals(t, "created", stored.Message)
+	})
+}
+
+func TestAdoptBucket(t *testing.T) {
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		ok(t, store.Bolt().Update(func(tx *bolt.Tx) error {
+			b, err := tx.CreateBucket([]byte("legacy"))
+			if err != nil {
+				return err
+			}
+			for i := 0; i < 5; i++ {
+				category := "vehicle"
+				if i%2 == 0 {
+					category = "animal"
+				}
+				err = b.Put([]byte(fmt.Sprintf("item-%d", i)), []byte(category))
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}))
+
+		ok(t, store.AdoptBucket([]byte("legacy"), &ItemTest{}, func(key []byte) (interface{}, error) {
+			return string(key), nil
+		}, func(data []byte, value interface{}) error {
+			value.(*ItemTest).Category = string(data)
+			return nil
+		}))
+
+		var result []ItemTest
+		ok(t, store.Find(&result, bolthold.Where("Category").Eq("animal").Index("Category")))
+		equals(t, 3, len(result))
+
+		var item ItemTest
+		ok(t, store.Get("item-1", &item))
+		equals(t, "vehicle", item.Category)
+
+		equals(t, bolthold.ErrKeyExists, store.AdoptBucket([]byte("legacy"), &ItemTest{},
+			func(key []byte) (interface{}, error) {
+				return string(key), nil
+			}, func(data []byte, value interface{}) error {
+				return nil
+			}))
+
+		equals(t, bolt.ErrBucketNotFound, store.AdoptBucket([]byte("missing"), &ItemTest{}, nil, nil))
+	})
+}
+
+func TestChangeKey(t *testing.T) {
+	type Account struct {
+		Name string `boltholdKey:"Name"`
+		Plan string `boltholdIndex:"Plan"`
+	}
+	type Invoice struct {
+		ID      int
+		Account string `boltholdIndex:"Account"`
+	}
+
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		ok(t, store.Insert("acme", &Account{Plan: "gold"}))
+		ok(t, store.Insert("globex", &Account{Plan: "gold"}))
+		for i := 0; i < 3; i++ {
+			ok(t, store.Insert(i, &Invoice{ID: i, Account: "acme"}))
+		}
+		ok(t, store.Insert(3, &Invoice{ID: 3, Account: "globex"}))
+
+		equals(t, bolthold.ErrKeyExists, store.ChangeKey(&Account{}, "acme", "globex"))
+		equals(t, bolthold.ErrNotFound, store.ChangeKey(&Account{}, "initech", "hooli"))
+
+		ok(t, store.ChangeKey(&Account{}, "acme", "acme corp", bolthold.KeyReference{
+			DataType: &Invoice{},
+			Field:    "Account",
+		}))
+
+		var account Account
+		equals(t, bolthold.ErrNotFound, store.Get("acme", &account))
+		ok(t, store.Get("acme corp", &account))
+		equals(t, "acme corp", account.Name)
+
+		var accounts []Account
+		ok(t, store.Find(&accounts, bolthold.Where("Plan").Eq("gold").Index("Plan")))
+		equals(t, 2, len(accounts))
+
+		var invoices []Invoice
+		ok(t, store.Find(&invoices, bolthold.Where("Account").Eq("acme corp").Index("Account")))
+		equals(t, 3, len(invoices))
+
+		problems, err := store.CheckIndexes(&Invoice{}, false)
+		ok(t, err)
+		equals(t, 0, len(problems))
+
+		// the whole change is rolled back on an error
+		err = store.ChangeKey(&Account{}, "globex", 5, bolthold.KeyReference{
+			DataType: &Invoice{},
+			Field:    "Account",
+		})
+		assert(t, err != nil, "no error setting a key of the wrong type")
+		ok(t, store.Get("globex", &account))
+	})
+}
+
+func TestRekeyAll(t *testing.T) {
+	type Customer struct {
+		ID     string `boltholdKey:"ID"`
+		Number int
+		Region string `boltholdIndex:"Region"`
+	}
+
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		regions := []string{"north", "south", "east"}
+		ok(t, store.Bolt().Update(func(tx *bolt.Tx) error {
+			for i := 0; i < 1500; i++ {
+				err := store.TxInsert(tx, fmt.Sprintf("c%04d", i), &Customer{Number: i, Region: regions[i%len(regions)]})
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}))
+
+		newKey := func(oldKey []byte, record interface{}) (interface{}, error) {
+			customer := record.(*Customer)
+			return fmt.Sprintf("%s-%05d", customer.Region, customer.Number), nil
+		}
+
+		// giving the customers of the second chunk the same key fails, and leaves the first chunk staged
+		err := store.RekeyAll(&Customer{}, func(oldKey []byte, record interface{}) (interface{}, error) {
+			if record.(*Customer).Number >= 1000 {
+				return record.(*Customer).Region, nil
+			}
+			return newKey(oldKey, record)
+		})
+		equals(t, bolthold.ErrKeyExists, err)
+
+		var oldKeys []string
+		ok(t, store.RekeyAll(&Customer{}, func(oldKey []byte, record interface{}) (interface{}, error) {
+			oldKeys = append(oldKeys, record.(*Customer).ID)
+			return newKey(oldKey, record)
+		}))
+		equals(t, 500, len(oldKeys))
+		equals(t, "c1000", oldKeys[0])
+
+		count, err := store.Count(&Customer{}, nil)
+		ok(t, err)
+		equals(t, 1500, count)
+
+		var customer Customer
+		equals(t, bolthold.ErrNotFound, store.Get("c0001", &customer))
+		ok(t, store.Get("south-00001", &customer))
+		equals(t, "south-00001", customer.ID)
+		equals(t, 1, customer.Number)
+
+		var result []Customer
+		ok(t, store.Find(&result, bolthold.Where("Region").Eq("east").Index("Region").Limit(2)))
+		equals(t, 2, len(result))
+		equals(t, "east-00002", result[0].ID)
+		equals(t, "east-00005", result[1].ID)
+
+		types, err := store.Buckets()
+		ok(t, err)
+		equals(t, 1, len(types))
+	})
+}
+
+func TestUpdateFields(t *testing.T) {
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		insertTestData(t, store)
+
+		original := testData[3]
+		ok(t, store.UpdateFields(original.Key, &ItemTest{}, map[string]interface{}{
+			"UpdateIndex": "patched",
+			"ID":          int64(42),
+			"Tags":        nil,
+		}))
+
+		var result ItemTest
+		ok(t, store.Get(original.Key, &result))
+		equals(t, "patched", result.UpdateIndex)
+		equals(t, 42, result.ID)
+		equals(t, 0, len(result.Tags))
+		equals(t, original.Name, result.Name)
+		equals(t, original.Category, result.Category)
+		assert(t, result.Created.Equal(original.Created), "Created was changed")
+
+		var found []ItemTest
+		ok(t, store.Find(&found, bolthold.Where("UpdateIndex").Eq("patched").Index("UpdateIndex")))
+		equals(t, 1, len(found))
+		equals(t, original.Name, found[0].Name)
+
+		err := store.UpdateFields(original.Key, &ItemTest{}, map[string]interface{}{"Missing": 1})
+		assert(t, err != nil, "Updating a field that doesn't exist didn't fail")
+
+		err = store.UpdateFields(original.Key, &ItemTest{}, map[string]interface{}{"Name": 1})
+		assert(t, err != nil, "Setting a string field to an int didn't fail")
+
+		err = store.UpdateFields(original.Key, &ItemTest{}, map[string]interface{}{"ID": nil})
+		assert(t, err != nil, "Setting an int field to nil didn't fail")
+
+		err = store.UpdateFields(-1, &ItemTest{}, map[string]interface{}{"Name": "none"})
+		equals(t, bolthold.ErrNotFound, err)
+	})
+}
+
+func TestInsertSequenceIntKey(t *testing.T) {
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		type IntSequenceTest struct {
+			ID   int `boltholdKey:"ID"`
+			Name string
+		}
+
+		for i := 1; i <= 3; i++ {
+			st := IntSequenceTest{Name: fmt.Sprintf("name %d", i)}
+			ok(t, store.Insert(bolthold.NextSequence(), &st))
+			equals(t, i, st.ID)
+		}
+
+		var result IntSequenceTest
+		ok(t, store.Get(2, &result))
+		equals(t, IntSequenceTest{ID: 2, Name: "name 2"}, result)
+
+		var all []IntSequenceTest
+		ok(t, store.Find(&all, bolthold.Where(bolthold.Key).Gt(1)))
+		equals(t, 2, len(all))
+		equals(t, 3, all[1].ID)
+	})
+}
+
+func TestStoreSequences(t *testing.T) {
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		type Ticket struct {
+			ID   uint64 `boltholdKey:"ID"`
+			Name string
+		}
+
+		seq, err := store.NextSequence(&Ticket{})
+		ok(t, err)
+		equals(t, uint64(1), seq)
+
+		first, err := store.ReserveSequences(&Ticket{}, 10)
+		ok(t, err)
+		equals(t, uint64(2), first)
+
+		ticket := Ticket{Name: "after the reserved range"}
+		ok(t, store.Insert(bolthold.NextSequence(), &ticket))
+		equals(t, uint64(12), ticket.ID)
+
+		ok(t, store.SetSequence(&Ticket{}, 100))
+		ok(t, store.Bolt().Update(func(tx *bolt.Tx) error {
+			seq, err = store.TxNextSequence(tx, &Ticket{})
+			return err
+		}))
+		equals(t, uint64(101), seq)
+
+		_, err = store.ReserveSequences(&Ticket{}, 0)
+		assert(t, err != nil, "reserving no sequences didn't fail")
+
+		ok(t, store.SetSequence(&Ticket{}, math.MaxUint64-1))
+		_, err = store.ReserveSequences(&Ticket{}, 2)
+		assert(t, err != nil, "reserving past the end of the sequence didn't fail")
+
+		ok(t, store.Bolt().View(func(tx *bolt.Tx) error {
+			_, err := store.TxNextSequence(tx, &Ticket{})
+			equals(t, bolt.ErrTxNotWritable, err)
+			return nil
+		}))
+	})
+}
+
+func TestIncrement(t *testing.T) {
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		type Counter struct {
+			Name   string
+			Hits   int `boltholdIndex:"Hits"`
+			Small  uint8
+			Ratio  float64
+			Nested struct{ Total int64 }
+		}
+
+		ok(t, store.Insert("page", &Counter{Name: "page", Hits: 5, Small: 2}))
+
+		var wg sync.WaitGroup
+		errs := make(chan error, 10)
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs <- store.Increment("page", &Counter{}, "Hits", 1)
+			}()
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			ok(t, err)
+		}
+
+		var counter Counter
+		ok(t, store.Increment("page", &counter, "Hits", -3))
+		equals(t, 12, counter.Hits)
+		equals(t, "page", counter.Name)
+
+		var found []Counter
+		ok(t, store.Find(&found, bolthold.Where("Hits").Eq(12).Index("Hits")))
+		equals(t, 1, len(found))
+
+		ok(t, store.Increment("page", &counter, "Ratio", 0.5))
+		equals(t, 0.5, counter.Ratio)
+		ok(t, store.Increment("page", &counter, "Nested.Total", uint16(7)))
+		equals(t, int64(7), counter.Nested.Total)
+
+		assert(t, store.Increment("page", &counter, "Small", -3) != nil, "Decrementing a uint below zero didn't fail")
+		assert(t, store.Increment("page", &counter, "Small", 254) != nil, "Overflowing a uint8 didn't fail")
+		assert(t, store.Increment("page", &counter, "Name", 1) != nil, "Incrementing a string didn't fail")
+		assert(t, store.Increment("page", &counter, "Hits", "1") != nil, "Incrementing by a string didn't fail")
+
+		ok(t, store.Get("page", &counter))
+		equals(t, uint8(2), counter.Small)
+
+		equals(t, bolthold.ErrNotFound, store.Increment("missing", &Counter{}, "Hits", 1))
+	})
+}
+
+func TestInsertKey(t *testing.T) {
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		key, err := store.InsertKey(bolthold.NextSequence(), ItemTest{Name: "first"})
+		ok(t, err)
+		equals(t, uint64(1), key)
+
+		key, err = store.InsertKey(bolthold.NextSequence(), ItemTest{Name: "second"})
+		ok(t, err)
+		equals(t, uint64(2), key)
+
+		var result ItemTest
+		ok(t, store.Get(key, &result))
+		equals(t, "second", result.Name)
+
+		key, err = store.InsertKey("named", &ItemTest{Name: "named"})
+		ok(t, err)
+		equals(t, "named", key)
+
+		_, err = store.InsertKey("named", &ItemTest{Name: "again"})
+		equals(t, bolthold.ErrKeyExists, err)
+	})
+}
+
+func TestFindOrInsert(t *testing.T) {
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		var result ItemTest
+		inserted, err := store.FindOrInsert("settings", &result, ItemTest{Name: "default"})
+		ok(t, err)
+		assert(t, inserted, "The default wasn't inserted")
+		equals(t, "default", result.Name)
+
+		ok(t, store.Update("settings", &ItemTest{Name: "changed"}))
+
+		result = ItemTest{}
+		inserted, err = store.FindOrInsert("settings", &result, &ItemTest{Name: "default"})
+		ok(t, err)
+		assert(t, !inserted, "The default was inserted over an existing record")
+		equals(t, "changed", result.Name)
+
+		_, err = store.FindOrInsert("other", &result, "wrong type")
+		assert(t, err != nil, "A default value of the wrong type didn't fail")
+	})
+}
+
+func TestFindOrInsertSequence(t *testing.T) {
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		type Setting struct {
+			ID    uint64 `boltholdKey:"ID"`
+			Value string
+		}
+
+		var result Setting
+		inserted, err := store.FindOrInsert(bolthold.NextSequence(), &result, &Setting{Value: "a"})
+		ok(t, err)
+		assert(t, inserted, "The default wasn't inserted")
+		equals(t, uint64(1), result.ID)
+	})
+}
+
+func TestMerge(t *testing.T) {
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		insertTestData(t, store)
+		original := testData[2]
+
+		patch := ItemTest{Name: "patched", UpdateIndex: "merged"}
+		ok(t, store.Merge(original.Key, &patch))
+		equals(t, original.Category, patch.Category)
+		equals(t, original.Tags, patch.Tags)
+
+		var result ItemTest
+		ok(t, store.Get(original.Key, &result))
+		equals(t, "patched", result.Name)
+		equals(t, "merged", result.UpdateIndex)
+		equals(t, original.Category, result.Category)
+		equals(t, original.ID, result.ID)
+		assert(t, result.Created.Equal(original.Created), "Created was changed")
+
+		var found []ItemTest
+		ok(t, store.Find(&found, bolthold.Where("UpdateIndex").Eq("merged").Index("UpdateIndex")))
+		equals(t, 1, len(found))
+
+		equals(t, bolthold.ErrNotFound, store.Merge(-1, ItemTest{Name: "missing"}))
+	})
+}
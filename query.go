@@ -5,10 +5,14 @@
 package bolthold
 
 import (
+	"bytes"
 	"fmt"
 	"reflect"
 	"sort"
 	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
 )
 
 type record struct {
@@ -38,17 +42,49 @@ func (s *Store) runQuery(source BucketSource, dataType interface{}, query *Query
 
 	query.dataType = reflect.TypeOf(tp)
 
+	err := checkTransient(storer, query)
+	if err != nil {
+		return err
+	}
+
+	if retrievedKeys == nil && query.hasBranchOptions() {
+		return s.runQueryBranches(source, dataType, query, action)
+	}
+
 	if len(query.sort) > 0 {
-		return s.runQuerySort(source, dataType, query, action)
+		return s.runQuerySort(source, dataType, query, retrievedKeys, action)
+	}
+
+	if run := s.orsRun(source, query, skip); retrievedKeys == nil && run != nil {
+		ran, err := s.runOrs(source.(*bolt.Tx), run, dataType, query, action)
+		if ran || err != nil {
+			return err
+		}
 	}
 
-	iter := s.newIterator(source, storer.Type(), query)
+	iter := s.newIterator(source, storer, query)
+	defer iter.release()
+
+	// index-only scan, the matching records are never read from the data bucket
+	iter.keysOnly = query.keysOnly && query.coveredByIndex() && !hasExpiry(storer) &&
+		(query.withDeleted || !hasSoftDelete(storer))
+
+	partial := s.partialType(storer, query)
 
-	newKeys := make(keyList, 0)
+	now := time.Now()
+	var expired, migrated [][]byte
+
+	// the keys found are only needed to leave them out of the Or'd queries
+	var newKeys keyList
+	trackKeys := len(query.ors) > 0
 
 	limit := query.limit - len(retrievedKeys)
 
 	for k, v := iter.Next(); k != nil; k, v = iter.Next() {
+		if query.after != nil && bytes.Compare(k, query.after) <= 0 {
+			continue
+		}
+
 		if len(retrievedKeys) != 0 {
 			// don't check this record if it's already been retrieved
 			if retrievedKeys.in(k) {
@@ -56,18 +92,58 @@ func (s *Store) runQuery(source BucketSource, dataType interface{}, query *Query
 			}
 		}
 
-		val := reflect.New(reflect.TypeOf(tp))
+		ok := true
+		var val reflect.Value
 
-		err := s.decode(v, val.Interface())
-		if err != nil {
-			return err
+		if iter.decoded.IsValid() {
+			val = iter.decoded
+		} else if !iter.keysOnly {
+			query.source = source
+
+			var err error
+			if partial != nil {
+				ok, err = s.matchesPartial(storer, partial, query, k, v)
+				if decodeErr, isDecode := err.(*decodeError); isDecode {
+					if s.undecodable(storer, query, k, err) {
+						continue
+					}
+					return decodeErr.err
+				}
+				if err != nil {
+					return err
+				}
+			}
+
+			if ok {
+				val = reflect.New(reflect.TypeOf(tp))
+
+				err = s.decodeRecord(storer, v, val.Interface())
+				if err != nil {
+					if s.undecodable(storer, query, k, err) {
+						continue
+					}
+					return err
+				}
+				if s.needsRewrite(storer, v) {
+					migrated = append(migrated, append([]byte(nil), k...))
+				}
+
+				if partial == nil {
+					ok, err = query.matchesAllFields(s, k, val, val.Interface())
+					if err != nil {
+						return err
+					}
+				}
+			}
 		}
 
-		query.source = source
+		if val.IsValid() && isExpired(storer, val.Interface(), now) {
+			expired = append(expired, k)
+			continue
+		}
 
-		ok, err := query.matchesAllFields(s, k, val, val.Interface())
-		if err != nil {
-			return err
+		if val.IsValid() && !query.withDeleted && isSoftDeleted(storer, val.Interface()) {
+			continue
 		}
 
 		if ok {
@@ -76,7 +152,7 @@ func (s *Store) runQuery(source BucketSource, dataType interface{}, query *Query
 				continue
 			}
 
-			err = action(&record{
+			err := action(&record{
 				key:   k,
 				value: val,
 			})
@@ -84,8 +160,10 @@ func (s *Store) runQuery(source BucketSource, dataType interface{}, query *Query
 				return err
 			}
 
-			// track that this key's entry has been added to the result list
-			newKeys.add(k)
+			if trackKeys {
+				// track that this key's entry has been added to the result list
+				newKeys.add(k)
+			}
 
 			if query.limit != 0 {
 				limit--
@@ -101,6 +179,21 @@ func (s *Store) runQuery(source BucketSource, dataType interface{}, query *Query
 		return iter.Error()
 	}
 
+	if len(expired) > 0 {
+		// expired records are purged as they're found, when the transaction allows it
+		if writable, ok := source.(interface{ Writable() bool }); ok && writable.Writable() {
+			_, err := s.deleteExpired(source, storer, dataType, expired)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	err = s.rewriteRecords(source, dataType, migrated)
+	if err != nil {
+		return err
+	}
+
 	if query.limit != 0 && limit == 0 {
 		return nil
 	}
@@ -111,7 +204,17 @@ func (s *Store) runQuery(source BucketSource, dataType interface{}, query *Query
 		}
 
 		for i := range query.ors {
-			err := s.runQuery(source, tp, query.ors[i], retrievedKeys, skip, action)
+			query.ors[i].keysOnly = query.keysOnly
+			query.ors[i].withDeleted = query.withDeleted
+			query.ors[i].skipUndecodable = query.skipUndecodable
+			query.ors[i].after = query.after
+			// keys found by this or are skipped by the ors after it, so records matching several ors are only
+			// returned once.  The list is copied, as the keys a query adds to its list can shift the caller's
+			err := s.runQuery(source, tp, query.ors[i], append(keyList{}, retrievedKeys...), skip,
+				func(r *record) error {
+					retrievedKeys.add(r.key)
+					return action(r)
+				})
 			if err != nil {
 				return err
 			}
@@ -122,8 +225,102 @@ func (s *Store) runQuery(source BucketSource, dataType interface{}, query *Query
 }
 
 // runQuerySort runs the query without sort, skip, or limit, then applies them to the entire result set
-func (s *Store) runQuerySort(source BucketSource, dataType interface{}, query *Query, action func(r *record) error) error {
-	// Validate sort fields
+func (s *Store) runQuerySort(source BucketSource, dataType interface{}, query *Query, retrievedKeys keyList,
+	action func(r *record) error) error {
+	err := validateSort(query)
+	if err != nil {
+		return err
+	}
+
+	// Run query without sort, skip or limit
+	// apply sort, skip and limit to entire dataset
+	qCopy := *query
+	qCopy.sort = nil
+	qCopy.limit = 0
+	qCopy.skip = 0
+	// the records' values are needed to sort them
+	qCopy.keysOnly = false
+
+	var records []*record
+	err = s.runQuery(source, dataType, &qCopy, retrievedKeys, 0,
+		func(r *record) error {
+			records = append(records, r)
+
+			return nil
+		})
+
+	if err != nil {
+		return err
+	}
+
+	sortRecords(records, query.sort, query.reverse)
+
+	return applySkipLimit(records, query.skip, query.limit, action)
+}
+
+// runQueryBranches runs the query and each of its Or'd queries separately, so that each can be sorted and limited
+// on its own.  Records already returned by an earlier query are left out of the later ones.  Unless the query is
+// InBranchOrder, the combined records are then sorted by the query's SortBy
+func (s *Store) runQueryBranches(source BucketSource, dataType interface{}, query *Query,
+	action func(r *record) error) error {
+	err := validateSort(query)
+	if err != nil {
+		return err
+	}
+
+	var records []*record
+	var retrieved keyList
+
+	keysOnly := query.keysOnly && (query.branchOrder || len(query.sort) == 0)
+
+	first := *query
+	first.ors = nil
+	first.skip = 0
+	first.limit = 0
+	if !query.branchOrder {
+		first.sort = nil
+	}
+
+	branches := append([]*Query{&first}, query.ors...)
+
+	for i := range branches {
+		branch := *branches[i]
+		branch.limit = 0
+		branch.keysOnly = keysOnly
+		branch.withDeleted = query.withDeleted
+		branch.skipUndecodable = query.skipUndecodable
+		branch.after = query.after
+
+		var found []*record
+		// retrieved keys are copied, as the keys a query adds to its list can shift the caller's
+		err := s.runQuery(source, dataType, &branch, append(keyList{}, retrieved...), 0,
+			func(r *record) error {
+				found = append(found, r)
+				return nil
+			})
+		if err != nil {
+			return err
+		}
+
+		if i > 0 && branches[i].limit > 0 && branches[i].limit < len(found) {
+			found = found[:branches[i].limit]
+		}
+
+		for j := range found {
+			retrieved.add(found[j].key)
+		}
+		records = append(records, found...)
+	}
+
+	if !query.branchOrder {
+		sortRecords(records, query.sort, query.reverse)
+	}
+
+	return applySkipLimit(records, query.skip, query.limit, action)
+}
+
+// validateSort returns an error if any of the query's sort fields don't exist in the query's data type
+func validateSort(query *Query) error {
 	for _, field := range query.sort {
 		fields := strings.Split(field, ".")
 
@@ -143,28 +340,17 @@ func (s *Store) runQuerySort(source BucketSource, dataType interface{}, query *Q
 			current = structField.Type
 		}
 	}
+	return nil
+}
 
-	// Run query without sort, skip or limit
-	// apply sort, skip and limit to entire dataset
-	qCopy := *query
-	qCopy.sort = nil
-	qCopy.limit = 0
-	qCopy.skip = 0
-
-	var records []*record
-	err := s.runQuery(source, dataType, &qCopy, nil, 0,
-		func(r *record) error {
-			records = append(records, r)
-
-			return nil
-		})
-
-	if err != nil {
-		return err
+// sortRecords sorts the records by the passed in fields, which must have been checked with validateSort
+func sortRecords(records []*record, fields []string, reverse bool) {
+	if len(fields) == 0 {
+		return
 	}
 
-	sort.Slice(records, func(i, j int) bool {
-		for _, field := range query.sort {
+	sort.SliceStable(records, func(i, j int) bool {
+		for _, field := range fields {
 			value, err := fieldValue(records[i].value.Elem(), field)
 			if err != nil {
 				panic(err.Error()) // shouldn't happen due to field check above
@@ -175,7 +361,7 @@ func (s *Store) runQuerySort(source BucketSource, dataType interface{}, query *Q
 				panic(err.Error()) // shouldn't happen due to field check above
 			}
 
-			if query.reverse {
+			if reverse {
 				value, other = other, value
 			}
 
@@ -201,11 +387,10 @@ func (s *Store) runQuerySort(source BucketSource, dataType interface{}, query *Q
 		}
 		return false
 	})
+}
 
-	// apply skip and limit
-	limit := query.limit
-	skip := query.skip
-
+// applySkipLimit runs action against the records left after skip and limit are applied
+func applySkipLimit(records []*record, skip, limit int, action func(r *record) error) error {
 	if skip > len(records) {
 		records = records[0:0]
 	} else {
@@ -217,21 +402,35 @@ func (s *Store) runQuerySort(source BucketSource, dataType interface{}, query *Q
 	}
 
 	for i := range records {
-		err = action(records[i])
+		err := action(records[i])
 		if err != nil {
 			return err
 		}
 	}
 
 	return nil
-
 }
 
 func (s *Store) findQuery(source BucketSource, result interface{}, query *Query) error {
-	if query == nil {
-		query = &Query{}
+	dataType, add, done := s.resultAppender(result)
+
+	query, err := s.prepQuery(dataType, query)
+	if err != nil {
+		return err
+	}
+
+	err = s.runQuery(source, dataType, query, nil, query.skip, add)
+	if err != nil {
+		return err
 	}
 
+	done()
+	return nil
+}
+
+// resultAppender returns the data type of the result slice, a function which appends a record to it, and a function
+// which sets the result once all of the records have been appended
+func (s *Store) resultAppender(result interface{}) (interface{}, func(r *record) error, func()) {
 	resultVal := reflect.ValueOf(result)
 	if resultVal.Kind() != reflect.Ptr || resultVal.Elem().Kind() != reflect.Slice {
 		panic("result argument must be a slice address")
@@ -249,61 +448,59 @@ func (s *Store) findQuery(source BucketSource, result interface{}, query *Query)
 
 	var keyType reflect.Type
 	var keyField string
-
-	for i := 0; i < tp.NumField(); i++ {
-		if strings.Contains(string(tp.Field(i).Tag), BoltholdKeyTag) {
-			keyType = tp.Field(i).Type
-			keyField = tp.Field(i).Name
-			break
-		}
+	if field, ok := decodedKeyField(tp); ok {
+		keyType = field.Type
+		keyField = field.Name
 	}
 
-	val := reflect.New(tp)
+	add := func(r *record) error {
+		var rowValue reflect.Value
 
-	err := s.runQuery(source, val.Interface(), query, nil, query.skip,
-		func(r *record) error {
-			var rowValue reflect.Value
+		// FIXME:
+		if elType.Kind() == reflect.Ptr {
+			rowValue = r.value
+		} else {
+			rowValue = r.value.Elem()
+		}
 
-			// FIXME:
-			if elType.Kind() == reflect.Ptr {
-				rowValue = r.value
-			} else {
-				rowValue = r.value.Elem()
+		if keyType != nil {
+			rowKey := rowValue
+			for rowKey.Kind() == reflect.Ptr {
+				rowKey = rowKey.Elem()
 			}
-
-			if keyType != nil {
-				rowKey := rowValue
-				for rowKey.Kind() == reflect.Ptr {
-					rowKey = rowKey.Elem()
-				}
-				err := s.decode(r.key, rowKey.FieldByName(keyField).Addr().Interface())
-				if err != nil {
-					return err
-				}
+			err := s.decodeKey(r.key, rowKey.FieldByName(keyField).Addr().Interface())
+			if err != nil {
+				return err
 			}
+		}
 
-			sliceVal = reflect.Append(sliceVal, rowValue)
-
-			return nil
-		})
+		sliceVal = reflect.Append(sliceVal, rowValue)
 
-	if err != nil {
-		return err
+		return nil
 	}
 
-	resultVal.Elem().Set(sliceVal.Slice(0, sliceVal.Len()))
+	done := func() {
+		resultVal.Elem().Set(sliceVal.Slice(0, sliceVal.Len()))
+	}
 
-	return nil
+	return reflect.New(tp).Interface(), add, done
 }
 
-func (s *Store) deleteQuery(source BucketSource, dataType interface{}, query *Query) error {
-	if query == nil {
-		query = &Query{}
+// deleteQuery deletes the records matching the query, and returns their keys
+func (s *Store) deleteQuery(source BucketSource, dataType interface{}, query *Query) ([][]byte, error) {
+	query, err := s.prepQuery(dataType, query)
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkMutable(s.newStorer(dataType), dataType, "delete")
+	if err != nil {
+		return nil, err
 	}
 
 	var records []*record
 
-	err := s.runQuery(source, dataType, query, nil, query.skip,
+	err = s.runQuery(source, dataType, query, nil, query.skip,
 		func(r *record) error {
 			records = append(records, r)
 
@@ -311,36 +508,48 @@ func (s *Store) deleteQuery(source BucketSource, dataType interface{}, query *Qu
 		})
 
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	storer := s.newStorer(dataType)
 
-	b := source.Bucket([]byte(storer.Type()))
+	keys := make([][]byte, 0, len(records))
+	b := getRecordBucket(source, storer)
 	for i := range records {
-		err := b.Delete(records[i].key)
-		if err != nil {
-			return err
+		value := records[i].value.Interface()
+
+		var err error
+		if !hasSoftDelete(storer) {
+			err = s.deleteRecord(source, storer, b, records[i].key, value)
+		} else if !isSoftDeleted(storer, value) {
+			err = s.softDelete(source, storer, b, records[i].key, value)
+		} else {
+			// already deleted, the query is WithDeleted
+			continue
 		}
-
-		// remove any indexes
-		err = s.deleteIndexes(storer, source, records[i].key, records[i].value.Interface())
 		if err != nil {
-			return err
+			return nil, err
 		}
+		keys = append(keys, records[i].key)
 	}
 
-	return nil
+	return keys, nil
 }
 
 func (s *Store) updateQuery(source BucketSource, dataType interface{}, query *Query, update func(record interface{}) error) error {
-	if query == nil {
-		query = &Query{}
+	query, err := s.prepQuery(dataType, query)
+	if err != nil {
+		return err
+	}
+
+	err = checkMutable(s.newStorer(dataType), dataType, "update")
+	if err != nil {
+		return err
 	}
 
 	var records []*record
 
-	err := s.runQuery(source, dataType, query, nil, query.skip,
+	err = s.runQuery(source, dataType, query, nil, query.skip,
 		func(r *record) error {
 			records = append(records, r)
 
@@ -353,46 +562,64 @@ func (s *Store) updateQuery(source BucketSource, dataType interface{}, query *Qu
 	}
 
 	storer := s.newStorer(dataType)
-	b := source.Bucket([]byte(storer.Type()))
+	b := getRecordBucket(source, storer)
 
 	for i := range records {
-		upVal := records[i].value.Interface()
-
-		// delete any existing indexes bad on original value
-		err := s.deleteIndexes(storer, source, records[i].key, upVal)
+		err = s.updateRecord(storer, source, b, records[i].key, records[i].value.Interface(), update)
 		if err != nil {
 			return err
 		}
+	}
 
-		err = update(upVal)
-		if err != nil {
-			return err
-		}
+	return nil
+}
 
-		encVal, err := s.encode(upVal)
-		if err != nil {
-			return err
-		}
+// updateRecord runs update on a record read from the store, and writes it back under the same key, along with its
+// indexes
+func (s *Store) updateRecord(storer Storer, source BucketSource, b *recordBucket, key []byte, upVal interface{},
+	update func(record interface{}) error) error {
+	// delete any existing indexes bad on original value
+	err := s.deleteIndexes(storer, source, key, upVal)
+	if err != nil {
+		return err
+	}
 
-		err = b.Put(records[i].key, encVal)
-		if err != nil {
-			return err
-		}
+	version := recordVersion(storer, upVal)
 
-		// insert any new indexes
-		err = s.addIndexes(storer, source, records[i].key, upVal)
-		if err != nil {
-			return err
-		}
+	err = update(upVal)
+	if err != nil {
+		return err
 	}
 
-	return nil
+	nextVersion(storer, upVal, version)
+	timestamp(storer, upVal, nil, time.Now())
+
+	err = s.checkUnique(storer, source, upVal, key)
+	if err != nil {
+		return err
+	}
+
+	encVal, err := s.encodeRecord(storer, upVal)
+	if err != nil {
+		return err
+	}
+
+	s.writes.record(false, key, encVal)
+	s.changes.add(storer, key, false)
+	err = b.Put(key, encVal)
+	if err != nil {
+		return err
+	}
+
+	// insert any new indexes
+	return s.addIndexes(storer, source, key, upVal)
 }
 
 func (s *Store) aggregateQuery(source BucketSource, dataType interface{}, query *Query,
 	groupBy ...string) ([]*AggregateResult, error) {
-	if query == nil {
-		query = &Query{}
+	query, err := s.prepQuery(dataType, query)
+	if err != nil {
+		return nil, err
 	}
 
 	var result []*AggregateResult
@@ -401,7 +628,7 @@ func (s *Store) aggregateQuery(source BucketSource, dataType interface{}, query
 		result = append(result, &AggregateResult{})
 	}
 
-	err := s.runQuery(source, dataType, query, nil, query.skip,
+	err = s.runQuery(source, dataType, query, nil, query.skip,
 		func(r *record) error {
 			if len(groupBy) == 0 {
 				result[0].reduction = append(result[0].reduction, r.value)
@@ -468,14 +695,53 @@ func (s *Store) aggregateQuery(source BucketSource, dataType interface{}, query
 	return result, nil
 }
 
+func (s *Store) findKeysQuery(source BucketSource, dataType interface{}, query *Query, keys interface{}) error {
+	keysVal := reflect.ValueOf(keys)
+	if keysVal.Kind() != reflect.Ptr || keysVal.Elem().Kind() != reflect.Slice {
+		panic("keys argument must be a slice address")
+	}
+
+	query, err := s.prepQuery(dataType, query)
+	if err != nil {
+		return err
+	}
+
+	// only the keys are returned, so the records don't need to be read if the index covers the query
+	query = query.clone()
+	query.keysOnly = true
+
+	sliceVal := keysVal.Elem()
+	err = s.runQuery(source, dataType, query, nil, query.skip,
+		func(r *record) error {
+			key := reflect.New(sliceVal.Type().Elem())
+			err := s.decodeKey(r.key, key.Interface())
+			if err != nil {
+				return err
+			}
+			sliceVal = reflect.Append(sliceVal, key.Elem())
+			return nil
+		})
+	if err != nil {
+		return err
+	}
+
+	keysVal.Elem().Set(sliceVal)
+	return nil
+}
+
 func (s *Store) countQuery(source BucketSource, dataType interface{}, query *Query) (int, error) {
-	if query == nil {
-		query = &Query{}
+	query, err := s.prepQuery(dataType, query)
+	if err != nil {
+		return 0, err
 	}
 
+	// only the keys are needed to count the records
+	query = query.clone()
+	query.keysOnly = true
+
 	count := 0
 
-	err := s.runQuery(source, dataType, query, nil, query.skip,
+	err = s.runQuery(source, dataType, query, nil, query.skip,
 		func(r *record) error {
 			count++
 			return nil
@@ -488,9 +754,37 @@ func (s *Store) countQuery(source BucketSource, dataType interface{}, query *Que
 	return count, nil
 }
 
+func (s *Store) existsQuery(source BucketSource, dataType interface{}, query *Query) (bool, error) {
+	query, err := s.prepQuery(dataType, query)
+	if err != nil {
+		return false, err
+	}
+
+	// the order doesn't matter, and only the first key is needed
+	query = query.clone()
+	query.keysOnly = true
+	query.sort = nil
+	query.limit = 1
+
+	found := false
+
+	err = s.runQuery(source, dataType, query, nil, query.skip,
+		func(r *record) error {
+			found = true
+			return nil
+		})
+
+	if err != nil {
+		return false, err
+	}
+
+	return found, nil
+}
+
 func (s *Store) findOneQuery(source BucketSource, result interface{}, query *Query) error {
-	if query == nil {
-		query = &Query{}
+	query, err := s.prepQuery(result, query)
+	if err != nil {
+		return err
 	}
 
 	originalLimit := query.limit
@@ -506,18 +800,14 @@ func (s *Store) findOneQuery(source BucketSource, result interface{}, query *Que
 
 	var keyType reflect.Type
 	var keyField string
-
-	for i := 0; i < structType.NumField(); i++ {
-		if strings.Contains(string(structType.Field(i).Tag), BoltholdKeyTag) {
-			keyType = structType.Field(i).Type
-			keyField = structType.Field(i).Name
-			break
-		}
+	if field, ok := decodedKeyField(structType); ok {
+		keyType = field.Type
+		keyField = field.Name
 	}
 
 	found := false
 
-	err := s.runQuery(source, result, query, nil, query.skip,
+	err = s.runQuery(source, result, query, nil, query.skip,
 		func(r *record) error {
 			found = true
 
@@ -526,7 +816,7 @@ func (s *Store) findOneQuery(source BucketSource, result interface{}, query *Que
 				for rowKey.Kind() == reflect.Ptr {
 					rowKey = rowKey.Elem()
 				}
-				err := s.decode(r.key, rowKey.FieldByName(keyField).Addr().Interface())
+				err := s.decodeKey(r.key, rowKey.FieldByName(keyField).Addr().Interface())
 				if err != nil {
 					return err
 				}
@@ -549,10 +839,6 @@ func (s *Store) findOneQuery(source BucketSource, result interface{}, query *Que
 }
 
 func (s *Store) forEach(source BucketSource, query *Query, fn interface{}) error {
-	if query == nil {
-		query = &Query{}
-	}
-
 	fnVal := reflect.ValueOf(fn)
 	argType := reflect.TypeOf(fn).In(0)
 
@@ -562,15 +848,16 @@ func (s *Store) forEach(source BucketSource, query *Query, fn interface{}) error
 
 	dataType := reflect.New(argType).Interface()
 
+	query, err := s.prepQuery(dataType, query)
+	if err != nil {
+		return err
+	}
+
 	var keyType reflect.Type
 	var keyField string
-
-	for i := 0; i < argType.NumField(); i++ {
-		if strings.Contains(string(argType.Field(i).Tag), BoltholdKeyTag) {
-			keyType = argType.Field(i).Type
-			keyField = argType.Field(i).Name
-			break
-		}
+	if field, ok := decodedKeyField(argType); ok {
+		keyType = field.Type
+		keyField = field.Name
 	}
 
 	return s.runQuery(source, dataType, query, nil, query.skip, func(r *record) error {
@@ -579,7 +866,7 @@ func (s *Store) forEach(source BucketSource, query *Query, fn interface{}) error
 			for rowKey.Kind() == reflect.Ptr {
 				rowKey = rowKey.Elem()
 			}
-			err := s.decode(r.key, rowKey.FieldByName(keyField).Addr().Interface())
+			err := s.decodeKey(r.key, rowKey.FieldByName(keyField).Addr().Interface())
 			if err != nil {
 				return err
 			}
@@ -597,3 +884,45 @@ func (s *Store) forEach(source BucketSource, query *Query, fn interface{}) error
 		return out[0].Interface().(error)
 	})
 }
+
+// prepQuery returns the query to run against the passed in dataType once all of the store's query rewriters have
+// been applied.  Rewriters are handed a copy, so the caller's query is never modified.
+func (s *Store) prepQuery(dataType interface{}, query *Query) (*Query, error) {
+	if query == nil {
+		query = &Query{}
+	}
+
+	if len(s.rewriters) == 0 {
+		return query, nil
+	}
+
+	return s.rewriteQuery(dataType, query.clone())
+}
+
+// rewriteQuery runs the rewriters against the query and each of its Or'd queries separately, as each of them is run
+// on its own, so a rewriter's criteria apply to every record returned, and its checks to every part of the query
+func (s *Store) rewriteQuery(dataType interface{}, query *Query) (*Query, error) {
+	ors := query.ors
+	query.ors = nil
+
+	for i := range s.rewriters {
+		var err error
+		query, err = s.rewriters[i](dataType, query)
+		if err != nil {
+			return nil, err
+		}
+		if query == nil {
+			query = &Query{}
+		}
+	}
+
+	for i := range ors {
+		or, err := s.rewriteQuery(dataType, ors[i])
+		if err != nil {
+			return nil, err
+		}
+		query.ors = append(query.ors, or)
+	}
+
+	return query, nil
+}
@@ -0,0 +1,244 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package bolthold
+
+import (
+	"reflect"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// rekeyChunk is how many records RekeyAll moves in each transaction
+const rekeyChunk = 1000
+
+const rekeyBucketPrefix = "_rekey"
+
+func rekeyBucketName(typeName string) []byte {
+	return []byte(rekeyBucketPrefix + ":" + typeName)
+}
+
+// bucketDeleter is implemented by both bolt transactions and buckets
+type bucketDeleter interface {
+	DeleteBucket(name []byte) error
+}
+
+// RekeyAll moves every record of dataType's type to the key returned by fn, for when the format of a type's keys
+// changes.  fn is passed each record's key as it's stored, and the record, whose key field, if it has one, is set to
+// the old key, and it returns the record's new key.  Records are first moved, a chunk per transaction, into a
+// staging bucket under their new keys, and then moved back, so new keys never collide with old keys that haven't been
+// moved yet.  The indexes and key fields of the records are updated along with them.  If two records are given the
+// same new key, RekeyAll fails with ErrKeyExists, leaving the records that have already been moved in the staging
+// bucket, and running RekeyAll again, with a fixed fn, picks up where it left off
+//
+//	err := store.RekeyAll(&Item{}, func(oldKey []byte, record interface{}) (interface{}, error) {
+//		item := record.(*Item)
+//		return item.Category + "/" + item.Name, nil
+//	})
+func (s *Store) RekeyAll(dataType interface{}, fn func(oldKey []byte, record interface{}) (interface{}, error)) error {
+	for _, chunk := range []func(source BucketSource) (bool, error){
+		func(source BucketSource) (bool, error) { return s.rekeyChunk(source, dataType, fn) },
+		func(source BucketSource) (bool, error) { return s.unstageChunk(source, dataType) },
+	} {
+		for {
+			done := false
+			err := s.updateTx(func(tx *bolt.Tx) error {
+				var txErr error
+				done, txErr = chunk(tx)
+				return txErr
+			})
+			if err != nil {
+				return err
+			}
+			if done {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// TxRekeyAll is the same as RekeyAll, except every record is moved in your own transaction
+func (s *Store) TxRekeyAll(tx *bolt.Tx, dataType interface{},
+	fn func(oldKey []byte, record interface{}) (interface{}, error)) error {
+	if !tx.Writable() {
+		return bolt.ErrTxNotWritable
+	}
+	return s.rekeyAll(tx, dataType, fn)
+}
+
+// RekeyAllInBucket is the same as TxRekeyAll, except the records are moved in the passed in parent bucket
+func (s *Store) RekeyAllInBucket(parent *bolt.Bucket, dataType interface{},
+	fn func(oldKey []byte, record interface{}) (interface{}, error)) error {
+	if !parent.Tx().Writable() {
+		return bolt.ErrTxNotWritable
+	}
+	return s.rekeyAll(parent, dataType, fn)
+}
+
+func (s *Store) rekeyAll(source BucketSource, dataType interface{},
+	fn func(oldKey []byte, record interface{}) (interface{}, error)) error {
+	for done := false; !done; {
+		var err error
+		done, err = s.rekeyChunk(source, dataType, fn)
+		if err != nil {
+			return err
+		}
+	}
+	for done := false; !done; {
+		var err error
+		done, err = s.unstageChunk(source, dataType)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rekeyChunk moves the next chunk of records into the staging bucket under their new keys, and returns true once
+// there are none left to move
+func (s *Store) rekeyChunk(source BucketSource, dataType interface{},
+	fn func(oldKey []byte, record interface{}) (interface{}, error)) (bool, error) {
+	storer := s.newStorer(dataType)
+
+	err := checkMutable(storer, dataType, "change the key of")
+	if err != nil {
+		return false, err
+	}
+
+	b := getRecordBucket(source, storer)
+	if b == nil {
+		return true, nil
+	}
+
+	keys, values := firstRecords(b.Cursor())
+	if len(keys) == 0 {
+		return true, nil
+	}
+
+	staging, err := source.CreateBucketIfNotExists(rekeyBucketName(storer.Type()))
+	if err != nil {
+		return false, err
+	}
+
+	keyField, hasKeyField := decodedKeyField(reflect.TypeOf(dataType))
+
+	for i := range keys {
+		value := newElemType(dataType)
+		err = s.decodeRecord(storer, values[i], value)
+		if err != nil {
+			return false, err
+		}
+		if hasKeyField {
+			field := reflect.ValueOf(value).Elem().FieldByIndex(keyField.Index)
+			err = s.decodeKey(keys[i], field.Addr().Interface())
+			if err != nil {
+				return false, err
+			}
+		}
+
+		newKey, err := fn(keys[i], value)
+		if err != nil {
+			return false, err
+		}
+		newGk, err := s.encodeKey(newKey)
+		if err != nil {
+			return false, err
+		}
+		if staging.Get(newGk) != nil {
+			return false, ErrKeyExists
+		}
+
+		err = s.deleteIndexes(storer, source, keys[i], value)
+		if err != nil {
+			return false, err
+		}
+		s.writes.record(false, keys[i], nil)
+		s.changes.add(storer, keys[i], true)
+		err = b.Delete(keys[i])
+		if err != nil {
+			return false, err
+		}
+
+		err = setKeyField(value, newKey)
+		if err != nil {
+			return false, err
+		}
+		encoded, err := s.encodeRecord(storer, value)
+		if err != nil {
+			return false, err
+		}
+		err = staging.Put(newGk, encoded)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	return len(keys) < rekeyChunk, nil
+}
+
+// unstageChunk moves the next chunk of records from the staging bucket back into the type's bucket, and returns true
+// once the staging bucket is empty, and has been deleted
+func (s *Store) unstageChunk(source BucketSource, dataType interface{}) (bool, error) {
+	storer := s.newStorer(dataType)
+
+	staging := source.Bucket(rekeyBucketName(storer.Type()))
+	if staging == nil {
+		return true, nil
+	}
+
+	keys, values := firstRecords(staging.Cursor())
+	if len(keys) == 0 {
+		return true, source.(bucketDeleter).DeleteBucket(rekeyBucketName(storer.Type()))
+	}
+
+	b, err := createRecordBucket(source, storer, dataType)
+	if err != nil {
+		return false, err
+	}
+
+	for i := range keys {
+		if b.Get(keys[i]) != nil {
+			return false, ErrKeyExists
+		}
+
+		value := newElemType(dataType)
+		err = s.decodeRecord(storer, values[i], value)
+		if err != nil {
+			return false, err
+		}
+
+		err = s.checkUnique(storer, source, value, keys[i])
+		if err != nil {
+			return false, err
+		}
+
+		s.writes.record(false, keys[i], values[i])
+		s.changes.add(storer, keys[i], false)
+		err = b.Put(keys[i], values[i])
+		if err != nil {
+			return false, err
+		}
+		err = s.addIndexes(storer, source, keys[i], value)
+		if err != nil {
+			return false, err
+		}
+		err = staging.Delete(keys[i])
+		if err != nil {
+			return false, err
+		}
+	}
+
+	return false, nil
+}
+
+// firstRecords returns copies of up to rekeyChunk of the first keys and values of the cursor, so they can still be
+// used once the records have been deleted
+func firstRecords(c recordCursor) (keys, values [][]byte) {
+	for k, v := c.First(); k != nil && len(keys) < rekeyChunk; k, v = c.Next() {
+		keys = append(keys, append([]byte(nil), k...))
+		values = append(values, append([]byte(nil), v...))
+	}
+	return keys, values
+}
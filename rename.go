@@ -0,0 +1,171 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package bolthold
+
+import (
+	"bytes"
+	"fmt"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// bucketCursor is implemented by both bolt transactions and buckets, and is used to list the buckets in them
+type bucketCursor interface {
+	Cursor() *bolt.Cursor
+}
+
+// RenameType moves the records of the type stored as oldTypeName, along with their indexes, keys and sequence, to
+// newType, for when a type is renamed or moved to another package and its records would otherwise be left behind
+// under the old name.  newType can't have any records of its own yet
+//
+//	err := store.RenameType("Contact", &Person{})
+func (s *Store) RenameType(oldTypeName string, newType interface{}) error {
+	return s.updateTx(func(tx *bolt.Tx) error {
+		return s.renameType(tx, oldTypeName, newType)
+	})
+}
+
+// TxRenameType is the same as RenameType except it allows you to specify your own transaction
+func (s *Store) TxRenameType(tx *bolt.Tx, oldTypeName string, newType interface{}) error {
+	if !tx.Writable() {
+		return bolt.ErrTxNotWritable
+	}
+	return s.renameType(tx, oldTypeName, newType)
+}
+
+// RenameTypeInBucket is the same as RenameType but you get to specify your parent bucket
+func (s *Store) RenameTypeInBucket(parent *bolt.Bucket, oldTypeName string, newType interface{}) error {
+	if !parent.Tx().Writable() {
+		return bolt.ErrTxNotWritable
+	}
+	return s.renameType(parent, oldTypeName, newType)
+}
+
+func (s *Store) renameType(source BucketSource, oldTypeName string, newType interface{}) error {
+	newTypeName := s.newStorer(newType).Type()
+	if oldTypeName == newTypeName {
+		return nil
+	}
+
+	err := checkTypeName(newTypeName)
+	if err != nil {
+		return err
+	}
+	if isReserved([]byte(oldTypeName)) {
+		return fmt.Errorf("The type name %s is reserved, and can't be renamed", oldTypeName)
+	}
+	if source.Bucket([]byte(oldTypeName)) == nil {
+		return fmt.Errorf("There are no records of the type %s to rename", oldTypeName)
+	}
+	if source.Bucket([]byte(newTypeName)) != nil {
+		return fmt.Errorf("The type %s already has records, so %s can't be renamed to it", newTypeName,
+			oldTypeName)
+	}
+
+	err = moveBucket(source, []byte(oldTypeName), []byte(newTypeName))
+	if err != nil {
+		return err
+	}
+	err = moveBucket(source, rekeyBucketName(oldTypeName), rekeyBucketName(newTypeName))
+	if err != nil {
+		return err
+	}
+
+	// index buckets are found by name, rather than from newType's indexes, as the indexes may have changed along
+	// with the type
+	oldIndexPrefix := indexBucketName(oldTypeName, "")
+	var indexes [][]byte
+	c := source.(bucketCursor).Cursor()
+	for k, v := c.Seek(oldIndexPrefix); k != nil && bytes.HasPrefix(k, oldIndexPrefix); k, v = c.Next() {
+		if v == nil {
+			indexes = append(indexes, append([]byte(nil), k...))
+		}
+	}
+	for _, name := range indexes {
+		err = moveBucket(source, name, indexBucketName(newTypeName, string(name[len(oldIndexPrefix):])))
+		if err != nil {
+			return err
+		}
+	}
+
+	if dropped := metaBucket(source, droppedIndexSubsystem); dropped != nil {
+		var names [][]byte
+		c := dropped.Cursor()
+		for k, _ := c.Seek(oldIndexPrefix); k != nil && bytes.HasPrefix(k, oldIndexPrefix); k, _ = c.Next() {
+			names = append(names, append([]byte(nil), k...))
+		}
+		for _, name := range names {
+			err = renameKey(dropped, name, indexBucketName(newTypeName, string(name[len(oldIndexPrefix):])))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if layout := metaBucket(source, layoutSubsystem); layout != nil {
+		err = renameKey(layout, []byte(oldTypeName), []byte(newTypeName))
+		if err != nil {
+			return err
+		}
+	}
+
+	if schema := metaBucket(source, schemaSubsystem); schema != nil {
+		err = renameKey(schema, []byte(oldTypeName), []byte(newTypeName))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// moveBucket moves the bucket from one name to another, along with its sequence and nested buckets, if it exists
+func moveBucket(source BucketSource, from, to []byte) error {
+	src := source.Bucket(from)
+	if src == nil {
+		return nil
+	}
+	dst, err := source.CreateBucketIfNotExists(to)
+	if err != nil {
+		return err
+	}
+	err = copyBucket(dst, src)
+	if err != nil {
+		return err
+	}
+	return source.(bucketDeleter).DeleteBucket(from)
+}
+
+func copyBucket(dst, src *bolt.Bucket) error {
+	err := dst.SetSequence(src.Sequence())
+	if err != nil {
+		return err
+	}
+
+	return src.ForEach(func(k, v []byte) error {
+		if v != nil {
+			return dst.Put(k, v)
+		}
+
+		child, err := dst.CreateBucket(k)
+		if err != nil {
+			return err
+		}
+		return copyBucket(child, src.Bucket(k))
+	})
+}
+
+// renameKey moves the value of a key to a new key, if it exists
+func renameKey(b *bolt.Bucket, from, to []byte) error {
+	value := b.Get(from)
+	if value == nil {
+		return nil
+	}
+	err := b.Put(to, append([]byte(nil), value...))
+	if err != nil {
+		return err
+	}
+	return b.Delete(from)
+}
@@ -0,0 +1,61 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package bolthold_test
+
+import (
+	"testing"
+
+	"github.com/timshannon/bolthold"
+	bolt "go.etcd.io/bbolt"
+)
+
+type Patron struct {
+	ID   uint64 `boltholdKey:"ID"`
+	Name string
+	City string `boltholdIndex:"City"`
+}
+
+func TestRenameType(t *testing.T) {
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		// the type before it was renamed to Patron
+		type Customer struct {
+			ID   uint64 `boltholdKey:"ID"`
+			Name string
+			City string `boltholdIndex:"City"`
+		}
+
+		ok(t, store.Insert(bolthold.NextSequence(), &Customer{Name: "ada", City: "London"}))
+		ok(t, store.Insert(bolthold.NextSequence(), &Customer{Name: "grace", City: "New York"}))
+		ok(t, store.Insert(bolthold.NextSequence(), &Customer{Name: "alan", City: "London"}))
+
+		equals(t, bolt.ErrTxNotWritable, store.Bolt().View(func(tx *bolt.Tx) error {
+			return store.TxRenameType(tx, "Customer", &Patron{})
+		}))
+		assert(t, store.RenameType("Missing", &Patron{}) != nil, "renamed a type with no records")
+
+		ok(t, store.RenameType("Customer", &Patron{}))
+
+		var result []Patron
+		ok(t, store.Find(&result, bolthold.Where("City").Eq("London").Index("City")))
+		equals(t, []Patron{{ID: 1, Name: "ada", City: "London"}, {ID: 3, Name: "alan", City: "London"}}, result)
+
+		count, err := store.Count(&Customer{}, nil)
+		ok(t, err)
+		equals(t, 0, count)
+
+		patron := &Patron{Name: "edsger", City: "Austin"}
+		ok(t, store.Insert(bolthold.NextSequence(), patron))
+		equals(t, uint64(4), patron.ID)
+
+		types, err := store.Buckets()
+		ok(t, err)
+		equals(t, 1, len(types))
+		equals(t, "Patron", types[0].Type)
+		equals(t, 1, len(types[0].Indexes))
+
+		ok(t, store.Insert(bolthold.NextSequence(), &Customer{Name: "barbara", City: "Boston"}))
+		assert(t, store.RenameType("Customer", &Patron{}) != nil, "renamed onto a type with records")
+	})
+}
@@ -0,0 +1,253 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package bolthold
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"reflect"
+	"sort"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// schemaChunk is how many records a schema migration rewrites in each transaction
+const schemaChunk = 1000
+
+// schemaSubsystem is the metadata bucket the applied schema versions of types are kept in
+const schemaSubsystem = "schema"
+
+// SchemaMigration is a change to the stored records of a type, which is run against every record once, such as
+// filling in a new field.  Unlike a Migration, which upgrades records as they're read, a SchemaMigration rewrites
+// every record of the type up front, and the store records that it has been applied
+type SchemaMigration struct {
+	// Version is the schema version of the type once the migration has run.  Versions start at 1, and migrations
+	// are run in the order of their versions
+	Version uint64
+	// Name describes the migration in progress reports
+	Name string
+	// Migrate is called with a pointer to each record of the type, and the record is written back, along with its
+	// indexes, when it returns
+	Migrate func(record interface{}) error
+}
+
+// TypeSchema is the schema migrations of a type, for Options.SchemaMigrations
+type TypeSchema struct {
+	Type       interface{}
+	Migrations []SchemaMigration
+}
+
+// SchemaProgress reports the progress of a schema migration
+type SchemaProgress struct {
+	Type    string
+	Version uint64
+	Name    string
+	// Done is the number of records migrated so far, out of Total
+	Done  int
+	Total int
+}
+
+// RegisterSchemaMigrations registers the schema migrations of dataType's type, replacing any registered before, to be
+// run by RunSchemaMigrations.  RegisterSchemaMigrations is not safe to call while schema migrations are running
+func (s *Store) RegisterSchemaMigrations(dataType interface{}, migrations ...SchemaMigration) error {
+	sorted := append([]SchemaMigration(nil), migrations...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Version < sorted[j].Version
+	})
+
+	for i := range sorted {
+		if sorted[i].Version == 0 {
+			return fmt.Errorf("Schema migration %q has no version, versions start at 1", sorted[i].Name)
+		}
+		if i > 0 && sorted[i].Version == sorted[i-1].Version {
+			return fmt.Errorf("There are two schema migrations with version %d", sorted[i].Version)
+		}
+		if sorted[i].Migrate == nil {
+			return fmt.Errorf("Schema migration %d has no Migrate func", sorted[i].Version)
+		}
+	}
+
+	typeName := s.newStorer(dataType).Type()
+	for i := range s.schemas {
+		if s.newStorer(s.schemas[i].Type).Type() == typeName {
+			s.schemas[i] = TypeSchema{Type: dataType, Migrations: sorted}
+			return nil
+		}
+	}
+	s.schemas = append(s.schemas, TypeSchema{Type: dataType, Migrations: sorted})
+	return nil
+}
+
+// SchemaVersion returns the version of the last schema migration applied to dataType's type, or 0 if none have been
+func (s *Store) SchemaVersion(dataType interface{}) (uint64, error) {
+	var version uint64
+	err := s.Bolt().View(func(tx *bolt.Tx) error {
+		version, _, _ = schemaState(tx, s.newStorer(dataType).Type())
+		return nil
+	})
+	return version, err
+}
+
+// RunSchemaMigrations runs the registered schema migrations that haven't been applied yet, in order, for each type in
+// the order they were registered.  Each migration rewrites the records of its type a chunk at a time, in a transaction
+// per chunk, and progress, if it's not nil, is called after each chunk.  If a migration fails, the chunks already
+// rewritten stay written, and running the migrations again carries on from the chunk that failed
+func (s *Store) RunSchemaMigrations(progress func(SchemaProgress)) error {
+	for _, schema := range s.schemas {
+		for _, migration := range schema.Migrations {
+			err := s.runSchemaMigration(schema.Type, migration, progress)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Store) runSchemaMigration(dataType interface{}, migration SchemaMigration,
+	progress func(SchemaProgress)) error {
+	storer := s.newStorer(dataType)
+
+	total := 0
+	err := s.Bolt().View(func(tx *bolt.Tx) error {
+		if b := getRecordBucket(tx, storer); b != nil {
+			total = b.Count()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	done := 0
+	for {
+		finished := false
+		migrated := 0
+		err := s.updateTx(func(tx *bolt.Tx) error {
+			var txErr error
+			migrated, finished, txErr = s.schemaChunk(tx, storer, dataType, migration)
+			return txErr
+		})
+		if err != nil {
+			return err
+		}
+		if finished && migrated == 0 && done == 0 {
+			// already applied
+			return nil
+		}
+
+		done += migrated
+		if progress != nil {
+			progress(SchemaProgress{
+				Type:    storer.Type(),
+				Version: migration.Version,
+				Name:    migration.Name,
+				Done:    done,
+				Total:   total,
+			})
+		}
+		if finished {
+			return nil
+		}
+	}
+}
+
+// schemaChunk runs the migration against the next chunk of records, and returns how many it migrated, and whether
+// the migration has been applied to every record
+func (s *Store) schemaChunk(tx *bolt.Tx, storer Storer, dataType interface{}, migration SchemaMigration) (int, bool,
+	error) {
+	applied, migrating, after := schemaState(tx, storer.Type())
+	if applied >= migration.Version {
+		return 0, true, nil
+	}
+	if migrating != migration.Version {
+		// the migration that was part way through is no longer registered, so this one starts from the beginning
+		after = nil
+	}
+
+	meta, err := createMetaBucket(tx, schemaSubsystem)
+	if err != nil {
+		return 0, false, err
+	}
+
+	var keys, values [][]byte
+	b := getRecordBucket(tx, storer)
+	if b != nil {
+		c := b.Cursor()
+		k, v := c.First()
+		if after != nil {
+			k, v = c.Seek(after)
+			if bytes.Equal(k, after) {
+				k, v = c.Next()
+			}
+		}
+		// the keys and values are copied as writing the records can move the pages they're on
+		for ; k != nil && len(keys) < schemaChunk; k, v = c.Next() {
+			keys = append(keys, append([]byte(nil), k...))
+			values = append(values, append([]byte(nil), v...))
+		}
+	}
+
+	keyField, hasKeyField := decodedKeyField(reflect.TypeOf(dataType))
+
+	for i := range keys {
+		value := newElemType(dataType)
+		err = s.decodeRecord(storer, values[i], value)
+		if err != nil {
+			return 0, false, err
+		}
+		if hasKeyField {
+			field := reflect.ValueOf(value).Elem().FieldByIndex(keyField.Index)
+			err = s.decodeKey(keys[i], field.Addr().Interface())
+			if err != nil {
+				return 0, false, err
+			}
+		}
+
+		err = s.updateRecord(storer, tx, b, keys[i], value, migration.Migrate)
+		if err != nil {
+			return 0, false, err
+		}
+	}
+
+	if len(keys) < schemaChunk {
+		return len(keys), true, meta.Put([]byte(storer.Type()), schemaValue(migration.Version, applied, nil))
+	}
+	return len(keys), false, meta.Put([]byte(storer.Type()), schemaValue(migration.Version, applied,
+		keys[len(keys)-1]))
+}
+
+// schemaState returns the schema version applied to the type, and, if a migration to a later version is part way
+// through, its version and the key of the last record it migrated
+func schemaState(tx *bolt.Tx, typeName string) (applied, migrating uint64, after []byte) {
+	meta := metaBucket(tx, schemaSubsystem)
+	if meta == nil {
+		return 0, 0, nil
+	}
+	value := meta.Get([]byte(typeName))
+	if len(value) < 8 {
+		return 0, 0, nil
+	}
+	if len(value) < 16 {
+		return binary.BigEndian.Uint64(value), 0, nil
+	}
+	return binary.BigEndian.Uint64(value[8:]), binary.BigEndian.Uint64(value), append([]byte(nil), value[16:]...)
+}
+
+// schemaValue is the state of a type's schema, which is just the applied version once a migration has finished,
+// or the version being migrated to, the applied version and the last key migrated while it's running
+func schemaValue(version, applied uint64, after []byte) []byte {
+	if after == nil {
+		value := make([]byte, 8)
+		binary.BigEndian.PutUint64(value, version)
+		return value
+	}
+
+	value := make([]byte, 16, 16+len(after))
+	binary.BigEndian.PutUint64(value, version)
+	binary.BigEndian.PutUint64(value[8:], applied)
+	return append(value, after...)
+}
@@ -0,0 +1,143 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package bolthold_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/timshannon/bolthold"
+	bolt "go.etcd.io/bbolt"
+)
+
+type Subscriber struct {
+	ID     int `boltholdKey:"ID"`
+	Email  string
+	Domain string `boltholdIndex:"Domain"`
+}
+
+// subscriberMigrations returns the migrations of Subscriber, where filling in domains fails on the failAt'th record
+func subscriberMigrations(failAt int) []bolthold.SchemaMigration {
+	calls := 0
+	return []bolthold.SchemaMigration{
+		{
+			Version: 2,
+			Name:    "lower case emails",
+			Migrate: func(record interface{}) error {
+				subscriber := record.(*Subscriber)
+				subscriber.Email = strings.ToLower(subscriber.Email)
+				return nil
+			},
+		},
+		{
+			Version: 1,
+			Name:    "fill in domains",
+			Migrate: func(record interface{}) error {
+				subscriber := record.(*Subscriber)
+				calls++
+				if calls == failAt {
+					return errors.New("failed")
+				}
+				subscriber.Domain = subscriber.Email[strings.Index(subscriber.Email, "@")+1:]
+				return nil
+			},
+		},
+	}
+}
+
+func TestSchemaMigrations(t *testing.T) {
+	filename := tempfile()
+	defer os.Remove(filename)
+
+	store, err := bolthold.Open(filename, 0666, nil)
+	ok(t, err)
+	ok(t, store.Bolt().Update(func(tx *bolt.Tx) error {
+		for i := 0; i < 2500; i++ {
+			err := store.TxInsert(tx, i, &Subscriber{Email: fmt.Sprintf("User%d@Example.com", i)})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+
+	// a failed migration keeps the chunks it has finished
+	ok(t, store.RegisterSchemaMigrations(&Subscriber{}, subscriberMigrations(1500)...))
+	assert(t, store.RunSchemaMigrations(nil) != nil, "migration didn't fail")
+	version, err := store.SchemaVersion(&Subscriber{})
+	ok(t, err)
+	equals(t, uint64(0), version)
+	count, err := store.Count(&Subscriber{}, bolthold.Where("Domain").Eq("Example.com").Index("Domain"))
+	ok(t, err)
+	equals(t, 1000, count)
+	ok(t, store.Close())
+
+	// reopening carries on from the failed chunk, then runs the next migration
+	var progress []bolthold.SchemaProgress
+	store, err = bolthold.Open(filename, 0666, &bolthold.Options{
+		SchemaMigrations: []bolthold.TypeSchema{
+			{Type: &Subscriber{}, Migrations: subscriberMigrations(-1)},
+		},
+		SchemaProgress: func(p bolthold.SchemaProgress) {
+			progress = append(progress, p)
+		},
+	})
+	ok(t, err)
+
+	equals(t, []bolthold.SchemaProgress{
+		{Type: "Subscriber", Version: 1, Name: "fill in domains", Done: 1000, Total: 2500},
+		{Type: "Subscriber", Version: 1, Name: "fill in domains", Done: 1500, Total: 2500},
+		{Type: "Subscriber", Version: 2, Name: "lower case emails", Done: 1000, Total: 2500},
+		{Type: "Subscriber", Version: 2, Name: "lower case emails", Done: 2000, Total: 2500},
+		{Type: "Subscriber", Version: 2, Name: "lower case emails", Done: 2500, Total: 2500},
+	}, progress)
+
+	version, err = store.SchemaVersion(&Subscriber{})
+	ok(t, err)
+	equals(t, uint64(2), version)
+
+	count, err = store.Count(&Subscriber{}, bolthold.Where("Domain").Eq("Example.com").Index("Domain"))
+	ok(t, err)
+	equals(t, 2500, count)
+
+	var subscriber Subscriber
+	ok(t, store.Get(42, &subscriber))
+	equals(t, Subscriber{ID: 42, Email: "user42@example.com", Domain: "Example.com"}, subscriber)
+
+	// migrations that have been applied aren't run again
+	progress = nil
+	ok(t, store.RunSchemaMigrations(func(p bolthold.SchemaProgress) {
+		progress = append(progress, p)
+	}))
+	equals(t, 0, len(progress))
+
+	buckets, err := store.Buckets()
+	ok(t, err)
+	equals(t, 1, len(buckets))
+	ok(t, store.Close())
+}
+
+func TestSchemaMigrationVersions(t *testing.T) {
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		migrate := func(record interface{}) error { return nil }
+
+		assert(t, store.RegisterSchemaMigrations(&Subscriber{}, bolthold.SchemaMigration{Migrate: migrate}) != nil,
+			"migration without a version was registered")
+		assert(t, store.RegisterSchemaMigrations(&Subscriber{},
+			bolthold.SchemaMigration{Version: 1, Migrate: migrate},
+			bolthold.SchemaMigration{Version: 1, Migrate: migrate}) != nil,
+			"migrations with the same version were registered")
+
+		// migrations of a type with no records are applied straight away
+		ok(t, store.RegisterSchemaMigrations(&Subscriber{}, bolthold.SchemaMigration{Version: 3, Migrate: migrate}))
+		ok(t, store.RunSchemaMigrations(nil))
+		version, err := store.SchemaVersion(&Subscriber{})
+		ok(t, err)
+		equals(t, uint64(3), version)
+	})
+}
@@ -0,0 +1,66 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package bolthold
+
+import (
+	"errors"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// seedSubsystem is the metadata bucket holding the IDs of the seed records which have been inserted
+const seedSubsystem = "seeds"
+
+// SeedRecord is a record to be inserted by Seed.  ID identifies the record across runs, and a record is only ever
+// inserted once per store for each ID
+type SeedRecord struct {
+	ID   string
+	Key  interface{}
+	Data interface{}
+}
+
+// Seed inserts bootstrap data, such as default settings, which should exist exactly once in a store.  Each record
+// is inserted only if a record with the same ID hasn't been seeded before, so Seed can be called every time an
+// application starts.  If a record already exists at a seed record's key, it is left as is and the seed record is
+// treated as inserted.  All of the records are seeded in a single transaction
+func (s *Store) Seed(records ...SeedRecord) error {
+	return s.updateTx(func(tx *bolt.Tx) error {
+		return s.TxSeed(tx, records...)
+	})
+}
+
+// TxSeed is the same as Seed except it allows you to specify your own transaction
+func (s *Store) TxSeed(tx *bolt.Tx, records ...SeedRecord) error {
+	if !tx.Writable() {
+		return bolt.ErrTxNotWritable
+	}
+
+	seeds, err := createMetaBucket(tx, seedSubsystem)
+	if err != nil {
+		return err
+	}
+
+	for i := range records {
+		if records[i].ID == "" {
+			return errors.New("Seed records must have an ID")
+		}
+
+		if seeds.Get([]byte(records[i].ID)) != nil {
+			continue
+		}
+
+		err = s.insert(tx, records[i].Key, records[i].Data)
+		if err != nil && err != ErrKeyExists {
+			return err
+		}
+
+		err = seeds.Put([]byte(records[i].ID), []byte{})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,50 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package bolthold_test
+
+import (
+	"testing"
+
+	"github.com/timshannon/bolthold"
+)
+
+type Setting struct {
+	Name  string
+	Value string
+}
+
+func TestSeed(t *testing.T) {
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		seed := []bolthold.SeedRecord{
+			{ID: "theme", Key: "theme", Data: &Setting{Name: "theme", Value: "dark"}},
+			{ID: "page-size", Key: "pageSize", Data: &Setting{Name: "pageSize", Value: "50"}},
+		}
+
+		ok(t, store.Seed(seed...))
+
+		// seeded records are never inserted again, even after they've been changed or deleted
+		ok(t, store.Update("theme", &Setting{Name: "theme", Value: "light"}))
+		ok(t, store.Delete("pageSize", &Setting{}))
+		ok(t, store.Seed(seed...))
+
+		var setting Setting
+		ok(t, store.Get("theme", &setting))
+		equals(t, "light", setting.Value)
+		equals(t, bolthold.ErrNotFound, store.Get("pageSize", &setting))
+
+		// existing records aren't overwritten
+		ok(t, store.Insert("locale", &Setting{Name: "locale", Value: "fr"}))
+		ok(t, store.Seed(bolthold.SeedRecord{ID: "locale", Key: "locale", Data: &Setting{Value: "en"}}))
+		ok(t, store.Get("locale", &setting))
+		equals(t, "fr", setting.Value)
+
+		types, err := store.Buckets()
+		ok(t, err)
+		equals(t, 1, len(types))
+
+		assert(t, store.Seed(bolthold.SeedRecord{Key: "missing", Data: &Setting{}}) != nil,
+			"No error seeding a record without an ID")
+	})
+}
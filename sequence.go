@@ -0,0 +1,125 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package bolthold
+
+import (
+	"errors"
+	"math"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// NextSequence returns the next value of the sequence of dataType's type, the same sequence used by
+// Insert(bolthold.NextSequence(), data), so that IDs can be allocated before the records they're for are inserted
+func (s *Store) NextSequence(dataType interface{}) (uint64, error) {
+	var seq uint64
+	err := s.updateTx(func(tx *bolt.Tx) error {
+		var txErr error
+		seq, txErr = s.nextSequence(tx, dataType)
+		return txErr
+	})
+	return seq, err
+}
+
+// TxNextSequence is the same as NextSequence except it allows you to specify your own transaction
+func (s *Store) TxNextSequence(tx *bolt.Tx, dataType interface{}) (uint64, error) {
+	if !tx.Writable() {
+		return 0, bolt.ErrTxNotWritable
+	}
+	return s.nextSequence(tx, dataType)
+}
+
+// NextSequenceInBucket is the same as NextSequence but you get to specify your parent bucket
+func (s *Store) NextSequenceInBucket(parent *bolt.Bucket, dataType interface{}) (uint64, error) {
+	if !parent.Tx().Writable() {
+		return 0, bolt.ErrTxNotWritable
+	}
+	return s.nextSequence(parent, dataType)
+}
+
+func (s *Store) nextSequence(source BucketSource, dataType interface{}) (uint64, error) {
+	b, err := createRecordBucket(source, s.newStorer(dataType), dataType)
+	if err != nil {
+		return 0, err
+	}
+	return b.NextSequence()
+}
+
+// ReserveSequences reserves the next n values of the sequence of dataType's type, and returns the first of them, so
+// a range of IDs can be allocated at once.  The values from first to first+n-1 are never returned by NextSequence
+func (s *Store) ReserveSequences(dataType interface{}, n uint64) (uint64, error) {
+	var first uint64
+	err := s.updateTx(func(tx *bolt.Tx) error {
+		var txErr error
+		first, txErr = s.reserveSequences(tx, dataType, n)
+		return txErr
+	})
+	return first, err
+}
+
+// TxReserveSequences is the same as ReserveSequences except it allows you to specify your own transaction
+func (s *Store) TxReserveSequences(tx *bolt.Tx, dataType interface{}, n uint64) (uint64, error) {
+	if !tx.Writable() {
+		return 0, bolt.ErrTxNotWritable
+	}
+	return s.reserveSequences(tx, dataType, n)
+}
+
+// ReserveSequencesInBucket is the same as ReserveSequences but you get to specify your parent bucket
+func (s *Store) ReserveSequencesInBucket(parent *bolt.Bucket, dataType interface{}, n uint64) (uint64, error) {
+	if !parent.Tx().Writable() {
+		return 0, bolt.ErrTxNotWritable
+	}
+	return s.reserveSequences(parent, dataType, n)
+}
+
+func (s *Store) reserveSequences(source BucketSource, dataType interface{}, n uint64) (uint64, error) {
+	if n == 0 {
+		return 0, errors.New("At least one sequence must be reserved")
+	}
+
+	b, err := createRecordBucket(source, s.newStorer(dataType), dataType)
+	if err != nil {
+		return 0, err
+	}
+
+	current := b.parent.Sequence()
+	if current > math.MaxUint64-n {
+		return 0, errors.New("Reserving the sequences would overflow the sequence")
+	}
+	return current + 1, b.parent.SetSequence(current + n)
+}
+
+// SetSequence sets the sequence of dataType's type, so the next call to NextSequence returns n+1.  Setting the
+// sequence below the keys it has already generated means they can be generated again
+func (s *Store) SetSequence(dataType interface{}, n uint64) error {
+	return s.updateTx(func(tx *bolt.Tx) error {
+		return s.setSequence(tx, dataType, n)
+	})
+}
+
+// TxSetSequence is the same as SetSequence except it allows you to specify your own transaction
+func (s *Store) TxSetSequence(tx *bolt.Tx, dataType interface{}, n uint64) error {
+	if !tx.Writable() {
+		return bolt.ErrTxNotWritable
+	}
+	return s.setSequence(tx, dataType, n)
+}
+
+// SetSequenceInBucket is the same as SetSequence but you get to specify your parent bucket
+func (s *Store) SetSequenceInBucket(parent *bolt.Bucket, dataType interface{}, n uint64) error {
+	if !parent.Tx().Writable() {
+		return bolt.ErrTxNotWritable
+	}
+	return s.setSequence(parent, dataType, n)
+}
+
+func (s *Store) setSequence(source BucketSource, dataType interface{}, n uint64) error {
+	b, err := createRecordBucket(source, s.newStorer(dataType), dataType)
+	if err != nil {
+		return err
+	}
+	return b.parent.SetSequence(n)
+}
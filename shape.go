@@ -0,0 +1,200 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package bolthold
+
+import (
+	"encoding"
+	"encoding/gob"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// shapeSubsystem is the metadata bucket the shapes of types are kept in
+const shapeSubsystem = "shape"
+
+// ShapeChange describes how the fields of a type have changed since its shape was recorded.  Fields are named by
+// their path from the type, such as Address.Street, along with their type.  Encoders such as gob silently drop the
+// values of fields that have been removed or renamed when records are decoded, so they're lost the next time the
+// records are written
+type ShapeChange struct {
+	Type    string
+	Added   []string
+	Removed []string
+}
+
+// ErrShapeChanged is the error returned by Open when one of the Options.ShapeTypes no longer matches the shape
+// recorded for it, and there is no Options.OnShapeChange to accept it
+type ErrShapeChanged struct {
+	ShapeChange
+}
+
+func (e *ErrShapeChanged) Error() string {
+	return fmt.Sprintf("The fields of %s have changed since its records were written, added: %s, removed: %s",
+		e.Type, strings.Join(e.Added, ", "), strings.Join(e.Removed, ", "))
+}
+
+// CheckShape compares the fields of dataType's type with the shape recorded for it, and returns the changes, or nil
+// if it hasn't changed, or no shape has been recorded for it yet
+func (s *Store) CheckShape(dataType interface{}) (*ShapeChange, error) {
+	var change *ShapeChange
+	err := s.Bolt().View(func(tx *bolt.Tx) error {
+		change = checkShape(tx, s.newStorer(dataType).Type(), dataType)
+		return nil
+	})
+	return change, err
+}
+
+// RecordShape records the current fields of dataType's type as its shape, accepting any changes CheckShape reports
+func (s *Store) RecordShape(dataType interface{}) error {
+	return s.updateTx(func(tx *bolt.Tx) error {
+		return recordShape(tx, s.newStorer(dataType).Type(), dataType)
+	})
+}
+
+// checkShapes checks each of the types against their recorded shapes when the store is opened.  Changes are passed
+// to onChange, and recorded unless it returns an error, and types which have no recorded shape have their shape
+// recorded.  When the store is read only nothing is recorded
+func (s *Store) checkShapes(dataTypes []interface{}, onChange func(ShapeChange) error, readOnly bool) error {
+	for _, dataType := range dataTypes {
+		typeName := s.newStorer(dataType).Type()
+
+		var change *ShapeChange
+		recorded := false
+		err := s.Bolt().View(func(tx *bolt.Tx) error {
+			change = checkShape(tx, typeName, dataType)
+			recorded = storedShape(tx, typeName) != nil
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		if change != nil {
+			if onChange == nil {
+				return &ErrShapeChanged{*change}
+			}
+			err = onChange(*change)
+			if err != nil {
+				return err
+			}
+		}
+
+		if readOnly || (recorded && change == nil) {
+			continue
+		}
+		err = s.updateTx(func(tx *bolt.Tx) error {
+			return recordShape(tx, typeName, dataType)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkShape(tx *bolt.Tx, typeName string, dataType interface{}) *ShapeChange {
+	stored := storedShape(tx, typeName)
+	if stored == nil {
+		return nil
+	}
+
+	previous := make(map[string]bool)
+	for _, field := range strings.Split(string(stored), "\n") {
+		if field != "" {
+			previous[field] = true
+		}
+	}
+
+	change := &ShapeChange{Type: typeName}
+	for _, field := range typeShape(dataType) {
+		if previous[field] {
+			delete(previous, field)
+			continue
+		}
+		change.Added = append(change.Added, field)
+	}
+	for field := range previous {
+		change.Removed = append(change.Removed, field)
+	}
+	sort.Strings(change.Removed)
+
+	if len(change.Added) == 0 && len(change.Removed) == 0 {
+		return nil
+	}
+	return change
+}
+
+func storedShape(tx *bolt.Tx, typeName string) []byte {
+	meta := metaBucket(tx, shapeSubsystem)
+	if meta == nil {
+		return nil
+	}
+	return meta.Get([]byte(typeName))
+}
+
+func recordShape(tx *bolt.Tx, typeName string, dataType interface{}) error {
+	meta, err := createMetaBucket(tx, shapeSubsystem)
+	if err != nil {
+		return err
+	}
+	return meta.Put([]byte(typeName), []byte(strings.Join(typeShape(dataType), "\n")))
+}
+
+// typeShape returns the sorted paths and types of every exported field of the type, including the fields of nested
+// structs
+func typeShape(dataType interface{}) []string {
+	var fields []string
+	for _, field := range typeFields(reflect.TypeOf(dataType)) {
+		fields = append(fields, field.Path+" "+field.Type)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// typeFields returns every exported field of the type, including the fields of nested structs, in the order they're
+// declared
+func typeFields(tp reflect.Type) []FieldDescription {
+	var fields []FieldDescription
+	shapeFields(tp, "", make(map[reflect.Type]bool), &fields)
+	return fields
+}
+
+var (
+	gobEncoderType      = reflect.TypeOf((*gob.GobEncoder)(nil)).Elem()
+	binaryMarshalerType = reflect.TypeOf((*encoding.BinaryMarshaler)(nil)).Elem()
+)
+
+func shapeFields(tp reflect.Type, path string, visiting map[reflect.Type]bool, fields *[]FieldDescription) {
+	for tp.Kind() == reflect.Ptr || tp.Kind() == reflect.Slice || tp.Kind() == reflect.Array ||
+		tp.Kind() == reflect.Map {
+		tp = tp.Elem()
+	}
+
+	// types that encode themselves, such as time.Time, have no fields of their own to drop
+	if tp.Kind() != reflect.Struct || visiting[tp] || reflect.PtrTo(tp).Implements(gobEncoderType) ||
+		reflect.PtrTo(tp).Implements(binaryMarshalerType) {
+		return
+	}
+
+	visiting[tp] = true
+	defer delete(visiting, tp)
+
+	for i := 0; i < tp.NumField(); i++ {
+		field := tp.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		name := field.Name
+		if path != "" {
+			name = path + "." + name
+		}
+		*fields = append(*fields, FieldDescription{Path: name, Type: field.Type.String()})
+		shapeFields(field.Type, name, visiting, fields)
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package bolthold_test
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/timshannon/bolthold"
+	bolt "go.etcd.io/bbolt"
+)
+
+type Address struct {
+	Street string
+	City   string
+}
+
+func TestShapeChanges(t *testing.T) {
+	filename := tempfile()
+	defer os.Remove(filename)
+
+	{
+		type Tenant struct {
+			Name    string
+			Address Address
+			Since   time.Time
+		}
+
+		store, err := bolthold.Open(filename, 0666, &bolthold.Options{ShapeTypes: []interface{}{&Tenant{}}})
+		ok(t, err)
+		ok(t, store.Insert("ada", &Tenant{Name: "ada"}))
+		ok(t, store.Close())
+
+		// unchanged
+		store, err = bolthold.Open(filename, 0666, &bolthold.Options{ShapeTypes: []interface{}{&Tenant{}}})
+		ok(t, err)
+		ok(t, store.Close())
+	}
+
+	{
+		type Address struct {
+			Line1 string
+			City  string
+		}
+		type Tenant struct {
+			Name    string
+			Address Address
+			Since   time.Time
+			Email   string
+		}
+
+		_, err := bolthold.Open(filename, 0666, &bolthold.Options{ShapeTypes: []interface{}{&Tenant{}}})
+		changed, isChanged := err.(*bolthold.ErrShapeChanged)
+		assert(t, isChanged, "Open didn't return an ErrShapeChanged")
+		equals(t, bolthold.ShapeChange{
+			Type:    "Tenant",
+			Added:   []string{"Address.Line1 string", "Email string"},
+			Removed: []string{"Address.Street string"},
+		}, changed.ShapeChange)
+
+		store, err := bolthold.Open(filename, 0666, &bolthold.Options{Options: &bolt.Options{ReadOnly: true}})
+		ok(t, err)
+		change, err := store.CheckShape(&Tenant{})
+		ok(t, err)
+		equals(t, changed.ShapeChange, *change)
+		ok(t, store.Close())
+
+		failed := errors.New("failed")
+		reported := 0
+		_, err = bolthold.Open(filename, 0666, &bolthold.Options{
+			ShapeTypes: []interface{}{&Tenant{}},
+			OnShapeChange: func(change bolthold.ShapeChange) error {
+				reported++
+				return failed
+			},
+		})
+		equals(t, failed, err)
+
+		// accepting the change records the new shape
+		options := &bolthold.Options{
+			ShapeTypes: []interface{}{&Tenant{}},
+			OnShapeChange: func(change bolthold.ShapeChange) error {
+				reported++
+				return nil
+			},
+		}
+		store, err = bolthold.Open(filename, 0666, options)
+		ok(t, err)
+		ok(t, store.Close())
+		store, err = bolthold.Open(filename, 0666, options)
+		ok(t, err)
+		equals(t, 2, reported)
+
+		change, err = store.CheckShape(&Tenant{})
+		ok(t, err)
+		assert(t, change == nil, "shape still changed after it was recorded")
+
+		types, err := store.Buckets()
+		ok(t, err)
+		equals(t, 1, len(types))
+		ok(t, store.Close())
+	}
+}
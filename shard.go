@@ -0,0 +1,372 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package bolthold
+
+import (
+	"bytes"
+	"hash/fnv"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Sharded is an optional interface that a type can implement to spread its records across several buckets, picked
+// by a hash of each record's key.  Sharding keeps the B-trees of types with tens of millions of records shallower
+// and spreads writes across more pages.
+// The number of shards is fixed when the first record of the type is written, changing it afterwards has no effect
+// on an existing store.
+type Sharded interface {
+	Shards() int
+}
+
+const shardBucketPrefix = "_shard:"
+
+func shardBucketName(shard int) []byte {
+	return []byte(shardBucketPrefix + strconv.Itoa(shard))
+}
+
+// recordBucket is where the records of a type are stored.  For types that aren't sharded it is the single type
+// bucket, otherwise the records are stored in nested shard buckets under the type bucket.
+type recordBucket struct {
+	parent *bolt.Bucket
+	shards []*bolt.Bucket
+}
+
+// recordCursor is a cursor over the records of a type in key order
+type recordCursor interface {
+	First() (key []byte, value []byte)
+	Next() (key []byte, value []byte)
+	Seek(seek []byte) (key []byte, value []byte)
+}
+
+// getRecordBucket returns the record bucket for the storer's type, or nil if no records of the type have been
+// written yet
+func getRecordBucket(source BucketSource, storer Storer) *recordBucket {
+	parent := source.Bucket([]byte(storer.Type()))
+	if parent == nil {
+		return nil
+	}
+	return newRecordBucket(parent)
+}
+
+// createRecordBucket returns the record bucket for the storer's type, creating it and its shards if needed
+func createRecordBucket(source BucketSource, storer Storer, dataType interface{}) (*recordBucket, error) {
+	if parent := source.Bucket([]byte(storer.Type())); parent != nil {
+		return newRecordBucket(parent), nil
+	}
+
+	err := checkTypeName(storer.Type())
+	if err != nil {
+		return nil, err
+	}
+
+	parent, err := source.CreateBucketIfNotExists([]byte(storer.Type()))
+	if err != nil {
+		return nil, err
+	}
+
+	if sharded, ok := newElemType(dataType).(Sharded); ok && sharded.Shards() > 1 {
+		for i := 0; i < sharded.Shards(); i++ {
+			_, err = parent.CreateBucket(shardBucketName(i))
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return newRecordBucket(parent), nil
+}
+
+func newRecordBucket(parent *bolt.Bucket) *recordBucket {
+	r := &recordBucket{parent: parent}
+
+	for i := 0; ; i++ {
+		shard := parent.Bucket(shardBucketName(i))
+		if shard == nil {
+			break
+		}
+		r.shards = append(r.shards, shard)
+	}
+
+	if len(r.shards) == 0 {
+		r.shards = []*bolt.Bucket{parent}
+	}
+	return r
+}
+
+func (r *recordBucket) shard(key []byte) *bolt.Bucket {
+	if len(r.shards) == 1 {
+		return r.shards[0]
+	}
+	h := fnv.New32a()
+	_, _ = h.Write(key)
+	return r.shards[h.Sum32()%uint32(len(r.shards))]
+}
+
+func (r *recordBucket) Get(key []byte) []byte {
+	return r.shard(key).Get(key)
+}
+
+func (r *recordBucket) Put(key, value []byte) error {
+	return r.shard(key).Put(key, value)
+}
+
+func (r *recordBucket) Delete(key []byte) error {
+	return r.shard(key).Delete(key)
+}
+
+// NextSequence returns the next sequence of the type, which is shared by all shards
+func (r *recordBucket) NextSequence() (uint64, error) {
+	return r.parent.NextSequence()
+}
+
+// Count returns the number of records stored
+func (r *recordBucket) Count() int {
+	count := 0
+	for i := range r.shards {
+		count += r.shards[i].Stats().KeyN
+	}
+	return count
+}
+
+// ForEach calls fn for every record in key order
+func (r *recordBucket) ForEach(fn func(k, v []byte) error) error {
+	c := r.Cursor()
+	for k, v := c.First(); k != nil; k, v = c.Next() {
+		err := fn(k, v)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Cursor returns a cursor over all of the records in key order, merged across shards
+func (r *recordBucket) Cursor() recordCursor {
+	if len(r.shards) == 1 {
+		return r.shards[0].Cursor()
+	}
+
+	c := &shardCursor{
+		cursors: make([]*bolt.Cursor, len(r.shards)),
+		keys:    make([][]byte, len(r.shards)),
+		values:  make([][]byte, len(r.shards)),
+		current: -1,
+	}
+	for i := range r.shards {
+		c.cursors[i] = r.shards[i].Cursor()
+	}
+	return c
+}
+
+// shardCursor merges the cursors of each shard, always returning the smallest key any of them are positioned on,
+// or the largest when moving backwards
+type shardCursor struct {
+	cursors []*bolt.Cursor
+	keys    [][]byte
+	values  [][]byte
+	current int
+	reverse bool
+}
+
+func (c *shardCursor) First() ([]byte, []byte) {
+	c.reverse = false
+	for i := range c.cursors {
+		c.keys[i], c.values[i] = c.cursors[i].First()
+	}
+	return c.min()
+}
+
+func (c *shardCursor) Last() ([]byte, []byte) {
+	c.reverse = true
+	for i := range c.cursors {
+		c.keys[i], c.values[i] = c.cursors[i].Last()
+	}
+	return c.max()
+}
+
+func (c *shardCursor) Seek(seek []byte) ([]byte, []byte) {
+	c.reverse = false
+	for i := range c.cursors {
+		c.keys[i], c.values[i] = c.cursors[i].Seek(seek)
+	}
+	return c.min()
+}
+
+func (c *shardCursor) Next() ([]byte, []byte) {
+	if c.current < 0 {
+		return nil, nil
+	}
+	if !c.reverse {
+		c.keys[c.current], c.values[c.current] = c.cursors[c.current].Next()
+		return c.min()
+	}
+
+	// the other shards are positioned before the current key, so move each of them past it
+	current := c.keys[c.current]
+	c.reverse = false
+	for i := range c.cursors {
+		c.keys[i], c.values[i] = c.cursors[i].Seek(current)
+		if bytes.Equal(c.keys[i], current) {
+			c.keys[i], c.values[i] = c.cursors[i].Next()
+		}
+	}
+	return c.min()
+}
+
+func (c *shardCursor) Prev() ([]byte, []byte) {
+	if c.current < 0 {
+		return nil, nil
+	}
+	if c.reverse {
+		c.keys[c.current], c.values[c.current] = c.cursors[c.current].Prev()
+		return c.max()
+	}
+
+	// the other shards are positioned after the current key, so move each of them before it
+	current := c.keys[c.current]
+	c.reverse = true
+	for i := range c.cursors {
+		c.keys[i], c.values[i] = c.cursors[i].Seek(current)
+		if c.keys[i] == nil {
+			c.keys[i], c.values[i] = c.cursors[i].Last()
+		} else {
+			c.keys[i], c.values[i] = c.cursors[i].Prev()
+		}
+	}
+	return c.max()
+}
+
+func (c *shardCursor) min() ([]byte, []byte) {
+	c.current = -1
+	for i := range c.keys {
+		if c.keys[i] == nil {
+			continue
+		}
+		if c.current < 0 || bytes.Compare(c.keys[i], c.keys[c.current]) < 0 {
+			c.current = i
+		}
+	}
+	if c.current < 0 {
+		return nil, nil
+	}
+	return c.keys[c.current], c.values[c.current]
+}
+
+func (c *shardCursor) max() ([]byte, []byte) {
+	c.current = -1
+	for i := range c.keys {
+		if c.keys[i] == nil {
+			continue
+		}
+		if c.current < 0 || bytes.Compare(c.keys[i], c.keys[c.current]) > 0 {
+			c.current = i
+		}
+	}
+	if c.current < 0 {
+		return nil, nil
+	}
+	return c.keys[c.current], c.values[c.current]
+}
+
+// canScanParallel returns true if a full scan of the records for the query can be split across goroutines, one
+// per shard.  Bolt only allows reads from several goroutines in read-only transactions, and the records all have
+// to be scanned, so queries with a limit are left to stop early instead.
+func (s *Store) canScanParallel(source BucketSource, records *recordBucket, query *Query) bool {
+	if records == nil || len(records.shards) < 2 || query.limit != 0 {
+		return false
+	}
+
+	writable, ok := source.(interface{ Writable() bool })
+	if !ok || writable.Writable() {
+		return false
+	}
+
+	for _, criteria := range query.fieldCriteria {
+		if hasMatchFunc(criteria) {
+			// match funcs can run subqueries, and aren't expected to be safe to call concurrently
+			return false
+		}
+	}
+
+	return true
+}
+
+// scanParallel reads every shard in its own goroutine, and returns the records that match the query in key order
+func (s *Store) scanParallel(source BucketSource, storer Storer, records *recordBucket, query *Query) ([]*record, error) {
+	query.source = source
+
+	// cursors are created up front, as creating them updates the transaction's stats
+	cursors := make([]*bolt.Cursor, len(records.shards))
+	for i := range records.shards {
+		cursors[i] = records.shards[i].Cursor()
+	}
+
+	matched := make([][]*record, len(cursors))
+	errs := make([]error, len(cursors))
+
+	var wg sync.WaitGroup
+	for i := range cursors {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			matched[i], errs[i] = s.scanShard(storer, cursors[i], query)
+		}(i)
+	}
+	wg.Wait()
+
+	result := make([]*record, 0)
+	for i := range matched {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		result = append(result, matched[i]...)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return bytes.Compare(result[i].key, result[j].key) < 0
+	})
+
+	return result, nil
+}
+
+func (s *Store) scanShard(storer Storer, cursor *bolt.Cursor, query *Query) ([]*record, error) {
+	var matched []*record
+
+	for k, v := cursor.First(); k != nil; k, v = cursor.Next() {
+		val := reflect.New(query.dataType)
+		err := s.decodeRecord(storer, v, val.Interface())
+		if err != nil {
+			if s.undecodable(storer, query, k, err) {
+				continue
+			}
+			return nil, err
+		}
+
+		if query.index == Key && !query.badIndex {
+			// key criteria are normally handled by the key iterator
+			ok, err := matchesAllCriteria(s, query.fieldCriteria[Key], k, s.decodeKey, val.Interface())
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				continue
+			}
+		}
+
+		ok, err := query.matchesAllFields(s, k, val, val.Interface())
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			matched = append(matched, &record{key: k, value: val})
+		}
+	}
+
+	return matched, nil
+}
@@ -0,0 +1,118 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package bolthold_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/timshannon/bolthold"
+	bolt "go.etcd.io/bbolt"
+)
+
+type Reading struct {
+	ID     uint64 `boltholdKey:"ID"`
+	Sensor string `boltholdIndex:"Sensor"`
+	Value  int
+}
+
+func (r *Reading) Shards() int { return 4 }
+
+func TestShardedType(t *testing.T) {
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		for i := 0; i < 100; i++ {
+			ok(t, store.Insert(bolthold.NextSequence(), &Reading{
+				Sensor: fmt.Sprintf("sensor%d", i%5),
+				Value:  i,
+			}))
+		}
+
+		ok(t, store.Bolt().View(func(tx *bolt.Tx) error {
+			b := tx.Bucket([]byte("Reading"))
+			for i := 0; i < 4; i++ {
+				shard := b.Bucket([]byte(fmt.Sprintf("_shard:%d", i)))
+				if shard == nil {
+					return fmt.Errorf("shard %d wasn't created", i)
+				}
+				if shard.Stats().KeyN == 0 {
+					return fmt.Errorf("shard %d is empty", i)
+				}
+			}
+			return nil
+		}))
+
+		var reading Reading
+		ok(t, store.Get(uint64(10), &reading))
+		equals(t, 9, reading.Value)
+
+		// results are still in key order across shards
+		var result []Reading
+		ok(t, store.Find(&result, nil))
+		equals(t, 100, len(result))
+		for i := range result {
+			equals(t, uint64(i+1), result[i].ID)
+		}
+
+		var sensor []Reading
+		ok(t, store.Find(&sensor, bolthold.Where("Sensor").Eq("sensor2").Index("Sensor")))
+		equals(t, 20, len(sensor))
+
+		var last []Reading
+		ok(t, store.Find(&last, bolthold.Where(bolthold.Key).Ge(uint64(91))))
+		equals(t, 10, len(last))
+
+		ok(t, store.UpdateMatching(&Reading{}, bolthold.Where("Value").Lt(10), func(record interface{}) error {
+			record.(*Reading).Sensor = "retired"
+			return nil
+		}))
+		count, err := store.Count(&Reading{}, bolthold.Where("Sensor").Eq("retired").Index("Sensor"))
+		ok(t, err)
+		equals(t, 10, count)
+
+		ok(t, store.Delete(uint64(10), &Reading{}))
+		ok(t, store.DeleteMatching(&Reading{}, bolthold.Where("Sensor").Eq("sensor4")))
+
+		types, err := store.Buckets()
+		ok(t, err)
+		equals(t, 1, len(types))
+		equals(t, 81, types[0].Count)
+
+		ok(t, store.ReIndex(&Reading{}, nil))
+		problems, err := store.CheckIndexes(&Reading{}, false)
+		ok(t, err)
+		equals(t, 0, len(problems))
+	})
+}
+
+func TestShardedParallelScan(t *testing.T) {
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		for i := 0; i < 200; i++ {
+			ok(t, store.Insert(bolthold.NextSequence(), &Reading{
+				Sensor: fmt.Sprintf("sensor%d", i%5),
+				Value:  i,
+			}))
+		}
+
+		var result []Reading
+		ok(t, store.Find(&result, bolthold.Where("Value").Ge(50).And(bolthold.Key).Lt(uint64(151))))
+		equals(t, 100, len(result))
+		for i := range result {
+			equals(t, uint64(i+51), result[i].ID)
+		}
+
+		// the same query in a write transaction is scanned in a single goroutine
+		var writeResult []Reading
+		ok(t, store.Bolt().Update(func(tx *bolt.Tx) error {
+			return store.TxFind(tx, &writeResult,
+				bolthold.Where("Value").Ge(50).And(bolthold.Key).Lt(uint64(151)))
+		}))
+		equals(t, result, writeResult)
+
+		count, err := store.Count(&Reading{}, bolthold.Where("Sensor").Eq("sensor1").Or(
+			bolthold.Where("Value").Lt(10)))
+		ok(t, err)
+		equals(t, 48, count)
+	})
+}
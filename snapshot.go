@@ -0,0 +1,83 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package bolthold
+
+import (
+	bolt "go.etcd.io/bbolt"
+)
+
+// Snapshot is a read-only view of the store as it was when the snapshot was taken.  Every read sees the same data,
+// no matter what's written to the store in the meantime.  A Snapshot holds open a bolt read transaction, which
+// stops bolt from reusing the pages freed by later writes, so the file grows until the snapshot is closed.  Like
+// any bolt transaction, a Snapshot isn't safe for use by multiple goroutines
+type Snapshot struct {
+	store *Store
+	tx    *bolt.Tx
+}
+
+// Snapshot starts a read-only view of the store, which must be closed when it's no longer needed.  Writes which
+// need bolt to grow the file block until every open Snapshot is closed, so a Snapshot shouldn't be held open by a
+// goroutine which is waiting on a write
+//
+//	snap, err := store.Snapshot()
+//	if err != nil {
+//		return err
+//	}
+//	defer snap.Close()
+func (s *Store) Snapshot() (*Snapshot, error) {
+	tx, err := s.Bolt().Begin(false)
+	if err != nil {
+		return nil, err
+	}
+	return &Snapshot{
+		store: s,
+		tx:    tx,
+	}, nil
+}
+
+// Get is the same as Store.Get, read from the snapshot
+func (s *Snapshot) Get(key, result interface{}) error {
+	return s.store.TxGet(s.tx, key, result)
+}
+
+// Find is the same as Store.Find, read from the snapshot
+func (s *Snapshot) Find(result interface{}, query *Query) error {
+	return s.store.TxFind(s.tx, result, query)
+}
+
+// FindOne is the same as Store.FindOne, read from the snapshot
+func (s *Snapshot) FindOne(result interface{}, query *Query) error {
+	return s.store.TxFindOne(s.tx, result, query)
+}
+
+// Count is the same as Store.Count, read from the snapshot
+func (s *Snapshot) Count(dataType interface{}, query *Query) (int, error) {
+	return s.store.TxCount(s.tx, dataType, query)
+}
+
+// ForEach is the same as Store.ForEach, read from the snapshot
+func (s *Snapshot) ForEach(query *Query, fn interface{}) error {
+	return s.store.TxForEach(s.tx, query, fn)
+}
+
+// Cursor is the same as Store.TxCursor, read from the snapshot
+func (s *Snapshot) Cursor(dataType interface{}) *Cursor {
+	return s.store.TxCursor(s.tx, dataType)
+}
+
+// FindAggregate is the same as Store.FindAggregate, read from the snapshot
+func (s *Snapshot) FindAggregate(dataType interface{}, query *Query, groupBy ...string) ([]*AggregateResult, error) {
+	return s.store.TxFindAggregate(s.tx, dataType, query, groupBy...)
+}
+
+// Tx returns the snapshot's bolt transaction, for use with the Tx functions of the store
+func (s *Snapshot) Tx() *bolt.Tx {
+	return s.tx
+}
+
+// Close ends the snapshot
+func (s *Snapshot) Close() error {
+	return s.tx.Rollback()
+}
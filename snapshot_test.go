@@ -0,0 +1,67 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package bolthold_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/timshannon/bolthold"
+)
+
+func TestSnapshot(t *testing.T) {
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		insertTestData(t, store)
+
+		snap, err := store.Snapshot()
+		ok(t, err)
+
+		// writers which need to grow the file wait for the snapshot to close, so the writes are made from another
+		// goroutine, and the test only waits a while for them
+		written := make(chan error, 1)
+		go func() {
+			err := store.Delete(testData[0].Key, &ItemTest{})
+			if err == nil {
+				err = store.Insert(1000, ItemTest{Key: 1000, Name: "new", Category: "vehicle"})
+			}
+			written <- err
+		}()
+		select {
+		case err = <-written:
+			ok(t, err)
+			written <- nil
+		case <-time.After(time.Second):
+		}
+
+		var item ItemTest
+		ok(t, snap.Get(testData[0].Key, &item))
+		equals(t, testData[0].Name, item.Name)
+		equals(t, bolthold.ErrNotFound, snap.Get(1000, &item))
+
+		count, err := snap.Count(&ItemTest{}, nil)
+		ok(t, err)
+		equals(t, len(testData), count)
+
+		var vehicles []ItemTest
+		ok(t, snap.Find(&vehicles, bolthold.Where("Category").Eq("vehicle").Index("Category")))
+		for i := range vehicles {
+			assert(t, vehicles[i].Name != "new", "Snapshot found a record inserted after it was taken")
+		}
+
+		seen := 0
+		ok(t, snap.ForEach(nil, func(record *ItemTest) error {
+			seen++
+			return nil
+		}))
+		equals(t, len(testData), seen)
+
+		ok(t, snap.Close())
+		ok(t, <-written)
+
+		count, err = store.Count(&ItemTest{}, nil)
+		ok(t, err)
+		equals(t, len(testData), count)
+	})
+}
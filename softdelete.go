@@ -0,0 +1,145 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package bolthold
+
+import (
+	"reflect"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// BoltholdDeletedTag is the struct tag that turns on soft deletes for a type.  It must be on a bool or time.Time
+// field.  Delete and DeleteMatching set the field to true, or the current time, instead of removing the record.
+// Soft deleted records are left out of Get and query results unless the query is WithDeleted, and are removed for
+// good by PurgeDeleted.  Clearing the field with Update restores the record
+//
+//	Deleted time.Time `boltholdDeleted:""`
+const BoltholdDeletedTag = "boltholdDeleted"
+
+// softDeleter is implemented by storers of types with a boltholdDeleted field
+type softDeleter interface {
+	deletedField() string
+}
+
+// deletedField returns the name of the field with the boltholdDeleted tag
+func (t *anonStorer) deletedField() string {
+	return t.deleted
+}
+
+func hasSoftDelete(storer Storer) bool {
+	d, ok := storer.(softDeleter)
+	return ok && d.deletedField() != ""
+}
+
+// isSoftDeleted returns true if the record has been soft deleted
+func isSoftDeleted(storer Storer, value interface{}) bool {
+	if !hasSoftDelete(storer) {
+		return false
+	}
+
+	switch deleted := findIndexValue(storer.(softDeleter).deletedField(), value, BoltholdDeletedTag).(type) {
+	case bool:
+		return deleted
+	case time.Time:
+		return !deleted.IsZero()
+	}
+	return false
+}
+
+// markDeleted sets the record's boltholdDeleted field
+func markDeleted(storer Storer, value interface{}) {
+	field := reflect.Indirect(reflect.ValueOf(value)).FieldByName(storer.(softDeleter).deletedField())
+	if field.Kind() == reflect.Bool {
+		field.SetBool(true)
+	} else {
+		field.Set(reflect.ValueOf(time.Now()))
+	}
+}
+
+// softDelete writes the record with its boltholdDeleted field set, moving its index entries
+func (s *Store) softDelete(source BucketSource, storer Storer, b *recordBucket, key []byte,
+	value interface{}) error {
+	err := s.deleteIndexes(storer, source, key, value)
+	if err != nil {
+		return err
+	}
+
+	markDeleted(storer, value)
+	nextVersion(storer, value, recordVersion(storer, value))
+	timestamp(storer, value, nil, time.Now())
+
+	encoded, err := s.encodeRecord(storer, value)
+	if err != nil {
+		return err
+	}
+
+	s.writes.record(false, key, encoded)
+	s.changes.add(storer, key, true)
+	err = b.Put(key, encoded)
+	if err != nil {
+		return err
+	}
+
+	return s.addIndexes(storer, source, key, value)
+}
+
+// WithDeleted includes soft deleted records in the results of the query, see BoltholdDeletedTag
+func (q *Query) WithDeleted() *Query {
+	q.withDeleted = true
+	return q
+}
+
+// PurgeDeleted removes the soft deleted records of the type which match the query for good, and returns how many
+// were removed.  A nil query purges every soft deleted record
+func (s *Store) PurgeDeleted(dataType interface{}, query *Query) (int, error) {
+	count := 0
+	err := s.updateTx(func(tx *bolt.Tx) error {
+		var err error
+		count, err = s.TxPurgeDeleted(tx, dataType, query)
+		return err
+	})
+	return count, err
+}
+
+// TxPurgeDeleted is the same as PurgeDeleted except it allows you to specify your own transaction
+func (s *Store) TxPurgeDeleted(tx *bolt.Tx, dataType interface{}, query *Query) (int, error) {
+	if !tx.Writable() {
+		return 0, bolt.ErrTxNotWritable
+	}
+
+	storer := s.newStorer(dataType)
+	if !hasSoftDelete(storer) {
+		return 0, nil
+	}
+
+	query, err := s.prepQuery(dataType, query)
+	if err != nil {
+		return 0, err
+	}
+	query = query.clone()
+	query.withDeleted = true
+
+	var records []*record
+	err = s.runQuery(tx, dataType, query, nil, query.skip, func(r *record) error {
+		if isSoftDeleted(storer, r.value.Interface()) {
+			records = append(records, r)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	b := getRecordBucket(tx, storer)
+	for i := range records {
+		err = s.deleteRecord(tx, storer, b, records[i].key, records[i].value.Interface())
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(records), nil
+}
@@ -0,0 +1,110 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package bolthold_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/timshannon/bolthold"
+)
+
+type Note struct {
+	ID      int    `boltholdKey:"ID"`
+	Author  string `boltholdIndex:"Author"`
+	Text    string
+	Deleted time.Time `boltholdDeleted:""`
+}
+
+type Draft struct {
+	Title   string `boltholdIndex:"Title"`
+	Removed bool   `boltholdDeleted:""`
+}
+
+func insertNotes(t *testing.T, store *bolthold.Store) {
+	for i := 0; i < 6; i++ {
+		author := "alice"
+		if i%2 == 1 {
+			author = "bob"
+		}
+		ok(t, store.Insert(i, &Note{Author: author, Text: "note"}))
+	}
+}
+
+func TestSoftDelete(t *testing.T) {
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		insertNotes(t, store)
+
+		ok(t, store.Delete(0, &Note{}))
+		equals(t, bolthold.ErrNotFound, store.Get(0, &Note{}))
+		equals(t, bolthold.ErrNotFound, store.Delete(0, &Note{}))
+
+		exists, err := store.Exists(0, &Note{})
+		ok(t, err)
+		assert(t, !exists, "Soft deleted record exists")
+
+		count, err := store.DeleteMatchingCount(&Note{}, bolthold.Where("Author").Eq("bob").Index("Author"))
+		ok(t, err)
+		equals(t, 3, count)
+
+		var notes []Note
+		ok(t, store.Find(&notes, nil))
+		equals(t, 2, len(notes))
+
+		count, err = store.Count(&Note{}, bolthold.Where("Author").Eq("alice").Index("Author"))
+		ok(t, err)
+		equals(t, 2, count)
+
+		notes = nil
+		ok(t, store.Find(&notes, bolthold.Where("Author").Eq("alice").Index("Author").WithDeleted()))
+		equals(t, 3, len(notes))
+
+		notes = nil
+		ok(t, store.Find(&notes, bolthold.Where("Author").Eq("alice").
+			Or(bolthold.Where("Author").Eq("bob")).WithDeleted()))
+		equals(t, 6, len(notes))
+		for i := range notes {
+			equals(t, notes[i].ID == 0 || notes[i].Author == "bob", !notes[i].Deleted.IsZero())
+		}
+
+		// restore a record by clearing the field
+		ok(t, store.Update(1, &Note{ID: 1, Author: "bob", Text: "restored"}))
+		var note Note
+		ok(t, store.Get(1, &note))
+		equals(t, "restored", note.Text)
+
+		purged, err := store.PurgeDeleted(&Note{}, bolthold.Where("Author").Eq("bob"))
+		ok(t, err)
+		equals(t, 2, purged)
+
+		purged, err = store.PurgeDeleted(&Note{}, nil)
+		ok(t, err)
+		equals(t, 1, purged)
+
+		count, err = store.Count(&Note{}, bolthold.Where("ID").Ge(0).WithDeleted())
+		ok(t, err)
+		equals(t, 3, count)
+	})
+}
+
+func TestSoftDeleteBool(t *testing.T) {
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		ok(t, store.Insert("a", &Draft{Title: "a"}))
+		ok(t, store.Insert("b", &Draft{Title: "b"}))
+
+		var draft Draft
+		ok(t, store.Pop("a", &draft))
+		equals(t, bolthold.ErrNotFound, store.Pop("a", &draft))
+
+		var drafts []Draft
+		ok(t, store.Find(&drafts, bolthold.Where("Title").Eq("a").Index("Title").WithDeleted()))
+		equals(t, 1, len(drafts))
+		assert(t, drafts[0].Removed, "Draft wasn't marked as removed")
+
+		count, err := store.Count(&Draft{}, bolthold.Where("Title").Eq("a").Index("Title"))
+		ok(t, err)
+		equals(t, 0, count)
+	})
+}
@@ -0,0 +1,239 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package bolthold
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+	"time"
+)
+
+// sortable index keys are encoded so that their byte order matches the order of the values, which lets range
+// criteria seek to the first matching key and stop at the last, rather than reading the whole index
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// sortableIndexer is implemented by storers that know which of their indexes have sortable keys
+type sortableIndexer interface {
+	sortableIndex(indexName string) (reflect.Type, bool)
+}
+
+// isSortable returns true if values of the type can be encoded as sortable index keys
+func isSortable(tp reflect.Type) bool {
+	if tp == timeType {
+		return true
+	}
+	switch tp.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// encodeSortable encodes a number or time so that the encoded values sort in the same order as the values
+func encodeSortable(value interface{}) ([]byte, error) {
+	if t, ok := value.(time.Time); ok {
+		key := make([]byte, 12)
+		binary.BigEndian.PutUint64(key, uint64(t.Unix())^(1<<63))
+		binary.BigEndian.PutUint32(key[8:], uint32(t.Nanosecond()))
+		return key, nil
+	}
+
+	key := make([]byte, 8)
+	val := reflect.ValueOf(value)
+
+	switch val.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		// flip the sign bit so negative numbers sort first
+		binary.BigEndian.PutUint64(key, uint64(val.Int())^(1<<63))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		binary.BigEndian.PutUint64(key, val.Uint())
+	case reflect.Float32, reflect.Float64:
+		bits := math.Float64bits(val.Float())
+		if bits&(1<<63) != 0 {
+			// negative numbers sort in reverse
+			bits = ^bits
+		} else {
+			bits |= 1 << 63
+		}
+		binary.BigEndian.PutUint64(key, bits)
+	default:
+		return nil, fmt.Errorf("%T can't be encoded as a sortable index key", value)
+	}
+
+	return key, nil
+}
+
+// decodeSortable decodes a key encoded with encodeSortable into a value of the passed in type
+func decodeSortable(key []byte, tp reflect.Type) (interface{}, error) {
+	if tp == timeType {
+		if len(key) != 12 {
+			return nil, fmt.Errorf("Invalid sortable time key %x", key)
+		}
+		sec := int64(binary.BigEndian.Uint64(key) ^ (1 << 63))
+		return time.Unix(sec, int64(binary.BigEndian.Uint32(key[8:]))), nil
+	}
+
+	if len(key) != 8 {
+		return nil, fmt.Errorf("Invalid sortable key %x", key)
+	}
+	bits := binary.BigEndian.Uint64(key)
+	val := reflect.New(tp).Elem()
+
+	switch tp.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		val.SetInt(int64(bits ^ (1 << 63)))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		val.SetUint(bits)
+	case reflect.Float32, reflect.Float64:
+		if bits&(1<<63) != 0 {
+			bits &^= 1 << 63
+		} else {
+			bits = ^bits
+		}
+		val.SetFloat(math.Float64frombits(bits))
+	default:
+		return nil, fmt.Errorf("%s can't be decoded from a sortable index key", tp)
+	}
+
+	return val.Interface(), nil
+}
+
+// sortableIndexType returns the type of the values in the index if its keys are sortable
+func sortableIndexType(storer Storer, indexName string) (reflect.Type, bool) {
+	indexer, ok := storer.(sortableIndexer)
+	if !ok {
+		return nil, false
+	}
+	return indexer.sortableIndex(indexName)
+}
+
+// matchesSortable tests the sortable index key against the criteria.  The key is converted to the type of each
+// criterion's value, the same way a gob encoded key would be decoded into it, as long as the value isn't changed by
+// the conversion
+func matchesSortable(s *Store, criteria []*Criterion, key []byte, tp reflect.Type) (bool, error) {
+	value, err := decodeSortable(key, tp)
+	if err != nil {
+		return false, err
+	}
+
+	for _, c := range criteria {
+		target := c.value
+		if c.operator == in || c.operator == any || c.operator == all {
+			target = nil
+			if len(c.values) > 0 {
+				target = c.values[0]
+			}
+		}
+
+		testValue := value
+		if target != nil {
+			targetType := reflect.TypeOf(target)
+			if targetType != tp && isNumeric(targetType) && tp.ConvertibleTo(targetType) {
+				converted, ok := convertLossless(reflect.ValueOf(value), targetType)
+				if !ok {
+					return false, &ErrTypeMismatch{value, target}
+				}
+				testValue = converted.Interface()
+			}
+		}
+
+		ok, err := c.test(s, testValue, nil, nil)
+		if err != nil {
+			return false, err
+		}
+		if c.negate == ok {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+func isNumeric(tp reflect.Type) bool {
+	switch tp.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// convertLossless converts the numeric value to the type, and returns false if the conversion would change it, such
+// as by truncating a float to an integer, overflowing, or changing its sign
+func convertLossless(value reflect.Value, tp reflect.Type) (reflect.Value, bool) {
+	converted := value.Convert(tp)
+	if converted.Convert(value.Type()).Interface() != value.Interface() {
+		return converted, false
+	}
+
+	// conversions between signed and unsigned integers round trip even when they change the sign
+	switch {
+	case value.Kind() >= reflect.Int && value.Kind() <= reflect.Int64 && value.Int() < 0:
+		return converted, tp.Kind() < reflect.Uint || tp.Kind() > reflect.Uintptr
+	case converted.Kind() >= reflect.Int && converted.Kind() <= reflect.Int64 && converted.Int() < 0:
+		return converted, value.Kind() < reflect.Uint || value.Kind() > reflect.Uintptr
+	}
+	return converted, true
+}
+
+// seekRange positions the cursor on the first key of a sortable index that could match the criteria, and returns
+// the last key that could match, or nil if the range has no upper bound
+func (s *Store) seekRange(cursor recordCursor, criteria []*Criterion, tp reflect.Type) (key, value, upper []byte) {
+	if s.floatTolerance != 0 {
+		k, v := cursor.First()
+		return k, v, nil
+	}
+
+	var lower []byte
+
+	for _, c := range criteria {
+		if c.negate || c.epsilon != 0 || c.value == nil || reflect.TypeOf(c.value) != tp {
+			continue
+		}
+
+		bound, err := encodeSortable(c.value)
+		if err != nil {
+			continue
+		}
+
+		switch c.operator {
+		case eq:
+			lower = maxBound(lower, bound)
+			upper = minBound(upper, bound)
+		case gt, ge:
+			lower = maxBound(lower, bound)
+		case lt, le:
+			upper = minBound(upper, bound)
+		}
+	}
+
+	if lower == nil {
+		key, value = cursor.First()
+	} else {
+		key, value = cursor.Seek(lower)
+	}
+	return key, value, upper
+}
+
+func maxBound(current, bound []byte) []byte {
+	if current == nil || bytes.Compare(bound, current) > 0 {
+		return bound
+	}
+	return current
+}
+
+func minBound(current, bound []byte) []byte {
+	if current == nil || bytes.Compare(bound, current) < 0 {
+		return bound
+	}
+	return current
+}
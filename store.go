@@ -5,19 +5,51 @@
 package bolthold
 
 import (
+	"bytes"
 	"fmt"
 	"os"
 	"reflect"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	bolt "go.etcd.io/bbolt"
 )
 
 // Store is a bolthold wrapper around a bolt DB
 type Store struct {
-	db     *bolt.DB
-	encode EncodeFunc
-	decode DecodeFunc
+	db              *bolt.DB
+	encode          EncodeFunc
+	decode          DecodeFunc
+	encodeKey       EncodeFunc
+	decodeKey       DecodeFunc
+	rewriters       []QueryRewriter
+	collations      map[string]Collation
+	floatTolerance  float64
+	txMetricsHook   func(TxMetrics)
+	autoIndex       bool
+	sortableKeys    bool
+	parallelOrs     bool
+	orsRuns         sync.Map
+	beforeOrsReplay func()
+	skipUndecodable bool
+	onUndecodable   func(typeName string, key []byte, err error)
+	writes          *writeCounters
+	codecs          map[string]Codec
+	migrations      map[string]Migration
+	schemas         []TypeSchema
+	rewriteMigrated bool
+	migrated        *migratedRecords
+	compressor      Compressor
+	pageTokenKey    []byte
+
+	indexUsage indexUsage
+
+	preCommitHooks  []PreCommitHook
+	postCommitHooks []PostCommitHook
+	changes         *changeLog
+	deferredUnique  *deferredUnique
 }
 
 // Options allows you set different options from the defaults
@@ -25,23 +57,250 @@ type Store struct {
 type Options struct {
 	Encoder EncodeFunc
 	Decoder DecodeFunc
+
+	// KeyEncoder and KeyDecoder, if set, are used for record keys instead of Encoder and Decoder.  Records are
+	// stored in the order of their encoded keys, so an order preserving encoding such as OrderedKeyEncode lets
+	// range criteria on Key seek straight to the first match, and makes the keys readable by other tools.  Keys
+	// written with a different encoding can't be read, so they can't be changed on an existing store
+	KeyEncoder EncodeFunc
+	KeyDecoder DecodeFunc
+
+	// Compressor, if set, compresses record values before they're written.  Records written without compression
+	// are still read as they are, so it can be turned on for an existing store.  Keys and indexes aren't compressed
+	Compressor Compressor
+
+	// LockRetries is the number of additional attempts Open will make to acquire the file lock after the
+	// first attempt times out.  If the lock still can't be acquired an *ErrLockTimeout is returned
+	LockRetries int
+	// LockBackoff is the delay before the first retry, doubling on every retry after that
+	LockBackoff time.Duration
+
+	// MaxBatchSize and MaxBatchDelay, if set, override bolt's limits on how many calls to the Batch functions are
+	// coalesced into one transaction, and how long a call waits for others to join it
+	MaxBatchSize  int
+	MaxBatchDelay time.Duration
+
+	// FloatTolerance, if set, is the epsilon used when comparing float fields in queries, so that values within
+	// FloatTolerance of each other are considered equal.  EqApprox overrides it for a single criterion
+	FloatTolerance float64
+
+	// TxMetricsHook, if set, is called with the metrics of every write transaction run by bolthold, after it is
+	// committed.  Transactions passed in to the Tx functions are not reported
+	TxMetricsHook func(TxMetrics)
+
+	// SortableIndexKeys stores the keys of indexes on numeric and time.Time fields in an encoding that sorts in
+	// the same order as the values, so range criteria only read the part of the index they match.  Existing indexes
+	// must be rebuilt with ReIndex after turning this on
+	SortableIndexKeys bool
+
+	// EnableAutoIndex lets bolthold use indexes to narrow down the records read by queries that don't specify an
+	// index with Query.Index.  The indexes are trusted to be complete, so it shouldn't be turned on while an index is
+	// missing records, such as after RemoveIndex, while ReIndexOnline or ReIndexIncremental are running, or when an
+	// index tag has been added to a type without calling ReIndex
+	EnableAutoIndex bool
+
+	// ParallelOrs runs the Or'd queries of Find, Count and ForEach each in its own goroutine and read transaction,
+	// and merges their results, so large scans can use more than one core.  It only applies to queries without Skip,
+	// Limit or match funcs, and to the calls which begin their own transaction, not TxFind and the like.  The query
+	// is run normally if the store is written to while the Or'd queries are starting
+	ParallelOrs bool
+
+	// SkipUndecodable skips records which fail to decode in every query, instead of failing the query, so one
+	// corrupt or legacy record doesn't make the whole type unreadable.  Query.SkipUndecodable does the same for a
+	// single query
+	SkipUndecodable bool
+	// OnUndecodable, if set, is called with the type name, encoded key and decoding error of each record a query
+	// skips.  Parallel scans of sharded types may call it from several goroutines at once
+	OnUndecodable func(typeName string, key []byte, err error)
+
+	// DisableIndexStats turns off tracking of index usage for IndexStats and IndexUsage
+	DisableIndexStats bool
+
+	// UpgradeTypes are example types which are upgraded to the store's current layout by Open, see Store.Upgrade
+	UpgradeTypes []interface{}
+	// UpgradeProgress, if set, is called as Open upgrades each of the UpgradeTypes
+	UpgradeProgress func(UpgradeProgress)
+
+	// RewriteMigrated rewrites records written with an older version of their type, see RegisterMigration, with the
+	// current version the first time they're read, rather than the next time they're updated.  Records read in a
+	// writable transaction are rewritten by it, and those read outside of one are rewritten by the store's next
+	// write transaction
+	RewriteMigrated bool
+
+	// ShapeTypes are example types whose fields are checked by Open against the fields they had when the store was
+	// last opened, see Store.CheckShape
+	ShapeTypes []interface{}
+	// OnShapeChange, if set, is called by Open with the changes to any of the ShapeTypes, and the new shape is
+	// recorded unless it returns an error, which Open returns.  If it isn't set, Open returns an *ErrShapeChanged
+	OnShapeChange func(ShapeChange) error
+
+	// SchemaMigrations are registered with the store, and any that haven't been applied yet are run by Open, see
+	// Store.RunSchemaMigrations
+	SchemaMigrations []TypeSchema
+	// SchemaProgress, if set, is called as Open runs the SchemaMigrations
+	SchemaProgress func(SchemaProgress)
+
+	// Collations are the named collations available to the boltholdCollate struct tag, in addition to the
+	// built in collations
+	Collations map[string]Collation
+
+	// PageTokenKey, if set, is the secret used to sign the page tokens returned by FindPage with HMAC-SHA256, and
+	// FindPage returns ErrInvalidPageToken for tokens that weren't signed with it.  Changing it invalidates the
+	// tokens already handed out
+	PageTokenKey []byte
+
 	*bolt.Options
 }
 
+// defaultLockTimeout is how long each attempt to acquire the file lock waits when retries are enabled
+// and no bolt timeout is specified
+const defaultLockTimeout = time.Second
+
+// defaultLockBackoff is the delay before the first retry of acquiring the file lock
+const defaultLockBackoff = 100 * time.Millisecond
+
+// ErrLockTimeout is the error returned by Open when the lock on the bolt file could not be acquired after
+// all retries
+type ErrLockTimeout struct {
+	Filename string
+	Attempts int
+	PID      int // the process holding the lock, or 0 if it couldn't be determined
+}
+
+func (e *ErrLockTimeout) Error() string {
+	msg := fmt.Sprintf("Timed out acquiring the lock on %s after %d attempts", e.Filename, e.Attempts)
+	if e.PID != 0 {
+		msg += fmt.Sprintf(", the lock is held by process %d", e.PID)
+	}
+	return msg
+}
+
+// Unwrap returns bolt.ErrTimeout so ErrLockTimeout can be tested with errors.Is
+func (e *ErrLockTimeout) Unwrap() error {
+	return bolt.ErrTimeout
+}
+
 // Open opens or creates a bolthold file.
 func Open(filename string, mode os.FileMode, options *Options) (*Store, error) {
 	options = fillOptions(options)
 
-	db, err := bolt.Open(filename, mode, options.Options)
+	db, err := openBolt(filename, mode, options)
+	if err != nil {
+		return nil, err
+	}
+
+	if options.MaxBatchSize != 0 {
+		db.MaxBatchSize = options.MaxBatchSize
+	}
+	if options.MaxBatchDelay != 0 {
+		db.MaxBatchDelay = options.MaxBatchDelay
+	}
+
+	collations := map[string]Collation{
+		CollateNoCase: strings.ToLower,
+	}
+	for name, collation := range options.Collations {
+		collations[name] = collation
+	}
+
+	s := &Store{
+		db:              db,
+		encode:          options.Encoder,
+		decode:          options.Decoder,
+		encodeKey:       compositeKeyEncoder(options.KeyEncoder),
+		decodeKey:       compositeKeyDecoder(options.KeyDecoder),
+		collations:      collations,
+		floatTolerance:  options.FloatTolerance,
+		txMetricsHook:   options.TxMetricsHook,
+		autoIndex:       options.EnableAutoIndex,
+		sortableKeys:    options.SortableIndexKeys,
+		parallelOrs:     options.ParallelOrs,
+		skipUndecodable: options.SkipUndecodable,
+		onUndecodable:   options.OnUndecodable,
+		writes:          &writeCounters{},
+		codecs:          make(map[string]Codec),
+		migrations:      make(map[string]Migration),
+		rewriteMigrated: options.RewriteMigrated,
+		migrated:        &migratedRecords{pending: make(map[string]migratedRecord)},
+		compressor:      options.Compressor,
+		pageTokenKey:    options.PageTokenKey,
+		indexUsage: indexUsage{
+			disabled: options.DisableIndexStats,
+		},
+	}
+
+	err = s.checkShapes(options.ShapeTypes, options.OnShapeChange, options.Options != nil && options.ReadOnly)
 	if err != nil {
+		_ = db.Close()
 		return nil, err
 	}
 
-	return &Store{
-		db:     db,
-		encode: options.Encoder,
-		decode: options.Decoder,
-	}, nil
+	for _, schema := range options.SchemaMigrations {
+		err = s.RegisterSchemaMigrations(schema.Type, schema.Migrations...)
+		if err != nil {
+			_ = db.Close()
+			return nil, err
+		}
+	}
+
+	if options.Options == nil || !options.ReadOnly {
+		for _, exampleType := range options.UpgradeTypes {
+			err = s.Upgrade(exampleType, options.UpgradeProgress)
+			if err != nil {
+				_ = db.Close()
+				return nil, err
+			}
+		}
+
+		err = s.RunSchemaMigrations(options.SchemaProgress)
+		if err != nil {
+			_ = db.Close()
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// openBolt opens the bolt file, retrying with an exponential backoff if the file lock can't be acquired
+func openBolt(filename string, mode os.FileMode, options *Options) (*bolt.DB, error) {
+	if options.LockRetries <= 0 {
+		return bolt.Open(filename, mode, options.Options)
+	}
+
+	boltOptions := bolt.Options{}
+	if options.Options != nil {
+		boltOptions = *options.Options
+	}
+	if boltOptions.Timeout == 0 {
+		// without a timeout bolt would wait on the lock forever
+		boltOptions.Timeout = defaultLockTimeout
+	}
+
+	backoff := options.LockBackoff
+	if backoff <= 0 {
+		backoff = defaultLockBackoff
+	}
+
+	attempts := 0
+	for {
+		attempts++
+		db, err := bolt.Open(filename, mode, &boltOptions)
+		if err != bolt.ErrTimeout {
+			return db, err
+		}
+
+		if attempts > options.LockRetries {
+			return nil, &ErrLockTimeout{
+				Filename: filename,
+				Attempts: attempts,
+				PID:      lockHolder(filename),
+			}
+		}
+
+		time.Sleep(backoff)
+		backoff *= 2
+	}
 }
 
 // set any unspecified options to defaults
@@ -56,6 +315,12 @@ func fillOptions(options *Options) *Options {
 	if options.Decoder == nil {
 		options.Decoder = DefaultDecode
 	}
+	if options.KeyEncoder == nil {
+		options.KeyEncoder = options.Encoder
+	}
+	if options.KeyDecoder == nil {
+		options.KeyDecoder = options.Decoder
+	}
 
 	return options
 }
@@ -70,85 +335,386 @@ func (s *Store) Close() error {
 	return s.db.Close()
 }
 
-// ReIndex removes any existing indexes and adds all the indexes defined by the passed in datatype example
+// ReIndex removes any existing indexes and adds all the indexes defined by the passed in datatype example, including
+// any that were removed with DeleteIndex
 // This function allows you to index an already existing boltDB file, or refresh any missing indexes
 // if bucketName is nil, then we'll assume a bucketName of storer.Type()
 // if a bucketname is specified, then the data will be copied to the bolthold standard bucket of storer.Type()
 func (s *Store) ReIndex(exampleType interface{}, bucketName []byte) error {
 	storer := s.newStorer(exampleType)
 
-	return s.Bolt().Update(func(tx *bolt.Tx) error {
-		indexes := storer.Indexes()
-		// delete existing indexes
-		// TODO: Remove indexes not specified the storer index list?
-		// good for cleanup, bad for possible side effects
+	return s.updateTx(func(tx *bolt.Tx) error {
+		err := deleteIndexBuckets(tx, storer)
+		if err != nil {
+			return err
+		}
 
-		for indexName := range indexes {
-			err := tx.DeleteBucket(indexBucketName(storer.Type(), indexName))
-			if err != nil && err != bolt.ErrBucketNotFound {
-				return err
+		copyData := bucketName != nil
+
+		var c recordCursor
+		if copyData {
+			bucket := tx.Bucket(bucketName)
+			if bucket == nil {
+				// no data / nothing to do,
+				return nil
 			}
+			c = bucket.Cursor()
+		} else {
+			bucket := getRecordBucket(tx, storer)
+			if bucket == nil {
+				// no data / nothing to do,
+				return nil
+			}
+			c = bucket.Cursor()
 		}
 
-		sliceIndexes := storer.SliceIndexes()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			if copyData {
+				b, err := createRecordBucket(tx, storer, exampleType)
+				if err != nil {
+					return err
+				}
 
-		for indexName := range sliceIndexes {
-			err := tx.DeleteBucket(indexBucketName(storer.Type(), indexName))
-			if err != nil && err != bolt.ErrBucketNotFound {
+				s.writes.record(false, k, v)
+				err = b.Put(k, v)
+				if err != nil {
+					return err
+				}
+			}
+			err := s.decodeRecord(storer, v, exampleType)
+			if err != nil {
+				return err
+			}
+			err = s.addIndexes(storer, tx, k, exampleType)
+			if err != nil {
 				return err
 			}
 		}
 
-		copyData := true
+		return nil
+	})
+}
+
+// ReIndexIncremental is the same as ReIndex, except the records are indexed batchSize at a time, each batch in its
+// own transaction, so that writers are not blocked for the entire reindex of a large type.  progress, if not nil,
+// is called after each batch is committed with the total number of records indexed so far.
+// Queries run against the indexes before ReIndexIncremental returns may not see all records.
+func (s *Store) ReIndexIncremental(exampleType interface{}, batchSize int, progress func(indexed int)) error {
+	if batchSize <= 0 {
+		return fmt.Errorf("Batch size must be greater than 0")
+	}
 
-		if bucketName == nil {
-			bucketName = []byte(storer.Type())
-			copyData = false
+	return s.ReIndexOnline(exampleType, &ReIndexOptions{
+		BatchSize: batchSize,
+		Progress:  progress,
+	})
+}
+
+// ReIndexOptions control how ReIndexOnline rebuilds indexes
+type ReIndexOptions struct {
+	// BatchSize is the number of records indexed in each transaction, defaults to 1000
+	BatchSize int
+
+	// Progress, if not nil, is called after each batch is committed with the total number of records indexed so far
+	Progress func(indexed int)
+
+	// RecordsPerSecond limits how fast records are indexed, so other writers get a larger share of the store while
+	// indexes are built.  Zero means no limit
+	RecordsPerSecond int
+
+	// Indexes are the names of the indexes to build, for instance when a new index has been added to a type with
+	// existing records.  All of the type's indexes are rebuilt if empty
+	Indexes []string
+}
+
+const defaultReIndexBatchSize = 1000
+
+// ReIndexOnline rebuilds the indexes of a type while the store is in use.  Records are indexed a batch at a time,
+// each batch in its own transaction, optionally at a limited rate.
+// Queries run against the indexes being built before ReIndexOnline returns may not see all records.
+func (s *Store) ReIndexOnline(exampleType interface{}, options *ReIndexOptions) error {
+	if options == nil {
+		options = &ReIndexOptions{}
+	}
+
+	batchSize := options.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultReIndexBatchSize
+	}
+
+	storer := s.newStorer(exampleType)
+	if len(options.Indexes) > 0 {
+		var err error
+		storer, err = selectIndexes(storer, options.Indexes)
+		if err != nil {
+			return err
 		}
+	}
 
-		bucket := tx.Bucket(bucketName)
-		if bucket == nil {
-			// no data / nothing to do,
-			return nil
+	err := s.updateTx(func(tx *bolt.Tx) error {
+		return deleteIndexBuckets(tx, storer)
+	})
+	if err != nil {
+		return err
+	}
+
+	var lastKey []byte
+	indexed := 0
+	start := time.Now()
+
+	for {
+		if options.RecordsPerSecond > 0 {
+			// wait until the records indexed so far are within the rate limit
+			due := start.Add(time.Duration(indexed) * time.Second / time.Duration(options.RecordsPerSecond))
+			time.Sleep(time.Until(due))
 		}
 
-		c := bucket.Cursor()
+		count := 0
+		err = s.updateTx(func(tx *bolt.Tx) error {
+			bucket := getRecordBucket(tx, storer)
+			if bucket == nil {
+				return nil
+			}
 
-		for k, v := c.First(); k != nil; k, v = c.Next() {
-			if copyData {
-				b, err := tx.CreateBucketIfNotExists([]byte(storer.Type()))
+			c := bucket.Cursor()
+
+			var k, v []byte
+			if lastKey == nil {
+				k, v = c.First()
+			} else {
+				k, v = c.Seek(lastKey)
+				if bytes.Equal(k, lastKey) {
+					k, v = c.Next()
+				}
+			}
+
+			for ; k != nil && count < batchSize; k, v = c.Next() {
+				value := newElemType(exampleType)
+				err := s.decodeRecord(storer, v, value)
 				if err != nil {
 					return err
 				}
-
-				err = b.Put(k, v)
+				err = s.addIndexes(storer, tx, k, value)
 				if err != nil {
 					return err
 				}
+
+				// k is only valid for the life of the transaction
+				lastKey = append(lastKey[:0], k...)
+				count++
 			}
-			err := s.decode(v, exampleType)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		if count == 0 {
+			return nil
+		}
+
+		indexed += count
+		if options.Progress != nil {
+			options.Progress(indexed)
+		}
+	}
+}
+
+// selectedIndexes is a Storer limited to some of the indexes of another Storer
+type selectedIndexes struct {
+	Storer
+	indexes      map[string]Index
+	sliceIndexes map[string]SliceIndex
+}
+
+// selectIndexes returns a storer with only the named indexes of the passed in storer
+func selectIndexes(storer Storer, names []string) (Storer, error) {
+	selected := &selectedIndexes{
+		Storer:       storer,
+		indexes:      make(map[string]Index),
+		sliceIndexes: make(map[string]SliceIndex),
+	}
+
+	for _, name := range names {
+		if index, ok := storer.Indexes()[name]; ok {
+			selected.indexes[name] = index
+			continue
+		}
+		if index, ok := storer.SliceIndexes()[name]; ok {
+			selected.sliceIndexes[name] = index
+			continue
+		}
+		return nil, fmt.Errorf("The index %s does not exist on the type %s", name, storer.Type())
+	}
+
+	return selected, nil
+}
+
+func (s *selectedIndexes) Indexes() map[string]Index {
+	return s.indexes
+}
+
+func (s *selectedIndexes) SliceIndexes() map[string]SliceIndex {
+	return s.sliceIndexes
+}
+
+// deleteIndexBuckets removes all of the index buckets defined by the storer, and clears any indexes
+// deleted with DeleteIndex so they will be maintained again
+func deleteIndexBuckets(tx *bolt.Tx, storer Storer) error {
+	if dropped := metaBucket(tx, droppedIndexSubsystem); dropped != nil {
+		for indexName := range storer.Indexes() {
+			err := dropped.Delete(indexBucketName(storer.Type(), indexName))
 			if err != nil {
 				return err
 			}
-			err = s.addIndexes(storer, tx, k, exampleType)
+		}
+		for indexName := range storer.SliceIndexes() {
+			err := dropped.Delete(indexBucketName(storer.Type(), indexName))
 			if err != nil {
 				return err
 			}
 		}
+	}
+
+	// TODO: Remove indexes not specified the storer index list?
+	// good for cleanup, bad for possible side effects
+	for indexName := range storer.Indexes() {
+		err := tx.DeleteBucket(indexBucketName(storer.Type(), indexName))
+		if err != nil && err != bolt.ErrBucketNotFound {
+			return err
+		}
+	}
 
-		return nil
-	})
+	for indexName := range storer.SliceIndexes() {
+		err := tx.DeleteBucket(indexBucketName(storer.Type(), indexName))
+		if err != nil && err != bolt.ErrBucketNotFound {
+			return err
+		}
+	}
+
+	return nil
 }
 
 // RemoveIndex removes an index from the store.
 func (s *Store) RemoveIndex(dataType interface{}, indexName string) error {
 	storer := s.newStorer(dataType)
-	return s.Bolt().Update(func(tx *bolt.Tx) error {
+	return s.updateTx(func(tx *bolt.Tx) error {
 		return tx.DeleteBucket(indexBucketName(storer.Type(), indexName))
 
 	})
 }
 
+// QueryRewriter inspects a query before it is run, and returns the query to run in its place.  Returning an error
+// prevents the query from running at all.  dataType is an example of the type being queried.
+type QueryRewriter func(dataType interface{}, query *Query) (*Query, error)
+
+// UseQueryRewriter adds a rewriter to the chain run against every query in the store, including those run by
+// UpdateMatching, DeleteMatching, PurgeDeleted, Count, ForEach, FindAggregate and SubQuery.  A query's Or'd queries
+// are each passed to the rewriters separately, without their own Or'd queries.  Rewriters run in the order they were
+// added, and each receives a copy of the query, so the caller's query is never modified.
+// UseQueryRewriter is not safe to call while the store is running queries.
+func (s *Store) UseQueryRewriter(rewriter QueryRewriter) {
+	s.rewriters = append(s.rewriters, rewriter)
+}
+
+// RegisterCodec sets the codec used to encode and decode the records of dataType, in place of the store's encoder.
+// Types that implement Storer themselves choose their codec by implementing TypeCodec instead.  Records written with
+// another codec need to be rewritten after registering one.
+// RegisterCodec is not safe to call while the store is running queries.
+func (s *Store) RegisterCodec(dataType interface{}, codec Codec) {
+	tp := reflect.TypeOf(dataType)
+	for tp.Kind() == reflect.Ptr {
+		tp = tp.Elem()
+	}
+	s.codecs[tp.Name()] = codec
+}
+
+// TypeInfo describes a type stored in bolthold
+type TypeInfo struct {
+	Type    string
+	Count   int // number of records stored
+	Indexes []IndexInfo
+}
+
+// IndexInfo describes an index on a stored type
+type IndexInfo struct {
+	Name    string
+	Entries int // number of distinct values in the index
+}
+
+// Buckets returns every type stored in the bolthold along with its indexes, sorted by type name.  All top level
+// buckets not used internally by bolthold are treated as types.
+func (s *Store) Buckets() ([]TypeInfo, error) {
+	var types []TypeInfo
+	indexes := make(map[string][]IndexInfo)
+
+	err := s.Bolt().View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, bucket *bolt.Bucket) error {
+			parts := strings.SplitN(string(name), ":", 3)
+			if len(parts) == 3 && parts[0] == indexBucketPrefix {
+				indexes[parts[1]] = append(indexes[parts[1]], IndexInfo{
+					Name:    parts[2],
+					Entries: bucket.Stats().KeyN,
+				})
+				return nil
+			}
+
+			if isReserved(name) {
+				// internal bucket
+				return nil
+			}
+
+			types = append(types, TypeInfo{
+				Type:  string(name),
+				Count: newRecordBucket(bucket).Count(),
+			})
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// buckets are iterated in order, so types and indexes are already sorted
+	for i := range types {
+		types[i].Indexes = indexes[types[i].Type]
+	}
+
+	return types, nil
+}
+
+// Indexes returns every index defined on the passed in datatype, sorted by name.  Indexes that haven't been built
+// have no entries.
+func (s *Store) Indexes(dataType interface{}) ([]IndexInfo, error) {
+	storer := s.newStorer(dataType)
+
+	var names []string
+	for name := range storer.Indexes() {
+		names = append(names, name)
+	}
+	for name := range storer.SliceIndexes() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	result := make([]IndexInfo, len(names))
+
+	err := s.Bolt().View(func(tx *bolt.Tx) error {
+		for i := range names {
+			result[i].Name = names[i]
+			if bucket := tx.Bucket(indexBucketName(storer.Type(), names[i])); bucket != nil {
+				result[i].Entries = bucket.Stats().KeyN
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
 // Storer is the Interface to implement to skip reflect calls on all data passed into the bolthold
 type Storer interface {
 	Type() string                        // used as the boltdb bucket name
@@ -156,11 +722,60 @@ type Storer interface {
 	SliceIndexes() map[string]SliceIndex // [indexname]sliceIndexFunc
 }
 
+// Keyer can be implemented by a Storer, or by any type, to derive the key of a record from the record itself, such as
+// a natural key made of some of its fields.  Records of the type can then be written with AutoKey in place of a key
+type Keyer interface {
+	Key(record interface{}) (interface{}, error)
+}
+
+// Immutable can be implemented by a type to mark it as write-once.  Records of an immutable type can only be
+// Inserted, any attempt to Update, Upsert over, or Delete an existing record returns an *ErrImmutable.
+// Immutable is called against the zero value of the type, so its result should not depend on the record.
+type Immutable interface {
+	Immutable() bool
+}
+
+// ErrImmutable is the error returned when trying to change or remove a record of an Immutable type
+type ErrImmutable struct {
+	Type      string
+	Operation string
+}
+
+func (e *ErrImmutable) Error() string {
+	return fmt.Sprintf("Cannot %s a record of type %s, it is immutable", e.Operation, e.Type)
+}
+
+// checkMutable returns an *ErrImmutable if the passed in datatype is immutable
+func checkMutable(storer Storer, dataType interface{}, operation string) error {
+	im, ok := newElemType(dataType).(Immutable)
+	if !ok || !im.Immutable() {
+		return nil
+	}
+	return &ErrImmutable{
+		Type:      storer.Type(),
+		Operation: operation,
+	}
+}
+
 // anonType is created from a reflection of an unknown interface. This is the default storer used
 type anonStorer struct {
 	rType        reflect.Type
 	indexes      map[string]Index
 	sliceIndexes map[string]SliceIndex
+	collations   map[string]Collation
+	fieldIndexes map[string]fieldIndex
+	omitZeros    map[string]interface{}
+	sortable     map[string]reflect.Type
+	geoIndexes   map[string]bool
+	uniqueFields map[string][]string
+	transient    map[string]bool
+	expires      string
+	deleted      string
+	version      string
+	created      string
+	updated      string
+	codec        Codec
+	migration    Migration
 }
 
 // Type returns the name of the type as determined from the reflect package
@@ -178,6 +793,54 @@ func (t *anonStorer) SliceIndexes() map[string]SliceIndex {
 	return t.sliceIndexes
 }
 
+// IndexCollation returns the collation used by the index, as specified by the boltholdCollate tag
+func (t *anonStorer) IndexCollation(indexName string) Collation {
+	return t.collations[indexName]
+}
+
+// sortableIndex returns the type of the field of an index stored with sortable keys
+func (t *anonStorer) sortableIndex(indexName string) (reflect.Type, bool) {
+	tp, ok := t.sortable[indexName]
+	return tp, ok
+}
+
+// Codec returns the codec registered for the type with RegisterCodec
+func (t *anonStorer) Codec() Codec {
+	return t.codec
+}
+
+// UniqueIndexes returns the names of the constraints defined with the boltholdUnique tag
+func (t *anonStorer) UniqueIndexes() []string {
+	names := make([]string, 0, len(t.uniqueFields))
+	for name := range t.uniqueFields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// isGeoIndex returns true if the index was defined with the boltholdGeoIndex tag
+func (t *anonStorer) isGeoIndex(indexName string) bool {
+	return t.geoIndexes[indexName]
+}
+
+// expireField returns the name of the field with the boltholdExpire tag
+func (t *anonStorer) expireField() string {
+	return t.expires
+}
+
+// OmittedZero returns the zero value of the field of an index with the boltholdOmitZero tag
+func (t *anonStorer) OmittedZero(indexName string) (interface{}, bool) {
+	zero, ok := t.omitZeros[indexName]
+	return zero, ok
+}
+
+// fieldIndex returns the index that holds the plain, encoded value of the field, if there is one
+func (t *anonStorer) fieldIndex(field string) (fieldIndex, bool) {
+	index, ok := t.fieldIndexes[field]
+	return index, ok
+}
+
 // newStorer creates a type which satisfies the Storer interface based on reflection of the passed in dataType
 // if the Type doesn't meet the requirements of a Storer (i.e. doesn't have a name) it panics
 // You can avoid any reflection costs, by implementing the Storer interface on a type
@@ -198,6 +861,15 @@ func (s *Store) newStorer(dataType interface{}) Storer {
 		rType:        tp,
 		indexes:      make(map[string]Index),
 		sliceIndexes: make(map[string]SliceIndex),
+		collations:   make(map[string]Collation),
+		fieldIndexes: make(map[string]fieldIndex),
+		omitZeros:    make(map[string]interface{}),
+		sortable:     make(map[string]reflect.Type),
+		geoIndexes:   make(map[string]bool),
+		uniqueFields: make(map[string][]string),
+		transient:    make(map[string]bool),
+		codec:        s.codecs[tp.Name()],
+		migration:    s.migrations[tp.Name()],
 	}
 
 	if storer.rType.Name() == "" {
@@ -212,10 +884,28 @@ func (s *Store) newStorer(dataType interface{}) Storer {
 		storer.addIndex(storer.rType.Field(i), s)
 	}
 
+	for name, fields := range storer.uniqueFields {
+		if _, ok := storer.indexes[name]; ok {
+			panic(fmt.Sprintf("The unique constraint %s has the same name as an index", name))
+		}
+		storer.indexes[name] = compositeIndex(fields, s)
+	}
+
 	return storer
 }
 
 func (t *anonStorer) addIndex(field reflect.StructField, store *Store) {
+	if isTransient(field) {
+		for _, tag := range []string{BoltholdIndexTag, BoltholdSliceIndexTag, BoltholdUniqueTag, BoltholdGeoIndexTag,
+			BoltholdExpireTag, BoltholdDeletedTag, BoltholdVersionTag, BoltholdCreatedTag, BoltholdUpdatedTag} {
+			if strings.Contains(string(field.Tag), tag) {
+				panic(fmt.Sprintf("The field %s isn't stored, so it can't have the %s tag", field.Name, tag))
+			}
+		}
+		t.transient[field.Name] = true
+		return
+	}
+
 	if field.Anonymous {
 		anonType := field.Type
 		if anonType.Kind() == reflect.Ptr {
@@ -227,6 +917,65 @@ func (t *anonStorer) addIndex(field reflect.StructField, store *Store) {
 		return
 	}
 
+	filter := t.indexFilter(field)
+
+	if name, ok := field.Tag.Lookup(BoltholdUniqueTag); ok {
+		if name == "" {
+			name = field.Name
+		}
+		t.uniqueFields[name] = append(t.uniqueFields[name], field.Name)
+	}
+
+	if indexName, ok := field.Tag.Lookup(BoltholdGeoIndexTag); ok {
+		if field.Type != reflect.TypeOf(GeoPoint{}) && field.Type != reflect.TypeOf(&GeoPoint{}) {
+			panic(fmt.Sprintf("The geo index field %s must be a bolthold.GeoPoint", field.Name))
+		}
+		if indexName == "" {
+			indexName = field.Name
+		}
+		t.geoIndexes[indexName] = true
+		t.indexes[indexName] = geoIndex(indexName)
+	}
+
+	if _, ok := field.Tag.Lookup(BoltholdVersionTag); ok {
+		switch field.Type.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		default:
+			panic(fmt.Sprintf("The version field %s must be an integer", field.Name))
+		}
+		t.version = field.Name
+	}
+
+	if _, ok := field.Tag.Lookup(BoltholdCreatedTag); ok {
+		if field.Type != reflect.TypeOf(time.Time{}) {
+			panic(fmt.Sprintf("The created field %s must be a time.Time", field.Name))
+		}
+		t.created = field.Name
+	}
+
+	if _, ok := field.Tag.Lookup(BoltholdUpdatedTag); ok {
+		if field.Type != reflect.TypeOf(time.Time{}) {
+			panic(fmt.Sprintf("The updated field %s must be a time.Time", field.Name))
+		}
+		t.updated = field.Name
+	}
+
+	if _, ok := field.Tag.Lookup(BoltholdDeletedTag); ok {
+		if field.Type != reflect.TypeOf(true) && field.Type != reflect.TypeOf(time.Time{}) {
+			panic(fmt.Sprintf("The deleted field %s must be a bool or a time.Time", field.Name))
+		}
+		t.deleted = field.Name
+	}
+
+	if _, ok := field.Tag.Lookup(BoltholdExpireTag); ok {
+		if field.Type != reflect.TypeOf(time.Time{}) {
+			panic(fmt.Sprintf("The expire field %s must be a time.Time", field.Name))
+		}
+		t.expires = field.Name
+		t.indexes[expireIndexName] = expireIndex(field.Name)
+	}
+
 	if strings.Contains(string(field.Tag), BoltholdIndexTag) {
 		indexName := field.Tag.Get(BoltholdIndexTag)
 
@@ -234,12 +983,58 @@ func (t *anonStorer) addIndex(field reflect.StructField, store *Store) {
 			indexName = field.Name
 		}
 
-		t.indexes[indexName] = func(name string, value interface{}) ([]byte, error) {
-			val := findIndexValue(name, value, BoltholdIndexTag)
-			if val == nil {
-				return nil, nil
+		if isMultiEntry(field.Type) {
+			// slices get one index entry per element rather than one for the encoded slice
+			t.sliceIndexes[indexName] = filterSliceIndex(filter, sliceIndexFunc(BoltholdIndexTag, store))
+		} else {
+			var collation Collation
+			if collationName, ok := field.Tag.Lookup(BoltholdCollateTag); ok {
+				collation, ok = store.collations[collationName]
+				if !ok {
+					panic(fmt.Sprintf("The collation %s on the field %s is not defined", collationName,
+						field.Name))
+				}
+				t.collations[indexName] = collation
+			}
+
+			_, omitZero := field.Tag.Lookup(BoltholdOmitZeroTag)
+			if omitZero {
+				t.omitZeros[indexName] = reflect.Zero(field.Type).Interface()
+			}
+
+			sortable := store.sortableKeys && collation == nil && isSortable(field.Type)
+			if sortable {
+				t.sortable[indexName] = field.Type
+			}
+
+			if collation == nil && filter == nil {
+				t.fieldIndexes[field.Name] = fieldIndex{
+					name:      indexName,
+					fieldType: field.Type,
+					omitZero:  omitZero,
+					sortable:  sortable,
+				}
+			}
+
+			t.indexes[indexName] = func(name string, value interface{}) ([]byte, error) {
+				if filter != nil && !filter(value) {
+					return nil, nil
+				}
+				val := findIndexValue(name, value, BoltholdIndexTag)
+				if val == nil {
+					return nil, nil
+				}
+				if omitZero && reflect.ValueOf(val).IsZero() {
+					return nil, nil
+				}
+				if collation != nil {
+					val = collateValue(collation, val)
+				}
+				if sortable {
+					return encodeSortable(val)
+				}
+				return store.encode(val)
 			}
-			return store.encode(val)
 		}
 	}
 	if strings.Contains(string(field.Tag), BoltholdSliceIndexTag) {
@@ -249,37 +1044,92 @@ func (t *anonStorer) addIndex(field reflect.StructField, store *Store) {
 			indexName = field.Name
 		}
 
-		t.sliceIndexes[indexName] = func(name string, value interface{}) ([][]byte, error) {
-			val := reflect.ValueOf(value)
-			for val.Kind() == reflect.Ptr {
-				if val.IsNil() {
-					return nil, nil
-				}
-				val = val.Elem()
-			}
+		t.sliceIndexes[indexName] = filterSliceIndex(filter, sliceIndexFunc(BoltholdSliceIndexTag, store))
+	}
+}
+
+// indexFilter returns the filter specified by the boltholdFilter tag on the field, or nil if there isn't one.
+// The filter is a method of the type with the signature func() bool, and only records for which it returns true
+// are included in the index
+func (t *anonStorer) indexFilter(field reflect.StructField) func(value interface{}) bool {
+	name, ok := field.Tag.Lookup(BoltholdFilterTag)
+	if !ok {
+		return nil
+	}
+
+	method, ok := reflect.PtrTo(t.rType).MethodByName(name)
+	if !ok || method.Type.NumIn() != 1 || method.Type.NumOut() != 1 ||
+		method.Type.Out(0).Kind() != reflect.Bool {
+		panic(fmt.Sprintf("The filter %s on the field %s must be a method of %s of the form func() bool", name,
+			field.Name, t.rType))
+	}
+
+	return func(value interface{}) bool {
+		val := reflect.ValueOf(value)
+		if val.Kind() == reflect.Ptr && val.IsNil() {
+			return false
+		}
+		if val.Kind() != reflect.Ptr {
+			// the method may have a pointer receiver
+			ptr := reflect.New(val.Type())
+			ptr.Elem().Set(val)
+			val = ptr
+		}
+		return val.MethodByName(name).Call(nil)[0].Bool()
+	}
+}
+
+// filterSliceIndex only runs the slice index for values which pass the filter
+func filterSliceIndex(filter func(value interface{}) bool, index SliceIndex) SliceIndex {
+	if filter == nil {
+		return index
+	}
+	return func(name string, value interface{}) ([][]byte, error) {
+		if !filter(value) {
+			return nil, nil
+		}
+		return index(name, value)
+	}
+}
+
+// isMultiEntry returns true if a field of the passed in type should have each of its elements indexed separately
+// []byte is treated as a single value
+func isMultiEntry(fieldType reflect.Type) bool {
+	return fieldType.Kind() == reflect.Slice && fieldType.Elem().Kind() != reflect.Uint8
+}
 
-			fldValue := findIndexValue(name, value, BoltholdSliceIndexTag)
-			if fldValue == nil {
+// sliceIndexFunc returns a SliceIndex which indexes each item in the slice field tagged with the passed in tag
+func sliceIndexFunc(tag string, store *Store) SliceIndex {
+	return func(name string, value interface{}) ([][]byte, error) {
+		val := reflect.ValueOf(value)
+		for val.Kind() == reflect.Ptr {
+			if val.IsNil() {
 				return nil, nil
 			}
-			fld := reflect.ValueOf(fldValue)
+			val = val.Elem()
+		}
 
-			if fld.Kind() != reflect.Slice {
-				return nil, fmt.Errorf("Type %s is not a slice", fld.Type())
-			}
+		fldValue := findIndexValue(name, value, tag)
+		if fldValue == nil {
+			return nil, nil
+		}
+		fld := reflect.ValueOf(fldValue)
 
-			indexValue := make(keyList, 0)
+		if fld.Kind() != reflect.Slice {
+			return nil, fmt.Errorf("Type %s is not a slice", fld.Type())
+		}
 
-			for i := 0; i < fld.Len(); i++ {
-				b, err := store.encode(fld.Index(i).Interface())
-				if err != nil {
-					return nil, err
-				}
-				indexValue.add(b)
-			}
+		indexValue := make(keyList, 0)
 
-			return indexValue, nil
+		for i := 0; i < fld.Len(); i++ {
+			b, err := store.encode(fld.Index(i).Interface())
+			if err != nil {
+				return nil, err
+			}
+			indexValue.add(b)
 		}
+
+		return indexValue, nil
 	}
 }
 
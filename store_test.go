@@ -6,13 +6,16 @@ package bolthold_test
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"reflect"
 	"runtime"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/timshannon/bolthold"
 	bolt "go.etcd.io/bbolt"
@@ -29,6 +32,26 @@ func TestOpen(t *testing.T) {
 	defer os.Remove(filename)
 }
 
+func TestOpenLockRetry(t *testing.T) {
+	filename := tempfile()
+	store, err := bolthold.Open(filename, 0666, nil)
+	ok(t, err)
+	defer os.Remove(filename)
+	defer store.Close()
+
+	_, err = bolthold.Open(filename, 0666, &bolthold.Options{
+		LockRetries: 2,
+		LockBackoff: time.Millisecond,
+		Options:     &bolt.Options{Timeout: 10 * time.Millisecond},
+	})
+
+	lockErr, isLockErr := err.(*bolthold.ErrLockTimeout)
+	assert(t, isLockErr, "Open did not return ErrLockTimeout: %s", err)
+	equals(t, 3, lockErr.Attempts)
+	equals(t, filename, lockErr.Filename)
+	assert(t, errors.Is(err, bolt.ErrTimeout), "ErrLockTimeout does not unwrap to bolt.ErrTimeout")
+}
+
 func TestBolt(t *testing.T) {
 	testWrap(t, func(store *bolthold.Store, t *testing.T) {
 		b := store.Bolt()
@@ -66,6 +89,41 @@ func TestRemoveIndex(t *testing.T) {
 	})
 }
 
+func TestDeleteIndex(t *testing.T) {
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		insertTestData(t, store)
+		var item ItemTest
+
+		iName := indexName("ItemTest", "Category")
+
+		ok(t, store.DeleteIndex(item, "Category"))
+
+		// writes must not rebuild the deleted index
+		ok(t, store.Insert(1000, &ItemTest{Key: 1000, Category: "vehicle"}))
+		ok(t, store.Bolt().View(func(tx *bolt.Tx) error {
+			if tx.Bucket(iName) != nil {
+				return fmt.Errorf("index %s was rebuilt after being deleted", iName)
+			}
+			if tx.Bucket(indexName("ItemTest", "UpdateIndex")) == nil {
+				return fmt.Errorf("other indexes are no longer maintained")
+			}
+			return nil
+		}))
+
+		var result []ItemTest
+		assert(t, store.Find(&result, bolthold.Where("Category").Eq("vehicle").Index("Category")) != nil,
+			"No error querying a deleted index")
+
+		ok(t, store.ReIndex(&item, nil))
+		ok(t, store.Insert(1001, &ItemTest{Key: 1001, Category: "vehicle"}))
+
+		var expected []ItemTest
+		ok(t, store.Find(&expected, bolthold.Where("Category").Eq("vehicle")))
+		ok(t, store.Find(&result, bolthold.Where("Category").Eq("vehicle").Index("Category")))
+		equals(t, len(expected), len(result))
+	})
+}
+
 func TestReIndex(t *testing.T) {
 	testWrap(t, func(store *bolthold.Store, t *testing.T) {
 		insertTestData(t, store)
@@ -90,6 +148,113 @@ func TestReIndex(t *testing.T) {
 	})
 }
 
+func TestReIndexIncremental(t *testing.T) {
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		insertTestData(t, store)
+		var item ItemTest
+
+		ok(t, store.RemoveIndex(item, "Category"))
+
+		var progress []int
+		ok(t, store.ReIndexIncremental(&item, 5, func(indexed int) {
+			progress = append(progress, indexed)
+		}))
+
+		assert(t, len(progress) == (len(testData)+4)/5, "Unexpected number of batches: %v", progress)
+		equals(t, len(testData), progress[len(progress)-1])
+
+		var result []ItemTest
+		ok(t, store.Find(&result, bolthold.Where("Category").Eq("vehicle").Index("Category")))
+
+		var expected []ItemTest
+		ok(t, store.Find(&expected, bolthold.Where("Category").Eq("vehicle")))
+		equals(t, len(expected), len(result))
+
+		assert(t, store.ReIndexIncremental(&item, 0, nil) != nil, "No error on a batch size of 0")
+	})
+}
+
+func TestReIndexOnline(t *testing.T) {
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		insertTestData(t, store)
+		var item ItemTest
+
+		ok(t, store.RemoveIndex(item, "Category"))
+		ok(t, store.DeleteIndex(item, "UpdateIndex"))
+
+		var progress []int
+		start := time.Now()
+		ok(t, store.ReIndexOnline(&item, &bolthold.ReIndexOptions{
+			BatchSize:        5,
+			RecordsPerSecond: 500,
+			Indexes:          []string{"Category"},
+			Progress: func(indexed int) {
+				progress = append(progress, indexed)
+			},
+		}))
+
+		// the last batch can't start until the rest of the records are within the rate limit
+		minimum := time.Duration(len(testData)-5) * time.Second / 500
+		assert(t, time.Since(start) >= minimum, "Reindexing took %s, expected at least %s", time.Since(start),
+			minimum)
+		equals(t, len(testData), progress[len(progress)-1])
+
+		var result []ItemTest
+		ok(t, store.Find(&result, bolthold.Where("Category").Eq("vehicle").Index("Category")))
+		var expected []ItemTest
+		ok(t, store.Find(&expected, bolthold.Where("Category").Eq("vehicle")))
+		equals(t, len(expected), len(result))
+
+		// other indexes are left alone
+		indexes, err := store.Indexes(&item)
+		ok(t, err)
+		for i := range indexes {
+			if indexes[i].Name == "UpdateIndex" {
+				equals(t, 0, indexes[i].Entries)
+			}
+		}
+
+		assert(t, store.ReIndexOnline(&item, &bolthold.ReIndexOptions{Indexes: []string{"Missing"}}) != nil,
+			"No error reindexing an index that doesn't exist")
+	})
+}
+
+func TestBuckets(t *testing.T) {
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		insertTestData(t, store)
+		ok(t, store.Insert(1, &Ticket{ID: 1, Status: "new"}))
+		ok(t, store.DeleteIndex(&ItemTest{}, "UpdateIndex"))
+
+		types, err := store.Buckets()
+		ok(t, err)
+		equals(t, 2, len(types))
+
+		equals(t, "ItemTest", types[0].Type)
+		equals(t, len(testData), types[0].Count)
+		equals(t, []bolthold.IndexInfo{{Name: "Category", Entries: 3}, {Name: "Tags", Entries: 3}},
+			types[0].Indexes)
+
+		equals(t, "Ticket", types[1].Type)
+		equals(t, 1, types[1].Count)
+		equals(t, []bolthold.IndexInfo{{Name: "Status", Entries: 1}}, types[1].Indexes)
+	})
+}
+
+func TestIndexes(t *testing.T) {
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		insertTestData(t, store)
+		ok(t, store.RemoveIndex(&ItemTest{}, "UpdateIndex"))
+
+		indexes, err := store.Indexes(&ItemTest{})
+		ok(t, err)
+		equals(t, []bolthold.IndexInfo{
+			{Name: "Category", Entries: 3},
+			{Name: "Tags", Entries: 3},
+			{Name: "UpdateIndex", Entries: 0},
+		}, indexes)
+	})
+}
+
 func TestIndexExists(t *testing.T) {
 	testWrap(t, func(store *bolthold.Store, t *testing.T) {
 		insertTestData(t, store)
@@ -155,6 +320,86 @@ func TestAlternateEncoding(t *testing.T) {
 
 }
 
+func TestTypeCodec(t *testing.T) {
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		store.RegisterCodec(&ItemTest{}, bolthold.Codec{
+			Encoder: json.Marshal,
+			Decoder: json.Unmarshal,
+		})
+
+		insertTestData(t, store)
+		ok(t, store.Insert("theme", &Setting{Name: "theme", Value: "dark"}))
+
+		ok(t, store.Bolt().View(func(tx *bolt.Tx) error {
+			key, err := bolthold.DefaultEncode(testData[3].Key)
+			ok(t, err)
+
+			var item ItemTest
+			ok(t, json.Unmarshal(tx.Bucket([]byte("ItemTest")).Get(key), &item))
+			equals(t, testData[3].Name, item.Name)
+
+			key, err = bolthold.DefaultEncode("theme")
+			ok(t, err)
+			assert(t, !json.Valid(tx.Bucket([]byte("Setting")).Get(key)),
+				"Type without a codec wasn't stored with the store's encoder")
+			return nil
+		}))
+
+		var result []ItemTest
+		ok(t, store.Find(&result, bolthold.Where("Category").Eq("vehicle").Index("Category")))
+		equals(t, 5, len(result))
+
+		ok(t, store.UpdateMatching(&ItemTest{}, bolthold.Where("Category").Eq("vehicle"), func(record interface{}) error {
+			record.(*ItemTest).Category = "car"
+			return nil
+		}))
+
+		var item ItemTest
+		ok(t, store.Get(result[0].Key, &item))
+		equals(t, "car", item.Category)
+
+		var setting Setting
+		ok(t, store.Get("theme", &setting))
+		equals(t, "dark", setting.Value)
+	})
+}
+
+func TestCompression(t *testing.T) {
+	filename := tempfile()
+	defer os.Remove(filename)
+
+	store, err := bolthold.Open(filename, 0666, nil)
+	ok(t, err)
+	ok(t, store.Insert("plain", &Setting{Name: "plain", Value: "uncompressed"}))
+	ok(t, store.Close())
+
+	store, err = bolthold.Open(filename, 0666, &bolthold.Options{Compressor: bolthold.FlateCompressor{}})
+	ok(t, err)
+	defer store.Close()
+
+	text := strings.Repeat("a large text blob that compresses well ", 1000)
+	ok(t, store.Insert("blob", &Setting{Name: "blob", Value: text}))
+
+	ok(t, store.Bolt().View(func(tx *bolt.Tx) error {
+		key, err := bolthold.DefaultEncode("blob")
+		ok(t, err)
+		assert(t, len(tx.Bucket([]byte("Setting")).Get(key)) < len(text)/10, "Record wasn't compressed")
+		return nil
+	}))
+
+	var setting Setting
+	ok(t, store.Get("blob", &setting))
+	equals(t, text, setting.Value)
+
+	// records written before compression was turned on are still readable
+	ok(t, store.Get("plain", &setting))
+	equals(t, "uncompressed", setting.Value)
+
+	var result []Setting
+	ok(t, store.Find(&result, bolthold.Where("Value").Eq(text)))
+	equals(t, 1, len(result))
+}
+
 func TestPerStoreEncoding(t *testing.T) {
 	jsnFilename := tempfile()
 	jsnStore, err := bolthold.Open(jsnFilename, 0666, &bolthold.Options{
@@ -237,6 +482,94 @@ func TestEmptyReIndexIssue89(t *testing.T) {
 	})
 }
 
+func TestQueryRewriter(t *testing.T) {
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		insertTestData(t, store)
+
+		vehicles := 0
+		for i := range testData {
+			if testData[i].Category == "vehicle" {
+				vehicles++
+			}
+		}
+
+		store.UseQueryRewriter(func(dataType interface{}, query *bolthold.Query) (*bolthold.Query, error) {
+			if _, ok := dataType.(*ItemTest); ok {
+				query.And("Category").Eq("vehicle")
+			}
+			return query, nil
+		})
+
+		query := bolthold.Where("Name").Ne("")
+
+		var result []ItemTest
+		ok(t, store.Find(&result, query))
+		equals(t, vehicles, len(result))
+
+		// the original query must not accumulate rewritten criteria
+		result = nil
+		ok(t, store.Find(&result, query))
+		equals(t, vehicles, len(result))
+
+		count, err := store.Count(&ItemTest{}, nil)
+		ok(t, err)
+		equals(t, vehicles, count)
+
+		errUnindexed := fmt.Errorf("unindexed query")
+		store.UseQueryRewriter(func(dataType interface{}, query *bolthold.Query) (*bolthold.Query, error) {
+			if query.IndexName() == "" {
+				return nil, errUnindexed
+			}
+			return query, nil
+		})
+
+		// rewriters see each of the Or'd queries too
+		result = nil
+		ok(t, store.Find(&result, bolthold.Where("Category").Eq("vehicle").Index("Category").
+			Or(bolthold.Where("Category").Eq("animal").Index("Category"))))
+		equals(t, vehicles, len(result))
+
+		equals(t, errUnindexed, store.Find(&result, query))
+		equals(t, errUnindexed, store.Find(&result, bolthold.Where("Category").Eq("vehicle").Index("Category").
+			Or(bolthold.Where("Name").Eq("fish"))))
+		ok(t, store.Find(&result, bolthold.Where("Category").Eq("vehicle").Index("Category")))
+	})
+}
+
+func TestTxMetricsHook(t *testing.T) {
+	type Order struct {
+		Customer string `boltholdIndex:"Customer"`
+		Total    int
+	}
+
+	var metrics []bolthold.TxMetrics
+	filename := tempfile()
+	store, err := bolthold.Open(filename, 0666, &bolthold.Options{
+		TxMetricsHook: func(m bolthold.TxMetrics) {
+			metrics = append(metrics, m)
+		},
+	})
+	ok(t, err)
+	defer store.Close()
+	defer os.Remove(filename)
+
+	ok(t, store.Insert(1, &Order{Customer: "tim", Total: 10}))
+	equals(t, 1, len(metrics))
+	equals(t, 1, metrics[0].KeysWritten)
+	equals(t, 1, metrics[0].IndexEntriesWritten)
+	assert(t, metrics[0].BytesWritten > 0, "no bytes reported for an insert")
+
+	ok(t, store.Delete(1, &Order{}))
+	equals(t, 2, len(metrics))
+	equals(t, 1, metrics[1].KeysWritten)
+	equals(t, 1, metrics[1].IndexEntriesWritten)
+	equals(t, 0, metrics[1].BytesWritten)
+
+	// failed transactions aren't reported
+	assert(t, store.Delete(1, &Order{}) == bolthold.ErrNotFound, "expected ErrNotFound")
+	equals(t, 2, len(metrics))
+}
+
 // utilities
 
 // testWrap creates a temporary database for testing and closes and cleans it up when
@@ -331,3 +664,106 @@ func equals(tb testing.TB, exp, act interface{}) {
 		tb.FailNow()
 	}
 }
+
+// Widget encodes itself, in the same way as a generated Protocol Buffers message
+type Widget struct {
+	Name  string
+	Count int
+}
+
+func (w *Widget) Marshal() ([]byte, error) {
+	return []byte(fmt.Sprintf("%s|%d", w.Name, w.Count)), nil
+}
+
+func (w *Widget) Unmarshal(data []byte) error {
+	parts := strings.SplitN(string(data), "|", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("invalid widget %q", data)
+	}
+	w.Name = parts[0]
+	_, err := fmt.Sscan(parts[1], &w.Count)
+	return err
+}
+
+func TestMarshalerCodec(t *testing.T) {
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		store.RegisterCodec(&Widget{}, bolthold.MarshalerCodec)
+
+		ok(t, store.Insert("sprocket", &Widget{Name: "sprocket", Count: 3}))
+		ok(t, store.Insert("cog", Widget{Name: "cog", Count: 12}))
+
+		ok(t, store.Bolt().View(func(tx *bolt.Tx) error {
+			key, err := bolthold.DefaultEncode("cog")
+			ok(t, err)
+			equals(t, "cog|12", string(tx.Bucket([]byte("Widget")).Get(key)))
+			return nil
+		}))
+
+		var result []Widget
+		ok(t, store.Find(&result, bolthold.Where("Count").Gt(5)))
+		equals(t, []Widget{{Name: "cog", Count: 12}}, result)
+
+		assert(t, store.Insert("bad", &Setting{}) == nil, "Types without the codec weren't stored with gob")
+		_, err := bolthold.MarshalerEncode(&Setting{})
+		assert(t, err != nil, "Encoding a type without Marshal didn't fail")
+	})
+}
+
+type Invoice struct {
+	ID       uint64 `boltholdKey:"ID"`
+	Customer string `boltholdIndex:"Customer"`
+	Amount   float64
+	Total    float64   `bolthold:"-"`
+	Cached   *Customer `bolthold:"-"`
+}
+
+type Customer struct {
+	Name string
+}
+
+func TestTransientFields(t *testing.T) {
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		invoice := Invoice{Customer: "tester", Amount: 10, Total: 12, Cached: &Customer{Name: "tester"}}
+		ok(t, store.Insert(bolthold.NextSequence(), &invoice))
+		equals(t, 12.0, invoice.Total)
+
+		var result Invoice
+		ok(t, store.Get(invoice.ID, &result))
+		equals(t, Invoice{ID: invoice.ID, Customer: "tester", Amount: 10}, result)
+
+		var results []Invoice
+		ok(t, store.Find(&results, bolthold.Where("Customer").Eq("tester").And("Amount").Gt(5.0)))
+		equals(t, 1, len(results))
+		equals(t, 0.0, results[0].Total)
+
+		err := store.Find(&results, bolthold.Where("Total").Gt(5.0))
+		assert(t, err != nil && strings.Contains(err.Error(), "Total"), "Querying a transient field didn't fail: %v",
+			err)
+
+		err = store.Find(&results, bolthold.Where("Amount").Gt(5.0).Or(bolthold.Where("Cached.Name").Eq("tester")))
+		assert(t, err != nil, "Querying a transient field in an Or didn't fail")
+
+		err = store.Find(&results, bolthold.Where("Amount").Gt(5.0).SortBy("Total"))
+		assert(t, err != nil, "Sorting by a transient field didn't fail")
+	})
+}
+
+// Internal is stored under a type name reserved for bolthold's own buckets
+type Internal struct{ Name string }
+
+func (i *Internal) Type() string                                 { return "_meta" }
+func (i *Internal) Indexes() map[string]bolthold.Index           { return nil }
+func (i *Internal) SliceIndexes() map[string]bolthold.SliceIndex { return nil }
+
+func TestReservedTypeName(t *testing.T) {
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		assert(t, store.Insert("key", &Internal{Name: "internal"}) != nil,
+			"a type was stored under a reserved name")
+
+		ok(t, store.Insert("key", &ItemTest{Name: "item"}))
+		types, err := store.Buckets()
+		ok(t, err)
+		equals(t, 1, len(types))
+		equals(t, "ItemTest", types[0].Type)
+	})
+}
@@ -0,0 +1,119 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package bolthold
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Result is a record streamed by FindChan.  If the query fails, the last result sent has Err set instead of a record
+type Result struct {
+	// Record is a pointer to a new value of the type passed to FindChan
+	Record interface{}
+	// Key is the record's encoded key
+	Key []byte
+	Err error
+
+	store *Store
+}
+
+// DecodeKey decodes the result's key into key, which must be a pointer
+func (r Result) DecodeKey(key interface{}) error {
+	return r.store.decodeKey(r.Key, key)
+}
+
+// errStreamStopped stops the query of a stream when the stream is cancelled
+var errStreamStopped = errors.New("stream stopped")
+
+// FindChan runs the query in the background, and sends each matching record on the returned channel, which is
+// closed once there are no more.  The query runs in its own read transaction, which is held open until the
+// channel is closed, so the channel should be drained, or the returned cancel function called, which stops the
+// query and waits for the transaction to close.  Calling cancel more than once, or after the channel is closed, is
+// safe
+//
+//	results, cancel := store.FindChan(&Item{}, bolthold.Where("Category").Eq("tools"))
+//	defer cancel()
+//	for result := range results {
+//		if result.Err != nil {
+//			return result.Err
+//		}
+//		item := result.Record.(*Item)
+//		...
+//	}
+func (s *Store) FindChan(dataType interface{}, query *Query) (<-chan Result, func()) {
+	results := make(chan Result)
+	stop := make(chan struct{})
+	finished := make(chan struct{})
+
+	go func() {
+		defer close(finished)
+		defer close(results)
+
+		err := s.Bolt().View(func(tx *bolt.Tx) error {
+			return s.streamQuery(tx, dataType, query, results, stop)
+		})
+		if err != nil && err != errStreamStopped {
+			select {
+			case results <- Result{Err: err, store: s}:
+			case <-stop:
+			}
+		}
+	}()
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			close(stop)
+		})
+		<-finished
+	}
+
+	return results, cancel
+}
+
+func (s *Store) streamQuery(source BucketSource, dataType interface{}, query *Query, results chan<- Result,
+	stop <-chan struct{}) error {
+	query, err := s.prepQuery(dataType, query)
+	if err != nil {
+		return err
+	}
+
+	tp := reflect.TypeOf(dataType)
+	for tp.Kind() == reflect.Ptr {
+		tp = tp.Elem()
+	}
+
+	keyField := ""
+	if field, ok := decodedKeyField(tp); ok {
+		keyField = field.Name
+	}
+
+	return s.runQuery(source, dataType, query, nil, query.skip, func(r *record) error {
+		if keyField != "" {
+			err := s.decodeKey(r.key, r.value.Elem().FieldByName(keyField).Addr().Interface())
+			if err != nil {
+				return err
+			}
+		}
+
+		result := Result{
+			Record: r.value.Interface(),
+			// keys are only valid for the life of the transaction
+			Key:   append([]byte(nil), r.key...),
+			store: s,
+		}
+
+		select {
+		case results <- result:
+			return nil
+		case <-stop:
+			return errStreamStopped
+		}
+	})
+}
@@ -0,0 +1,75 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package bolthold_test
+
+import (
+	"testing"
+
+	"github.com/timshannon/bolthold"
+)
+
+func TestFindChan(t *testing.T) {
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		insertTestData(t, store)
+
+		query := bolthold.Where("Category").Eq("animal").SortBy("Name")
+		var want []ItemTest
+		ok(t, store.Find(&want, query))
+		assert(t, len(want) > 1, "Not enough records to stream")
+
+		results, cancel := store.FindChan(&ItemTest{}, query)
+		defer cancel()
+
+		i := 0
+		for result := range results {
+			ok(t, result.Err)
+			item := result.Record.(*ItemTest)
+			equals(t, want[i].Key, item.Key)
+			equals(t, want[i].Name, item.Name)
+
+			var key int
+			ok(t, result.DecodeKey(&key))
+			equals(t, want[i].Key, key)
+			i++
+		}
+		equals(t, len(want), i)
+		cancel()
+	})
+}
+
+func TestFindChanCancel(t *testing.T) {
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		insertTestData(t, store)
+
+		results, cancel := store.FindChan(&ItemTest{}, nil)
+		result := <-results
+		ok(t, result.Err)
+		cancel()
+
+		for range results {
+			t.Fatalf("Records were sent after the stream was cancelled")
+		}
+
+		// the stream's read transaction is closed, so writes aren't held up by it
+		ok(t, store.Insert(1000, &ItemTest{Name: "after"}))
+		cancel()
+	})
+}
+
+func TestFindChanError(t *testing.T) {
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		insertTestData(t, store)
+
+		results, cancel := store.FindChan(&ItemTest{}, bolthold.Where("Name").Eq("car").Index("BadIndex"))
+		defer cancel()
+
+		result, open := <-results
+		assert(t, open, "No result was sent")
+		assert(t, result.Err != nil, "No error was sent for a bad index")
+
+		_, open = <-results
+		assert(t, !open, "The channel wasn't closed after the error")
+	})
+}
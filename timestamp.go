@@ -0,0 +1,82 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package bolthold
+
+import (
+	"reflect"
+	"time"
+)
+
+// BoltholdCreatedTag is the struct tag for a time.Time field which bolthold sets to the current time when the
+// record is inserted, unless it's already set.  Updates keep the stored time
+//
+//	Created time.Time `boltholdCreated:""`
+const BoltholdCreatedTag = "boltholdCreated"
+
+// BoltholdUpdatedTag is the struct tag for a time.Time field which bolthold sets to the current time every time
+// the record is written
+//
+//	Updated time.Time `boltholdUpdated:""`
+const BoltholdUpdatedTag = "boltholdUpdated"
+
+// timestamper is implemented by storers of types with boltholdCreated or boltholdUpdated fields
+type timestamper interface {
+	createdField() string
+	updatedField() string
+}
+
+// createdField returns the name of the field with the boltholdCreated tag
+func (t *anonStorer) createdField() string {
+	return t.created
+}
+
+// updatedField returns the name of the field with the boltholdUpdated tag
+func (t *anonStorer) updatedField() string {
+	return t.updated
+}
+
+// settableRecord returns the struct of the record so its fields can be set, along with the record to write.  If the
+// record isn't a pointer it is copied, so the caller's value isn't changed
+func settableRecord(value interface{}) (reflect.Value, interface{}) {
+	record := reflect.ValueOf(value)
+	if record.Kind() == reflect.Ptr {
+		return record.Elem(), value
+	}
+
+	copied := reflect.New(record.Type())
+	copied.Elem().Set(record)
+	return copied.Elem(), copied.Interface()
+}
+
+// timestamp returns the record to write with its boltholdUpdated field set to now, and its boltholdCreated field
+// set to the created time of the existing record, or to now if it's being inserted and the time isn't set.  If the
+// record is a pointer the fields are set in place
+func timestamp(storer Storer, value, existing interface{}, now time.Time) interface{} {
+	ts, ok := storer.(timestamper)
+	if !ok || (ts.createdField() == "" && ts.updatedField() == "") {
+		return value
+	}
+	if v := reflect.ValueOf(value); v.Kind() == reflect.Ptr && v.IsNil() {
+		return value
+	}
+
+	record, result := settableRecord(value)
+
+	if ts.createdField() != "" {
+		created := record.FieldByName(ts.createdField())
+		if existing != nil {
+			stored, _ := findIndexValue(ts.createdField(), existing, BoltholdCreatedTag).(time.Time)
+			created.Set(reflect.ValueOf(stored))
+		} else if created.Interface().(time.Time).IsZero() {
+			created.Set(reflect.ValueOf(now))
+		}
+	}
+
+	if ts.updatedField() != "" {
+		record.FieldByName(ts.updatedField()).Set(reflect.ValueOf(now))
+	}
+
+	return result
+}
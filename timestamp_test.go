@@ -0,0 +1,89 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package bolthold_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/timshannon/bolthold"
+)
+
+type Article struct {
+	Title   string
+	Created time.Time `boltholdCreated:""`
+	Updated time.Time `boltholdUpdated:""`
+}
+
+func TestTimestamps(t *testing.T) {
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		before := time.Now()
+		article := Article{Title: "first"}
+		ok(t, store.Insert("a", &article))
+		assert(t, !article.Created.Before(before), "Created wasn't set on insert")
+		assert(t, article.Created.Equal(article.Updated), "Updated wasn't set to the created time on insert")
+
+		created := article.Created
+
+		var stored Article
+		ok(t, store.Get("a", &stored))
+		assert(t, stored.Created.Equal(created), "Created wasn't stored")
+
+		time.Sleep(time.Millisecond)
+
+		// a zero or changed created time doesn't overwrite the stored one
+		ok(t, store.Update("a", Article{Title: "second"}))
+		ok(t, store.Get("a", &stored))
+		equals(t, "second", stored.Title)
+		assert(t, stored.Created.Equal(created), "Update changed the created time")
+		assert(t, stored.Updated.After(created), "Update didn't set the updated time")
+
+		updated := stored.Updated
+		time.Sleep(time.Millisecond)
+
+		ok(t, store.Upsert("a", &Article{Title: "third", Created: time.Now().Add(time.Hour)}))
+		ok(t, store.Get("a", &stored))
+		assert(t, stored.Created.Equal(created), "Upsert changed the created time")
+		assert(t, stored.Updated.After(updated), "Upsert didn't set the updated time")
+
+		updated = stored.Updated
+		time.Sleep(time.Millisecond)
+
+		ok(t, store.UpdateMatching(&Article{}, nil, func(record interface{}) error {
+			record.(*Article).Title = "fourth"
+			return nil
+		}))
+		ok(t, store.Get("a", &stored))
+		equals(t, "fourth", stored.Title)
+		assert(t, stored.Created.Equal(created), "UpdateMatching changed the created time")
+		assert(t, stored.Updated.After(updated), "UpdateMatching didn't set the updated time")
+	})
+}
+
+func TestTimestampsKeepCreatedOnInsert(t *testing.T) {
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		created := time.Date(2015, 6, 1, 0, 0, 0, 0, time.UTC)
+		ok(t, store.Upsert("a", Article{Title: "imported", Created: created}))
+
+		var stored Article
+		ok(t, store.Get("a", &stored))
+		assert(t, stored.Created.Equal(created), "Created time was overwritten on insert")
+		assert(t, stored.Updated.After(created), "Updated wasn't set on insert")
+	})
+}
+
+func TestTimestampsWrongType(t *testing.T) {
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		defer func() {
+			if recover() == nil {
+				t.Fatalf("No panic for a created field that isn't a time.Time")
+			}
+		}()
+
+		_ = store.Insert("a", struct {
+			Created string `boltholdCreated:""`
+		}{})
+	})
+}
@@ -0,0 +1,146 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package bolthold
+
+import (
+	"fmt"
+	"reflect"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// TransformFunc converts a record of one type into a record of another, along with the key to store it under.  A nil
+// key stores the new record under the same key as the old one
+type TransformFunc func(record interface{}) (newRecord interface{}, key interface{}, err error)
+
+// storedKey is a key which has already been encoded, and is inserted as is
+type storedKey []byte
+
+// TransformAll moves every record of oldType's type into newType's type, converting each of them with fn, for when a
+// type is replaced by another with a different shape.  fn is passed each record, with its key field set if it has
+// one, and the converted record is inserted, along with its indexes, as a new record.  Records are moved a chunk per
+// transaction, and each old record is deleted as its new record is inserted, so a TransformAll that fails part way
+// through picks up where it left off when it's run again
+//
+//	err := store.TransformAll(&ContactV1{}, &Contact{}, func(record interface{}) (interface{}, interface{}, error) {
+//		old := record.(*ContactV1)
+//		names := strings.SplitN(old.Name, " ", 2)
+//		return &Contact{First: names[0], Last: names[1]}, nil, nil
+//	})
+func (s *Store) TransformAll(oldType, newType interface{}, fn TransformFunc) error {
+	for {
+		done := false
+		err := s.updateTx(func(tx *bolt.Tx) error {
+			var txErr error
+			done, txErr = s.transformChunk(tx, oldType, newType, fn)
+			return txErr
+		})
+		if err != nil {
+			return err
+		}
+		if done {
+			return nil
+		}
+	}
+}
+
+// TxTransformAll is the same as TransformAll, except every record is moved in your own transaction
+func (s *Store) TxTransformAll(tx *bolt.Tx, oldType, newType interface{}, fn TransformFunc) error {
+	if !tx.Writable() {
+		return bolt.ErrTxNotWritable
+	}
+	return s.transformAll(tx, oldType, newType, fn)
+}
+
+// TransformAllInBucket is the same as TxTransformAll, except the records are moved in the passed in parent bucket
+func (s *Store) TransformAllInBucket(parent *bolt.Bucket, oldType, newType interface{}, fn TransformFunc) error {
+	if !parent.Tx().Writable() {
+		return bolt.ErrTxNotWritable
+	}
+	return s.transformAll(parent, oldType, newType, fn)
+}
+
+func (s *Store) transformAll(source BucketSource, oldType, newType interface{}, fn TransformFunc) error {
+	for done := false; !done; {
+		var err error
+		done, err = s.transformChunk(source, oldType, newType, fn)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// transformChunk moves the next chunk of records into the new type, and returns true once there are none left
+func (s *Store) transformChunk(source BucketSource, oldType, newType interface{}, fn TransformFunc) (bool, error) {
+	storer := s.newStorer(oldType)
+	newTypeName := s.newStorer(newType).Type()
+	if storer.Type() == newTypeName {
+		return false, fmt.Errorf("Records of %s can't be transformed into the same type, use UpdateMatching instead",
+			newTypeName)
+	}
+
+	err := checkMutable(storer, oldType, "transform")
+	if err != nil {
+		return false, err
+	}
+
+	b := getRecordBucket(source, storer)
+	if b == nil {
+		return true, nil
+	}
+
+	keys, values := firstRecords(b.Cursor())
+	if len(keys) == 0 {
+		return true, nil
+	}
+
+	keyField, hasKeyField := decodedKeyField(reflect.TypeOf(oldType))
+
+	for i := range keys {
+		value := newElemType(oldType)
+		err = s.decodeRecord(storer, values[i], value)
+		if err != nil {
+			return false, err
+		}
+		if hasKeyField {
+			field := reflect.ValueOf(value).Elem().FieldByIndex(keyField.Index)
+			err = s.decodeKey(keys[i], field.Addr().Interface())
+			if err != nil {
+				return false, err
+			}
+		}
+
+		newRecord, key, err := fn(value)
+		if err != nil {
+			return false, err
+		}
+		if s.newStorer(newRecord).Type() != newTypeName {
+			return false, fmt.Errorf("Transforming %s returned a %T, not a %s", storer.Type(), newRecord,
+				newTypeName)
+		}
+		if key == nil {
+			key = storedKey(keys[i])
+		}
+
+		err = s.deleteIndexes(storer, source, keys[i], value)
+		if err != nil {
+			return false, err
+		}
+		s.writes.record(false, keys[i], nil)
+		s.changes.add(storer, keys[i], true)
+		err = b.Delete(keys[i])
+		if err != nil {
+			return false, err
+		}
+
+		err = s.insert(source, key, newRecord)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	return len(keys) < rekeyChunk, nil
+}
@@ -0,0 +1,77 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package bolthold_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/timshannon/bolthold"
+	bolt "go.etcd.io/bbolt"
+)
+
+type Resident struct {
+	First string
+	Last  string
+	City  string `boltholdIndex:"City"`
+}
+
+func TestTransformAll(t *testing.T) {
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		// the type being replaced by Resident
+		type Householder struct {
+			Name string
+			City string `boltholdIndex:"City"`
+		}
+
+		ok(t, store.Insert("ada", &Householder{Name: "Ada Lovelace", City: "London"}))
+		ok(t, store.Insert("grace", &Householder{Name: "Grace Hopper", City: "New York"}))
+		ok(t, store.Insert("alan", &Householder{Name: "Alan Turing", City: "London"}))
+
+		transform := func(record interface{}) (interface{}, interface{}, error) {
+			old := record.(*Householder)
+			names := strings.SplitN(old.Name, " ", 2)
+			resident := &Resident{First: names[0], Last: names[1], City: old.City}
+			if resident.First == "Alan" {
+				return resident, "turing", nil
+			}
+			return resident, nil, nil
+		}
+
+		equals(t, bolt.ErrTxNotWritable, store.Bolt().View(func(tx *bolt.Tx) error {
+			return store.TxTransformAll(tx, &Householder{}, &Resident{}, transform)
+		}))
+		assert(t, store.TransformAll(&Householder{}, &Householder{}, transform) != nil,
+			"transformed a type into itself")
+
+		failed := errors.New("failed")
+		equals(t, failed, store.TransformAll(&Householder{}, &Resident{},
+			func(record interface{}) (interface{}, interface{}, error) {
+				return nil, nil, failed
+			}))
+		count, err := store.Count(&Householder{}, nil)
+		ok(t, err)
+		equals(t, 3, count)
+
+		ok(t, store.TransformAll(&Householder{}, &Resident{}, transform))
+
+		count, err = store.Count(&Householder{}, bolthold.Where("City").Eq("London").Index("City"))
+		ok(t, err)
+		equals(t, 0, count)
+
+		var resident Resident
+		ok(t, store.Get("ada", &resident))
+		equals(t, Resident{First: "Ada", Last: "Lovelace", City: "London"}, resident)
+		ok(t, store.Get("turing", &resident))
+		equals(t, Resident{First: "Alan", Last: "Turing", City: "London"}, resident)
+
+		var result []Resident
+		ok(t, store.Find(&result, bolthold.Where("City").Eq("London").Index("City").SortBy("First")))
+		equals(t, 2, len(result))
+		equals(t, "Ada", result[0].First)
+		equals(t, "Alan", result[1].First)
+	})
+}
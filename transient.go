@@ -0,0 +1,136 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package bolthold
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// BoltholdTag is the struct tag used for field options that aren't about indexes.  A field tagged with
+// `bolthold:"-"` is transient: it isn't stored, reads always return its zero value, and it can't be used in queries
+//
+//	Total float64 `bolthold:"-"`
+const BoltholdTag = "bolthold"
+
+// transientFielder is implemented by Storers with fields that aren't stored
+type transientFielder interface {
+	transientFields() map[string]bool
+}
+
+// transientFields returns the names of the fields with the `bolthold:"-"` tag
+func (t *anonStorer) transientFields() map[string]bool {
+	return t.transient
+}
+
+// isTransient returns true if the field has the `bolthold:"-"` tag
+func isTransient(field reflect.StructField) bool {
+	return field.Tag.Get(BoltholdTag) == "-"
+}
+
+// withoutTransient returns a copy of value with its transient fields set to their zero values, so they aren't
+// encoded.  value is returned as it is if the storer has no transient fields
+func withoutTransient(storer Storer, value interface{}) interface{} {
+	tf, ok := storer.(transientFielder)
+	if !ok || len(tf.transientFields()) == 0 {
+		return value
+	}
+
+	original := reflect.ValueOf(value)
+	if original.Kind() == reflect.Ptr && original.IsNil() {
+		return value
+	}
+
+	copied := reflect.New(reflect.Indirect(original).Type()).Elem()
+	copied.Set(reflect.Indirect(original))
+
+	for name := range tf.transientFields() {
+		field, ok := copied.Type().FieldByName(name)
+		if !ok {
+			continue
+		}
+		zeroField(copied, field.Index)
+	}
+
+	if original.Kind() == reflect.Ptr {
+		return copied.Addr().Interface()
+	}
+	return copied.Interface()
+}
+
+// zeroField sets the field at index to its zero value.  Embedded structs on the way to the field are copied
+// rather than changed in place, so the caller's record is left as it is
+func zeroField(value reflect.Value, index []int) {
+	for _, i := range index[:len(index)-1] {
+		value = value.Field(i)
+		if value.Kind() == reflect.Ptr {
+			if value.IsNil() {
+				return
+			}
+			embedded := reflect.New(value.Type().Elem())
+			embedded.Elem().Set(value.Elem())
+			value.Set(embedded)
+			value = embedded.Elem()
+		}
+	}
+
+	field := value.Field(index[len(index)-1])
+	field.Set(reflect.Zero(field.Type()))
+}
+
+// checkTransient returns an error if the query, or any of its Or queries, reads a transient field of the storer
+func checkTransient(storer Storer, query *Query) error {
+	tf, ok := storer.(transientFielder)
+	if !ok || len(tf.transientFields()) == 0 {
+		return nil
+	}
+	transient := tf.transientFields()
+
+	check := func(field string) error {
+		name := strings.SplitN(field, ".", 2)[0]
+		f, ok := query.dataType.FieldByName(name)
+		if !ok {
+			return nil
+		}
+		for i := range f.Index {
+			if transient[query.dataType.FieldByIndex(f.Index[:i+1]).Name] {
+				return fmt.Errorf("The field %s of the type %s has the bolthold:\"-\" tag, it isn't stored and "+
+					"can't be queried", field, query.dataType)
+			}
+		}
+		return nil
+	}
+
+	for field, criteria := range query.fieldCriteria {
+		if field == Key {
+			continue
+		}
+		if err := check(field); err != nil {
+			return err
+		}
+		for _, c := range criteria {
+			if other, ok := c.value.(Field); ok {
+				if err := check(string(other)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	for _, field := range query.sort {
+		if err := check(field); err != nil {
+			return err
+		}
+	}
+
+	for i := range query.ors {
+		query.ors[i].dataType = query.dataType
+		if err := checkTransient(storer, query.ors[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
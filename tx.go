@@ -0,0 +1,239 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package bolthold
+
+import (
+	"io"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Tx is a bolt transaction bound to the store, with the store's functions run in the transaction.  A Tx is only
+// valid inside the function passed to WithTx
+type Tx struct {
+	store    *Store
+	tx       *bolt.Tx
+	deferred bool
+}
+
+// WithTx runs fn in a transaction, which is a write transaction if writable is true, and is committed if fn returns
+// nil.  Write transactions run the commit hooks and are reported to the TxMetricsHook like any other write
+//
+//	err := store.WithTx(true, func(tx *bolthold.Tx) error {
+//		var account Account
+//		err := tx.Get(id, &account)
+//		if err != nil {
+//			return err
+//		}
+//		account.Balance -= amount
+//		return tx.Update(id, account)
+//	})
+func (s *Store) WithTx(writable bool, fn func(tx *Tx) error) error {
+	run := func(tx *bolt.Tx) error {
+		t := &Tx{store: s, tx: tx}
+		err := fn(t)
+		if !t.deferred {
+			return err
+		}
+
+		defer func() {
+			s.deferredUnique = nil
+		}()
+		if err != nil {
+			return err
+		}
+		return s.checkDeferredUnique(tx)
+	}
+	if writable {
+		return s.updateTx(run)
+	}
+	return s.Bolt().View(run)
+}
+
+// Bolt returns the underlying bolt transaction
+func (t *Tx) Bolt() *bolt.Tx {
+	return t.tx
+}
+
+// Store returns the store the transaction belongs to
+func (t *Tx) Store() *Store {
+	return t.store
+}
+
+// DeferUniqueChecks checks unique constraints for the rest of the transaction when fn returns, instead of as each
+// record is written, like Txn.DeferUniqueChecks.  WithTx fails with an *ErrUniqueViolation if a constraint is still
+// violated at the end
+func (t *Tx) DeferUniqueChecks() {
+	if t.deferred || t.store.deferredUnique != nil || !t.tx.Writable() {
+		return
+	}
+	t.deferred = true
+	t.store.deferredUnique = &deferredUnique{}
+}
+
+// Get is the same as Store.Get, in the transaction
+func (t *Tx) Get(key, result interface{}) error {
+	return t.store.TxGet(t.tx, key, result)
+}
+
+// GetMany is the same as Store.GetMany, in the transaction
+func (t *Tx) GetMany(keys []interface{}, result interface{}) ([]interface{}, error) {
+	return t.store.TxGetMany(t.tx, keys, result)
+}
+
+// Exists is the same as Store.Exists, in the transaction
+func (t *Tx) Exists(key, dataType interface{}) (bool, error) {
+	return t.store.TxExists(t.tx, key, dataType)
+}
+
+// ExistsMatching is the same as Store.ExistsMatching, in the transaction
+func (t *Tx) ExistsMatching(dataType interface{}, query *Query) (bool, error) {
+	return t.store.TxExistsMatching(t.tx, dataType, query)
+}
+
+// Find is the same as Store.Find, in the transaction
+func (t *Tx) Find(result interface{}, query *Query) error {
+	return t.store.TxFind(t.tx, result, query)
+}
+
+// FindOne is the same as Store.FindOne, in the transaction
+func (t *Tx) FindOne(result interface{}, query *Query) error {
+	return t.store.TxFindOne(t.tx, result, query)
+}
+
+// FindAggregate is the same as Store.FindAggregate, in the transaction
+func (t *Tx) FindAggregate(dataType interface{}, query *Query, groupBy ...string) ([]*AggregateResult, error) {
+	return t.store.TxFindAggregate(t.tx, dataType, query, groupBy...)
+}
+
+// FindJSON is the same as Store.FindJSON, in the transaction
+func (t *Tx) FindJSON(w io.Writer, dataType interface{}, query *Query) error {
+	return t.store.TxFindJSON(t.tx, w, dataType, query)
+}
+
+// FindNDJSON is the same as Store.FindNDJSON, in the transaction
+func (t *Tx) FindNDJSON(w io.Writer, dataType interface{}, query *Query) error {
+	return t.store.TxFindNDJSON(t.tx, w, dataType, query)
+}
+
+// Count is the same as Store.Count, in the transaction
+func (t *Tx) Count(dataType interface{}, query *Query) (int, error) {
+	return t.store.TxCount(t.tx, dataType, query)
+}
+
+// ForEach is the same as Store.ForEach, in the transaction
+func (t *Tx) ForEach(query *Query, fn interface{}) error {
+	return t.store.TxForEach(t.tx, query, fn)
+}
+
+// Cursor is the same as Store.TxCursor, in the transaction
+func (t *Tx) Cursor(dataType interface{}) *Cursor {
+	return t.store.TxCursor(t.tx, dataType)
+}
+
+// Insert is the same as Store.Insert, in the transaction
+func (t *Tx) Insert(key, data interface{}) error {
+	return t.store.TxInsert(t.tx, key, data)
+}
+
+// InsertKey is the same as Store.InsertKey, in the transaction
+func (t *Tx) InsertKey(key, data interface{}) (interface{}, error) {
+	return t.store.TxInsertKey(t.tx, key, data)
+}
+
+// FindOrInsert is the same as Store.FindOrInsert, in the transaction
+func (t *Tx) FindOrInsert(key, result, defaultValue interface{}) (bool, error) {
+	return t.store.TxFindOrInsert(t.tx, key, result, defaultValue)
+}
+
+// Update is the same as Store.Update, in the transaction
+func (t *Tx) Update(key, data interface{}) error {
+	return t.store.TxUpdate(t.tx, key, data)
+}
+
+// UpdateFields is the same as Store.UpdateFields, in the transaction
+func (t *Tx) UpdateFields(key, dataType interface{}, fields map[string]interface{}) error {
+	return t.store.TxUpdateFields(t.tx, key, dataType, fields)
+}
+
+// Merge is the same as Store.Merge, in the transaction
+func (t *Tx) Merge(key, data interface{}) error {
+	return t.store.TxMerge(t.tx, key, data)
+}
+
+// Increment is the same as Store.Increment, in the transaction
+func (t *Tx) Increment(key, dataType interface{}, field string, delta interface{}) error {
+	return t.store.TxIncrement(t.tx, key, dataType, field, delta)
+}
+
+// Upsert is the same as Store.Upsert, in the transaction
+func (t *Tx) Upsert(key, data interface{}) error {
+	return t.store.TxUpsert(t.tx, key, data)
+}
+
+// UpdateMatching is the same as Store.UpdateMatching, in the transaction
+func (t *Tx) UpdateMatching(dataType interface{}, query *Query, update func(record interface{}) error) error {
+	return t.store.TxUpdateMatching(t.tx, dataType, query, update)
+}
+
+// ChangeKey is the same as Store.ChangeKey, in the transaction
+func (t *Tx) ChangeKey(dataType, oldKey, newKey interface{}, references ...KeyReference) error {
+	return t.store.TxChangeKey(t.tx, dataType, oldKey, newKey, references...)
+}
+
+// NextSequence is the same as Store.NextSequence, in the transaction
+func (t *Tx) NextSequence(dataType interface{}) (uint64, error) {
+	return t.store.TxNextSequence(t.tx, dataType)
+}
+
+// ReserveSequences is the same as Store.ReserveSequences, in the transaction
+func (t *Tx) ReserveSequences(dataType interface{}, n uint64) (uint64, error) {
+	return t.store.TxReserveSequences(t.tx, dataType, n)
+}
+
+// SetSequence is the same as Store.SetSequence, in the transaction
+func (t *Tx) SetSequence(dataType interface{}, n uint64) error {
+	return t.store.TxSetSequence(t.tx, dataType, n)
+}
+
+// Delete is the same as Store.Delete, in the transaction
+func (t *Tx) Delete(key, dataType interface{}) error {
+	return t.store.TxDelete(t.tx, key, dataType)
+}
+
+// DeleteKeys is the same as Store.DeleteKeys, in the transaction
+func (t *Tx) DeleteKeys(dataType interface{}, keys ...interface{}) error {
+	return t.store.TxDeleteKeys(t.tx, dataType, keys...)
+}
+
+// DeleteMatching is the same as Store.DeleteMatching, in the transaction
+func (t *Tx) DeleteMatching(dataType interface{}, query *Query) error {
+	return t.store.TxDeleteMatching(t.tx, dataType, query)
+}
+
+// DeleteMatchingCount is the same as Store.DeleteMatchingCount, in the transaction
+func (t *Tx) DeleteMatchingCount(dataType interface{}, query *Query) (int, error) {
+	return t.store.TxDeleteMatchingCount(t.tx, dataType, query)
+}
+
+// DeleteMatchingKeys is the same as Store.DeleteMatchingKeys, in the transaction
+func (t *Tx) DeleteMatchingKeys(dataType interface{}, query *Query, keys interface{}) error {
+	return t.store.TxDeleteMatchingKeys(t.tx, dataType, query, keys)
+}
+
+// Pop is the same as Store.Pop, in the transaction
+func (t *Tx) Pop(key, result interface{}) error {
+	return t.store.TxPop(t.tx, key, result)
+}
+
+// PurgeDeleted is the same as Store.PurgeDeleted, in the transaction
+func (t *Tx) PurgeDeleted(dataType interface{}, query *Query) (int, error) {
+	return t.store.TxPurgeDeleted(t.tx, dataType, query)
+}
+
+// PurgeExpired is the same as Store.PurgeExpired, in the transaction
+func (t *Tx) PurgeExpired(dataType interface{}) (int, error) {
+	return t.store.TxPurgeExpired(t.tx, dataType)
+}
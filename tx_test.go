@@ -0,0 +1,59 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package bolthold_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/timshannon/bolthold"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestWithTx(t *testing.T) {
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		insertTestData(t, store)
+
+		item := testData[0]
+		ok(t, store.WithTx(true, func(tx *bolthold.Tx) error {
+			var stored ItemTest
+			err := tx.Get(item.Key, &stored)
+			if err != nil {
+				return err
+			}
+			stored.Name = "moved"
+			err = tx.Insert(1000, stored)
+			if err != nil {
+				return err
+			}
+			return tx.Delete(item.Key, &ItemTest{})
+		}))
+
+		ok(t, store.WithTx(false, func(tx *bolthold.Tx) error {
+			equals(t, bolthold.ErrNotFound, tx.Get(item.Key, &ItemTest{}))
+
+			var result []ItemTest
+			ok(t, tx.Find(&result, bolthold.Where("Name").Eq("moved")))
+			equals(t, 1, len(result))
+
+			count, err := tx.Count(&ItemTest{}, nil)
+			ok(t, err)
+			equals(t, len(testData), count)
+
+			equals(t, bolt.ErrTxNotWritable, tx.Insert(2000, item))
+			return nil
+		}))
+
+		errFailed := errors.New("failed")
+		equals(t, errFailed, store.WithTx(true, func(tx *bolthold.Tx) error {
+			ok(t, tx.Upsert(2000, item))
+			return errFailed
+		}))
+
+		exists, err := store.Exists(2000, &ItemTest{})
+		ok(t, err)
+		assert(t, !exists, "The write of a failed transaction was committed")
+	})
+}
@@ -0,0 +1,248 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package bolthold
+
+import (
+	"context"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Txn queues writes and reads across any number of types, and runs them in order in a single transaction when
+// Commit is called.  If any of them fail, none of the writes are kept.  A Txn is created with Store.Txn, and
+// isn't safe for use by multiple goroutines
+type Txn struct {
+	store     *Store
+	ops       []func(tx *bolt.Tx) error
+	attempts  int
+	backoff   time.Duration
+	retryable func(err error) bool
+	deferred  bool
+
+	nested []*Txn
+	// err is why a nested Txn was discarded by the last Commit of its parent
+	err error
+}
+
+// savepointError is returned from the transaction when the operations of a nested Txn fail, so that Commit can run
+// the transaction again without them
+type savepointError struct {
+	txn *Txn
+	err error
+}
+
+func (e *savepointError) Error() string {
+	return e.err.Error()
+}
+
+// Txn starts a new transaction builder
+//
+//	err := store.Txn().
+//		Insert(orderID, order).
+//		Update(customerID, customer).
+//		Delete(cartID, &Cart{}).
+//		Commit()
+func (s *Store) Txn() *Txn {
+	return &Txn{
+		store:    s,
+		attempts: 1,
+	}
+}
+
+// Insert queues an Insert
+func (t *Txn) Insert(key, data interface{}) *Txn {
+	return t.Func(func(tx *bolt.Tx) error {
+		return t.store.TxInsert(tx, key, data)
+	})
+}
+
+// Update queues an Update
+func (t *Txn) Update(key, data interface{}) *Txn {
+	return t.Func(func(tx *bolt.Tx) error {
+		return t.store.TxUpdate(tx, key, data)
+	})
+}
+
+// Upsert queues an Upsert
+func (t *Txn) Upsert(key, data interface{}) *Txn {
+	return t.Func(func(tx *bolt.Tx) error {
+		return t.store.TxUpsert(tx, key, data)
+	})
+}
+
+// UpdateMatching queues an UpdateMatching
+func (t *Txn) UpdateMatching(dataType interface{}, query *Query, update func(record interface{}) error) *Txn {
+	return t.Func(func(tx *bolt.Tx) error {
+		return t.store.TxUpdateMatching(tx, dataType, query, update)
+	})
+}
+
+// Delete queues a Delete
+func (t *Txn) Delete(key, dataType interface{}) *Txn {
+	return t.Func(func(tx *bolt.Tx) error {
+		return t.store.TxDelete(tx, key, dataType)
+	})
+}
+
+// DeleteMatching queues a DeleteMatching
+func (t *Txn) DeleteMatching(dataType interface{}, query *Query) *Txn {
+	return t.Func(func(tx *bolt.Tx) error {
+		return t.store.TxDeleteMatching(tx, dataType, query)
+	})
+}
+
+// Get queues a Get into result, which is set when the Txn is committed, and sees the writes queued before it
+func (t *Txn) Get(key, result interface{}) *Txn {
+	return t.Func(func(tx *bolt.Tx) error {
+		return t.store.TxGet(tx, key, result)
+	})
+}
+
+// Find queues a Find into result, which is set when the Txn is committed, and sees the writes queued before it
+func (t *Txn) Find(result interface{}, query *Query) *Txn {
+	return t.Func(func(tx *bolt.Tx) error {
+		return t.store.TxFind(tx, result, query)
+	})
+}
+
+// Func queues a function which is run with the transaction, for anything that doesn't have its own method
+func (t *Txn) Func(fn func(tx *bolt.Tx) error) *Txn {
+	t.ops = append(t.ops, fn)
+	return t
+}
+
+// Nested queues the operations of another Txn as a group which acts like a savepoint.  If any of them fail, the
+// transaction is run again without the group, as though it had never been queued, and the rest of the operations
+// are still committed.  The error which discarded the group is returned by inner.Err.  Groups can be nested in
+// each other, and operations are run again each time a group is discarded, so they must be safe to repeat.  Retry
+// settings on inner are ignored
+//
+//	audit := store.Txn().Insert(auditID, entry)
+//	err := store.Txn().Update(orderID, order).Nested(audit).Commit()
+//	if audit.Err() != nil {
+//		// the order was updated without the audit entry
+//	}
+func (t *Txn) Nested(inner *Txn) *Txn {
+	t.nested = append(t.nested, inner)
+	return t.Func(func(tx *bolt.Tx) error {
+		if inner.err != nil {
+			return nil
+		}
+		err := inner.run(tx)
+		if err == nil {
+			return nil
+		}
+		if _, ok := err.(*savepointError); ok {
+			return err
+		}
+		return &savepointError{txn: inner, err: err}
+	})
+}
+
+// Err returns the error which discarded a nested Txn during the last Commit of its parent, or nil if its operations
+// were committed
+func (t *Txn) Err() error {
+	return t.err
+}
+
+// Retry runs the whole transaction again, up to attempts times in total, when it fails with an error for which
+// retryable returns true.  A nil retryable retries every error.  The delay before each retry starts at backoff and
+// doubles every time.  Queued functions are run again on every attempt, so they must be safe to repeat
+func (t *Txn) Retry(attempts int, backoff time.Duration, retryable func(err error) bool) *Txn {
+	if attempts < 1 {
+		attempts = 1
+	}
+	t.attempts = attempts
+	t.backoff = backoff
+	t.retryable = retryable
+	return t
+}
+
+// DeferUniqueChecks checks unique constraints once all of the queued operations have run, instead of as each record
+// is written, so operations which only violate a constraint part way through the transaction, such as swapping the
+// values of two records, can be committed.  Commit fails with an *ErrUniqueViolation if a constraint is still
+// violated at the end
+func (t *Txn) DeferUniqueChecks() *Txn {
+	t.deferred = true
+	return t
+}
+
+// Commit runs the queued operations in order in a single write transaction
+func (t *Txn) Commit() error {
+	return t.commit(context.Background())
+}
+
+func (t *Txn) commit(ctx context.Context) error {
+	t.reset()
+
+	update := t.store.updateTx
+	if ctx.Done() != nil {
+		update = func(fn func(tx *bolt.Tx) error) error {
+			return t.store.updateTxContext(ctx, fn)
+		}
+	}
+
+	backoff := t.backoff
+	for attempt := 1; ; attempt++ {
+		err := update(t.run)
+
+		if savepoint, ok := err.(*savepointError); ok {
+			// run again without the failed group, which doesn't count as an attempt
+			savepoint.txn.err = savepoint.err
+			attempt--
+			continue
+		}
+
+		if err == nil || attempt >= t.attempts || ctx.Err() != nil || (t.retryable != nil && !t.retryable(err)) {
+			return err
+		}
+
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// TxCommit is the same as Commit except it runs the queued operations in your own transaction, without retrying.
+// Bolt can't roll back part of a transaction, so if a nested Txn fails its error is returned, and the transaction
+// must be rolled back
+func (t *Txn) TxCommit(tx *bolt.Tx) error {
+	if !tx.Writable() {
+		return bolt.ErrTxNotWritable
+	}
+	t.reset()
+
+	err := t.run(tx)
+	if savepoint, ok := err.(*savepointError); ok {
+		savepoint.txn.err = savepoint.err
+		return savepoint.err
+	}
+	return err
+}
+
+// reset clears the errors of nested groups discarded by an earlier Commit
+func (t *Txn) reset() {
+	for i := range t.nested {
+		t.nested[i].err = nil
+		t.nested[i].reset()
+	}
+}
+
+func (t *Txn) run(tx *bolt.Tx) error {
+	if t.deferred {
+		return t.store.withDeferredUnique(t.runOps)(tx)
+	}
+	return t.runOps(tx)
+}
+
+func (t *Txn) runOps(tx *bolt.Tx) error {
+	for i := range t.ops {
+		err := t.ops[i](tx)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package bolthold_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/timshannon/bolthold"
+	bolt "go.etcd.io/bbolt"
+)
+
+type Ledger struct {
+	Account string `boltholdIndex:"Account"`
+	Balance int
+}
+
+func TestTxn(t *testing.T) {
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		insertTestData(t, store)
+
+		var ledger Ledger
+		var items []ItemTest
+		ok(t, store.Txn().
+			Insert("checking", Ledger{Account: "checking", Balance: 10}).
+			Delete(testData[0].Key, &ItemTest{}).
+			UpdateMatching(&Ledger{}, bolthold.Where("Account").Eq("checking"), func(record interface{}) error {
+				record.(*Ledger).Balance += 5
+				return nil
+			}).
+			Get("checking", &ledger).
+			Find(&items, nil).
+			Commit())
+
+		equals(t, 15, ledger.Balance)
+		equals(t, len(testData)-1, len(items))
+
+		var stored Ledger
+		ok(t, store.Get("checking", &stored))
+		equals(t, 15, stored.Balance)
+	})
+}
+
+func TestTxnRollback(t *testing.T) {
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		insertTestData(t, store)
+
+		err := store.Txn().
+			Insert("savings", Ledger{Account: "savings"}).
+			Delete(testData[0].Key, &ItemTest{}).
+			Insert(testData[1].Key, testData[1]).
+			Commit()
+		equals(t, bolthold.ErrKeyExists, err)
+
+		equals(t, bolthold.ErrNotFound, store.Get("savings", &Ledger{}))
+		ok(t, store.Get(testData[0].Key, &ItemTest{}))
+	})
+}
+
+func TestTxnRetry(t *testing.T) {
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		errBusy := errors.New("busy")
+
+		attempts := 0
+		txn := store.Txn().
+			Upsert("checking", Ledger{Account: "checking", Balance: 1}).
+			Func(func(tx *bolt.Tx) error {
+				attempts++
+				if attempts < 3 {
+					return errBusy
+				}
+				return nil
+			})
+
+		ok(t, txn.Retry(3, 0, func(err error) bool { return err == errBusy }).Commit())
+		equals(t, 3, attempts)
+
+		attempts = 0
+		equals(t, errBusy, txn.Retry(2, 0, nil).Commit())
+		equals(t, 2, attempts)
+
+		attempts = 0
+		equals(t, errBusy, txn.Retry(5, 0, func(err error) bool { return false }).Commit())
+		equals(t, 1, attempts)
+	})
+}
+
+func TestTxnNested(t *testing.T) {
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		insertTestData(t, store)
+
+		failing := store.Txn().
+			Insert("inner", Ledger{Account: "inner"}).
+			Insert(testData[0].Key, testData[0])
+
+		deepest := store.Txn().Insert("deepest", Ledger{Account: "deepest"}).Insert("deepest", Ledger{})
+		succeeding := store.Txn().
+			Insert("outer", Ledger{Account: "outer"}).
+			Nested(deepest)
+
+		ok(t, store.Txn().
+			Insert("checking", Ledger{Account: "checking"}).
+			Nested(failing).
+			Nested(succeeding).
+			Commit())
+
+		equals(t, bolthold.ErrKeyExists, failing.Err())
+		ok(t, succeeding.Err())
+		equals(t, bolthold.ErrKeyExists, deepest.Err())
+
+		ok(t, store.Get("checking", &Ledger{}))
+		ok(t, store.Get("outer", &Ledger{}))
+		equals(t, bolthold.ErrNotFound, store.Get("inner", &Ledger{}))
+		equals(t, bolthold.ErrNotFound, store.Get("deepest", &Ledger{}))
+
+		// a failure outside of any nested group still fails the whole transaction
+		err := store.Txn().
+			Insert("savings", Ledger{Account: "savings"}).
+			Nested(store.Txn().Insert("other", Ledger{Account: "other"})).
+			Insert("checking", Ledger{}).
+			Commit()
+		equals(t, bolthold.ErrKeyExists, err)
+		equals(t, bolthold.ErrNotFound, store.Get("savings", &Ledger{}))
+		equals(t, bolthold.ErrNotFound, store.Get("other", &Ledger{}))
+	})
+}
@@ -0,0 +1,40 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package bolthold
+
+// decodeError is a record failing to decode while it's being matched against a query, rather than the query
+// failing to match it
+type decodeError struct {
+	err error
+}
+
+func (e *decodeError) Error() string {
+	return e.err.Error()
+}
+
+// SkipUndecodable skips records which fail to decode, instead of failing the query.  They are reported to
+// Options.OnUndecodable if it's set
+func (q *Query) SkipUndecodable() *Query {
+	q.skipUndecodable = true
+	return q
+}
+
+// undecodable reports a record which failed to decode, and returns true if the query should skip it rather than
+// fail with the error
+func (s *Store) undecodable(storer Storer, query *Query, key []byte, err error) bool {
+	if !s.skipUndecodable && !query.skipUndecodable {
+		return false
+	}
+
+	if decodeErr, ok := err.(*decodeError); ok {
+		err = decodeErr.err
+	}
+
+	if s.onUndecodable != nil {
+		// keys are only valid for the life of the transaction
+		s.onUndecodable(storer.Type(), append([]byte(nil), key...), err)
+	}
+	return true
+}
@@ -0,0 +1,67 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package bolthold_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/timshannon/bolthold"
+	bolt "go.etcd.io/bbolt"
+)
+
+func insertCorruptRecord(t *testing.T, store *bolthold.Store) []byte {
+	key := []byte("corrupt")
+	ok(t, store.Bolt().Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte("ItemTest")).Put(key, []byte("not a record"))
+	}))
+	return key
+}
+
+func TestSkipUndecodable(t *testing.T) {
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		insertTestData(t, store)
+		insertCorruptRecord(t, store)
+
+		var result []ItemTest
+		assert(t, store.Find(&result, nil) != nil, "Find didn't fail on a corrupt record")
+
+		result = nil
+		ok(t, store.Find(&result, bolthold.Where("Category").Eq("vehicle").Or(
+			bolthold.Where("Name").Eq("fish")).SkipUndecodable()))
+		assert(t, len(result) > 0, "No records were found")
+
+		result = nil
+		ok(t, store.Find(&result, (&bolthold.Query{}).SkipUndecodable()))
+		equals(t, len(testData), len(result))
+	})
+}
+
+func TestSkipUndecodableOption(t *testing.T) {
+	type skipped struct {
+		typeName string
+		key      string
+	}
+	var reported []skipped
+
+	filename := tempfile()
+	store, err := bolthold.Open(filename, 0666, &bolthold.Options{
+		SkipUndecodable: true,
+		OnUndecodable: func(typeName string, key []byte, err error) {
+			reported = append(reported, skipped{typeName: typeName, key: string(key)})
+		},
+	})
+	ok(t, err)
+	defer store.Close()
+	defer os.Remove(filename)
+
+	insertTestData(t, store)
+	key := insertCorruptRecord(t, store)
+
+	count, err := store.Count(&ItemTest{}, nil)
+	ok(t, err)
+	equals(t, len(testData), count)
+	equals(t, []skipped{{typeName: "ItemTest", key: string(key)}}, reported)
+}
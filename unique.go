@@ -0,0 +1,223 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package bolthold
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"reflect"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// BoltholdUniqueTag is the struct tag used to define a unique constraint.  Fields with the same constraint name
+// make up a compound constraint, and no two records can have the same values in all of them.  Records with a nil
+// value in any of the fields aren't checked
+//
+//	TenantID string `boltholdUnique:"TenantEmail"`
+//	Email    string `boltholdUnique:"TenantEmail"`
+const BoltholdUniqueTag = "boltholdUnique"
+
+// UniqueIndexer can be implemented by a Storer to make some of its indexes unique.  Writing a record with the same
+// index value as another record fails with an *ErrUniqueViolation
+type UniqueIndexer interface {
+	UniqueIndexes() []string
+}
+
+// ErrUniqueViolation is the error returned when a write would give two records the same value in a unique index
+type ErrUniqueViolation struct {
+	Type       string
+	Constraint string
+	// Key is the encoded key of the record which already has the value, it can be decoded with the store's decoder
+	Key []byte
+}
+
+func (e *ErrUniqueViolation) Error() string {
+	return fmt.Sprintf("The %s constraint on %s is violated by the existing record %x", e.Constraint, e.Type, e.Key)
+}
+
+// compositeIndex returns the index of a unique constraint.  For compound constraints each field's value is encoded
+// and length prefixed, so that different values can't produce the same key
+func compositeIndex(fields []string, store *Store) Index {
+	return func(name string, value interface{}) ([]byte, error) {
+		if len(fields) == 1 {
+			val := uniqueValue(fields[0], value)
+			if val == nil {
+				return nil, nil
+			}
+			return store.encode(val)
+		}
+
+		var key []byte
+		for i := range fields {
+			val := uniqueValue(fields[i], value)
+			if val == nil {
+				return nil, nil
+			}
+
+			encoded, err := store.encode(val)
+			if err != nil {
+				return nil, err
+			}
+
+			size := make([]byte, binary.MaxVarintLen64)
+			key = append(key, size[:binary.PutUvarint(size, uint64(len(encoded)))]...)
+			key = append(key, encoded...)
+		}
+		return key, nil
+	}
+}
+
+func uniqueValue(field string, value interface{}) interface{} {
+	val := findIndexValue(field, value, BoltholdUniqueTag)
+	if val == nil {
+		return nil
+	}
+	if rv := reflect.ValueOf(val); rv.Kind() == reflect.Ptr && rv.IsNil() {
+		return nil
+	}
+	return val
+}
+
+// checkUnique returns an *ErrUniqueViolation if writing data would give it the same value in a unique index as a
+// record other than the record at the passed in keys
+func (s *Store) checkUnique(storer Storer, source BucketSource, data interface{}, keys ...[]byte) error {
+	indexer, ok := storer.(UniqueIndexer)
+	if !ok {
+		return nil
+	}
+
+	dropped := metaBucket(source, droppedIndexSubsystem)
+
+	for _, name := range indexer.UniqueIndexes() {
+		if isDropped(dropped, storer.Type(), name) {
+			continue
+		}
+
+		index, ok := storer.Indexes()[name]
+		if !ok {
+			continue
+		}
+
+		indexKey, err := index(name, data)
+		if err != nil {
+			return err
+		}
+		if indexKey == nil {
+			continue
+		}
+
+		iBucket := source.Bucket(indexBucketName(storer.Type(), name))
+		if iBucket == nil {
+			continue
+		}
+
+		v := iBucket.Get(indexKey)
+		if v == nil {
+			continue
+		}
+
+		var existing keyList
+		err = s.decode(v, &existing)
+		if err != nil {
+			return err
+		}
+
+	nextKey:
+		for i := range existing {
+			for j := range keys {
+				if bytes.Equal(existing[i], keys[j]) {
+					continue nextKey
+				}
+			}
+			if s.deferredUnique != nil {
+				s.deferredUnique.add(storer, name, indexKey)
+				break
+			}
+			return &ErrUniqueViolation{
+				Type:       storer.Type(),
+				Constraint: name,
+				Key:        existing[i],
+			}
+		}
+	}
+
+	return nil
+}
+
+// deferredUnique is the list of unique index values which were shared by more than one record when they were
+// written, in a transaction which defers its unique checks until it's committed
+type deferredUnique struct {
+	checks []deferredCheck
+}
+
+type deferredCheck struct {
+	storer   Storer
+	name     string
+	indexKey []byte
+}
+
+func (d *deferredUnique) add(storer Storer, name string, indexKey []byte) {
+	d.checks = append(d.checks, deferredCheck{
+		storer:   storer,
+		name:     name,
+		indexKey: append([]byte(nil), indexKey...),
+	})
+}
+
+// withDeferredUnique wraps fn so the unique checks of the writes it makes are run once it's done, instead of as
+// each record is written.  That allows writes such as swapping the values of two records, which would violate the
+// constraint part way through
+func (s *Store) withDeferredUnique(fn func(tx *bolt.Tx) error) func(tx *bolt.Tx) error {
+	return func(tx *bolt.Tx) error {
+		if s.deferredUnique != nil {
+			// already deferred by an enclosing transaction, which will run the checks
+			return fn(tx)
+		}
+
+		s.deferredUnique = &deferredUnique{}
+		defer func() {
+			s.deferredUnique = nil
+		}()
+
+		err := fn(tx)
+		if err != nil {
+			return err
+		}
+		return s.checkDeferredUnique(tx)
+	}
+}
+
+// checkDeferredUnique returns an *ErrUniqueViolation if any of the deferred unique index values are still shared by
+// more than one record
+func (s *Store) checkDeferredUnique(source BucketSource) error {
+	for _, check := range s.deferredUnique.checks {
+		iBucket := source.Bucket(indexBucketName(check.storer.Type(), check.name))
+		if iBucket == nil {
+			continue
+		}
+
+		v := iBucket.Get(check.indexKey)
+		if v == nil {
+			continue
+		}
+
+		var existing keyList
+		err := s.decode(v, &existing)
+		if err != nil {
+			return err
+		}
+
+		if len(existing) > 1 {
+			return &ErrUniqueViolation{
+				Type:       check.storer.Type(),
+				Constraint: check.name,
+				Key:        existing[0],
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package bolthold_test
+
+import (
+	"testing"
+
+	"github.com/timshannon/bolthold"
+)
+
+type Account struct {
+	ID       string  `boltholdKey:"ID"`
+	TenantID string  `boltholdUnique:"TenantEmail"`
+	Email    string  `boltholdUnique:"TenantEmail"`
+	Username *string `boltholdUnique:""`
+}
+
+func TestUniqueConstraint(t *testing.T) {
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		name := "tim"
+
+		ok(t, store.Insert("a", &Account{TenantID: "one", Email: "tim@example.com", Username: &name}))
+		ok(t, store.Insert("b", &Account{TenantID: "two", Email: "tim@example.com"}))
+		ok(t, store.Insert("c", &Account{TenantID: "one", Email: "other@example.com"}))
+
+		err := store.Insert("d", &Account{TenantID: "one", Email: "tim@example.com"})
+		violation, isViolation := err.(*bolthold.ErrUniqueViolation)
+		assert(t, isViolation, "Inserting a duplicate didn't return an ErrUniqueViolation: %v", err)
+		equals(t, "TenantEmail", violation.Constraint)
+
+		var key string
+		ok(t, bolthold.DefaultDecode(violation.Key, &key))
+		equals(t, "a", key)
+
+		// single field constraints use the field name, and nil values aren't checked
+		err = store.Insert("d", &Account{TenantID: "three", Email: "x@example.com", Username: &name})
+		violation, isViolation = err.(*bolthold.ErrUniqueViolation)
+		assert(t, isViolation, "Inserting a duplicate username didn't return an ErrUniqueViolation: %v", err)
+		equals(t, "Username", violation.Constraint)
+		ok(t, store.Insert("d", &Account{TenantID: "three", Email: "x@example.com"}))
+
+		// a record can keep its own values
+		ok(t, store.Update("a", &Account{TenantID: "one", Email: "tim@example.com", Username: &name}))
+		ok(t, store.Upsert("a", &Account{TenantID: "one", Email: "tim@example.com"}))
+
+		_, isViolation = store.Update("c", &Account{TenantID: "one", Email: "tim@example.com"}).(*bolthold.ErrUniqueViolation)
+		assert(t, isViolation, "Updating to a duplicate didn't return an ErrUniqueViolation")
+		_, isViolation = store.Upsert("e", &Account{TenantID: "two", Email: "tim@example.com"}).(*bolthold.ErrUniqueViolation)
+		assert(t, isViolation, "Upserting a duplicate didn't return an ErrUniqueViolation")
+
+		_, isViolation = store.UpdateMatching(&Account{}, bolthold.Where("TenantID").Eq("one"),
+			func(record interface{}) error {
+				record.(*Account).Email = "same@example.com"
+				return nil
+			}).(*bolthold.ErrUniqueViolation)
+		assert(t, isViolation, "Updating several records to the same value didn't return an ErrUniqueViolation")
+
+		// once the conflicting record is gone the value can be used again
+		ok(t, store.Delete("a", &Account{}))
+		ok(t, store.Update("c", &Account{TenantID: "one", Email: "tim@example.com"}))
+	})
+}
+
+func TestDeferredUniqueChecks(t *testing.T) {
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		alice, bob := "alice", "bob"
+		ok(t, store.Insert("a", &Account{Email: "alice@example.com", Username: &alice}))
+		ok(t, store.Insert("b", &Account{Email: "bob@example.com", Username: &bob}))
+
+		swap := func(txn *bolthold.Txn) *bolthold.Txn {
+			return txn.
+				Update("a", &Account{Email: "bob@example.com", Username: &bob}).
+				Update("b", &Account{Email: "alice@example.com", Username: &alice})
+		}
+
+		_, isViolation := swap(store.Txn()).Commit().(*bolthold.ErrUniqueViolation)
+		assert(t, isViolation, "Swapping usernames without deferring didn't return an ErrUniqueViolation")
+
+		ok(t, swap(store.Txn().DeferUniqueChecks()).Commit())
+
+		var a, b Account
+		ok(t, store.Get("a", &a))
+		ok(t, store.Get("b", &b))
+		equals(t, bob, *a.Username)
+		equals(t, alice, *b.Username)
+
+		// a violation that's still there at the end fails the transaction
+		err := store.Txn().DeferUniqueChecks().
+			Update("a", &Account{Email: "alice@example.com", Username: &alice}).
+			Commit()
+		_, isViolation = err.(*bolthold.ErrUniqueViolation)
+		assert(t, isViolation, "A deferred violation didn't return an ErrUniqueViolation: %v", err)
+		ok(t, store.Get("a", &a))
+		equals(t, bob, *a.Username)
+
+		ok(t, store.WithTx(true, func(tx *bolthold.Tx) error {
+			tx.DeferUniqueChecks()
+			err := tx.Update("a", &Account{Email: "alice@example.com", Username: &alice})
+			if err != nil {
+				return err
+			}
+			return tx.Update("b", &Account{Email: "bob@example.com", Username: &bob})
+		}))
+		ok(t, store.Get("a", &a))
+		equals(t, alice, *a.Username)
+
+		// later transactions check as they write again
+		_, isViolation = store.Update("b", &Account{Email: "alice@example.com", Username: &alice}).(*bolthold.ErrUniqueViolation)
+		assert(t, isViolation, "Unique checks were still deferred after the transaction")
+	})
+}
@@ -0,0 +1,210 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package bolthold
+
+import (
+	"bytes"
+	"sort"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// layoutSubsystem is the metadata bucket recording the layout each type's records and indexes were written with, so
+// that stores written by older versions of bolthold, or with different options, can be detected and upgraded
+const layoutSubsystem = "layout"
+
+const layoutSortableKeys = 1 << 0
+
+// UpgradeProgress reports the progress of upgrading a type
+type UpgradeProgress struct {
+	Type string
+	// Step is "shard" while records are moved into their shard buckets, and "index" while indexes are rebuilt
+	Step string
+	// Done is the number of records handled so far, out of Total
+	Done  int
+	Total int
+}
+
+// Upgrade brings the records and indexes of a type written by an older version of bolthold, or with different
+// options, up to date with the store's current layout:
+//
+//   - records of a type that implements Sharded, but was first written without shards, are moved into shard buckets
+//   - indexes are rebuilt if they were written before SortableIndexKeys was changed, or before the layout was
+//     recorded at all
+//   - indexes added to the type after its records were written, such as a new boltholdIndex or boltholdExpire tag,
+//     are built
+//
+// Types that are already up to date are left alone, so Upgrade can be called every time the store is opened, see
+// Options.UpgradeTypes.  The first upgrade of a type rebuilds all of its indexes, as its layout hasn't been recorded
+// yet.  progress is optional
+func (s *Store) Upgrade(exampleType interface{}, progress func(UpgradeProgress)) error {
+	storer := s.newStorer(exampleType)
+
+	report := func(step string, done, total int) {
+		if progress != nil {
+			progress(UpgradeProgress{Type: storer.Type(), Step: step, Done: done, Total: total})
+		}
+	}
+
+	var rebuild []string
+	total := 0
+	err := s.updateTx(func(tx *bolt.Tx) error {
+		records := getRecordBucket(tx, storer)
+		if records == nil {
+			// no records, nothing to upgrade
+			return nil
+		}
+		total = records.Count()
+
+		err := s.shardRecords(records, exampleType, report)
+		if err != nil {
+			return err
+		}
+
+		rebuild = s.staleIndexes(tx, storer)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(rebuild) > 0 {
+		err = s.ReIndexOnline(exampleType, &ReIndexOptions{
+			Indexes: rebuild,
+			Progress: func(indexed int) {
+				report("index", indexed, total)
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return s.updateTx(func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte(storer.Type())) == nil {
+			return nil
+		}
+		return s.writeLayout(tx, storer)
+	})
+}
+
+// shardRecords moves the records of a sharded type that are stored directly in the type's bucket into shard buckets
+func (s *Store) shardRecords(records *recordBucket, exampleType interface{}, report func(string, int, int)) error {
+	sharded, ok := newElemType(exampleType).(Sharded)
+	if !ok || sharded.Shards() <= 1 || records.shards[0] != records.parent {
+		return nil
+	}
+
+	parent := records.parent
+
+	var keys [][]byte
+	err := parent.ForEach(func(k, v []byte) error {
+		if v != nil {
+			keys = append(keys, append([]byte(nil), k...))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < sharded.Shards(); i++ {
+		_, err = parent.CreateBucket(shardBucketName(i))
+		if err != nil {
+			return err
+		}
+	}
+
+	shards := newRecordBucket(parent)
+
+	for i := range keys {
+		key := keys[i]
+		// the value is copied, as it may point into a page which is freed when the record is deleted
+		value := append([]byte(nil), parent.Get(key)...)
+
+		err = parent.Delete(key)
+		if err != nil {
+			return err
+		}
+
+		s.writes.record(false, key, value)
+		err = shards.Put(key, value)
+		if err != nil {
+			return err
+		}
+
+		if (i+1)%defaultReIndexBatchSize == 0 || i == len(keys)-1 {
+			report("shard", i+1, len(keys))
+		}
+	}
+
+	return nil
+}
+
+// staleIndexes returns the names of the storer's indexes which need to be rebuilt to match the store's layout
+func (s *Store) staleIndexes(tx *bolt.Tx, storer Storer) []string {
+	dropped := metaBucket(tx, droppedIndexSubsystem)
+
+	var current []byte
+	if layout := metaBucket(tx, layoutSubsystem); layout != nil {
+		current = layout.Get([]byte(storer.Type()))
+	}
+
+	built := make(map[string]bool)
+	rebuildAll := len(current) == 0 || current[0] != s.layoutFlags()
+	if !rebuildAll {
+		for _, name := range bytes.Split(current[1:], []byte{0}) {
+			built[string(name)] = true
+		}
+	}
+
+	var stale []string
+	for _, name := range storerIndexNames(storer) {
+		if !built[name] && !isDropped(dropped, storer.Type(), name) {
+			stale = append(stale, name)
+		}
+	}
+	return stale
+}
+
+// storerIndexNames returns the sorted names of all of the storer's indexes
+func storerIndexNames(storer Storer) []string {
+	var names []string
+	for name := range storer.Indexes() {
+		names = append(names, name)
+	}
+	for name := range storer.SliceIndexes() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// layoutFlags returns the options which change how the store writes indexes
+func (s *Store) layoutFlags() byte {
+	var flags byte
+	if s.sortableKeys {
+		flags |= layoutSortableKeys
+	}
+	return flags
+}
+
+// writeLayout records that the storer's type and its indexes have been written with the store's current layout.
+// The layout is stored as the layout flags followed by the names of the indexes, separated by zero bytes
+func (s *Store) writeLayout(source BucketSource, storer Storer) error {
+	b, err := createMetaBucket(source, layoutSubsystem)
+	if err != nil {
+		return err
+	}
+
+	layout := []byte{s.layoutFlags()}
+	for i, name := range storerIndexNames(storer) {
+		if i > 0 {
+			layout = append(layout, 0)
+		}
+		layout = append(layout, name...)
+	}
+	return b.Put([]byte(storer.Type()), layout)
+}
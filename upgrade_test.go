@@ -0,0 +1,102 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package bolthold_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/timshannon/bolthold"
+	bolt "go.etcd.io/bbolt"
+)
+
+type Gauge struct {
+	ID    int
+	Value int `boltholdIndex:"Value"`
+}
+
+func TestUpgradeSortableIndexKeys(t *testing.T) {
+	filename := tempfile()
+	defer os.Remove(filename)
+
+	store, err := bolthold.Open(filename, 0666, nil)
+	ok(t, err)
+	for i := -50; i < 50; i++ {
+		ok(t, store.Insert(i, &Gauge{ID: i, Value: i * 10}))
+	}
+	ok(t, store.Close())
+
+	var progress []bolthold.UpgradeProgress
+	store, err = bolthold.Open(filename, 0666, &bolthold.Options{
+		SortableIndexKeys: true,
+		UpgradeTypes:      []interface{}{&Gauge{}},
+		UpgradeProgress: func(p bolthold.UpgradeProgress) {
+			progress = append(progress, p)
+		},
+	})
+	ok(t, err)
+
+	equals(t, 1, len(progress))
+	equals(t, bolthold.UpgradeProgress{Type: "Gauge", Step: "index", Done: 100, Total: 100}, progress[0])
+
+	var result []Gauge
+	ok(t, store.Find(&result, bolthold.Where("Value").Ge(-20).And("Value").Lt(20).Index("Value")))
+	equals(t, 4, len(result))
+	ok(t, store.Close())
+
+	// already up to date, nothing is rebuilt
+	progress = nil
+	store, err = bolthold.Open(filename, 0666, &bolthold.Options{
+		SortableIndexKeys: true,
+		UpgradeTypes:      []interface{}{&Gauge{}},
+		UpgradeProgress: func(p bolthold.UpgradeProgress) {
+			progress = append(progress, p)
+		},
+	})
+	ok(t, err)
+	defer store.Close()
+	equals(t, 0, len(progress))
+}
+
+func TestUpgradeShards(t *testing.T) {
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		// records written before the type was sharded are stored directly in the type's bucket
+		ok(t, store.Bolt().Update(func(tx *bolt.Tx) error {
+			b, err := tx.CreateBucket([]byte("Reading"))
+			ok(t, err)
+			for i := uint64(0); i < 20; i++ {
+				key, err := bolthold.DefaultEncode(i)
+				ok(t, err)
+				value, err := bolthold.DefaultEncode(&Reading{Sensor: "legacy", Value: int(i)})
+				ok(t, err)
+				ok(t, b.Put(key, value))
+			}
+			return nil
+		}))
+
+		var steps []string
+		ok(t, store.Upgrade(&Reading{}, func(p bolthold.UpgradeProgress) {
+			steps = append(steps, p.Step)
+		}))
+		equals(t, []string{"shard", "index"}, steps)
+
+		ok(t, store.Bolt().View(func(tx *bolt.Tx) error {
+			b := tx.Bucket([]byte("Reading"))
+			assert(t, b.Bucket([]byte("_shard:0")) != nil, "Shards weren't created")
+			return b.ForEach(func(k, v []byte) error {
+				assert(t, v == nil, "Record was left in the type's bucket")
+				return nil
+			})
+		}))
+
+		var result []Reading
+		ok(t, store.Find(&result, bolthold.Where("Sensor").Eq("legacy").Index("Sensor")))
+		equals(t, 20, len(result))
+
+		var reading Reading
+		ok(t, store.Get(uint64(7), &reading))
+		equals(t, 7, reading.Value)
+	})
+}
@@ -0,0 +1,85 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package bolthold
+
+import (
+	"errors"
+	"reflect"
+)
+
+// BoltholdVersionTag is the struct tag used for optimistic concurrency.  It must be on an integer field, which
+// bolthold sets to 1 when the record is inserted, and increments every time the record is written.  Update and
+// Upsert fail with ErrConflict if the record being written doesn't have the same version as the stored record, so
+// a writer can't overwrite changes made since it read the record
+//
+//	Version uint64 `boltholdVersion:""`
+const BoltholdVersionTag = "boltholdVersion"
+
+// ErrConflict is the error returned when a record with a boltholdVersion field is written with a different version
+// than the stored record, because the record was changed after it was read
+var ErrConflict = errors.New("This record has been changed since it was read")
+
+// versioner is implemented by storers of types with a boltholdVersion field
+type versioner interface {
+	versionField() string
+}
+
+// versionField returns the name of the field with the boltholdVersion tag
+func (t *anonStorer) versionField() string {
+	return t.version
+}
+
+func hasVersion(storer Storer) bool {
+	v, ok := storer.(versioner)
+	return ok && v.versionField() != ""
+}
+
+// recordVersion returns the value of the record's boltholdVersion field, or 0 if it doesn't have one
+func recordVersion(storer Storer, value interface{}) uint64 {
+	if !hasVersion(storer) || value == nil {
+		return 0
+	}
+
+	field := reflect.ValueOf(findIndexValue(storer.(versioner).versionField(), value, BoltholdVersionTag))
+	switch field.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return uint64(field.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return field.Uint()
+	}
+	return 0
+}
+
+// checkVersion returns ErrConflict if the record being written has a different version than the stored record
+func checkVersion(storer Storer, existing, data interface{}) error {
+	if hasVersion(storer) && recordVersion(storer, existing) != recordVersion(storer, data) {
+		return ErrConflict
+	}
+	return nil
+}
+
+// nextVersion returns the record to write with its version set to one more than the stored version.  If the
+// record is a pointer the version is set in place, so the caller has the version it needs for its next write
+func nextVersion(storer Storer, value interface{}, stored uint64) interface{} {
+	if !hasVersion(storer) {
+		return value
+	}
+
+	if v := reflect.ValueOf(value); v.Kind() == reflect.Ptr && v.IsNil() {
+		return value
+	}
+
+	record, result := settableRecord(value)
+
+	field := record.FieldByName(storer.(versioner).versionField())
+	switch field.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		field.SetInt(int64(stored + 1))
+	default:
+		field.SetUint(stored + 1)
+	}
+
+	return result
+}
@@ -0,0 +1,65 @@
+// Copyright 2016 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package bolthold_test
+
+import (
+	"testing"
+
+	"github.com/timshannon/bolthold"
+)
+
+type Profile struct {
+	Name    string `boltholdIndex:"Name"`
+	Bio     string
+	Version uint64 `boltholdVersion:""`
+}
+
+func TestVersionConflict(t *testing.T) {
+	testWrap(t, func(store *bolthold.Store, t *testing.T) {
+		profile := Profile{Name: "tim"}
+		ok(t, store.Insert("tim", &profile))
+		equals(t, uint64(1), profile.Version)
+
+		var first, second Profile
+		ok(t, store.Get("tim", &first))
+		ok(t, store.Get("tim", &second))
+
+		first.Bio = "first"
+		ok(t, store.Update("tim", &first))
+		equals(t, uint64(2), first.Version)
+
+		second.Bio = "second"
+		equals(t, bolthold.ErrConflict, store.Update("tim", &second))
+		equals(t, bolthold.ErrConflict, store.Upsert("tim", second))
+
+		var stored Profile
+		ok(t, store.Get("tim", &stored))
+		equals(t, "first", stored.Bio)
+		equals(t, uint64(2), stored.Version)
+
+		// passed by value the stored version still increments
+		stored.Bio = "by value"
+		ok(t, store.Upsert("tim", stored))
+		ok(t, store.Get("tim", &stored))
+		equals(t, uint64(3), stored.Version)
+
+		ok(t, store.UpdateMatching(&Profile{}, bolthold.Where("Name").Eq("tim").Index("Name"),
+			func(record interface{}) error {
+				record.(*Profile).Bio = "matched"
+				return nil
+			}))
+		ok(t, store.Get("tim", &stored))
+		equals(t, uint64(4), stored.Version)
+		equals(t, "matched", stored.Bio)
+
+		ok(t, store.UpdateFields("tim", &Profile{}, map[string]interface{}{"Bio": "field"}))
+		ok(t, store.Get("tim", &stored))
+		equals(t, uint64(5), stored.Version)
+
+		ok(t, store.Upsert("new", &Profile{Name: "new", Version: 10}))
+		ok(t, store.Get("new", &stored))
+		equals(t, uint64(1), stored.Version)
+	})
+}